@@ -0,0 +1,77 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-logr/logr"
+
+	"go.opentelemetry.io/auto/pkg/doctor"
+	"go.opentelemetry.io/auto/pkg/log"
+	"go.opentelemetry.io/auto/pkg/process"
+)
+
+// doctorCommand checks whether the host is ready to run the agent, and
+// whether the configured targets are reachable. It returns 1 if any check
+// failed.
+func doctorCommand(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s doctor\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	log.Logger = logr.Discard()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// without any target configured, only the host is checked
+	var targets []*process.TargetArgs
+	if (cfg != nil && len(cfg.Targets) > 0) || process.TargetEnvSet() {
+		targets, err = parseTargets(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	failed := false
+	for _, r := range doctor.Run(targets) {
+		line := fmt.Sprintf("[%s] %s", r.Status, r.Check)
+		if r.Detail != "" {
+			line += ": " + r.Detail
+		}
+		fmt.Println(line)
+		if r.Hint != "" {
+			fmt.Printf("       hint: %s\n", r.Hint)
+		}
+
+		failed = failed || r.Status == doctor.Fail
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
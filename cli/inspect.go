@@ -0,0 +1,125 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/go-logr/logr"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors"
+	"go.opentelemetry.io/auto/pkg/log"
+)
+
+// inspectCommand reports what the agent would instrument in a Go executable,
+// without running or attaching to it. It returns the exit code of the agent.
+func inspectCommand(args []string) int {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "print the report as JSON")
+	verbose := fs.Bool("v", false, "print the logs of the analysis")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s inspect [-json] [-v] <binary>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if !*verbose {
+		log.Logger = logr.Discard()
+	}
+
+	// the selection of instrumentors may come from the configuration file
+	if _, err := loadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	manager, err := instrumentors.NewManager(nil, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	report, err := manager.Inspect(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to inspect %s: %s\n", fs.Arg(0), err)
+		return 1
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(report)
+	} else {
+		err = printInspectReport(os.Stdout, report)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
+
+func printInspectReport(out io.Writer, report *instrumentors.InspectReport) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(w, "Binary:\t%s\n", report.Path)
+	fmt.Fprintf(w, "Go version:\t%s\n", report.GoVersion)
+
+	fmt.Fprintf(w, "\nModules (%d):\n", len(report.Modules))
+	modules := make([]string, 0, len(report.Modules))
+	for m := range report.Modules {
+		modules = append(modules, m)
+	}
+	sort.Strings(modules)
+	for _, m := range modules {
+		fmt.Fprintf(w, "  %s\t%s\n", m, report.Modules[m])
+	}
+
+	fmt.Fprintf(w, "\nInstrumentors:\n")
+	for _, ir := range report.Instrumentors {
+		status := "inactive"
+		if ir.Active {
+			status = "active"
+		}
+		fmt.Fprintf(w, "  %s\t%s\n", ir.Name, status)
+
+		for _, fr := range ir.Functions {
+			if fr.Found {
+				fmt.Fprintf(w, "    %s\toffset 0x%x, %d return(s)\n", fr.Name, fr.Offset, fr.Returns)
+			} else {
+				fmt.Fprintf(w, "    %s\tnot found\n", fr.Name)
+			}
+		}
+
+		for _, mo := range ir.MissingOffsets {
+			fmt.Fprintf(w, "    missing offset\t%s.%s for version %q\n", mo.Struct, mo.Field, mo.Version)
+		}
+	}
+
+	return w.Flush()
+}
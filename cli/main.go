@@ -15,7 +15,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"go.opentelemetry.io/auto/pkg/admin"
+	"go.opentelemetry.io/auto/pkg/config"
 	"go.opentelemetry.io/auto/pkg/errors"
 	"go.opentelemetry.io/auto/pkg/instrumentors"
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"
@@ -25,6 +28,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -36,17 +40,38 @@ func main() {
 		os.Exit(1)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "inspect":
+			os.Exit(inspectCommand(os.Args[2:]))
+		case "doctor":
+			os.Exit(doctorCommand(os.Args[2:]))
+		case "replay":
+			os.Exit(replayCommand(os.Args[2:]))
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q, available commands are: inspect, doctor, replay\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
 	log.Logger.V(0).Info("starting Go OpenTelemetry Agent ...")
-	// examine target -
-	target := process.ParseTargetArgs()
-	if err = target.Validate(); err != nil {
+	// load configuration file, environment variables override its settings
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Logger.Error(err, "unable to load configuration file")
+		return
+	}
+
+	// examine targets -
+	targets, err := parseTargets(cfg)
+	if err != nil {
 		log.Logger.Error(err, "invalid target args")
 		return
 	}
 
 	// Define singleton for event properties
 	// parse queue deplay duration
-	delayDurationRaw, exists := os.LookupEnv("QUEUE_DELAY_DURATION")
+	delayDurationRaw, exists := os.LookupEnv(config.QueueDelayEnvVar)
 	if !exists {
 		delayDurationRaw = "5s"
 	}
@@ -57,7 +82,7 @@ func main() {
 	}
 
 	// parse queue max size
-	maxSizeRaw, exists := os.LookupEnv("QUEUE_MAX_SIZE")
+	maxSizeRaw, exists := os.LookupEnv(config.QueueMaxSizeEnvVar)
 	if !exists {
 		maxSizeRaw = "0"
 	}
@@ -67,55 +92,218 @@ func main() {
 		return
 	}
 
-	// init priority queue
-	utils.Initialize(delayDuration, uint64(maxSize))
-	utils.EventProrityQueueSingleton.Run()
-
-	processAnalyzer := process.NewAnalyzer()
-	otelController, err := opentelemetry.NewController()
+	// parse the deadline of the export of the pending spans on shutdown
+	shutdownTimeoutRaw, exists := os.LookupEnv(config.ShutdownTimeoutEnvVar)
+	if !exists {
+		shutdownTimeoutRaw = "10s"
+	}
+	shutdownTimeout, err := time.ParseDuration(shutdownTimeoutRaw)
 	if err != nil {
-		log.Logger.Error(err, "unable to create OpenTelemetry controller")
+		log.Logger.Error(err, "error while parse shutdown timeout")
 		return
 	}
 
-	instManager, err := instrumentors.NewManager(otelController)
-	if err != nil {
-		log.Logger.Error(err, "error creating instrumetors manager")
-		return
+	runners := make([]*targetRunner, 0, len(targets))
+	for _, target := range targets {
+		runner, err := newTargetRunner(target, delayDuration, uint64(maxSize))
+		if err != nil {
+			log.Logger.Error(err, "unable to set up target", "target", target.String())
+			for _, r := range runners {
+				r.close()
+			}
+			return
+		}
+		runners = append(runners, runner)
 	}
 
+	if addr, exists := os.LookupEnv(admin.AddrEnvVar); exists {
+		adminTargets := make([]admin.Target, 0, len(runners))
+		for _, r := range runners {
+			adminTargets = append(adminTargets, admin.Target{Name: r.target.String(), Status: r.manager.Status})
+		}
+
+		adminServer := admin.NewServer(addr, adminTargets)
+		if err := adminServer.Start(); err != nil {
+			log.Logger.Error(err, "unable to start admin server")
+			for _, r := range runners {
+				r.close()
+			}
+			return
+		}
+		defer adminServer.Shutdown(context.Background())
+	}
+
+	// the deadline starts when the agent is stopped, the pending events are
+	// exported until then
+	shutdownCtx := make(chan context.Context, 1)
 	stopper := make(chan os.Signal, 1)
 	signal.Notify(stopper, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-stopper
 		log.Logger.V(0).Info("Got SIGTERM, cleaning up..")
-		processAnalyzer.Close()
-		instManager.Close()
-		utils.EventProrityQueueSingleton.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		shutdownCtx <- ctx
+		for _, r := range runners {
+			r.shutdown(ctx)
+		}
+
+		// a second signal skips the export of the pending events
+		<-stopper
+		cancel()
 	}()
 
-	pid, err := processAnalyzer.DiscoverProcessID(target)
+	wg := sync.WaitGroup{}
+	for _, r := range runners {
+		wg.Add(1)
+		go func(r *targetRunner) {
+			defer wg.Done()
+			r.run()
+		}(r)
+	}
+	wg.Wait()
+
+	var ctx context.Context
+	select {
+	case ctx = <-shutdownCtx:
+	default:
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+	}
+	for _, r := range runners {
+		if err := r.otelController.Shutdown(ctx); err != nil {
+			log.Logger.Error(err, "unable to export pending spans", "target", r.target.String())
+		}
+	}
+}
+
+// loadConfig loads the configuration file pointed to by OTEL_GO_AUTO_CONFIG,
+// if any, and sets the environment variables matching its settings.
+func loadConfig() (*config.Config, error) {
+	path, exists := os.LookupEnv(config.FileEnvVar)
+	if !exists {
+		return nil, nil
+	}
+
+	cfg, err := config.Load(path)
 	if err != nil {
-		if err != errors.ErrInterrupted {
-			log.Logger.Error(err, "error while discovering process id")
+		return nil, err
+	}
+	if err = cfg.Apply(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// parseTargets returns the targets selected by environment variables or, if
+// none is, by cfg.
+func parseTargets(cfg *config.Config) ([]*process.TargetArgs, error) {
+	var targets []*process.TargetArgs
+	if cfg != nil && len(cfg.Targets) > 0 && !process.TargetEnvSet() {
+		targets = cfg.TargetArgs()
+	} else {
+		var err error
+		targets, err = process.ParseTargetsArgs()
+		if err != nil {
+			return nil, err
 		}
-		return
 	}
 
-	targetDetails, err := processAnalyzer.Analyze(pid, instManager.GetRelevantFuncs())
+	if err := process.ValidateTargets(targets); err != nil {
+		return nil, err
+	}
+
+	return targets, nil
+}
+
+// targetRunner instruments a single target process. Every target gets its own
+// analyzer, event queue, OpenTelemetry controller and instrumentors manager,
+// so targets never share goroutine ids, bpffs pins or service.name.
+type targetRunner struct {
+	target         *process.TargetArgs
+	analyzer       *process.Analyzer
+	eventQueue     *utils.EventPriorityQueue
+	manager        *instrumentors.Manager
+	otelController *opentelemetry.Controller
+}
+
+func newTargetRunner(target *process.TargetArgs, delayDuration time.Duration, maxSize uint64) (*targetRunner, error) {
+	otelController, err := opentelemetry.NewController(target.ServiceName)
 	if err != nil {
-		log.Logger.Error(err, "error while analyzing target process")
-		return
+		return nil, fmt.Errorf("unable to create OpenTelemetry controller: %w", err)
 	}
-	log.Logger.V(0).Info("target process analysis completed", "pid", targetDetails.PID,
-		"go_version", targetDetails.GoVersion, "dependencies", targetDetails.Libraries,
-		"total_functions_found", len(targetDetails.Functions))
 
-	instManager.FilterUnusedInstrumentors(targetDetails)
+	// init priority queue
+	eventQueue := utils.NewEventPriorityQueue(delayDuration, maxSize)
 
-	log.Logger.V(0).Info("invoking instrumentors")
-	err = instManager.Run(targetDetails)
-	if err != nil && err != errors.ErrInterrupted {
-		log.Logger.Error(err, "error while running instrumentors")
+	instManager, err := instrumentors.NewManager(otelController, eventQueue)
+	if err != nil {
+		return nil, fmt.Errorf("error creating instrumetors manager: %w", err)
 	}
+
+	analyzer := process.NewAnalyzer()
+	analyzer.ObserveOnly(instManager.ObserveOnly())
+
+	return &targetRunner{
+		target:         target,
+		analyzer:       analyzer,
+		eventQueue:     eventQueue,
+		manager:        instManager,
+		otelController: otelController,
+	}, nil
+}
+
+// run instruments the target until the agent is stopped. Whenever the target
+// process exits, run waits for it to start again and instruments the new
+// process from scratch.
+func (r *targetRunner) run() {
+	logger := log.Logger.WithValues("target", r.target.String())
+	r.eventQueue.Run()
+	defer r.eventQueue.Close()
+
+	for {
+		pid, err := r.analyzer.DiscoverProcessID(r.target)
+		if err != nil {
+			if err != errors.ErrInterrupted {
+				logger.Error(err, "error while discovering process id")
+			}
+			return
+		}
+
+		targetDetails, err := r.analyzer.Analyze(pid, r.manager.GetRelevantFuncs())
+		if err != nil {
+			logger.Error(err, "error while analyzing target process")
+			return
+		}
+		logger.V(0).Info("target process analysis completed", "pid", targetDetails.PID,
+			"go_version", targetDetails.GoVersion, "dependencies", targetDetails.Libraries,
+			"total_functions_found", len(targetDetails.Functions))
+
+		r.manager.FilterUnusedInstrumentors(targetDetails)
+
+		logger.V(0).Info("invoking instrumentors")
+		err = r.manager.Run(targetDetails)
+		if err == errors.ErrProcessExited {
+			logger.V(0).Info("target process exited, waiting for it to restart", "pid", targetDetails.PID)
+			continue
+		}
+		if err != nil && err != errors.ErrInterrupted {
+			logger.Error(err, "error while running instrumentors")
+		}
+		return
+	}
+}
+
+// shutdown stops r, whose pending events are exported until ctx is done.
+// run returns once they are.
+func (r *targetRunner) shutdown(ctx context.Context) {
+	r.analyzer.Close()
+	r.manager.Shutdown(ctx)
+}
+
+func (r *targetRunner) close() {
+	r.analyzer.Close()
+	r.manager.Close()
+	r.eventQueue.Close()
 }
@@ -80,6 +80,20 @@ static __always_inline void append_item_to_slice(struct go_slice *slice, void *n
         // Room available on current array
         bpf_probe_write_user(slice->array + (item_size * slice->len), new_item, item_size);
     }
+    else if (slice->len == 0)
+    {
+        // Empty slice - the new array holds the new item only
+        void *new_array = write_target_data(new_item, item_size);
+        if (new_array == NULL)
+        {
+            return;
+        }
+
+        slice->array = new_array;
+        bpf_probe_write_user(slice_user_ptr->array, &slice->array, sizeof(slice->array));
+        slice->cap = 1;
+        bpf_probe_write_user(slice_user_ptr->cap, &slice->cap, sizeof(slice->cap));
+    }
     else
     {
         // No room on current array - copy to new one of size item_size * (len + 1)
@@ -0,0 +1,225 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#ifndef _INJECTION_POLICY_H_
+#define _INJECTION_POLICY_H_
+
+#include "bpf_helpers.h"
+
+#define MAX_DESTINATION_SIZE 64
+#define MAX_INJECTION_POLICIES 256
+
+#define DESTINATION_HOST 0
+#define DESTINATION_GRPC_TARGET 1
+
+#define INJECTION_ALLOW 1
+#define INJECTION_DENY 2
+
+// A destination of the injection policy: a host and port, a host on any
+// port (port 0), any host on a port (empty destination) or a gRPC target.
+// The key with an empty destination and port 0 holds the default action.
+struct injection_policy_key
+{
+    char destination[MAX_DESTINATION_SIZE];
+    u16 port;
+    u8 kind;
+    u8 padding;
+};
+
+// The actions of the injection policy by destination, written by the agent
+// before the probes are attached.
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, struct injection_policy_key);
+    __type(value, u8);
+    __uint(max_entries, MAX_INJECTION_POLICIES);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} injection_policies SEC(".maps");
+
+// Injected in init. When set, the probes never write into the memory of the
+// target, and so never inject the trace context in outgoing requests.
+volatile const bool observe_only;
+
+static __always_inline u8 injection_policy_action(struct injection_policy_key *key)
+{
+    u8 *action = bpf_map_lookup_elem(&injection_policies, key);
+    if (action == NULL)
+    {
+        return 0;
+    }
+    return *action;
+}
+
+// Returns whether the policy allows injecting headers in the requests to the
+// host and port of key. The most specific rule applies: the one of the host
+// and port, then the one of the host, of the port, and the default one.
+static __always_inline bool destination_injection_allowed(struct injection_policy_key *key)
+{
+    u8 action = injection_policy_action(key);
+    u16 port = key->port;
+    if (action == 0 && port != 0)
+    {
+        key->port = 0;
+        action = injection_policy_action(key);
+        key->port = port;
+    }
+    if (action == 0)
+    {
+        __builtin_memset(key->destination, 0, sizeof(key->destination));
+        action = injection_policy_action(key);
+    }
+    if (action == 0 && port != 0)
+    {
+        key->port = 0;
+        action = injection_policy_action(key);
+    }
+    return action != INJECTION_DENY;
+}
+
+// Splits the host[:port] read in key->destination, len bytes long, into its
+// lower-cased host and its port, default_port if it has none.
+static __always_inline void parse_host_port(struct injection_policy_key *key, u64 len, u16 default_port)
+{
+    s32 colon = -1;
+    for (s32 i = 0; i < MAX_DESTINATION_SIZE - 1; i++)
+    {
+        if (i >= len)
+        {
+            break;
+        }
+        char c = key->destination[i];
+        if (c == ':')
+        {
+            colon = i;
+        }
+        else if (c == ']')
+        {
+            // the colons of an IPv6 address are not followed by a port
+            colon = -1;
+        }
+        else if (c >= 'A' && c <= 'Z')
+        {
+            key->destination[i] = c - 'A' + 'a';
+        }
+    }
+
+    key->port = default_port;
+    if (colon < 0)
+    {
+        return;
+    }
+
+    u32 port = 0;
+    for (s32 i = 0; i < MAX_DESTINATION_SIZE - 1; i++)
+    {
+        if (i <= colon)
+        {
+            continue;
+        }
+        char c = key->destination[i];
+        key->destination[i] = 0;
+        if (c >= '0' && c <= '9')
+        {
+            port = port * 10 + (c - '0');
+        }
+    }
+    if (colon < MAX_DESTINATION_SIZE)
+    {
+        key->destination[colon] = 0;
+    }
+    if (port > 0 && port <= 0xffff)
+    {
+        key->port = port;
+    }
+}
+
+// Returns whether the trace context can be injected in the HTTP requests to
+// host, the host[:port] of their URL, for the scheme https if secure.
+static __always_inline bool http_injection_allowed(void *host_ptr, u64 host_len, bool secure)
+{
+    if (observe_only)
+    {
+        return false;
+    }
+
+    struct injection_policy_key key = {};
+    u64 size = host_len < MAX_DESTINATION_SIZE - 1 ? host_len : MAX_DESTINATION_SIZE - 1;
+    bpf_probe_read(key.destination, size, host_ptr);
+    parse_host_port(&key, size, secure ? 443 : 80);
+    return destination_injection_allowed(&key);
+}
+
+// Returns whether the trace context can be injected in the gRPC calls to
+// target. The rule of the target itself applies first, then those of the
+// host and port of its authority, its part after the last slash.
+static __always_inline bool grpc_injection_allowed(void *target_ptr, u64 target_len)
+{
+    if (observe_only)
+    {
+        return false;
+    }
+
+    struct injection_policy_key key = {};
+    u64 size = target_len < MAX_DESTINATION_SIZE - 1 ? target_len : MAX_DESTINATION_SIZE - 1;
+    bpf_probe_read(key.destination, size, target_ptr);
+    key.kind = DESTINATION_GRPC_TARGET;
+    u8 action = injection_policy_action(&key);
+    if (action != 0)
+    {
+        return action != INJECTION_DENY;
+    }
+
+    s32 slash = -1;
+    for (s32 i = 0; i < MAX_DESTINATION_SIZE - 1; i++)
+    {
+        if (i >= size)
+        {
+            break;
+        }
+        if (key.destination[i] == '/')
+        {
+            slash = i;
+        }
+    }
+
+    key.kind = DESTINATION_HOST;
+    if (slash >= 0)
+    {
+        u64 offset = slash + 1;
+        size = size > offset ? size - offset : 0;
+        __builtin_memset(key.destination, 0, sizeof(key.destination));
+        if (size > 0 && size < MAX_DESTINATION_SIZE)
+        {
+            bpf_probe_read(key.destination, size, target_ptr + offset);
+        }
+    }
+    parse_host_port(&key, size, 443);
+    return destination_injection_allowed(&key);
+}
+
+// Returns whether the trace context can be injected in the requests whose
+// destination is unknown.
+static __always_inline bool default_injection_allowed()
+{
+    if (observe_only)
+    {
+        return false;
+    }
+
+    struct injection_policy_key key = {};
+    return injection_policy_action(&key) != INJECTION_DENY;
+}
+
+#endif
@@ -0,0 +1,512 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#ifndef _PROPAGATION_H_
+#define _PROPAGATION_H_
+
+#include "bpf_helpers.h"
+#include "alloc.h"
+#include "go_types.h"
+#include "span_context.h"
+
+// The propagation formats selected by OTEL_PROPAGATORS. When a request
+// carries several of them, the first one in this order is extracted.
+#define PROPAGATOR_TRACECONTEXT 0x1
+#define PROPAGATOR_B3 0x2
+#define PROPAGATOR_B3_MULTI 0x4
+#define PROPAGATOR_JAEGER 0x8
+
+// Injected in init
+volatile const u32 propagators;
+
+// The headers of the propagation formats.
+#define HEADER_TRACEPARENT 0
+#define HEADER_TRACESTATE 1
+#define HEADER_B3 2
+#define HEADER_B3_TRACE_ID 3
+#define HEADER_B3_SPAN_ID 4
+#define HEADER_B3_SAMPLED 5
+#define HEADER_JAEGER 6
+#define PROPAGATION_HEADERS 7
+
+#define MAX_HEADER_NAME_LEN 16
+// b3: {trace id}-{span id}-{sampled}
+#define B3_STRING_SIZE 51
+// uber-trace-id: {trace id}:{span id}:{parent span id}:{flags}
+#define JAEGER_STRING_SIZE 53
+
+#define B3_MULTI_TRACE_ID 0x1
+#define B3_MULTI_SPAN_ID 0x2
+
+// The trace context extracted from the headers of a request.
+struct propagated_context
+{
+    // sc is the remote parent, and remote its trace flags and tracestate.
+    struct span_context sc;
+    struct remote_trace_t remote;
+    // found are the formats whose parent was extracted.
+    u32 found;
+    // the parent of the b3 multi-header format, read from several headers
+    struct span_context b3_multi_sc;
+    u16 b3_multi_flags;
+    u8 b3_multi_parts;
+    // value is the header value being parsed or injected, as large as the
+    // data written by write_target_data may be.
+    char value[MAX_BUFFER_SIZE];
+};
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __uint(key_size, sizeof(u32));
+    __uint(value_size, sizeof(struct propagated_context));
+    __uint(max_entries, 1);
+} propagated_context_storage_map SEC(".maps");
+
+// Copies the lower-case name of the header h to name, and returns its length.
+static __always_inline u32 propagation_header_name(u32 h, char *name)
+{
+    switch (h)
+    {
+    case HEADER_TRACEPARENT:
+        __builtin_memcpy(name, "traceparent", 11);
+        return 11;
+    case HEADER_TRACESTATE:
+        __builtin_memcpy(name, "tracestate", 10);
+        return 10;
+    case HEADER_B3:
+        __builtin_memcpy(name, "b3", 2);
+        return 2;
+    case HEADER_B3_TRACE_ID:
+        __builtin_memcpy(name, "x-b3-traceid", 12);
+        return 12;
+    case HEADER_B3_SPAN_ID:
+        __builtin_memcpy(name, "x-b3-spanid", 11);
+        return 11;
+    case HEADER_B3_SAMPLED:
+        __builtin_memcpy(name, "x-b3-sampled", 12);
+        return 12;
+    case HEADER_JAEGER:
+        __builtin_memcpy(name, "uber-trace-id", 13);
+        return 13;
+    }
+    return 0;
+}
+
+// Returns the format the header h belongs to.
+static __always_inline u32 propagation_header_format(u32 h)
+{
+    switch (h)
+    {
+    case HEADER_TRACEPARENT:
+    case HEADER_TRACESTATE:
+        return PROPAGATOR_TRACECONTEXT;
+    case HEADER_B3:
+        return PROPAGATOR_B3;
+    case HEADER_B3_TRACE_ID:
+    case HEADER_B3_SPAN_ID:
+    case HEADER_B3_SAMPLED:
+        return PROPAGATOR_B3_MULTI;
+    case HEADER_JAEGER:
+        return PROPAGATOR_JAEGER;
+    }
+    return 0;
+}
+
+// Returns the header of the selected formats named by the len chars at the
+// user address name_ptr, whatever their case, or -1.
+static __always_inline s32 propagation_header_of(void *name_ptr, s64 len)
+{
+    if (len < 2 || len >= MAX_HEADER_NAME_LEN)
+    {
+        return -1;
+    }
+    char name[MAX_HEADER_NAME_LEN] = {};
+    if (bpf_probe_read(name, len & (MAX_HEADER_NAME_LEN - 1), name_ptr) < 0)
+    {
+        return -1;
+    }
+
+    for (u32 h = 0; h < PROPAGATION_HEADERS; h++)
+    {
+        if (!(propagators & propagation_header_format(h)))
+        {
+            continue;
+        }
+        char want[MAX_HEADER_NAME_LEN] = {};
+        if (propagation_header_name(h, want) != len)
+        {
+            continue;
+        }
+        bool equal = true;
+        for (u32 i = 0; i < MAX_HEADER_NAME_LEN; i++)
+        {
+            // the names are made of letters, digits and dashes only
+            if (i < len && (name[i] | 0x20) != want[i])
+            {
+                equal = false;
+                break;
+            }
+        }
+        if (equal)
+        {
+            return h;
+        }
+    }
+    return -1;
+}
+
+static __always_inline u8 hex_value(char ch)
+{
+    if (ch >= '0' && ch <= '9')
+    {
+        return ch - '0';
+    }
+    if (ch >= 'a' && ch <= 'f')
+    {
+        return ch - 'a' + 10;
+    }
+    if (ch >= 'A' && ch <= 'F')
+    {
+        return ch - 'A' + 10;
+    }
+    return 0xff;
+}
+
+// Parses the len hex digits of str starting at start into the size bytes of
+// out, aligned to the right as the ids of b3 and jaeger may be shorter than
+// those of W3C. Returns false if they are not an id of at most size bytes.
+static __always_inline bool hex_id_to_bytes(char *str, u32 start, u32 len, unsigned char *out, u32 size)
+{
+    if (len == 0 || len > size * 2)
+    {
+        return false;
+    }
+    for (u32 i = 0; i < TRACE_ID_SIZE; i++)
+    {
+        if (i < size)
+        {
+            out[i] = 0;
+        }
+    }
+    bool zero = true;
+    for (u32 i = 0; i < TRACE_ID_STRING_SIZE; i++)
+    {
+        if (i >= len)
+        {
+            break;
+        }
+        u8 nib = hex_value(str[(start + len - 1 - i) & (MAX_TRACESTATE_LEN - 1)]);
+        if (nib == 0xff)
+        {
+            return false;
+        }
+        zero = zero && nib == 0;
+        u32 pos = (size - 1 - i / 2) & (TRACE_ID_SIZE - 1);
+        if (i % 2 == 0)
+        {
+            out[pos] = nib;
+        }
+        else
+        {
+            out[pos] |= nib << 4;
+        }
+    }
+    return !zero;
+}
+
+// Records sc and flags as the parent extracted for format, unless the parent
+// of a format coming first was extracted already.
+static __always_inline void set_propagated_parent(struct propagated_context *pc, u32 format, struct span_context *sc, u16 flags)
+{
+    if (pc->found & (format - 1))
+    {
+        return;
+    }
+    pc->sc = *sc;
+    pc->remote.flags = flags;
+    pc->found |= format;
+}
+
+// Parses the value of the header h of the request, len chars at the user
+// address value_ptr, into pc.
+static __always_inline void extract_propagation_header(struct propagated_context *pc, u32 h, void *value_ptr, s64 len)
+{
+    if (len < 1 || len >= MAX_TRACESTATE_LEN)
+    {
+        return;
+    }
+    char *value = pc->value;
+    if (h == HEADER_TRACESTATE)
+    {
+        value = pc->remote.tracestate;
+    }
+    if (bpf_probe_read(value, len & (MAX_TRACESTATE_LEN - 1), value_ptr) < 0)
+    {
+        return;
+    }
+
+    struct span_context sc = {};
+    switch (h)
+    {
+    case HEADER_TRACEPARENT:
+        if (len != SPAN_CONTEXT_STRING_SIZE || value[2] != '-' || value[35] != '-' || value[52] != '-')
+        {
+            return;
+        }
+        w3c_string_to_span_context(value, &sc);
+        set_propagated_parent(pc, PROPAGATOR_TRACECONTEXT, &sc, TRACE_FLAGS_PROPAGATED | w3c_string_trace_flags(value));
+        return;
+    case HEADER_TRACESTATE:
+        pc->remote.tracestate_len = len;
+        return;
+    case HEADER_B3:
+    {
+        // {trace id}-{span id}[-{sampled}[-{parent span id}]]
+        u32 trace_id_len = TRACE_ID_STRING_SIZE;
+        if (len < TRACE_ID_STRING_SIZE + 1 + SPAN_ID_STRING_SIZE || value[TRACE_ID_STRING_SIZE] != '-')
+        {
+            trace_id_len = TRACE_ID_STRING_SIZE / 2;
+            if (len < TRACE_ID_STRING_SIZE / 2 + 1 + SPAN_ID_STRING_SIZE || value[TRACE_ID_STRING_SIZE / 2] != '-')
+            {
+                return;
+            }
+        }
+        if (!hex_id_to_bytes(value, 0, trace_id_len, sc.TraceID, TRACE_ID_SIZE) ||
+            !hex_id_to_bytes(value, trace_id_len + 1, SPAN_ID_STRING_SIZE, sc.SpanID, SPAN_ID_SIZE))
+        {
+            return;
+        }
+        // the decision is deferred when the sampled part is missing
+        u16 flags = 0;
+        u32 sampled_pos = trace_id_len + 1 + SPAN_ID_STRING_SIZE + 1;
+        if (len > sampled_pos && value[sampled_pos - 1] == '-')
+        {
+            char sampled = value[sampled_pos & (MAX_TRACESTATE_LEN - 1)];
+            if (sampled == '1' || sampled == 'd')
+            {
+                flags = TRACE_FLAGS_PROPAGATED | TRACE_FLAGS_SAMPLED;
+            }
+            else if (sampled == '0')
+            {
+                flags = TRACE_FLAGS_PROPAGATED;
+            }
+        }
+        set_propagated_parent(pc, PROPAGATOR_B3, &sc, flags);
+        return;
+    }
+    case HEADER_B3_TRACE_ID:
+        if (hex_id_to_bytes(value, 0, len, pc->b3_multi_sc.TraceID, TRACE_ID_SIZE))
+        {
+            pc->b3_multi_parts |= B3_MULTI_TRACE_ID;
+        }
+        return;
+    case HEADER_B3_SPAN_ID:
+        if (hex_id_to_bytes(value, 0, len, pc->b3_multi_sc.SpanID, SPAN_ID_SIZE))
+        {
+            pc->b3_multi_parts |= B3_MULTI_SPAN_ID;
+        }
+        return;
+    case HEADER_B3_SAMPLED:
+        if (value[0] == '1' || value[0] == 't')
+        {
+            pc->b3_multi_flags = TRACE_FLAGS_PROPAGATED | TRACE_FLAGS_SAMPLED;
+        }
+        else if (value[0] == '0' || value[0] == 'f')
+        {
+            pc->b3_multi_flags = TRACE_FLAGS_PROPAGATED;
+        }
+        return;
+    case HEADER_JAEGER:
+    {
+        // {trace id}:{span id}:{parent span id}:{flags}
+        u32 colons[3] = {};
+        u32 n = 0;
+        for (u32 i = 0; i < JAEGER_STRING_SIZE + SPAN_ID_STRING_SIZE; i++)
+        {
+            if (i >= len)
+            {
+                break;
+            }
+            if (value[i] == ':' && n < 3)
+            {
+                colons[n++] = i;
+            }
+        }
+        if (n != 3 || colons[2] + 1 >= len)
+        {
+            return;
+        }
+        if (!hex_id_to_bytes(value, 0, colons[0], sc.TraceID, TRACE_ID_SIZE) ||
+            !hex_id_to_bytes(value, colons[0] + 1, colons[1] - colons[0] - 1, sc.SpanID, SPAN_ID_SIZE))
+        {
+            return;
+        }
+        u8 flags = hex_value(value[(len - 1) & (MAX_TRACESTATE_LEN - 1)]);
+        if (flags == 0xff)
+        {
+            return;
+        }
+        set_propagated_parent(pc, PROPAGATOR_JAEGER, &sc, TRACE_FLAGS_PROPAGATED | (flags & TRACE_FLAGS_SAMPLED));
+        return;
+    }
+    }
+}
+
+// Returns the storage of the context to extract from the headers of a
+// request, reset.
+static __always_inline struct propagated_context *new_propagated_context()
+{
+    u32 map_id = 0;
+    struct propagated_context *pc = bpf_map_lookup_elem(&propagated_context_storage_map, &map_id);
+    if (pc == NULL)
+    {
+        return NULL;
+    }
+    pc->found = 0;
+    pc->remote.flags = 0;
+    pc->remote.tracestate_len = 0;
+    pc->b3_multi_flags = 0;
+    pc->b3_multi_parts = 0;
+    return pc;
+}
+
+// Completes the extraction of pc once every header of the request was parsed,
+// recording the trace flags and tracestate of the trace of the parent in the
+// remote traces map. Returns false if no parent was extracted.
+static __always_inline bool finish_propagated_context(struct propagated_context *pc)
+{
+    if (pc->b3_multi_parts == (B3_MULTI_TRACE_ID | B3_MULTI_SPAN_ID))
+    {
+        set_propagated_parent(pc, PROPAGATOR_B3_MULTI, &pc->b3_multi_sc, pc->b3_multi_flags);
+    }
+    if (pc->found == 0)
+    {
+        return false;
+    }
+    if (!(pc->found & PROPAGATOR_TRACECONTEXT))
+    {
+        // the tracestate is only that of the W3C parent
+        pc->remote.tracestate_len = 0;
+    }
+    if (pc->remote.flags != 0 || pc->remote.tracestate_len != 0)
+    {
+        bpf_map_update_elem(&remote_traces, pc->sc.TraceID, &pc->remote, BPF_ANY);
+    }
+    return true;
+}
+
+static __always_inline void span_context_to_b3_string(struct span_context *ctx, char *buff)
+{
+    char *out = buff;
+    bytes_to_hex_string(ctx->TraceID, TRACE_ID_SIZE, out);
+    out += TRACE_ID_STRING_SIZE;
+    *out++ = '-';
+    bytes_to_hex_string(ctx->SpanID, SPAN_ID_SIZE, out);
+    out += SPAN_ID_STRING_SIZE;
+    *out++ = '-';
+    *out = trace_sampled(ctx) ? '1' : '0';
+}
+
+static __always_inline void span_context_to_jaeger_string(struct span_context *ctx, char *buff)
+{
+    char *out = buff;
+    bytes_to_hex_string(ctx->TraceID, TRACE_ID_SIZE, out);
+    out += TRACE_ID_STRING_SIZE;
+    *out++ = ':';
+    bytes_to_hex_string(ctx->SpanID, SPAN_ID_SIZE, out);
+    out += SPAN_ID_STRING_SIZE;
+    // the parent span id is deprecated
+    *out++ = ':';
+    *out++ = '0';
+    *out++ = ':';
+    *out = trace_sampled(ctx) ? '1' : '0';
+}
+
+// Writes to the user memory the value of the header h propagating sc, and
+// returns it, or a zero-length string if h is not to be injected.
+static __always_inline struct go_string propagation_header_value(u32 h, struct span_context *sc)
+{
+    struct go_string empty = {};
+    if (!(propagators & propagation_header_format(h)))
+    {
+        return empty;
+    }
+
+    switch (h)
+    {
+    case HEADER_TRACEPARENT:
+    {
+        char val[SPAN_CONTEXT_STRING_SIZE];
+        span_context_to_w3c_string(sc, val);
+        return write_user_go_string(val, sizeof(val));
+    }
+    case HEADER_TRACESTATE:
+    {
+        struct remote_trace_t *remote = bpf_map_lookup_elem(&remote_traces, sc->TraceID);
+        if (remote == NULL || remote->tracestate_len == 0 || remote->tracestate_len >= MAX_TRACESTATE_LEN)
+        {
+            return empty;
+        }
+        struct propagated_context *pc = new_propagated_context();
+        if (pc == NULL)
+        {
+            return empty;
+        }
+        u32 len = remote->tracestate_len;
+        bpf_probe_read(pc->value, sizeof(remote->tracestate), remote->tracestate);
+        return write_user_go_string(pc->value, len);
+    }
+    case HEADER_B3:
+    {
+        char val[B3_STRING_SIZE];
+        span_context_to_b3_string(sc, val);
+        return write_user_go_string(val, sizeof(val));
+    }
+    case HEADER_B3_TRACE_ID:
+    {
+        char val[TRACE_ID_STRING_SIZE];
+        bytes_to_hex_string(sc->TraceID, TRACE_ID_SIZE, val);
+        return write_user_go_string(val, sizeof(val));
+    }
+    case HEADER_B3_SPAN_ID:
+    {
+        char val[SPAN_ID_STRING_SIZE];
+        bytes_to_hex_string(sc->SpanID, SPAN_ID_SIZE, val);
+        return write_user_go_string(val, sizeof(val));
+    }
+    case HEADER_B3_SAMPLED:
+    {
+        char val[1] = {trace_sampled(sc) ? '1' : '0'};
+        return write_user_go_string(val, sizeof(val));
+    }
+    case HEADER_JAEGER:
+    {
+        char val[JAEGER_STRING_SIZE];
+        span_context_to_jaeger_string(sc, val);
+        return write_user_go_string(val, sizeof(val));
+    }
+    }
+    return empty;
+}
+
+// Writes to the user memory the name of the header h.
+static __always_inline struct go_string propagation_header_key(u32 h)
+{
+    char name[MAX_HEADER_NAME_LEN] = {};
+    u32 len = propagation_header_name(h, name);
+    return write_user_go_string(name, len);
+}
+
+#endif
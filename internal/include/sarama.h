@@ -0,0 +1,77 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#ifndef _SARAMA_H_
+#define _SARAMA_H_
+
+#include "bpf_helpers.h"
+#include "go_types.h"
+#include "propagation.h"
+
+// struct RecordHeader { Key, Value []byte }
+struct record_header
+{
+    struct go_slice key;
+    struct go_slice value;
+};
+
+struct headers_buff
+{
+    unsigned char buff[MAX_DATA_SIZE];
+};
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, s32);
+    __type(value, struct headers_buff);
+    __uint(max_entries, 1);
+} headers_buff_map SEC(".maps");
+
+// Appends the headers of the propagation formats selected, propagating sc, to
+// the record headers headers_ptr, the Headers of a ProducerMessage.
+static __always_inline void inject_headers(void *headers_ptr, struct span_context *sc)
+{
+    struct go_slice headers = {};
+    struct go_slice_user_ptr headers_user_ptr = {};
+    headers_user_ptr.array = headers_ptr;
+    headers_user_ptr.len = headers_ptr + 8;
+    headers_user_ptr.cap = headers_ptr + 16;
+    bpf_probe_read(&headers, sizeof(headers), headers_user_ptr.array);
+
+    for (u32 h = 0; h < PROPAGATION_HEADERS; h++)
+    {
+        struct go_string value = propagation_header_value(h, sc);
+        if (value.len == 0)
+        {
+            continue;
+        }
+        struct go_string key = propagation_header_key(h);
+        if (key.len == 0)
+        {
+            return;
+        }
+
+        struct record_header header = {};
+        header.key.array = key.str;
+        header.key.len = key.len;
+        header.key.cap = key.len;
+        header.value.array = value.str;
+        header.value.len = value.len;
+        header.value.cap = value.len;
+        append_item_to_slice(&headers, &header, sizeof(header), &headers_user_ptr, &headers_buff_map);
+    }
+}
+
+#endif
@@ -26,6 +26,107 @@ struct span_context
     unsigned char SpanID[SPAN_ID_SIZE];
 };
 
+#define TRACE_FLAGS_SAMPLED 0x1
+// Set with the trace flags received with a remote parent, in the lower byte,
+// unless its format left the sampling decision to the receiver.
+#define TRACE_FLAGS_PROPAGATED 0x100
+#define MAX_TRACESTATE_LEN 256
+#define MAX_REMOTE_TRACES 1000
+
+// The trace flags and tracestate received with the remote parent of a trace,
+// passed on to the calls made for the trace.
+struct remote_trace_t
+{
+    u16 flags;
+    u16 tracestate_len;
+    char tracestate[MAX_TRACESTATE_LEN];
+};
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __uint(key_size, TRACE_ID_SIZE);
+    __uint(value_size, sizeof(struct remote_trace_t));
+    __uint(max_entries, MAX_REMOTE_TRACES);
+    __uint(pinning, LIBBPF_PIN_BY_NAME);
+} remote_traces SEC(".maps");
+
+// Injected in init. The traces whose trace ID, read as by the traceidratio
+// sampler of the SDK, is below the threshold are sampled; 1 << 63 samples
+// every trace. It decides the sampled flag of the trace context injected.
+volatile const u64 sampling_threshold;
+// Injected in init. Set if the spans of the traces not sampled are dropped by
+// the probes instead of the agent.
+volatile const bool kernel_sampling;
+// Injected in init. Set if the sampled flag received with a remote parent
+// decides for its trace instead of the threshold.
+volatile const bool parent_based_sampling;
+
+// The sampling decision is a function of the trace ID alone, so that the
+// decision of the root span, stored with its span context in the span
+// context maps, is the one found by the probes of its children.
+static __always_inline bool trace_sampled(struct span_context *sc)
+{
+    if (parent_based_sampling)
+    {
+        struct remote_trace_t *remote = bpf_map_lookup_elem(&remote_traces, sc->TraceID);
+        if (remote != NULL && (remote->flags & TRACE_FLAGS_PROPAGATED))
+        {
+            return remote->flags & TRACE_FLAGS_SAMPLED;
+        }
+    }
+
+    u64 id = 0;
+    for (int i = TRACE_ID_SIZE / 2; i < TRACE_ID_SIZE; i++)
+    {
+        id = (id << 8) | sc->TraceID[i];
+    }
+    return (id >> 1) < sampling_threshold;
+}
+
+// Returns the trace flags the trace of sc was received with, 0 unless it was
+// received from a remote parent.
+static __always_inline u64 remote_trace_flags(struct span_context *sc)
+{
+    struct remote_trace_t *remote = bpf_map_lookup_elem(&remote_traces, sc->TraceID);
+    if (remote == NULL)
+    {
+        return 0;
+    }
+    return remote->flags;
+}
+
+static __always_inline bool span_context_is_valid(struct span_context *sc)
+{
+    for (int i = 0; i < TRACE_ID_SIZE; i++)
+    {
+        if (sc->TraceID[i] != 0)
+        {
+            return true;
+        }
+    }
+    return false;
+}
+
+// Returns whether the root span sc is to be emitted.
+static __always_inline bool root_span_sampled(struct span_context *sc)
+{
+    return !kernel_sampling || trace_sampled(sc);
+}
+
+// Returns whether the span sc, child of psc, is to be emitted. A child span
+// whose parent was not found by the probes is emitted whatever its trace, as
+// the agent may still find its parent among the spans of the ancestors of
+// its goroutine.
+static __always_inline bool span_sampled(struct span_context *sc, struct span_context *psc)
+{
+    if (!kernel_sampling || !span_context_is_valid(psc))
+    {
+        return true;
+    }
+    return trace_sampled(sc);
+}
+
 static __always_inline struct span_context generate_span_context()
 {
     struct span_context context = {};
@@ -56,7 +157,7 @@ static __always_inline void span_context_to_w3c_string(struct span_context *ctx,
 
     // Write sampled
     *out++ = '0';
-    *out = '1';
+    *out = trace_sampled(ctx) ? '1' : '0';
 }
 
 static __always_inline void w3c_string_to_span_context(char *str, struct span_context *ctx)
@@ -67,4 +168,12 @@ static __always_inline void w3c_string_to_span_context(char *str, struct span_co
     hex_string_to_bytes(str + span_id_start_pod, SPAN_ID_STRING_SIZE, ctx->SpanID);
 }
 
+// Returns the trace flags of the W3C traceparent str.
+static __always_inline u8 w3c_string_trace_flags(char *str)
+{
+    u8 flags = 0;
+    hex_string_to_bytes(str + SPAN_CONTEXT_STRING_SIZE - 2, 2, &flags);
+    return flags;
+}
+
 #endif
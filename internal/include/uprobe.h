@@ -25,13 +25,13 @@
     u64 end_time;            \
     struct span_context sc;  \
     struct span_context psc; \
-    u64 trace_root;
+    u64 trace_flags;
 
 // Common flow for uprobe return:
 // 1. Find consistend key for the current uprobe context
 // 2. Use the key to lookup for the uprobe context in the uprobe_context_map
-// 3. Update the end time of the found span
-// 4. Submit the constructed event to the agent code using perf buffer events_map
+// 3. Update the end time and the trace flags of the found span
+// 4. Submit the constructed event to the agent code using perf buffer events_map, if its trace is sampled
 // 5. Delete the span from the uprobe_context_map
 // 6. Delete the span from the global active spans map
 #define UPROBE_RETURN(name, event_type, ctx_struct_pos, ctx_struct_offset, uprobe_context_map, events_map) \
@@ -43,7 +43,11 @@ int uprobe_##name##_Returns(struct pt_regs *ctx) {
     event_type tmpReq = {};                                                                                \
     bpf_probe_read(&tmpReq, sizeof(tmpReq), req_ptr_map);                                                  \
     tmpReq.end_time = bpf_ktime_get_ns();                                                                  \
-    bpf_perf_event_output(ctx, &events_map, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));                   \
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);                                                   \
+    if (span_sampled(&tmpReq.sc, &tmpReq.psc))                                                             \
+    {                                                                                                      \
+        bpf_perf_event_output(ctx, &events_map, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));               \
+    }                                                                                                      \
     bpf_map_delete_elem(&uprobe_context_map, &key);                                                        \
     stop_tracking_span(&tmpReq.sc);                                                                        \
     return 0;                                                                                              \
@@ -195,7 +195,7 @@ func getFuncOffset(f *elf.File, symbol elf.Symbol) (uint64, error) {
 	}
 
 	if len(sections) == 0 {
-		return 0, fmt.Errorf("function %q not found in file", symbol)
+		return 0, fmt.Errorf("function %q not found in file", symbol.Name)
 	}
 
 	var execSection *elf.Section
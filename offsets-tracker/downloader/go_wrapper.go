@@ -37,9 +37,10 @@ var (
 	goMain string
 )
 
-// DownloadBinary downloads the module with modName at version.
+// DownloadBinary downloads the module with modName at version. The app built
+// with it has mainSrc as main.go, or else only imports it.
 // revive:disable-next-line:flag-parameter
-func DownloadBinary(modName string, version string, isGoStandartLib bool) (string, string, error) {
+func DownloadBinary(modName string, version string, isGoStandartLib bool, mainSrc string) (string, string, error) {
 	dir, err := os.MkdirTemp("", appName)
 	if err != nil {
 		return "", "", err
@@ -57,7 +58,10 @@ func DownloadBinary(modName string, version string, isGoStandartLib bool) (strin
 		return "", "", err
 	}
 
-	goMainContent := fmt.Sprintf(goMain, modName)
+	goMainContent := mainSrc
+	if goMainContent == "" {
+		goMainContent = fmt.Sprintf(goMain, modName)
+	}
 	err = os.WriteFile(path.Join(dir, "main.go"), []byte(goMainContent), fs.ModePerm)
 	if err != nil {
 		return "", "", err
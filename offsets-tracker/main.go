@@ -31,6 +31,26 @@ const (
 	defaultOutputFile = "/tmp/offset_results.json"
 )
 
+// saramaWrapperMain uses the producers and consumers of sarama instrumented,
+// for their structs to be linked in.
+const saramaWrapperMain = `package main
+
+import "github.com/IBM/sarama"
+
+func main() {
+	config := sarama.NewConfig()
+	if p, err := sarama.NewSyncProducer(nil, config); err == nil {
+		_, _, _ = p.SendMessage(&sarama.ProducerMessage{})
+	}
+	if c, err := sarama.NewConsumer(nil, config); err == nil {
+		_, _ = c.ConsumePartition("", 0, 0)
+	}
+	if g, err := sarama.NewConsumerGroup(nil, "", config); err == nil {
+		_ = g.Consume(nil, nil, nil)
+	}
+}
+`
+
 func main() {
 	outputFilename := defaultOutputFile
 	if len(os.Getenv("OFFSETS_OUTPUT_FILE")) > 0 {
@@ -84,6 +104,10 @@ func main() {
 				StructName: "net/http.Request",
 				Field:      "ctx",
 			},
+			{
+				StructName: "net/http.Response",
+				Field:      "StatusCode",
+			},
 		})
 
 	if err != nil {
@@ -95,16 +119,47 @@ func main() {
 		DownloadBinaryBy(target.WrapAsGoAppBinaryFetchStrategy).
 		VersionConstraint(&minimunGoVersion).
 		FindOffsets([]*binary.DataMember{
+			{
+				StructName: "net/url.URL",
+				Field:      "Host",
+			},
 			{
 				StructName: "net/url.URL",
 				Field:      "Path",
 			},
+			{
+				StructName: "net/url.URL",
+				Field:      "Scheme",
+			},
 		})
 
 	if err != nil {
 		log.Fatalf("error while fetching offsets for \"net/url\": %v\n", err)
 	}
 
+	stdLibDatabaseSQLOffsets, err := target.New("database/sql", *outputFile, true).
+		FindVersionsBy(target.GoDevFileVersionsStrategy).
+		DownloadBinaryBy(target.WrapAsGoAppBinaryFetchStrategy).
+		VersionConstraint(&minimunGoVersion).
+		FindOffsets([]*binary.DataMember{
+			{
+				StructName: "database/sql.Stmt",
+				Field:      "query",
+			},
+			{
+				StructName: "database/sql.Stmt",
+				Field:      "cg",
+			},
+			{
+				StructName: "database/sql.Tx",
+				Field:      "dc",
+			},
+		})
+
+	if err != nil {
+		log.Fatalf("error while fetching offsets for \"database/sql\": %v\n", err)
+	}
+
 	grpcOffsets, err := target.New("google.golang.org/grpc", *outputFile, false).
 		FindOffsets([]*binary.DataMember{
 			{
@@ -167,11 +222,160 @@ func main() {
 	}
 
 	saramaOffsets, err := target.New("github.com/IBM/sarama", *outputFile, false).
+		WrapperMain(saramaWrapperMain).
 		FindOffsets([]*binary.DataMember{
 			{
 				StructName: "github.com/IBM/sarama.ProducerMessage",
 				Field:      "Topic",
 			},
+			{
+				StructName: "github.com/IBM/sarama.ProducerMessage",
+				Field:      "Key",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ProducerMessage",
+				Field:      "Value",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ProducerMessage",
+				Field:      "Headers",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ProducerMessage",
+				Field:      "Offset",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ProducerMessage",
+				Field:      "Partition",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ConsumerMessage",
+				Field:      "Headers",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ConsumerMessage",
+				Field:      "Key",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ConsumerMessage",
+				Field:      "Topic",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ConsumerMessage",
+				Field:      "Partition",
+			},
+			{
+				StructName: "github.com/IBM/sarama.ConsumerMessage",
+				Field:      "Offset",
+			},
+			{
+				StructName: "github.com/IBM/sarama.partitionConsumer",
+				Field:      "consumer",
+			},
+			{
+				StructName: "github.com/IBM/sarama.consumerGroup",
+				Field:      "consumer",
+			},
+			{
+				StructName: "github.com/IBM/sarama.consumerGroup",
+				Field:      "groupID",
+			},
+			{
+				StructName: "github.com/IBM/sarama.syncProducer",
+				Field:      "producer",
+			},
+			{
+				StructName: "github.com/IBM/sarama.asyncProducer",
+				Field:      "conf",
+			},
+			{
+				StructName: "github.com/IBM/sarama.Config",
+				Field:      "Version",
+			},
+		})
+
+	if err != nil {
+		log.Fatalf("error while fetching offsets: %v\n", err)
+	}
+
+	kafkaGoOffsets, err := target.New("github.com/segmentio/kafka-go", *outputFile, false).
+		FindOffsets([]*binary.DataMember{
+			{
+				StructName: "github.com/segmentio/kafka-go.Message",
+				Field:      "Topic",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.Message",
+				Field:      "Partition",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.Message",
+				Field:      "Offset",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.Message",
+				Field:      "Key",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.Message",
+				Field:      "Headers",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.Message",
+				Field:      "Time",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.Writer",
+				Field:      "Topic",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.Reader",
+				Field:      "config",
+			},
+			{
+				StructName: "github.com/segmentio/kafka-go.ReaderConfig",
+				Field:      "GroupID",
+			},
+		})
+
+	if err != nil {
+		log.Fatalf("error while fetching offsets: %v\n", err)
+	}
+
+	goRedisV9Offsets, err := target.New("github.com/redis/go-redis/v9", *outputFile, false).
+		FindOffsets([]*binary.DataMember{
+			{
+				StructName: "github.com/redis/go-redis/v9.baseCmd",
+				Field:      "args",
+			},
+			{
+				StructName: "github.com/redis/go-redis/v9.baseClient",
+				Field:      "opt",
+			},
+			{
+				StructName: "github.com/redis/go-redis/v9.Options",
+				Field:      "Addr",
+			},
+		})
+
+	if err != nil {
+		log.Fatalf("error while fetching offsets: %v\n", err)
+	}
+
+	goRedisV8Offsets, err := target.New("github.com/go-redis/redis/v8", *outputFile, false).
+		FindOffsets([]*binary.DataMember{
+			{
+				StructName: "github.com/go-redis/redis/v8.baseCmd",
+				Field:      "args",
+			},
+			{
+				StructName: "github.com/go-redis/redis/v8.baseClient",
+				Field:      "opt",
+			},
+			{
+				StructName: "github.com/go-redis/redis/v8.Options",
+				Field:      "Addr",
+			},
 		})
 
 	if err != nil {
@@ -183,9 +387,13 @@ func main() {
 		stdLibRuntimeOffsets,
 		stdLibNetHTTPOffsets,
 		stdLibNetURLOffsets,
+		stdLibDatabaseSQLOffsets,
 		grpcOffsets,
 		logrusOffsets,
 		saramaOffsets,
+		kafkaGoOffsets,
+		goRedisV9Offsets,
+		goRedisV8Offsets,
 	)
 	if err != nil {
 		log.Fatalf("error while writing results to file: %v\n", err)
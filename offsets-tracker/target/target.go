@@ -61,6 +61,7 @@ type Data struct {
 	versionsStrategy    VersionsStrategy
 	binaryFetchStrategy BinaryFetchStrategy
 	versionConstraint   *version.Constraints
+	wrapperMain         string
 	cache               *cache.Cache
 }
 
@@ -81,6 +82,14 @@ func (t *Data) VersionConstraint(constraint *version.Constraints) *Data {
 	return t
 }
 
+// WrapperMain sets the source of the main package of the Go app built with
+// the module, instead of one only importing it. The structs of a module are
+// only linked in, with their offsets, when the app uses them.
+func (t *Data) WrapperMain(src string) *Data {
+	t.wrapperMain = src
+	return t
+}
+
 // FindVersionsBy sets the VersionsStrategy used.
 func (t *Data) FindVersionsBy(strategy VersionsStrategy) *Data {
 	t.versionsStrategy = strategy
@@ -199,7 +208,7 @@ func (t *Data) findVersions() ([]string, error) {
 func (t *Data) downloadBinary(modName string, version string) (string, string, error) {
 	switch t.binaryFetchStrategy {
 	case WrapAsGoAppBinaryFetchStrategy:
-		return downloader.DownloadBinary(modName, version, t.isGoStdlib)
+		return downloader.DownloadBinary(modName, version, t.isGoStdlib, t.wrapperMain)
 	case DownloadPreCompiledBinaryFetchStrategy:
 		return downloader.DownloadBinaryFromRemote(modName, version)
 	}
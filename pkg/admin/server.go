@@ -0,0 +1,147 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package admin provides a local HTTP server exposing the state of the agent.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/log"           // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"       // nolint:staticcheck  // Atomic deprecation.
+)
+
+// AddrEnvVar is the environment variable key whose value is the address the
+// admin server listens on, e.g. "localhost:8888". The server is not started
+// if it is not set.
+const AddrEnvVar = "OTEL_GO_AUTO_ADMIN_ADDR"
+
+// Target is a target of the agent.
+type Target struct {
+	// Name describes how the target is selected, e.g. "exe=/usr/bin/app".
+	Name string
+	// Status returns the state of the instrumentation of the target, or nil
+	// if the target process is not instrumented yet.
+	Status func() *instrumentors.Status
+}
+
+// TargetStatus is the state of a target reported by the status page.
+type TargetStatus struct {
+	Target       string `json:"target"`
+	Instrumented bool   `json:"instrumented"`
+	*instrumentors.Status
+}
+
+// Server is the admin HTTP server. It serves:
+//
+//   - /healthz, answering 200 as long as the agent runs.
+//   - /readyz, answering 200 once every target process is instrumented and
+//     503 otherwise.
+//   - /status, the JSON state of every target.
+//   - /metrics, the metrics of the agent in the Prometheus format.
+type Server struct {
+	targets []Target
+	server  *http.Server
+}
+
+// NewServer returns a [Server] listening on addr and reporting the state of
+// targets.
+func NewServer(addr string, targets []Target) *Server {
+	s := &Server{targets: targets}
+	s.server = &http.Server{
+		Addr:              addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	return s
+}
+
+// Handler returns the handler serving the endpoints of s.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	mux.HandleFunc("/status", s.status)
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+// Start starts listening, and serves requests in the background.
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	log.Logger.V(0).Info("admin server listening", "address", l.Addr().String())
+	go func() {
+		if err := s.server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Logger.Error(err, "admin server failed")
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops s, waiting for the requests being served until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, _ *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) readyz(w http.ResponseWriter, _ *http.Request) {
+	var waiting []string
+	for _, t := range s.targets {
+		if t.Status() == nil {
+			waiting = append(waiting, t.Name)
+		}
+	}
+
+	if len(waiting) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not instrumented: %s\n", strings.Join(waiting, ", "))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (s *Server) status(w http.ResponseWriter, _ *http.Request) {
+	statuses := make([]*TargetStatus, 0, len(s.targets))
+	for _, t := range s.targets {
+		st := t.Status()
+		statuses = append(statuses, &TargetStatus{
+			Target:       t.Name,
+			Instrumented: st != nil,
+			Status:       st,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(statuses); err != nil {
+		log.Logger.Error(err, "unable to write admin status")
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package admin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors"                     // nolint:staticcheck  // Atomic deprecation.
+	instContext "go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+)
+
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, err := io.ReadAll(rec.Result().Body)
+	require.NoError(t, err)
+	return rec.Code, string(body)
+}
+
+func TestServer(t *testing.T) {
+	var status *instrumentors.Status
+	h := NewServer("", []Target{{
+		Name:   "exe=/usr/bin/app",
+		Status: func() *instrumentors.Status { return status },
+	}}).Handler()
+
+	code, body := get(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+
+	code, body = get(t, h, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not instrumented: exe=/usr/bin/app\n", body)
+
+	code, body = get(t, h, "/status")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `[{"target": "exe=/usr/bin/app", "instrumented": false}]`, body)
+
+	status = &instrumentors.Status{
+		PID:       42,
+		GoVersion: "1.20.5",
+		Instrumentors: []*instrumentors.InstrumentorStatus{{
+			Name: "net/http",
+			Uprobes: []instContext.UprobeStatus{
+				{Function: "net/http.serverHandler.ServeHTTP", Address: 0x1000},
+				{Function: "net/http.serverHandler.ServeHTTP", Address: 0x1040, Return: true},
+			},
+			FailedUprobes: []instContext.UprobeStatus{
+				{Function: "net/http.(*ServeMux).ServeHTTP", Error: "symbol not found"},
+			},
+			Events: 3,
+		}},
+	}
+
+	code, _ = get(t, h, "/readyz")
+	assert.Equal(t, http.StatusOK, code)
+
+	_, body = get(t, h, "/status")
+	assert.JSONEq(t, `[{
+  "target": "exe=/usr/bin/app",
+  "instrumented": true,
+  "pid": 42,
+  "go_version": "1.20.5",
+  "instrumentors": [{
+    "name": "net/http",
+    "uprobes": [
+      {"function": "net/http.serverHandler.ServeHTTP", "address": 4096},
+      {"function": "net/http.serverHandler.ServeHTTP", "address": 4160, "return": true}
+    ],
+    "failed_uprobes": [
+      {"function": "net/http.(*ServeMux).ServeHTTP", "error": "symbol not found"}
+    ],
+    "events": 3
+  }]
+}]`, body)
+}
+
+func TestServerMetrics(t *testing.T) {
+	h := NewServer("", nil).Handler()
+
+	code, body := get(t, h, "/metrics")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "otel_go_auto_queue_depth")
+	assert.Contains(t, body, "otel_go_auto_spans_exported_total")
+}
@@ -0,0 +1,607 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config provides the declarative configuration file of the agent.
+//
+// The file is written in YAML or JSON. Every setting of the file has an
+// environment variable counterpart, which takes precedence over the file when
+// set, e.g.
+//
+//	service_name: frontend
+//	targets:
+//	  - exe_path: /usr/bin/frontend
+//	  - service_name: cart
+//	    pod_uid: 0f1c2d3e-4a5b-6c7d-8e9f-a0b1c2d3e4f5
+//	instrumentors:
+//	  exclude: [sirupsen/logrus]
+//	queue:
+//	  delay: 5s
+//	  max_size: 10000
+//	exporter:
+//	  endpoint: http://localhost:4317
+//	sampling:
+//	  sampler: parentbased_traceidratio
+//	  arg: 0.1
+//	capture:
+//	  database/sql:
+//	    include_statement: true
+//	  redis:
+//	    include_args: true
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"go.opentelemetry.io/auto/pkg/admin"                                       // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors"                               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/database/sql"              // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/redis/go-redis" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/injection"                     // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/utils"                         // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/opentelemetry"                               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"                                     // nolint:staticcheck  // Atomic deprecation.
+)
+
+// FileEnvVar is the environment variable key whose value points to the
+// configuration file of the agent.
+const FileEnvVar = "OTEL_GO_AUTO_CONFIG"
+
+// QueueDelayEnvVar is the environment variable key whose value is how long
+// the events are held back to be reordered.
+const QueueDelayEnvVar = "QUEUE_DELAY_DURATION"
+
+// QueueMaxSizeEnvVar is the environment variable key whose value is the
+// maximum number of queued events, 0 meaning unbounded.
+const QueueMaxSizeEnvVar = "QUEUE_MAX_SIZE"
+
+// ShutdownTimeoutEnvVar is the environment variable key whose value bounds
+// how long the pending spans are exported for once the agent is stopped.
+const ShutdownTimeoutEnvVar = "OTEL_GO_AUTO_SHUTDOWN_TIMEOUT"
+
+// Config is the configuration of the agent.
+type Config struct {
+	// ServiceName is the service.name of the targets without one.
+	ServiceName string `yaml:"service_name"`
+
+	Targets       []Target      `yaml:"targets"`
+	Instrumentors Instrumentors `yaml:"instrumentors"`
+	Queue         Queue         `yaml:"queue"`
+	Exporter      Exporter      `yaml:"exporter"`
+	Sampling      Sampling      `yaml:"sampling"`
+	Capture       Capture       `yaml:"capture"`
+	EBPF          EBPF          `yaml:"ebpf"`
+	Admin         Admin         `yaml:"admin"`
+
+	// Propagators are the formats the trace context is propagated with:
+	// tracecontext (default), baggage, b3, b3multi, jaeger or none.
+	Propagators []string `yaml:"propagators"`
+	// HeaderInjection restricts the outgoing requests the trace context is
+	// injected in.
+	HeaderInjection HeaderInjection `yaml:"header_injection"`
+
+	// ShutdownTimeout bounds how long the pending spans are exported for
+	// once the agent is stopped.
+	ShutdownTimeout *Duration `yaml:"shutdown_timeout"`
+}
+
+// Target selects a process to instrument, see [process.TargetArgs].
+type Target struct {
+	ServiceName string `yaml:"service_name"`
+	ExePath     string `yaml:"exe_path"`
+	PID         int    `yaml:"pid"`
+	Cmdline     string `yaml:"cmdline"`
+	ContainerID string `yaml:"container_id"`
+	Cgroup      string `yaml:"cgroup"`
+	PodUID      string `yaml:"pod_uid"`
+
+	line int
+}
+
+// Instrumentors selects the instrumentors to run by library name, e.g.
+// net/http or database/sql.
+type Instrumentors struct {
+	// Include lists the only instrumentors to run. If empty, all the
+	// instrumentors enabled by default run.
+	Include []string `yaml:"include"`
+	// Exclude lists the instrumentors not to run.
+	Exclude []string `yaml:"exclude"`
+}
+
+// Queue configures the queue reordering the events of a target.
+type Queue struct {
+	// Delay is how long events are held back to be reordered.
+	Delay *Duration `yaml:"delay"`
+	// MaxSize is the maximum number of queued events, 0 meaning unbounded.
+	MaxSize *uint64 `yaml:"max_size"`
+}
+
+// Exporter configures the exporter of the spans.
+type Exporter struct {
+	// Type is the exporter of the spans: otlp (default), console, stdout,
+	// file or none.
+	Type string `yaml:"type"`
+	// Protocol is the protocol of the otlp exporter: grpc (default) or
+	// http/protobuf.
+	Protocol string            `yaml:"protocol"`
+	Endpoint string            `yaml:"endpoint"`
+	Insecure *bool             `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	Timeout  *Duration         `yaml:"timeout"`
+	File     FileExporter      `yaml:"file"`
+	// RetryQueue holds the spans on disk until the otlp endpoint receives
+	// them.
+	RetryQueue RetryQueue `yaml:"retry_queue"`
+}
+
+// FileExporter configures the file exporter, which writes the spans to
+// size-rotated files to be replayed later.
+type FileExporter struct {
+	Directory string `yaml:"directory"`
+	// Format is the encoding of the files: protobuf (default) or json.
+	Format string `yaml:"format"`
+	// MaxSize is the size in bytes above which a new file is started.
+	MaxSize *uint64 `yaml:"max_size"`
+	// MaxFiles is the number of files kept, 0 meaning all.
+	MaxFiles *uint64 `yaml:"max_files"`
+}
+
+// RetryQueue configures the retry queue of the otlp exporter, enabled when
+// Directory is set.
+type RetryQueue struct {
+	Directory string `yaml:"directory"`
+	// MaxSize is the size in bytes of the queue above which the oldest spans
+	// are dropped.
+	MaxSize *uint64 `yaml:"max_size"`
+	// MaxAge is how long spans are retried for before being dropped.
+	MaxAge *Duration `yaml:"max_age"`
+}
+
+// Sampling configures the head sampling of the traces.
+type Sampling struct {
+	// Sampler is the sampler of the spans: always_on, always_off,
+	// traceidratio, parentbased_always_on (default), parentbased_always_off
+	// or parentbased_traceidratio.
+	Sampler string `yaml:"sampler"`
+	// Arg is the argument of the sampler, the sampling probability of the
+	// traceidratio samplers.
+	Arg string `yaml:"arg"`
+	// InKernel has the eBPF probes drop the spans of the traces not sampled
+	// by the root sampler, before they are read by the agent.
+	InKernel *bool `yaml:"in_kernel"`
+	// Tail buffers the traces and keeps those matching one of its policies,
+	// after the head sampling.
+	Tail TailSampling `yaml:"tail"`
+}
+
+// TailSampling configures the tail sampling of the traces, enabled when
+// Window is set. A trace is kept if any of the policies set keeps it.
+type TailSampling struct {
+	// Window is how long the spans of a trace are buffered after its first
+	// span before the trace is decided.
+	Window *Duration `yaml:"window"`
+	// Latency keeps the traces lasting at least that long.
+	Latency *Duration `yaml:"latency"`
+	// Errors keeps the traces with a span whose status is Error. The spans
+	// of the gRPC servers carry no status and are never kept by it.
+	Errors *bool `yaml:"errors"`
+	// Libraries keeps the traces with a span of one of the libraries, e.g.
+	// database/sql.
+	Libraries []string `yaml:"libraries"`
+	// Percentage keeps that percentage of the traces.
+	Percentage *float64 `yaml:"percentage"`
+	// MaxTraces is the number of traces buffered above which the oldest is
+	// decided early.
+	MaxTraces *uint64 `yaml:"max_traces"`
+}
+
+// HeaderInjection configures the injection of the trace context headers in
+// outgoing requests. The syntax of the destinations is that of the policy of
+// the pkg/instrumentors/injection package.
+type HeaderInjection struct {
+	// ObserveOnly keeps the probes from writing into the memory of the
+	// targets, and so from injecting any header.
+	ObserveOnly *bool `yaml:"observe_only"`
+	// Allow lists the only destinations the headers are injected for, unless
+	// it includes *.
+	Allow []string `yaml:"allow"`
+	// Deny lists the destinations the headers are not injected for.
+	Deny []string `yaml:"deny"`
+}
+
+// Capture configures the optional attributes captured per library.
+type Capture struct {
+	SQL   SQLCapture   `yaml:"database/sql"`
+	Redis RedisCapture `yaml:"redis"`
+}
+
+// SQLCapture configures the attributes captured by the database/sql
+// instrumentor.
+type SQLCapture struct {
+	// IncludeStatement records the SQL query of the spans.
+	IncludeStatement *bool `yaml:"include_statement"`
+}
+
+// RedisCapture configures the attributes captured by the go-redis
+// instrumentors.
+type RedisCapture struct {
+	// IncludeArgs records the commands of the spans with their key, their
+	// other arguments redacted.
+	IncludeArgs *bool `yaml:"include_args"`
+}
+
+// Admin configures the admin HTTP server of the agent.
+type Admin struct {
+	// Address is the address the server listens on, e.g. localhost:8888.
+	// The server is not started without it.
+	Address string `yaml:"address"`
+}
+
+// EBPF configures the loading of eBPF programs.
+type EBPF struct {
+	// ShowVerifierLog prints the verifier log of programs failing to load.
+	ShowVerifierLog *bool `yaml:"show_verifier_log"`
+}
+
+// Duration is a time.Duration written as a Go duration string, e.g. 500ms.
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if value.Kind != yaml.ScalarNode || err != nil {
+		return &Error{Line: value.Line, Msg: fmt.Sprintf("invalid duration %q, expected e.g. 500ms or 5s", value.Value)}
+	}
+	if parsed < 0 {
+		return &Error{Line: value.Line, Msg: fmt.Sprintf("negative duration %q", value.Value)}
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Error is an invalid setting of the configuration file.
+type Error struct {
+	// Line is the line of the setting in the file.
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Load reads the configuration file at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// Parse parses and validates a configuration written in YAML or JSON.
+// Unknown settings are rejected.
+func Parse(data []byte) (*Config, error) {
+	c := &Config{}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil {
+		if errors.Is(err, io.EOF) {
+			return c, nil
+		}
+		return nil, err
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	for i, n := range lookup(&root, "targets").Content {
+		c.Targets[i].line = n.Line
+	}
+
+	if err := c.validate(&root); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// lookup returns the value of key in the top level mapping of the document
+// root, or an empty node if it is not set.
+func lookup(root *yaml.Node, key string) *yaml.Node {
+	if root.Kind == yaml.DocumentNode && len(root.Content) == 1 {
+		root = root.Content[0]
+	}
+	if root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == key {
+				return root.Content[i+1]
+			}
+		}
+	}
+
+	return &yaml.Node{}
+}
+
+func (c *Config) validate(root *yaml.Node) error {
+	seen := make(map[string]int, len(c.Targets))
+	for _, t := range c.Targets {
+		args := t.args()
+		if err := args.Validate(); err != nil {
+			if t.ExePath == "" && t.PID == 0 && t.Cmdline == "" && t.ContainerID == "" && t.Cgroup == "" && t.PodUID == "" {
+				return &Error{Line: t.line, Msg: "target has no selector, set one of exe_path, pid, cmdline, container_id, cgroup or pod_uid"}
+			}
+			return &Error{Line: t.line, Msg: err.Error()}
+		}
+
+		if line, exists := seen[args.String()]; exists {
+			return &Error{Line: t.line, Msg: fmt.Sprintf("target %s already specified at line %d", args, line)}
+		}
+		seen[args.String()] = t.line
+	}
+
+	instrumentors := lookup(root, "instrumentors")
+	excluded := make(map[string]struct{}, len(c.Instrumentors.Exclude))
+	for i, name := range c.Instrumentors.Exclude {
+		if name == "" || strings.Contains(name, ",") {
+			return &Error{Line: lookup(instrumentors, "exclude").Content[i].Line, Msg: fmt.Sprintf("invalid instrumentor name %q", name)}
+		}
+		excluded[name] = struct{}{}
+	}
+	for i, name := range c.Instrumentors.Include {
+		line := lookup(instrumentors, "include").Content[i].Line
+		if name == "" || strings.Contains(name, ",") {
+			return &Error{Line: line, Msg: fmt.Sprintf("invalid instrumentor name %q", name)}
+		}
+		if _, exists := excluded[name]; exists {
+			return &Error{Line: line, Msg: fmt.Sprintf("instrumentor %s is both included and excluded", name)}
+		}
+	}
+
+	exporter := lookup(root, "exporter")
+	switch c.Exporter.Type {
+	case "", "otlp", "console", "stdout", "file", "none":
+	default:
+		return &Error{Line: lookup(exporter, "type").Line, Msg: fmt.Sprintf("unsupported exporter type %q", c.Exporter.Type)}
+	}
+	switch c.Exporter.Protocol {
+	case "", "grpc", "http/protobuf":
+	default:
+		return &Error{Line: lookup(exporter, "protocol").Line, Msg: fmt.Sprintf("unsupported exporter protocol %q", c.Exporter.Protocol)}
+	}
+
+	switch c.Exporter.File.Format {
+	case "", "protobuf", "json":
+	default:
+		file := lookup(exporter, "file")
+		return &Error{Line: lookup(file, "format").Line, Msg: fmt.Sprintf("unsupported file exporter format %q", c.Exporter.File.Format)}
+	}
+	if c.Exporter.File.MaxSize != nil && *c.Exporter.File.MaxSize == 0 {
+		file := lookup(exporter, "file")
+		return &Error{Line: lookup(file, "max_size").Line, Msg: "file exporter max_size must be positive"}
+	}
+
+	retryQueue := lookup(exporter, "retry_queue")
+	if c.Exporter.RetryQueue.MaxSize != nil && *c.Exporter.RetryQueue.MaxSize == 0 {
+		return &Error{Line: lookup(retryQueue, "max_size").Line, Msg: "retry queue max_size must be positive"}
+	}
+	if c.Exporter.RetryQueue.MaxAge != nil && *c.Exporter.RetryQueue.MaxAge <= 0 {
+		return &Error{Line: lookup(retryQueue, "max_age").Line, Msg: "retry queue max_age must be positive"}
+	}
+
+	sampling := lookup(root, "sampling")
+	switch c.Sampling.Sampler {
+	case "", "always_on", "always_off", "traceidratio",
+		"parentbased_always_on", "parentbased_always_off", "parentbased_traceidratio":
+	default:
+		return &Error{Line: lookup(sampling, "sampler").Line, Msg: fmt.Sprintf("unsupported sampler %q", c.Sampling.Sampler)}
+	}
+	if c.Sampling.Arg != "" {
+		ratio, err := strconv.ParseFloat(c.Sampling.Arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return &Error{Line: lookup(sampling, "arg").Line, Msg: fmt.Sprintf("invalid sampler arg %q, must be a probability between 0 and 1", c.Sampling.Arg)}
+		}
+	}
+
+	tail := lookup(sampling, "tail")
+	if c.Sampling.Tail.Window != nil && *c.Sampling.Tail.Window <= 0 {
+		return &Error{Line: lookup(tail, "window").Line, Msg: "tail sampling window must be positive"}
+	}
+	if p := c.Sampling.Tail.Percentage; p != nil && (*p < 0 || *p > 100) {
+		return &Error{Line: lookup(tail, "percentage").Line, Msg: fmt.Sprintf("invalid tail sampling percentage %v, must be between 0 and 100", *p)}
+	}
+	if c.Sampling.Tail.MaxTraces != nil && *c.Sampling.Tail.MaxTraces == 0 {
+		return &Error{Line: lookup(tail, "max_traces").Line, Msg: "tail sampling max_traces must be positive"}
+	}
+	for i, lib := range c.Sampling.Tail.Libraries {
+		if lib == "" || strings.Contains(lib, ",") {
+			return &Error{Line: lookup(tail, "libraries").Content[i].Line, Msg: fmt.Sprintf("invalid library name %q", lib)}
+		}
+	}
+
+	for i, name := range c.Propagators {
+		switch name {
+		case "tracecontext", "baggage", "b3", "b3multi", "jaeger", "none":
+		default:
+			return &Error{Line: lookup(root, "propagators").Content[i].Line, Msg: fmt.Sprintf("unsupported propagator %q", name)}
+		}
+	}
+
+	headerInjection := lookup(root, "header_injection")
+	for _, list := range []string{"allow", "deny"} {
+		destinations := c.HeaderInjection.Allow
+		if list == "deny" {
+			destinations = c.HeaderInjection.Deny
+		}
+		for i, d := range destinations {
+			if d == "" || strings.Contains(d, ",") {
+				return &Error{Line: lookup(headerInjection, list).Content[i].Line, Msg: fmt.Sprintf("invalid header injection destination %q", d)}
+			}
+		}
+	}
+
+	for name := range c.Exporter.Headers {
+		if name == "" || strings.ContainsAny(name, ",=") {
+			headers := lookup(exporter, "headers")
+			return &Error{Line: headers.Line, Msg: fmt.Sprintf("invalid exporter header name %q", name)}
+		}
+	}
+
+	return nil
+}
+
+func (t Target) args() *process.TargetArgs {
+	return &process.TargetArgs{
+		ExePath:        t.ExePath,
+		PID:            t.PID,
+		CmdlinePattern: t.Cmdline,
+		ContainerID:    t.ContainerID,
+		CgroupPath:     t.Cgroup,
+		PodUID:         t.PodUID,
+		ServiceName:    t.ServiceName,
+	}
+}
+
+// TargetArgs returns the targets of c.
+func (c *Config) TargetArgs() []*process.TargetArgs {
+	result := make([]*process.TargetArgs, 0, len(c.Targets))
+	for _, t := range c.Targets {
+		result = append(result, t.args())
+	}
+
+	return result
+}
+
+// Env returns the environment variables equivalent to the settings of c.
+func (c *Config) Env() map[string]string {
+	env := make(map[string]string)
+	setString := func(key, val string) {
+		if val != "" {
+			env[key] = val
+		}
+	}
+	setBool := func(key string, val *bool) {
+		if val != nil {
+			env[key] = strconv.FormatBool(*val)
+		}
+	}
+
+	setString(opentelemetry.ServiceNameEnvVar, c.ServiceName)
+	setString(instrumentors.InstrumentationsEnvVar, strings.Join(c.Instrumentors.Include, ","))
+	setString(instrumentors.DisabledInstrumentationsEnvVar, strings.Join(c.Instrumentors.Exclude, ","))
+
+	if c.Queue.Delay != nil {
+		env[QueueDelayEnvVar] = time.Duration(*c.Queue.Delay).String()
+	}
+	if c.Queue.MaxSize != nil {
+		env[QueueMaxSizeEnvVar] = strconv.FormatUint(*c.Queue.MaxSize, 10)
+	}
+
+	setString(opentelemetry.TracesExporterEnvVar, c.Exporter.Type)
+	setString(opentelemetry.OTLPProtocolEnvVar, c.Exporter.Protocol)
+	setString(opentelemetry.OTLPEndpointEnvVar, c.Exporter.Endpoint)
+	setBool(opentelemetry.OTLPInsecureEnvVar, c.Exporter.Insecure)
+	if len(c.Exporter.Headers) > 0 {
+		headers := make([]string, 0, len(c.Exporter.Headers))
+		for name, val := range c.Exporter.Headers {
+			headers = append(headers, name+"="+val)
+		}
+		sort.Strings(headers)
+		env[opentelemetry.OTLPHeadersEnvVar] = strings.Join(headers, ",")
+	}
+	if c.Exporter.Timeout != nil {
+		env[opentelemetry.OTLPTimeoutEnvVar] = strconv.FormatInt(time.Duration(*c.Exporter.Timeout).Milliseconds(), 10)
+	}
+
+	setString(opentelemetry.FileDirEnvVar, c.Exporter.File.Directory)
+	setString(opentelemetry.FileFormatEnvVar, c.Exporter.File.Format)
+	if c.Exporter.File.MaxSize != nil {
+		env[opentelemetry.FileMaxSizeEnvVar] = strconv.FormatUint(*c.Exporter.File.MaxSize, 10)
+	}
+	if c.Exporter.File.MaxFiles != nil {
+		env[opentelemetry.FileMaxFilesEnvVar] = strconv.FormatUint(*c.Exporter.File.MaxFiles, 10)
+	}
+	setString(opentelemetry.RetryQueueDirEnvVar, c.Exporter.RetryQueue.Directory)
+	if c.Exporter.RetryQueue.MaxSize != nil {
+		env[opentelemetry.RetryQueueMaxSizeEnvVar] = strconv.FormatUint(*c.Exporter.RetryQueue.MaxSize, 10)
+	}
+	if c.Exporter.RetryQueue.MaxAge != nil {
+		env[opentelemetry.RetryQueueMaxAgeEnvVar] = time.Duration(*c.Exporter.RetryQueue.MaxAge).String()
+	}
+	setString(opentelemetry.TracesSamplerEnvVar, c.Sampling.Sampler)
+	setString(opentelemetry.TracesSamplerArgEnvVar, c.Sampling.Arg)
+	setBool(opentelemetry.KernelSamplingEnvVar, c.Sampling.InKernel)
+	if c.Sampling.Tail.Window != nil {
+		env[opentelemetry.TailSamplingWindowEnvVar] = time.Duration(*c.Sampling.Tail.Window).String()
+	}
+	if c.Sampling.Tail.Latency != nil {
+		env[opentelemetry.TailSamplingLatencyEnvVar] = time.Duration(*c.Sampling.Tail.Latency).String()
+	}
+	setBool(opentelemetry.TailSamplingErrorsEnvVar, c.Sampling.Tail.Errors)
+	setString(opentelemetry.TailSamplingLibrariesEnvVar, strings.Join(c.Sampling.Tail.Libraries, ","))
+	if c.Sampling.Tail.Percentage != nil {
+		env[opentelemetry.TailSamplingPercentageEnvVar] = strconv.FormatFloat(*c.Sampling.Tail.Percentage, 'g', -1, 64)
+	}
+	if c.Sampling.Tail.MaxTraces != nil {
+		env[opentelemetry.TailSamplingMaxTracesEnvVar] = strconv.FormatUint(*c.Sampling.Tail.MaxTraces, 10)
+	}
+
+	setString(opentelemetry.PropagatorsEnvVar, strings.Join(c.Propagators, ","))
+	setBool(injection.ObserveOnlyEnvVar, c.HeaderInjection.ObserveOnly)
+	setString(injection.AllowEnvVar, strings.Join(c.HeaderInjection.Allow, ","))
+	setString(injection.DenyEnvVar, strings.Join(c.HeaderInjection.Deny, ","))
+
+	setBool(sql.IncludeDBStatementEnvVar, c.Capture.SQL.IncludeStatement)
+	setBool(redis.IncludeArgsEnvVar, c.Capture.Redis.IncludeArgs)
+	setBool(utils.ShowVerifierLogEnvVar, c.EBPF.ShowVerifierLog)
+	setString(admin.AddrEnvVar, c.Admin.Address)
+	if c.ShutdownTimeout != nil {
+		env[ShutdownTimeoutEnvVar] = time.Duration(*c.ShutdownTimeout).String()
+	}
+
+	return env
+}
+
+// Apply sets the environment variables equivalent to the settings of c,
+// except for those already set which override the file.
+func (c *Config) Apply() error {
+	for key, val := range c.Env() {
+		if _, exists := os.LookupEnv(key); exists {
+			continue
+		}
+		if err := os.Setenv(key, val); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,249 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/process" // nolint:staticcheck  // Atomic deprecation.
+)
+
+const yamlConfig = `service_name: frontend
+targets:
+  - exe_path: /usr/bin/frontend
+  - service_name: cart
+    pod_uid: 0f1c2d3e-4a5b-6c7d-8e9f-a0b1c2d3e4f5
+instrumentors:
+  exclude: [sirupsen/logrus, runtime]
+queue:
+  delay: 500ms
+  max_size: 10000
+exporter:
+  protocol: http/protobuf
+  endpoint: http://collector:4318
+  insecure: true
+  headers:
+    x-tenant: a
+    authorization: token
+  timeout: 2s
+  file:
+    directory: /var/lib/otel-go-auto/spans
+    format: json
+    max_size: 1048576
+    max_files: 5
+  retry_queue:
+    directory: /var/lib/otel-go-auto/queue
+    max_size: 67108864
+    max_age: 1h
+sampling:
+  sampler: parentbased_traceidratio
+  arg: 0.25
+  in_kernel: true
+  tail:
+    window: 30s
+    latency: 500ms
+    errors: true
+    libraries: [database/sql]
+    percentage: 5
+    max_traces: 1000
+propagators: [tracecontext, b3]
+header_injection:
+  observe_only: false
+  allow: ["*"]
+  deny: [api.partner.com, "grpc:dns:///legacy:50051"]
+capture:
+  database/sql:
+    include_statement: true
+  redis:
+    include_args: true
+ebpf:
+  show_verifier_log: false
+admin:
+  address: localhost:8888
+shutdown_timeout: 15s
+`
+
+func TestParseYAML(t *testing.T) {
+	c, err := Parse([]byte(yamlConfig))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*process.TargetArgs{
+		{ExePath: "/usr/bin/frontend"},
+		{PodUID: "0f1c2d3e-4a5b-6c7d-8e9f-a0b1c2d3e4f5", ServiceName: "cart"},
+	}, c.TargetArgs())
+
+	assert.Equal(t, map[string]string{
+		"OTEL_SERVICE_NAME":                      "frontend",
+		"OTEL_GO_AUTO_DISABLED_INSTRUMENTATIONS": "sirupsen/logrus,runtime",
+		"QUEUE_DELAY_DURATION":                   "500ms",
+		"QUEUE_MAX_SIZE":                         "10000",
+		"OTEL_EXPORTER_OTLP_PROTOCOL":            "http/protobuf",
+		"OTEL_EXPORTER_OTLP_ENDPOINT":            "http://collector:4318",
+		"OTEL_EXPORTER_OTLP_INSECURE":            "true",
+		"OTEL_EXPORTER_OTLP_HEADERS":             "authorization=token,x-tenant=a",
+		"OTEL_EXPORTER_OTLP_TIMEOUT":             "2000",
+		"OTEL_GO_AUTO_EXPORTER_FILE_DIR":         "/var/lib/otel-go-auto/spans",
+		"OTEL_GO_AUTO_EXPORTER_FILE_FORMAT":      "json",
+		"OTEL_GO_AUTO_EXPORTER_FILE_MAX_SIZE":    "1048576",
+		"OTEL_GO_AUTO_EXPORTER_FILE_MAX_FILES":   "5",
+		"OTEL_GO_AUTO_RETRY_QUEUE_DIR":           "/var/lib/otel-go-auto/queue",
+		"OTEL_GO_AUTO_RETRY_QUEUE_MAX_SIZE":      "67108864",
+		"OTEL_GO_AUTO_RETRY_QUEUE_MAX_AGE":       "1h0m0s",
+		"OTEL_TRACES_SAMPLER":                    "parentbased_traceidratio",
+		"OTEL_TRACES_SAMPLER_ARG":                "0.25",
+		"OTEL_GO_AUTO_KERNEL_SAMPLING":           "true",
+		"OTEL_GO_AUTO_TAIL_SAMPLING_WINDOW":      "30s",
+		"OTEL_GO_AUTO_TAIL_SAMPLING_LATENCY":     "500ms",
+		"OTEL_GO_AUTO_TAIL_SAMPLING_ERRORS":      "true",
+		"OTEL_GO_AUTO_TAIL_SAMPLING_LIBRARIES":   "database/sql",
+		"OTEL_GO_AUTO_TAIL_SAMPLING_PERCENTAGE":  "5",
+		"OTEL_GO_AUTO_TAIL_SAMPLING_MAX_TRACES":  "1000",
+		"OTEL_PROPAGATORS":                       "tracecontext,b3",
+		"OTEL_GO_AUTO_OBSERVE_ONLY":              "false",
+		"OTEL_GO_AUTO_HEADER_INJECTION_ALLOW":    "*",
+		"OTEL_GO_AUTO_HEADER_INJECTION_DENY":     "api.partner.com,grpc:dns:///legacy:50051",
+		"OTEL_GO_AUTO_INCLUDE_DB_STATEMENT":      "true",
+		"OTEL_GO_AUTO_INCLUDE_REDIS_ARGS":        "true",
+		"OTEL_GO_AUTO_SHOW_VERIFIER_LOG":         "false",
+		"OTEL_GO_AUTO_SHUTDOWN_TIMEOUT":          "15s",
+		"OTEL_GO_AUTO_ADMIN_ADDR":                "localhost:8888",
+	}, c.Env())
+}
+
+func TestParseJSON(t *testing.T) {
+	c, err := Parse([]byte(`{
+  "targets": [{"pid": 42, "service_name": "worker"}],
+  "queue": {"max_size": 0}
+}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*process.TargetArgs{{PID: 42, ServiceName: "worker"}}, c.TargetArgs())
+	assert.Equal(t, map[string]string{"QUEUE_MAX_SIZE": "0"}, c.Env())
+}
+
+func TestParseEmpty(t *testing.T) {
+	c, err := Parse(nil)
+	require.NoError(t, err)
+	assert.Empty(t, c.Env())
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "unknown setting",
+			data: "queue:\n  delay: 1s\n  size: 3\n",
+			want: "line 3: field size not found",
+		},
+		{
+			name: "wrong type",
+			data: "targets:\n  - pid: abc\n",
+			want: "line 2: cannot unmarshal !!str `abc` into int",
+		},
+		{
+			name: "invalid duration",
+			data: "queue:\n  delay: 5 seconds\n",
+			want: `line 2: invalid duration "5 seconds"`,
+		},
+		{
+			name: "target without selector",
+			data: "targets:\n  - exe_path: /usr/bin/a\n  - service_name: b\n",
+			want: "line 3: target has no selector",
+		},
+		{
+			name: "invalid cmdline",
+			data: "targets:\n  - cmdline: '('\n",
+			want: "line 2: invalid target command line pattern",
+		},
+		{
+			name: "included and excluded instrumentor",
+			data: "instrumentors:\n  include:\n    - net/http\n    - database/sql\n  exclude: [database/sql]\n",
+			want: "line 4: instrumentor database/sql is both included and excluded",
+		},
+		{
+			name: "unsupported exporter protocol",
+			data: "exporter:\n  type: otlp\n  protocol: http/json\n",
+			want: `line 3: unsupported exporter protocol "http/json"`,
+		},
+		{
+			name: "unsupported file exporter format",
+			data: "exporter:\n  file:\n    directory: /tmp\n    format: csv\n",
+			want: `line 4: unsupported file exporter format "csv"`,
+		},
+		{
+			name: "unsupported sampler",
+			data: "sampling:\n  sampler: jaeger_remote\n",
+			want: `line 2: unsupported sampler "jaeger_remote"`,
+		},
+		{
+			name: "unsupported propagator",
+			data: "propagators:\n  - b3\n  - xray\n",
+			want: `line 3: unsupported propagator "xray"`,
+		},
+		{
+			name: "invalid header injection destination",
+			data: "header_injection:\n  deny:\n    - a.com\n    - \"\"\n",
+			want: `line 4: invalid header injection destination ""`,
+		},
+		{
+			name: "invalid sampler arg",
+			data: "sampling:\n  sampler: traceidratio\n  arg: 10%\n",
+			want: `line 3: invalid sampler arg "10%"`,
+		},
+		{
+			name: "invalid tail sampling percentage",
+			data: "sampling:\n  tail:\n    window: 10s\n    percentage: 150\n",
+			want: "line 4: invalid tail sampling percentage 150",
+		},
+		{
+			name: "zero retry queue max age",
+			data: "exporter:\n  retry_queue:\n    directory: /tmp\n    max_age: 0s\n",
+			want: "line 4: retry queue max_age must be positive",
+		},
+		{
+			name: "duplicate target",
+			data: "targets:\n  - exe_path: /usr/bin/a\n  - exe_path: /usr/bin/a\n",
+			want: "line 3: target exe=/usr/bin/a already specified at line 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestApplyKeepsEnv(t *testing.T) {
+	c, err := Parse([]byte("service_name: frontend\nqueue:\n  delay: 1s\n"))
+	require.NoError(t, err)
+
+	t.Setenv("OTEL_SERVICE_NAME", "from-env")
+	t.Setenv("QUEUE_DELAY_DURATION", "")
+	require.NoError(t, os.Unsetenv("QUEUE_DELAY_DURATION"))
+
+	require.NoError(t, c.Apply())
+	assert.Equal(t, "from-env", os.Getenv("OTEL_SERVICE_NAME"))
+	assert.Equal(t, "1s", os.Getenv("QUEUE_DELAY_DURATION"))
+}
@@ -0,0 +1,387 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package doctor checks whether the host is ready to run the agent.
+package doctor
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/auto/pkg/process" // nolint:staticcheck  // Atomic deprecation.
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	// Pass means the host is ready as far as the check is concerned.
+	Pass Status = "PASS"
+	// Warn means the agent runs, but with degraded features.
+	Warn Status = "WARN"
+	// Fail means the agent cannot instrument targets until fixed.
+	Fail Status = "FAIL"
+)
+
+// Result is the result of a check.
+type Result struct {
+	Check  string
+	Status Status
+	Detail string
+	// Hint explains how to fix a check which did not pass.
+	Hint string
+}
+
+// kernelVersion is a Linux kernel major and minor version.
+type kernelVersion struct {
+	major, minor int
+}
+
+func (v kernelVersion) atLeast(major, minor int) bool {
+	return v.major > major || (v.major == major && v.minor >= minor)
+}
+
+// minKernelVersion is the oldest kernel the instrumentors can attach to. The
+// uprobe PMU used to attach uprobes through perf events was added in 4.17.
+var minKernelVersion = kernelVersion{4, 17}
+
+// bpfFsPath is the mount point of the BPF file-system used by the agent.
+const bpfFsPath = "/sys/fs/bpf"
+
+// Run runs all checks. Reachability of the process is checked for every
+// target of targets.
+func Run(targets []*process.TargetArgs) []Result {
+	kernel, kernelResult := checkKernel()
+	caps, capsErr := readCapabilities()
+
+	results := []Result{
+		kernelResult,
+		checkUprobes(),
+		checkMapType("perf event arrays", ebpf.PerfEventArray, Fail,
+			"perf event arrays are required to read events, upgrade the kernel"),
+		checkMapType("ring buffers", ebpf.RingBuf, Warn,
+			"ring buffers need kernel 5.8 or newer, perf event arrays are used instead"),
+	}
+	results = append(results, checkCapabilities(caps, capsErr)...)
+	results = append(results,
+		checkBPFFS(caps),
+		checkMemlock(kernel, caps),
+		checkPtraceScope(caps),
+	)
+	for _, t := range targets {
+		results = append(results, checkTarget(t))
+	}
+
+	return results
+}
+
+func checkKernel() (kernelVersion, Result) {
+	result := Result{Check: "kernel version"}
+
+	var uname unix.Utsname
+	if err := unix.Uname(&uname); err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		return kernelVersion{}, result
+	}
+
+	release := unix.ByteSliceToString(uname.Release[:])
+	v, err := parseKernelRelease(release)
+	if err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		return kernelVersion{}, result
+	}
+
+	result.Detail = release
+	if !v.atLeast(minKernelVersion.major, minKernelVersion.minor) {
+		result.Status = Fail
+		result.Hint = fmt.Sprintf("uprobes are attached through the uprobe PMU, upgrade the kernel to %d.%d or newer", minKernelVersion.major, minKernelVersion.minor)
+		return v, result
+	}
+
+	result.Status = Pass
+	return v, result
+}
+
+// parseKernelRelease parses the major and minor versions of a kernel release,
+// e.g. 5.15.0-86-generic.
+func parseKernelRelease(release string) (kernelVersion, error) {
+	fields := strings.SplitN(release, ".", 3)
+	if len(fields) < 2 {
+		return kernelVersion{}, fmt.Errorf("unexpected kernel release %q", release)
+	}
+
+	major, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return kernelVersion{}, fmt.Errorf("unexpected kernel release %q", release)
+	}
+
+	// The minor version may be directly followed by a suffix, e.g. 4.19-rc1.
+	minor := fields[1]
+	if end := strings.IndexFunc(minor, func(r rune) bool { return r < '0' || r > '9' }); end >= 0 {
+		minor = minor[:end]
+	}
+	minorVersion, err := strconv.Atoi(minor)
+	if err != nil {
+		return kernelVersion{}, fmt.Errorf("unexpected kernel release %q", release)
+	}
+
+	return kernelVersion{major: major, minor: minorVersion}, nil
+}
+
+func checkUprobes() Result {
+	result := Result{Check: "uprobes"}
+	if _, err := os.Stat("/sys/bus/event_source/devices/uprobe/type"); err != nil {
+		result.Status = Fail
+		result.Detail = "uprobe PMU not found"
+		result.Hint = "the kernel needs CONFIG_UPROBE_EVENTS=y"
+		return result
+	}
+
+	result.Status = Pass
+	return result
+}
+
+func checkMapType(name string, mt ebpf.MapType, unsupported Status, hint string) Result {
+	result := Result{Check: name}
+
+	err := features.HaveMapType(mt)
+	switch {
+	case err == nil:
+		result.Status = Pass
+	case errors.Is(err, ebpf.ErrNotSupported):
+		result.Status, result.Detail, result.Hint = unsupported, "not supported by the kernel", hint
+	case errors.Is(err, unix.EPERM):
+		result.Status, result.Detail = Fail, err.Error()
+		result.Hint = "run the agent as root or grant it CAP_BPF and CAP_PERFMON (CAP_SYS_ADMIN before kernel 5.8)"
+	default:
+		result.Status, result.Detail = Fail, err.Error()
+	}
+
+	return result
+}
+
+// capabilities is a set of effective capabilities.
+type capabilities struct {
+	effective *big.Int
+}
+
+func (c capabilities) has(capability int) bool {
+	return c.effective != nil && c.effective.Bit(capability) == 1
+}
+
+func readCapabilities() (capabilities, error) {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return capabilities{}, err
+	}
+
+	return parseCapabilities(string(status))
+}
+
+// parseCapabilities parses the effective capabilities of a /proc/<pid>/status
+// file.
+func parseCapabilities(status string) (capabilities, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, "CapEff:") {
+			continue
+		}
+
+		val := strings.TrimSpace(strings.TrimPrefix(line, "CapEff:"))
+		effective, ok := new(big.Int).SetString(val, 16)
+		if !ok {
+			return capabilities{}, fmt.Errorf("unexpected effective capabilities %q", val)
+		}
+		return capabilities{effective: effective}, nil
+	}
+
+	return capabilities{}, errors.New("effective capabilities not found")
+}
+
+func checkCapabilities(caps capabilities, err error) []Result {
+	if err != nil {
+		return []Result{{Check: "capabilities", Status: Fail, Detail: err.Error()}}
+	}
+
+	type capabilityCheck struct {
+		name   string
+		holds  bool
+		status Status
+		hint   string
+	}
+	checks := []capabilityCheck{
+		{
+			name:   "CAP_BPF",
+			holds:  caps.has(unix.CAP_BPF) || caps.has(unix.CAP_SYS_ADMIN),
+			status: Fail,
+			hint:   "grant CAP_BPF, or CAP_SYS_ADMIN before kernel 5.8, to load eBPF programs",
+		},
+		{
+			name:   "CAP_PERFMON",
+			holds:  caps.has(unix.CAP_PERFMON) || caps.has(unix.CAP_SYS_ADMIN),
+			status: Fail,
+			hint:   "grant CAP_PERFMON, or CAP_SYS_ADMIN before kernel 5.8, to attach uprobes",
+		},
+		{
+			name:   "CAP_SYS_PTRACE",
+			holds:  caps.has(unix.CAP_SYS_PTRACE),
+			status: Fail,
+			hint:   "grant CAP_SYS_PTRACE to allocate memory in the target process",
+		},
+		{
+			name:   "CAP_NET_ADMIN",
+			holds:  caps.has(unix.CAP_NET_ADMIN),
+			status: Warn,
+			hint:   "grant CAP_NET_ADMIN to discover processes as they start instead of polling",
+		},
+	}
+
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		result := Result{Check: "capability " + c.name, Status: Pass}
+		if !c.holds {
+			result.Status, result.Detail, result.Hint = c.status, "missing", c.hint
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func checkBPFFS(caps capabilities) Result {
+	result := Result{Check: "bpffs"}
+
+	var stat unix.Statfs_t
+	if err := unix.Statfs(bpfFsPath, &stat); err == nil && stat.Type == unix.BPF_FS_MAGIC {
+		result.Status, result.Detail = Pass, "mounted at "+bpfFsPath
+		return result
+	}
+
+	result.Detail = "not mounted at " + bpfFsPath
+	if caps.has(unix.CAP_SYS_ADMIN) {
+		result.Status = Warn
+		result.Hint = "the agent mounts it on start, or mount it with: mount -t bpf bpf " + bpfFsPath
+		return result
+	}
+
+	result.Status = Fail
+	result.Hint = "mount it with: mount -t bpf bpf " + bpfFsPath + ", or grant the agent CAP_SYS_ADMIN"
+	return result
+}
+
+func checkMemlock(kernel kernelVersion, caps capabilities) Result {
+	result := Result{Check: "memlock rlimit"}
+
+	// Since kernel 5.11, eBPF memory is accounted to the memory cgroup
+	// instead of the memlock rlimit.
+	if kernel.atLeast(5, 11) {
+		result.Status, result.Detail = Pass, "not used by kernel"
+		return result
+	}
+
+	var limit unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_MEMLOCK, &limit); err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		return result
+	}
+
+	if limit.Cur == unix.RLIM_INFINITY {
+		result.Status, result.Detail = Pass, "unlimited"
+		return result
+	}
+
+	result.Detail = fmt.Sprintf("%d bytes", limit.Cur)
+	if limit.Max == unix.RLIM_INFINITY || caps.has(unix.CAP_SYS_RESOURCE) {
+		result.Status = Pass
+		return result
+	}
+
+	result.Status = Fail
+	result.Hint = "run the agent with ulimit -l unlimited, or grant it CAP_SYS_RESOURCE"
+	return result
+}
+
+func checkPtraceScope(caps capabilities) Result {
+	result := Result{Check: "ptrace scope"}
+
+	raw, err := os.ReadFile("/proc/sys/kernel/yama/ptrace_scope")
+	if err != nil {
+		result.Status, result.Detail = Pass, "Yama not enabled"
+		return result
+	}
+
+	scope := strings.TrimSpace(string(raw))
+	result.Detail = "kernel.yama.ptrace_scope=" + scope
+	switch scope {
+	case "0", "1":
+		result.Status = Pass
+	case "2":
+		if caps.has(unix.CAP_SYS_PTRACE) {
+			result.Status = Pass
+		} else {
+			result.Status = Fail
+			result.Hint = "grant the agent CAP_SYS_PTRACE, as only admins may ptrace"
+		}
+	default:
+		result.Status = Fail
+		result.Hint = "ptrace is disabled until reboot, set kernel.yama.ptrace_scope below 3 at boot"
+	}
+
+	return result
+}
+
+func checkTarget(target *process.TargetArgs) Result {
+	result := Result{Check: "target " + target.String()}
+
+	if err := target.Validate(); err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		return result
+	}
+
+	pids, err := process.FindProcessIDs(target)
+	if err != nil {
+		result.Status, result.Detail = Fail, err.Error()
+		return result
+	}
+
+	switch len(pids) {
+	case 0:
+		result.Status, result.Detail = Warn, "no running process matches"
+		result.Hint = "the agent waits for the process to start"
+		return result
+	case 1:
+	default:
+		result.Status, result.Detail = Fail, fmt.Sprintf("pids %v match", pids)
+		result.Hint = "narrow down the target selectors so a single process matches"
+		return result
+	}
+
+	details, err := process.AnalyzeFile(fmt.Sprintf("/proc/%d/exe", pids[0]), nil)
+	if err != nil {
+		result.Status, result.Detail = Fail, fmt.Sprintf("pid %d: %s", pids[0], err)
+		result.Hint = "the agent needs to read the executable of the target, run it as root or as the owner of the target"
+		return result
+	}
+
+	result.Status = Pass
+	result.Detail = fmt.Sprintf("pid %d, go%s", pids[0], details.GoVersion.Original())
+	return result
+}
@@ -0,0 +1,84 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package doctor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseKernelRelease(t *testing.T) {
+	tests := []struct {
+		release string
+		want    kernelVersion
+	}{
+		{"5.15.0-86-generic", kernelVersion{5, 15}},
+		{"4.4.0", kernelVersion{4, 4}},
+		{"6.1", kernelVersion{6, 1}},
+		{"4.19-rc1", kernelVersion{4, 19}},
+	}
+
+	for _, tt := range tests {
+		got, err := parseKernelRelease(tt.release)
+		require.NoError(t, err, tt.release)
+		assert.Equal(t, tt.want, got, tt.release)
+	}
+
+	_, err := parseKernelRelease("linux")
+	assert.Error(t, err)
+}
+
+func TestKernelVersionAtLeast(t *testing.T) {
+	assert.True(t, kernelVersion{4, 4}.atLeast(4, 4))
+	assert.True(t, kernelVersion{5, 0}.atLeast(4, 19))
+	assert.False(t, kernelVersion{4, 3}.atLeast(4, 4))
+	assert.False(t, kernelVersion{3, 19}.atLeast(4, 4))
+}
+
+func TestParseCapabilities(t *testing.T) {
+	status := "Name:\tagent\nCapInh:\t0000000000000000\nCapPrm:\t000001ffffffffff\n" +
+		"CapEff:\t000000c000080000\nCapBnd:\t000001ffffffffff\n"
+
+	caps, err := parseCapabilities(status)
+	require.NoError(t, err)
+	assert.True(t, caps.has(unix.CAP_BPF))
+	assert.True(t, caps.has(unix.CAP_PERFMON))
+	assert.True(t, caps.has(unix.CAP_SYS_PTRACE))
+	assert.False(t, caps.has(unix.CAP_SYS_ADMIN))
+	assert.False(t, caps.has(unix.CAP_NET_ADMIN))
+
+	_, err = parseCapabilities("Name:\tagent\n")
+	assert.Error(t, err)
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	caps, err := parseCapabilities("CapEff:\t0000000000200000\n")
+	require.NoError(t, err)
+
+	statuses := make(map[string]Status)
+	for _, r := range checkCapabilities(caps, nil) {
+		statuses[r.Check] = r.Status
+	}
+
+	assert.Equal(t, map[string]Status{
+		"capability CAP_BPF":        Pass,
+		"capability CAP_PERFMON":    Pass,
+		"capability CAP_SYS_PTRACE": Fail,
+		"capability CAP_NET_ADMIN":  Warn,
+	}, statuses)
+}
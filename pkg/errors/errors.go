@@ -27,4 +27,12 @@ var (
 	// ErrProcessNotFound is returned when a requested process is not currently
 	// running.
 	ErrProcessNotFound = errors.New("process not found")
+
+	// ErrMultipleProcessesFound is returned when more than one running
+	// process matches a requested process.
+	ErrMultipleProcessesFound = errors.New("more than one process found")
+
+	// ErrProcessExited is returned when an instrumented process exits while
+	// it is still being instrumented.
+	ErrProcessExited = errors.New("process exited")
 )
@@ -22,10 +22,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"runtime"
+	"strings"
 
 	"github.com/hashicorp/go-version"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
 
 	"go.opentelemetry.io/auto/pkg/log"     // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/process" // nolint:staticcheck  // Atomic deprecation.
@@ -42,6 +44,51 @@ type Injector struct {
 	isRegAbi          bool
 	TotalCPUs         uint32
 	AllocationDetails *process.AllocationDetails
+
+	samplingThreshold   uint64
+	kernelSampling      bool
+	propagators         uint32
+	parentBasedSampling bool
+	observeOnly         bool
+}
+
+// samplingThresholdVar is the constant of the eBPF programs below which the
+// trace IDs, read as by the traceidratio sampler, are sampled.
+const samplingThresholdVar = "sampling_threshold"
+
+// kernelSamplingVar is the constant of the eBPF programs set if they drop the
+// spans of the traces not sampled.
+const kernelSamplingVar = "kernel_sampling"
+
+// sampleAll is the sampling threshold of a ratio of 1.
+const sampleAll = 1 << 63
+
+// eventsMap is the map the eBPF programs emitting spans send them through.
+const eventsMap = "events"
+
+const (
+	// propagatorsVar is the constant of the eBPF programs whose bits select
+	// the formats the trace context is extracted from and injected with.
+	propagatorsVar = "propagators"
+	// parentBasedSamplingVar is the constant of the eBPF programs set if the
+	// sampled flag of the remote parents decides for their traces.
+	parentBasedSamplingVar = "parent_based_sampling"
+	// observeOnlyVar is the constant of the eBPF programs set if they are
+	// not to write into the memory of the target.
+	observeOnlyVar = "observe_only"
+	// injectionPoliciesMap is the map of the header injection policy,
+	// declared by the eBPF programs writing the trace context into the
+	// target.
+	injectionPoliciesMap = "injection_policies"
+)
+
+// propagatorBits are the bits of the propagators constant of the eBPF
+// programs, as defined in propagation.h.
+var propagatorBits = map[string]uint32{
+	"tracecontext": 1 << 0,
+	"b3":           1 << 1,
+	"b3multi":      1 << 2,
+	"jaeger":       1 << 3,
 }
 
 // New returns an [Injector] configured for the target.
@@ -57,9 +104,53 @@ func New(target *process.TargetDetails) (*Injector, error) {
 		isRegAbi:          target.IsRegistersABI(),
 		TotalCPUs:         uint32(runtime.NumCPU()),
 		AllocationDetails: target.AllocationDetails,
+		samplingThreshold: sampleAll,
+		propagators:       propagatorBits["tracecontext"],
 	}, nil
 }
 
+// SampleRatio makes the eBPF programs injected by i sample a ratio of the
+// traces, decided on their trace IDs as the traceidratio sampler does. The
+// decision is the sampled flag of the trace context they inject.
+func (i *Injector) SampleRatio(ratio float64) {
+	switch {
+	case ratio >= 1:
+		i.samplingThreshold = sampleAll
+	case ratio <= 0:
+		i.samplingThreshold = 0
+	default:
+		i.samplingThreshold = uint64(ratio * sampleAll)
+	}
+}
+
+// KernelSampling makes the eBPF programs injected by i drop the spans of the
+// traces not sampled, if enabled, instead of emitting them all.
+func (i *Injector) KernelSampling(enabled bool) {
+	i.kernelSampling = enabled
+}
+
+// Propagators makes the eBPF programs injected by i extract the trace context
+// from, and inject it with, the formats names. The names unknown to the eBPF
+// programs are ignored.
+func (i *Injector) Propagators(names []string) {
+	i.propagators = 0
+	for _, name := range names {
+		i.propagators |= propagatorBits[name]
+	}
+}
+
+// ParentBasedSampling makes the eBPF programs injected by i sample the traces
+// with a remote parent as the parent was, if enabled.
+func (i *Injector) ParentBasedSampling(enabled bool) {
+	i.parentBasedSampling = enabled
+}
+
+// ObserveOnly keeps the eBPF programs injected by i from writing into the
+// memory of the target, if enabled.
+func (i *Injector) ObserveOnly(enabled bool) {
+	i.observeOnly = enabled
+}
+
 type loadBpfFunc func() (*ebpf.CollectionSpec, error)
 
 // StructField is the definition of a structure field for which instrumentation
@@ -94,7 +185,7 @@ func (i *Injector) Inject(loadBpf loadBpfFunc, library string, libVersion string
 		}
 	}
 
-	if err := i.addCommonInjections(injectedVars, initAlloc); err != nil {
+	if err := i.addCommonInjections(spec, injectedVars, initAlloc); err != nil {
 		return nil, fmt.Errorf("adding instrumenter injections: %w", err)
 	}
 
@@ -113,19 +204,68 @@ func (i *Injector) Inject(loadBpf loadBpfFunc, library string, libVersion string
 	return spec, nil
 }
 
-func (i *Injector) addCommonInjections(varsMap map[string]interface{}, initAlloc bool) error { // nolint:revive  // initAlloc is a control flag.
+func (i *Injector) addCommonInjections(spec *ebpf.CollectionSpec, varsMap map[string]interface{}, initAlloc bool) error { // nolint:revive  // initAlloc is a control flag.
 	varsMap["is_registers_abi"] = i.isRegAbi
+	if declaresConstant(spec, samplingThresholdVar) {
+		varsMap[samplingThresholdVar] = i.samplingThreshold
+	}
+	// only the programs emitting spans declare the kernel sampling, which
+	// they must if the traces are sampled in the kernel
+	if declaresConstant(spec, kernelSamplingVar) {
+		varsMap[kernelSamplingVar] = i.kernelSampling
+	} else if _, emitsSpans := spec.Maps[eventsMap]; emitsSpans && i.kernelSampling {
+		return fmt.Errorf("the eBPF programs do not declare %s, their traces cannot be sampled", kernelSamplingVar)
+	}
+	if declaresConstant(spec, parentBasedSamplingVar) {
+		varsMap[parentBasedSamplingVar] = i.parentBasedSampling
+	}
+	if declaresConstant(spec, propagatorsVar) {
+		varsMap[propagatorsVar] = i.propagators
+	}
+	// the programs writing into the target must honor the observe-only mode
+	if declaresConstant(spec, observeOnlyVar) {
+		varsMap[observeOnlyVar] = i.observeOnly
+	} else if _, writes := spec.Maps[injectionPoliciesMap]; writes && i.observeOnly {
+		return fmt.Errorf("the eBPF programs do not declare %s, they cannot run in observe-only mode", observeOnlyVar)
+	}
 	if initAlloc {
-		if i.AllocationDetails == nil {
+		varsMap["total_cpus"] = i.TotalCPUs
+		switch {
+		case i.AllocationDetails != nil:
+			varsMap["start_addr"] = i.AllocationDetails.StartAddr
+			varsMap["end_addr"] = i.AllocationDetails.EndAddr
+		case i.observeOnly:
+			// no memory is allocated in the target in observe-only mode, an
+			// empty area leaves nothing to write to
+			varsMap["start_addr"] = uint64(0)
+			varsMap["end_addr"] = uint64(0)
+		default:
 			return fmt.Errorf("couldn't get process allocation details. Try running it from the KeyVal Launcher")
 		}
-		varsMap["total_cpus"] = i.TotalCPUs
-		varsMap["start_addr"] = i.AllocationDetails.StartAddr
-		varsMap["end_addr"] = i.AllocationDetails.EndAddr
 	}
 	return nil
 }
 
+// declaresConstant returns whether the programs of spec declare the constant
+// name, which can only be rewritten if declared.
+func declaresConstant(spec *ebpf.CollectionSpec, name string) bool {
+	for secName, m := range spec.Maps {
+		if !strings.HasPrefix(secName, ".rodata") {
+			continue
+		}
+		ds, ok := m.Value.(*btf.Datasec)
+		if !ok {
+			continue
+		}
+		for _, v := range ds.Vars {
+			if v.Type.TypeName() == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (i *Injector) addConfigInjections(varsMap map[string]interface{}, flagFields []*FlagField) error {
 	for _, dm := range flagFields {
 		varsMap[dm.VarName] = dm.Value
@@ -133,6 +273,24 @@ func (i *Injector) addConfigInjections(varsMap map[string]interface{}, flagField
 	return nil
 }
 
+// MissingFields returns the fields whose offsets are not tracked for the given
+// version of their library. All fields are missing if libVersion is not a
+// valid version.
+func (i *Injector) MissingFields(libVersion string, fields []*StructField) []*StructField {
+	if _, err := version.NewVersion(libVersion); err != nil {
+		return fields
+	}
+
+	var missing []*StructField
+	for _, f := range fields {
+		if _, found := i.getFieldOffset(f.StructName, f.Field, libVersion); !found {
+			missing = append(missing, f)
+		}
+	}
+
+	return missing
+}
+
 func (i *Injector) getFieldOffset(structName string, fieldName string, libVersion string) (uint64, bool) {
 	strct, ok := i.data.Data[structName]
 	if !ok {
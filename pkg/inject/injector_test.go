@@ -15,10 +15,16 @@
 package inject
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"math/rand"
 	"testing"
 
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
 
 	"github.com/stretchr/testify/require"
 )
@@ -92,3 +98,154 @@ func TestGetFieldOffset_OffsetResultsJSON(t *testing.T) {
 	offset, ok = injector.getFieldOffset("net/url.URL", "Foo", "1.15.0")
 	assert.Falsef(t, ok, "found: %d", int(offset))
 }
+
+func TestMissingFields(t *testing.T) {
+	injector := Injector{data: &TrackedOffsets{}}
+	err := json.Unmarshal([]byte(offsetsData), injector.data)
+	require.NoError(t, err)
+
+	goid := &StructField{VarName: "goid_pos", StructName: "runtime.g", Field: "goid"}
+	unknown := &StructField{VarName: "unknown_pos", StructName: "runtime.g", Field: "unknown"}
+
+	assert.Empty(t, injector.MissingFields("1.20.0", []*StructField{goid}))
+	assert.Equal(t, []*StructField{unknown}, injector.MissingFields("1.20.0", []*StructField{goid, unknown}))
+	assert.Equal(t, []*StructField{goid}, injector.MissingFields("", []*StructField{goid}))
+}
+
+// rodataSizes are the sizes of the constants of rodataSpec not 8 bytes long.
+var rodataSizes = map[string]uint32{
+	propagatorsVar:         4,
+	parentBasedSamplingVar: 1,
+	kernelSamplingVar:      1,
+	observeOnlyVar:         1,
+	"total_cpus":           4,
+}
+
+// rodataSpec returns a collection whose programs declare is_registers_abi
+// and the constants vars, each in its own 8-byte slot.
+func rodataSpec(vars ...string) *ebpf.CollectionSpec {
+	ds := &btf.Datasec{Name: ".rodata", Size: uint32(8 * (len(vars) + 1))}
+	ds.Vars = append(ds.Vars, btf.VarSecinfo{
+		Type: &btf.Var{Name: "is_registers_abi", Type: &btf.Int{Size: 1}},
+		Size: 1,
+	})
+	for i, name := range vars {
+		size, ok := rodataSizes[name]
+		if !ok {
+			size = 8
+		}
+		ds.Vars = append(ds.Vars, btf.VarSecinfo{
+			Type:   &btf.Var{Name: name, Type: &btf.Int{Size: size}},
+			Offset: uint32(8 * (i + 1)),
+			Size:   size,
+		})
+	}
+	return &ebpf.CollectionSpec{Maps: map[string]*ebpf.MapSpec{
+		".rodata": {
+			Name:       ".rodata",
+			Type:       ebpf.Array,
+			KeySize:    4,
+			MaxEntries: 1,
+			Value:      ds,
+			Contents:   []ebpf.MapKV{{Key: uint32(0), Value: make([]byte, ds.Size)}},
+		},
+	}}
+}
+
+func TestInjectSamplingThreshold(t *testing.T) {
+	injector := Injector{data: &TrackedOffsets{}, samplingThreshold: sampleAll}
+	injector.SampleRatio(0.25)
+
+	spec, err := injector.Inject(func() (*ebpf.CollectionSpec, error) {
+		return rodataSpec(samplingThresholdVar, kernelSamplingVar), nil
+	}, "go", "1.20.0", nil, nil, false)
+	require.NoError(t, err)
+	rodata := spec.Maps[".rodata"].Contents[0].Value.([]byte)
+	// the threshold decides the sampled flag injected without kernel sampling
+	assert.Equal(t, uint64(1<<61), binary.LittleEndian.Uint64(rodata[8:]))
+	assert.Equal(t, byte(0), rodata[16])
+
+	// the programs not emitting spans do not declare the kernel sampling
+	injector.KernelSampling(true)
+	_, err = injector.Inject(func() (*ebpf.CollectionSpec, error) {
+		return rodataSpec(), nil
+	}, "go", "1.20.0", nil, nil, false)
+	assert.NoError(t, err)
+
+	// those emitting spans must
+	_, err = injector.Inject(func() (*ebpf.CollectionSpec, error) {
+		spec := rodataSpec()
+		spec.Maps[eventsMap] = &ebpf.MapSpec{Name: eventsMap, Type: ebpf.PerfEventArray}
+		return spec, nil
+	}, "go", "1.20.0", nil, nil, false)
+	assert.ErrorContains(t, err, kernelSamplingVar)
+}
+
+func TestSampleRatioMatchesSampler(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, ratio := range []float64{0, 0.1, 0.5, 1} {
+		injector := Injector{}
+		injector.SampleRatio(ratio)
+		sampler := trace.TraceIDRatioBased(ratio)
+
+		for i := 0; i < 1000; i++ {
+			var tid oteltrace.TraceID
+			rnd.Read(tid[:])
+			want := sampler.ShouldSample(trace.SamplingParameters{TraceID: tid}).Decision == trace.RecordAndSample
+			// as trace_sampled of the eBPF programs
+			got := binary.BigEndian.Uint64(tid[8:])>>1 < injector.samplingThreshold
+			assert.Equal(t, want, got, "ratio %v, trace %s", ratio, tid)
+		}
+	}
+}
+
+func TestInjectPropagation(t *testing.T) {
+	injector := Injector{data: &TrackedOffsets{}}
+	injector.Propagators([]string{"b3", "jaeger", "unknown"})
+	injector.ParentBasedSampling(true)
+	injector.ObserveOnly(true)
+
+	spec, err := injector.Inject(func() (*ebpf.CollectionSpec, error) {
+		return rodataSpec(propagatorsVar, parentBasedSamplingVar, observeOnlyVar), nil
+	}, "go", "1.20.0", nil, nil, false)
+	require.NoError(t, err)
+	rodata := spec.Maps[".rodata"].Contents[0].Value.([]byte)
+	assert.Equal(t, uint32(0b1010), binary.LittleEndian.Uint32(rodata[8:]))
+	assert.Equal(t, byte(1), rodata[16])
+	assert.Equal(t, byte(1), rodata[24])
+
+	// the programs not propagating the context do not declare the formats
+	_, err = injector.Inject(func() (*ebpf.CollectionSpec, error) {
+		return rodataSpec(), nil
+	}, "go", "1.20.0", nil, nil, false)
+	assert.NoError(t, err)
+}
+
+func TestInjectObserveOnly(t *testing.T) {
+	injector := Injector{data: &TrackedOffsets{}}
+	injector.ObserveOnly(true)
+
+	writingSpec := func(constants ...string) func() (*ebpf.CollectionSpec, error) {
+		return func() (*ebpf.CollectionSpec, error) {
+			spec := rodataSpec(constants...)
+			spec.Maps[injectionPoliciesMap] = &ebpf.MapSpec{Name: injectionPoliciesMap, Type: ebpf.Hash}
+			return spec, nil
+		}
+	}
+
+	// no memory is allocated in the target to write to
+	spec, err := injector.Inject(writingSpec(observeOnlyVar, "total_cpus", "start_addr", "end_addr"), "go", "1.20.0", nil, nil, true)
+	require.NoError(t, err)
+	rodata := spec.Maps[".rodata"].Contents[0].Value.([]byte)
+	assert.Equal(t, byte(1), rodata[8])
+	assert.Equal(t, uint64(0), binary.LittleEndian.Uint64(rodata[24:]))
+	assert.Equal(t, uint64(0), binary.LittleEndian.Uint64(rodata[32:]))
+
+	// the programs writing into the target must be able to refrain from it
+	_, err = injector.Inject(writingSpec(), "go", "1.20.0", nil, nil, false)
+	assert.ErrorContains(t, err, observeOnlyVar)
+
+	injector.ObserveOnly(false)
+	_, err = injector.Inject(writingSpec(), "go", "1.20.0", nil, nil, true)
+	assert.Error(t, err, "memory must be allocated in the target")
+}
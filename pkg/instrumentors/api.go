@@ -31,9 +31,24 @@ type Instrumentor interface {
 	// Load loads all instrumentation offsets.
 	Load(ctx *context.InstrumentorContext) error
 
-	// Run runs the events processing loop.
+	// Run runs the events processing loop. It returns once the
+	// Instrumentor is closed and the records left in its perf readers are
+	// pushed to the event queue.
 	Run(eventsChan chan<- *events.Event)
 
 	// Close stops the Instrumentor.
 	Close()
 }
+
+// OptionalFuncsInstrumentor is implemented by the instrumentors of libraries
+// whose instrumented functions are used independently of each other, as the
+// producer and consumer sides of a messaging client. Such an instrumentor is
+// run if any of its functions is found in the target, and only instruments
+// the functions found.
+type OptionalFuncsInstrumentor interface {
+	Instrumentor
+
+	// FuncsOptional reports whether each of the functions of the
+	// instrumentor is optional.
+	FuncsOptional() bool
+}
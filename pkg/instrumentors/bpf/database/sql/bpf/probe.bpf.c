@@ -24,93 +24,361 @@ char __license[] SEC("license") = "Dual MIT/GPL";
 #define MAX_QUERY_SIZE 100
 #define MAX_CONCURRENT 50
 
+#define KIND_QUERY 0
+#define KIND_EXEC 1
+#define KIND_STMT_QUERY 2
+#define KIND_STMT_EXEC 3
+#define KIND_BEGIN 4
+#define KIND_COMMIT 5
+#define KIND_ROLLBACK 6
+
 struct sql_request_t {
     BASE_SPAN_PROPERTIES
     char query[MAX_QUERY_SIZE];
+    u32 kind;
     u64 goid;
+    u32 failed;
+    u32 in_tx;
 };
 
 struct {
 	__uint(type, BPF_MAP_TYPE_HASH);
-	__type(key, void*);
+	__type(key, u64);
 	__type(value, struct sql_request_t);
 	__uint(max_entries, MAX_CONCURRENT);
 } sql_events SEC(".maps");
 
+// The transactions begun, by *Tx. The transactions the application never
+// ends are evicted.
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__type(key, void*);
+	__type(value, struct sql_request_t);
+	__uint(max_entries, MAX_CONCURRENT);
+} tx_spans SEC(".maps");
+
+// The span contexts of the transactions begun, by the *driverConn they own
+// until their end.
+struct {
+	__uint(type, BPF_MAP_TYPE_LRU_HASH);
+	__type(key, void*);
+	__type(value, struct span_context);
+	__uint(max_entries, MAX_CONCURRENT);
+} tx_conns SEC(".maps");
+
 struct {
 	__uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
 } events SEC(".maps");
 
 // Injected in init
 volatile const bool should_include_db_statement;
+volatile const u64 stmt_query_pos;
+volatile const u64 stmt_cg_pos;
+volatile const u64 tx_dc_pos;
 
-// This instrumentation attaches uprobe to the following function:
-// func (db *DB) queryDC(ctx, txctx context.Context, dc *driverConn, releaseConn func(error), query string, args []any)
-SEC("uprobe/queryDC")
-int uprobe_queryDC(struct pt_regs *ctx) {
-    // argument positions
-    u64 context_ptr_pos = 3;
-    u64 query_str_ptr_pos = 8;
-    u64 query_str_len_pos = 9;
+static __always_inline void read_query(struct sql_request_t *sql_request, void *query_str_ptr, u64 query_str_len)
+{
+    if (!should_include_db_statement) {
+        return;
+    }
+    u64 query_size = MAX_QUERY_SIZE < query_str_len ? MAX_QUERY_SIZE : query_str_len;
+    bpf_probe_read(sql_request->query, query_size, query_str_ptr);
+}
 
-    struct sql_request_t sql_request = {0};
-    sql_request.start_time = bpf_ktime_get_ns();
-
-    if (should_include_db_statement) {
-        // Read Query string
-        void *query_str_ptr = get_argument(ctx, query_str_ptr_pos);
-        u64 query_str_len = (u64)get_argument(ctx, query_str_len_pos);
-        u64 query_size = MAX_QUERY_SIZE < query_str_len ? MAX_QUERY_SIZE : query_str_len;
-        bpf_probe_read(sql_request.query, query_size, query_str_ptr);
+// Starts the span of sql_request, child of the transaction tx_sc it is part
+// of, or else of the span of the context context_ptr_val or of the
+// goroutine.
+static __always_inline void start_sql_request(struct pt_regs *ctx, struct sql_request_t *sql_request, void *context_ptr_val, struct span_context *tx_sc)
+{
+    sql_request->start_time = bpf_ktime_get_ns();
+    sql_request->goid = get_current_goroutine();
+
+    if (tx_sc != NULL) {
+        sql_request->in_tx = 1;
+        bpf_probe_read(&sql_request->psc, sizeof(sql_request->psc), tx_sc);
+        copy_byte_arrays(sql_request->psc.TraceID, sql_request->sc.TraceID, TRACE_ID_SIZE);
+        generate_random_bytes(sql_request->sc.SpanID, SPAN_ID_SIZE);
+        return;
     }
 
     // Get parent if exists
-    void *context_ptr = get_argument(ctx, context_ptr_pos);
-    void *context_ptr_val = 0;
-    bpf_probe_read(&context_ptr_val, sizeof(context_ptr_val), context_ptr);
     struct span_context *span_ctx = get_parent_span_context(context_ptr_val);
-
-    u64 goid = get_current_goroutine();
-    void* same_goroutine_sc_ptr = bpf_map_lookup_elem(&goroutine_sc_map, &goid);
+    void* same_goroutine_sc_ptr = bpf_map_lookup_elem(&goroutine_sc_map, &sql_request->goid);
 
     if (span_ctx != NULL) {
         // Set the parent context
-        bpf_probe_read(&sql_request.psc, sizeof(sql_request.psc), span_ctx);
-        copy_byte_arrays(sql_request.psc.TraceID, sql_request.sc.TraceID, TRACE_ID_SIZE);
-        generate_random_bytes(sql_request.sc.SpanID, SPAN_ID_SIZE);
+        bpf_probe_read(&sql_request->psc, sizeof(sql_request->psc), span_ctx);
+        copy_byte_arrays(sql_request->psc.TraceID, sql_request->sc.TraceID, TRACE_ID_SIZE);
+        generate_random_bytes(sql_request->sc.SpanID, SPAN_ID_SIZE);
     } else {
         if (same_goroutine_sc_ptr != NULL) {
             struct span_context sc = {};
             bpf_probe_read(&sc, sizeof(sc), same_goroutine_sc_ptr);
 
-            sql_request.psc = sc;
-            copy_byte_arrays(sql_request.psc.TraceID, sql_request.sc.TraceID, TRACE_ID_SIZE);
-            generate_random_bytes(sql_request.sc.SpanID, SPAN_ID_SIZE);
+            sql_request->psc = sc;
+            copy_byte_arrays(sql_request->psc.TraceID, sql_request->sc.TraceID, TRACE_ID_SIZE);
+            generate_random_bytes(sql_request->sc.SpanID, SPAN_ID_SIZE);
         } else {
-            sql_request.sc = generate_span_context();
+            sql_request->sc = generate_span_context();
         }
     }
 
-    sql_request.goid = get_current_goroutine();
-
     // send type 3 event
     struct gmap_t event3 = {};
 
-    event3.key = sql_request.goid;
-    event3.sc = sql_request.sc;
+    event3.key = sql_request->goid;
+    event3.sc = sql_request->sc;
     event3.type = GOID_SC;
-    event3.start_time = sql_request.start_time;
+    event3.start_time = sql_request->start_time;
 
     bpf_perf_event_output(ctx, &gmap_events, BPF_F_CURRENT_CPU, &event3, sizeof(event3));
+}
 
-    // Get key
-    void *key = get_consistent_key(ctx, context_ptr);
+// Reads the value of the context.Context argument at context_ptr_pos.
+static __always_inline void *context_value(struct pt_regs *ctx, u64 context_ptr_pos)
+{
+    void *context_ptr = get_argument(ctx, context_ptr_pos);
+    void *context_ptr_val = 0;
+    bpf_probe_read(&context_ptr_val, sizeof(context_ptr_val), context_ptr);
+    return context_ptr_val;
+}
+
+// Starts the span of a statement run on the connection dc.
+static __always_inline int start_statement(struct pt_regs *ctx, u32 kind, u64 context_ptr_pos, void *dc, void *query_str_ptr, u64 query_str_len)
+{
+    struct sql_request_t sql_request = {0};
+    sql_request.kind = kind;
+    read_query(&sql_request, query_str_ptr, query_str_len);
+
+    void *context_ptr_val = context_value(ctx, context_ptr_pos);
+    struct span_context *tx_sc = bpf_map_lookup_elem(&tx_conns, &dc);
+    start_sql_request(ctx, &sql_request, context_ptr_val, tx_sc);
 
-    bpf_map_update_elem(&sql_events, &key, &sql_request, 0);
+    bpf_map_update_elem(&sql_events, &sql_request.goid, &sql_request, 0);
     start_tracking_span(context_ptr_val, &sql_request.sc);
     return 0;
 }
 
-// This instrumentation attaches uprobe to the following function, but when function return:
+// Starts the span of the statement of a prepared Stmt.
+static __always_inline int start_stmt_statement(struct pt_regs *ctx, u32 kind)
+{
+    // argument positions
+    u64 stmt_pos = 1;
+    u64 context_ptr_pos = 3;
+
+    void *stmt_ptr = get_argument(ctx, stmt_pos);
+
+    struct sql_request_t sql_request = {0};
+    sql_request.kind = kind;
+    struct go_string query = {};
+    bpf_probe_read(&query, sizeof(query), stmt_ptr + stmt_query_pos);
+    read_query(&sql_request, query.str, query.len);
+
+    // a Stmt of a transaction grabs the connection of the transaction
+    struct go_iface cg = {};
+    bpf_probe_read(&cg, sizeof(cg), stmt_ptr + stmt_cg_pos);
+    struct span_context *tx_sc = NULL;
+    if (cg.data != NULL) {
+        struct sql_request_t *tx = bpf_map_lookup_elem(&tx_spans, &cg.data);
+        if (tx != NULL) {
+            tx_sc = &tx->sc;
+        }
+    }
+
+    void *context_ptr_val = context_value(ctx, context_ptr_pos);
+    start_sql_request(ctx, &sql_request, context_ptr_val, tx_sc);
+
+    bpf_map_update_elem(&sql_events, &sql_request.goid, &sql_request, 0);
+    start_tracking_span(context_ptr_val, &sql_request.sc);
+    return 0;
+}
+
+// Ends the span of the current goroutine, failed if the error returned at
+// err_pos is not nil.
+static __always_inline int end_sql_request(struct pt_regs *ctx, u64 err_pos)
+{
+    u64 goid = get_current_goroutine();
+    struct sql_request_t *sql_request = bpf_map_lookup_elem(&sql_events, &goid);
+    if (sql_request == NULL) {
+        return 0;
+    }
+
+    sql_request->failed = get_argument(ctx, err_pos) != NULL;
+    sql_request->end_time = bpf_ktime_get_ns();
+    sql_request->trace_flags = remote_trace_flags(&sql_request->sc);
+
+    if (span_sampled(&sql_request->sc, &sql_request->psc)) {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, sql_request, sizeof(*sql_request));
+    }
+    stop_tracking_span(&sql_request->sc);
+    bpf_map_delete_elem(&sql_events, &goid);
+    return 0;
+}
+
+// Moves the span of the transaction tx_ptr, ending with kind, to the spans of
+// the current goroutine.
+static __always_inline int end_tx(void *tx_ptr, u32 kind)
+{
+    struct sql_request_t *tx = bpf_map_lookup_elem(&tx_spans, &tx_ptr);
+    if (tx == NULL) {
+        return 0;
+    }
+    tx->kind = kind;
+
+    u64 goid = get_current_goroutine();
+    bpf_map_update_elem(&sql_events, &goid, tx, 0);
+    bpf_map_delete_elem(&tx_spans, &tx_ptr);
+
+    void *dc = NULL;
+    bpf_probe_read(&dc, sizeof(dc), tx_ptr + tx_dc_pos);
+    bpf_map_delete_elem(&tx_conns, &dc);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the following function:
 // func (db *DB) queryDC(ctx, txctx context.Context, dc *driverConn, releaseConn func(error), query string, args []any)
-UPROBE_RETURN(queryDC, struct sql_request_t, 3, 0, sql_events, events)
\ No newline at end of file
+SEC("uprobe/queryDC")
+int uprobe_queryDC(struct pt_regs *ctx) {
+    // argument positions
+    u64 context_ptr_pos = 3;
+    u64 dc_pos = 6;
+    u64 query_str_ptr_pos = 8;
+    u64 query_str_len_pos = 9;
+
+    void *dc = get_argument(ctx, dc_pos);
+    void *query_str_ptr = get_argument(ctx, query_str_ptr_pos);
+    u64 query_str_len = (u64)get_argument(ctx, query_str_len_pos);
+    return start_statement(ctx, KIND_QUERY, context_ptr_pos, dc, query_str_ptr, query_str_len);
+}
+
+// This instrumentation attaches uprobe to the following function, but when function return:
+// func (db *DB) queryDC(ctx, txctx context.Context, dc *driverConn, releaseConn func(error), query string, args []any) (*Rows, error)
+SEC("uprobe/queryDC")
+int uprobe_queryDC_Returns(struct pt_regs *ctx) {
+    return end_sql_request(ctx, is_registers_abi ? 2 : 14);
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (db *DB) execDC(ctx context.Context, dc *driverConn, release func(error), query string, args []any)
+SEC("uprobe/execDC")
+int uprobe_execDC(struct pt_regs *ctx) {
+    // argument positions
+    u64 context_ptr_pos = 3;
+    u64 dc_pos = 4;
+    u64 query_str_ptr_pos = 6;
+    u64 query_str_len_pos = 7;
+
+    void *dc = get_argument(ctx, dc_pos);
+    void *query_str_ptr = get_argument(ctx, query_str_ptr_pos);
+    u64 query_str_len = (u64)get_argument(ctx, query_str_len_pos);
+    return start_statement(ctx, KIND_EXEC, context_ptr_pos, dc, query_str_ptr, query_str_len);
+}
+
+// This instrumentation attaches uprobe to the following function, but when function return:
+// func (db *DB) execDC(ctx context.Context, dc *driverConn, release func(error), query string, args []any) (res Result, err error)
+SEC("uprobe/execDC")
+int uprobe_execDC_Returns(struct pt_regs *ctx) {
+    return end_sql_request(ctx, is_registers_abi ? 3 : 13);
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (s *Stmt) QueryContext(ctx context.Context, args ...any) (*Rows, error)
+SEC("uprobe/Stmt_QueryContext")
+int uprobe_Stmt_QueryContext(struct pt_regs *ctx) {
+    return start_stmt_statement(ctx, KIND_STMT_QUERY);
+}
+
+// This instrumentation attaches uprobe to the following function, but when function return:
+// func (s *Stmt) QueryContext(ctx context.Context, args ...any) (*Rows, error)
+SEC("uprobe/Stmt_QueryContext")
+int uprobe_Stmt_QueryContext_Returns(struct pt_regs *ctx) {
+    return end_sql_request(ctx, is_registers_abi ? 2 : 8);
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (s *Stmt) ExecContext(ctx context.Context, args ...any) (Result, error)
+SEC("uprobe/Stmt_ExecContext")
+int uprobe_Stmt_ExecContext(struct pt_regs *ctx) {
+    return start_stmt_statement(ctx, KIND_STMT_EXEC);
+}
+
+// This instrumentation attaches uprobe to the following function, but when function return:
+// func (s *Stmt) ExecContext(ctx context.Context, args ...any) (Result, error)
+SEC("uprobe/Stmt_ExecContext")
+int uprobe_Stmt_ExecContext_Returns(struct pt_regs *ctx) {
+    return end_sql_request(ctx, is_registers_abi ? 3 : 9);
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (db *DB) BeginTx(ctx context.Context, opts *TxOptions) (*Tx, error)
+SEC("uprobe/BeginTx")
+int uprobe_BeginTx(struct pt_regs *ctx) {
+    // argument positions
+    u64 context_ptr_pos = 3;
+
+    struct sql_request_t sql_request = {0};
+    sql_request.kind = KIND_BEGIN;
+    // the context of the transaction is not tracked, as the span ends with
+    // Commit or Rollback, past the use of the context by the application
+    start_sql_request(ctx, &sql_request, context_value(ctx, context_ptr_pos), NULL);
+
+    bpf_map_update_elem(&sql_events, &sql_request.goid, &sql_request, 0);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the following function, but when function return:
+// func (db *DB) BeginTx(ctx context.Context, opts *TxOptions) (*Tx, error)
+SEC("uprobe/BeginTx")
+int uprobe_BeginTx_Returns(struct pt_regs *ctx) {
+    void *tx_ptr = get_argument(ctx, is_registers_abi ? 1 : 5);
+    void *err_ptr = get_argument(ctx, is_registers_abi ? 2 : 6);
+    if (err_ptr != NULL || tx_ptr == NULL) {
+        // the span of a transaction not begun ends here
+        return end_sql_request(ctx, is_registers_abi ? 2 : 6);
+    }
+
+    u64 goid = get_current_goroutine();
+    struct sql_request_t *tx = bpf_map_lookup_elem(&sql_events, &goid);
+    if (tx == NULL) {
+        return 0;
+    }
+
+    // the statements run on the connection of the transaction are its
+    // children, until it ends
+    void *dc = NULL;
+    bpf_probe_read(&dc, sizeof(dc), tx_ptr + tx_dc_pos);
+    bpf_map_update_elem(&tx_conns, &dc, &tx->sc, 0);
+    bpf_map_update_elem(&tx_spans, &tx_ptr, tx, 0);
+    bpf_map_delete_elem(&sql_events, &goid);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (tx *Tx) Commit() error
+SEC("uprobe/Tx_Commit")
+int uprobe_Tx_Commit(struct pt_regs *ctx) {
+    return end_tx(get_argument(ctx, 1), KIND_COMMIT);
+}
+
+// This instrumentation attaches uprobe to the following function, but when function return:
+// func (tx *Tx) Commit() error
+SEC("uprobe/Tx_Commit")
+int uprobe_Tx_Commit_Returns(struct pt_regs *ctx) {
+    return end_sql_request(ctx, is_registers_abi ? 1 : 2);
+}
+
+// This instrumentation attaches uprobe to the following function, run by
+// Rollback and by the rollback of a transaction whose context is done:
+// func (tx *Tx) rollback(discardConn bool) error
+SEC("uprobe/Tx_rollback")
+int uprobe_Tx_rollback(struct pt_regs *ctx) {
+    return end_tx(get_argument(ctx, 1), KIND_ROLLBACK);
+}
+
+// This instrumentation attaches uprobe to the following function, but when function return:
+// func (tx *Tx) rollback(discardConn bool) error
+SEC("uprobe/Tx_rollback")
+int uprobe_Tx_rollback_Returns(struct pt_regs *ctx) {
+    // the error follows the receiver and the bool, aligned, on the stack
+    return end_sql_request(ctx, is_registers_abi ? 1 : 3);
+}
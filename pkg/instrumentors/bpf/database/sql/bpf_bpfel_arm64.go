@@ -18,14 +18,16 @@ type bpfSpanContext struct {
 }
 
 type bpfSqlRequestT struct {
-	StartTime uint64
-	EndTime   uint64
-	Sc        bpfSpanContext
-	Psc       bpfSpanContext
-	TraceRoot uint64
-	Query     [100]int8
-	_         [4]byte
-	Goid      uint64
+	StartTime  uint64
+	EndTime    uint64
+	Sc         bpfSpanContext
+	Psc        bpfSpanContext
+	TraceFlags uint64
+	Query      [100]int8
+	Kind       uint32
+	Goid       uint64
+	Failed     uint32
+	InTx       uint32
 }
 
 // loadBpf returns the embedded CollectionSpec for bpf.
@@ -69,8 +71,20 @@ type bpfSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfProgramSpecs struct {
-	UprobeQueryDC         *ebpf.ProgramSpec `ebpf:"uprobe_queryDC"`
-	UprobeQueryDC_Returns *ebpf.ProgramSpec `ebpf:"uprobe_queryDC_Returns"`
+	UprobeBeginTx                 *ebpf.ProgramSpec `ebpf:"uprobe_BeginTx"`
+	UprobeBeginTxReturns          *ebpf.ProgramSpec `ebpf:"uprobe_BeginTx_Returns"`
+	UprobeStmtExecContext         *ebpf.ProgramSpec `ebpf:"uprobe_Stmt_ExecContext"`
+	UprobeStmtExecContextReturns  *ebpf.ProgramSpec `ebpf:"uprobe_Stmt_ExecContext_Returns"`
+	UprobeStmtQueryContext        *ebpf.ProgramSpec `ebpf:"uprobe_Stmt_QueryContext"`
+	UprobeStmtQueryContextReturns *ebpf.ProgramSpec `ebpf:"uprobe_Stmt_QueryContext_Returns"`
+	UprobeTxCommit                *ebpf.ProgramSpec `ebpf:"uprobe_Tx_Commit"`
+	UprobeTxCommitReturns         *ebpf.ProgramSpec `ebpf:"uprobe_Tx_Commit_Returns"`
+	UprobeTxRollback              *ebpf.ProgramSpec `ebpf:"uprobe_Tx_rollback"`
+	UprobeTxRollbackReturns       *ebpf.ProgramSpec `ebpf:"uprobe_Tx_rollback_Returns"`
+	UprobeExecDC                  *ebpf.ProgramSpec `ebpf:"uprobe_execDC"`
+	UprobeExecDC_Returns          *ebpf.ProgramSpec `ebpf:"uprobe_execDC_Returns"`
+	UprobeQueryDC                 *ebpf.ProgramSpec `ebpf:"uprobe_queryDC"`
+	UprobeQueryDC_Returns         *ebpf.ProgramSpec `ebpf:"uprobe_queryDC_Returns"`
 }
 
 // bpfMapSpecs contains maps before they are loaded into the kernel.
@@ -82,9 +96,12 @@ type bpfMapSpecs struct {
 	GmapEvents       *ebpf.MapSpec `ebpf:"gmap_events"`
 	GoroutineScMap   *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
 	GoroutinesMap    *ebpf.MapSpec `ebpf:"goroutines_map"`
+	RemoteTraces     *ebpf.MapSpec `ebpf:"remote_traces"`
 	SqlEvents        *ebpf.MapSpec `ebpf:"sql_events"`
 	TrackedSpans     *ebpf.MapSpec `ebpf:"tracked_spans"`
 	TrackedSpansBySc *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
+	TxConns          *ebpf.MapSpec `ebpf:"tx_conns"`
+	TxSpans          *ebpf.MapSpec `ebpf:"tx_spans"`
 }
 
 // bpfObjects contains all objects after they have been loaded into the kernel.
@@ -111,9 +128,12 @@ type bpfMaps struct {
 	GmapEvents       *ebpf.Map `ebpf:"gmap_events"`
 	GoroutineScMap   *ebpf.Map `ebpf:"goroutine_sc_map"`
 	GoroutinesMap    *ebpf.Map `ebpf:"goroutines_map"`
+	RemoteTraces     *ebpf.Map `ebpf:"remote_traces"`
 	SqlEvents        *ebpf.Map `ebpf:"sql_events"`
 	TrackedSpans     *ebpf.Map `ebpf:"tracked_spans"`
 	TrackedSpansBySc *ebpf.Map `ebpf:"tracked_spans_by_sc"`
+	TxConns          *ebpf.Map `ebpf:"tx_conns"`
+	TxSpans          *ebpf.Map `ebpf:"tx_spans"`
 }
 
 func (m *bpfMaps) Close() error {
@@ -123,9 +143,12 @@ func (m *bpfMaps) Close() error {
 		m.GmapEvents,
 		m.GoroutineScMap,
 		m.GoroutinesMap,
+		m.RemoteTraces,
 		m.SqlEvents,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
+		m.TxConns,
+		m.TxSpans,
 	)
 }
 
@@ -133,12 +156,36 @@ func (m *bpfMaps) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfPrograms struct {
-	UprobeQueryDC         *ebpf.Program `ebpf:"uprobe_queryDC"`
-	UprobeQueryDC_Returns *ebpf.Program `ebpf:"uprobe_queryDC_Returns"`
+	UprobeBeginTx                 *ebpf.Program `ebpf:"uprobe_BeginTx"`
+	UprobeBeginTxReturns          *ebpf.Program `ebpf:"uprobe_BeginTx_Returns"`
+	UprobeStmtExecContext         *ebpf.Program `ebpf:"uprobe_Stmt_ExecContext"`
+	UprobeStmtExecContextReturns  *ebpf.Program `ebpf:"uprobe_Stmt_ExecContext_Returns"`
+	UprobeStmtQueryContext        *ebpf.Program `ebpf:"uprobe_Stmt_QueryContext"`
+	UprobeStmtQueryContextReturns *ebpf.Program `ebpf:"uprobe_Stmt_QueryContext_Returns"`
+	UprobeTxCommit                *ebpf.Program `ebpf:"uprobe_Tx_Commit"`
+	UprobeTxCommitReturns         *ebpf.Program `ebpf:"uprobe_Tx_Commit_Returns"`
+	UprobeTxRollback              *ebpf.Program `ebpf:"uprobe_Tx_rollback"`
+	UprobeTxRollbackReturns       *ebpf.Program `ebpf:"uprobe_Tx_rollback_Returns"`
+	UprobeExecDC                  *ebpf.Program `ebpf:"uprobe_execDC"`
+	UprobeExecDC_Returns          *ebpf.Program `ebpf:"uprobe_execDC_Returns"`
+	UprobeQueryDC                 *ebpf.Program `ebpf:"uprobe_queryDC"`
+	UprobeQueryDC_Returns         *ebpf.Program `ebpf:"uprobe_queryDC_Returns"`
 }
 
 func (p *bpfPrograms) Close() error {
 	return _BpfClose(
+		p.UprobeBeginTx,
+		p.UprobeBeginTxReturns,
+		p.UprobeStmtExecContext,
+		p.UprobeStmtExecContextReturns,
+		p.UprobeStmtQueryContext,
+		p.UprobeStmtQueryContextReturns,
+		p.UprobeTxCommit,
+		p.UprobeTxCommitReturns,
+		p.UprobeTxRollback,
+		p.UprobeTxRollbackReturns,
+		p.UprobeExecDC,
+		p.UprobeExecDC_Returns,
 		p.UprobeQueryDC,
 		p.UprobeQueryDC_Returns,
 	)
@@ -35,22 +35,52 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"
 	"go.opentelemetry.io/auto/pkg/log"
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process" // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
 
-const instrumentedPkg = "database/sql"
+const (
+	instrumentedPkg  = "database/sql"
+	instrumentorName = "database/sql/sql-instrumentor"
+
+	queryDCFunc          = "database/sql.(*DB).queryDC"
+	execDCFunc           = "database/sql.(*DB).execDC"
+	stmtQueryContextFunc = "database/sql.(*Stmt).QueryContext"
+	stmtExecContextFunc  = "database/sql.(*Stmt).ExecContext"
+	beginTxFunc          = "database/sql.(*DB).BeginTx"
+	txCommitFunc         = "database/sql.(*Tx).Commit"
+	// Rollback, and the rollback of a transaction whose context is done, run
+	// rollback.
+	txRollbackFunc = "database/sql.(*Tx).rollback"
+)
+
+// The kinds of the spans of the Events: the statements, and the transactions
+// by the way they end.
+const (
+	kindQuery uint32 = iota
+	kindExec
+	kindStmtQuery
+	kindStmtExec
+	kindBegin
+	kindCommit
+	kindRollback
+)
 
 // Event represents an event in an SQL database
-// request-response.
+// request-response, or a transaction.
 type Event struct {
 	context.BaseSpanProperties
-	Query [100]byte
-	_     [4]byte
-	Goid  uint64
+	Query  [100]byte
+	Kind   uint32
+	Goid   uint64
+	Failed uint32
+	InTx   uint32
 }
 
 // Instrumentor is the database/sql instrumentor.
@@ -58,8 +88,10 @@ type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
 	returnProbs     []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
+	queue           *utils.EventPriorityQueue
+	goroutines      *gmap.GMap
 }
 
 // IncludeDBStatementEnvVar is the environment variable to opt-in for sql query inclusion in the trace.
@@ -77,12 +109,48 @@ func (h *Instrumentor) LibraryName() string {
 
 // FuncNames returns the function names from "database/sql" that are instrumented.
 func (h *Instrumentor) FuncNames() []string {
-	return []string{"database/sql.(*DB).queryDC"}
+	return []string{
+		queryDCFunc, execDCFunc, stmtQueryContextFunc, stmtExecContextFunc,
+		beginTxFunc, txCommitFunc, txRollbackFunc,
+	}
+}
+
+// FuncsOptional reports that the functions of the instrumentor are each
+// optional, as the linker drops those of the statements and transactions a
+// target does not use.
+func (h *Instrumentor) FuncsOptional() bool {
+	return true
+}
+
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (h *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.GoVersion.Original(), []*inject.StructField{
+		{
+			VarName:    "stmt_query_pos",
+			StructName: "database/sql.Stmt",
+			Field:      "query",
+		},
+		{
+			VarName:    "stmt_cg_pos",
+			StructName: "database/sql.Stmt",
+			Field:      "cg",
+		},
+		{
+			VarName:    "tx_dc_pos",
+			StructName: "database/sql.Tx",
+			Field:      "dc",
+		},
+	}
 }
 
 // Load loads all instrumentation offsets.
 func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), nil, []*inject.FlagField{
+	h.queue = ctx.EventQueue
+	h.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := h.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "go", libVersion, fields, []*inject.FlagField{
 		{
 			VarName: "should_include_db_statement",
 			Value:   shouldIncludeDBStatement(),
@@ -104,75 +172,91 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 		return err
 	}
 
-	offset, err := ctx.TargetDetails.GetFunctionOffset(h.FuncNames()[0])
+	h.registerProbes(ctx, queryDCFunc, h.bpfObjects.UprobeQueryDC, h.bpfObjects.UprobeQueryDC_Returns)
+	h.registerProbes(ctx, execDCFunc, h.bpfObjects.UprobeExecDC, h.bpfObjects.UprobeExecDC_Returns)
+	h.registerProbes(ctx, stmtQueryContextFunc, h.bpfObjects.UprobeStmtQueryContext,
+		h.bpfObjects.UprobeStmtQueryContextReturns)
+	h.registerProbes(ctx, stmtExecContextFunc, h.bpfObjects.UprobeStmtExecContext,
+		h.bpfObjects.UprobeStmtExecContextReturns)
+	h.registerProbes(ctx, beginTxFunc, h.bpfObjects.UprobeBeginTx, h.bpfObjects.UprobeBeginTxReturns)
+	h.registerProbes(ctx, txCommitFunc, h.bpfObjects.UprobeTxCommit, h.bpfObjects.UprobeTxCommitReturns)
+	h.registerProbes(ctx, txRollbackFunc, h.bpfObjects.UprobeTxRollback, h.bpfObjects.UprobeTxRollbackReturns)
 
+	rd, err := perf.NewReader(h.bpfObjects.Events, os.Getpagesize())
 	if err != nil {
 		return err
 	}
+	h.eventsReader = utils.NewPerfReader(h.LibraryName(), rd)
 
-	up, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeQueryDC, &link.UprobeOptions{
-		Address: offset,
-	})
-
+	gmrd, err := perf.NewReader(h.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
+	h.gmapEventReader = utils.NewPerfReader(h.LibraryName(), gmrd)
 
-	h.uprobes = append(h.uprobes, up)
-
-	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(h.FuncNames()[0])
+	return nil
+}
 
+// registerProbes attaches prog to the start of funcName and retProg to its
+// returns. Nothing is attached if the target does not use funcName.
+func (h *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName string, prog, retProg *ebpf.Program) {
+	logger := log.Logger.WithName(instrumentorName).
+		WithValues("function", funcName)
+	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
 	if err != nil {
-		return err
+		logger.V(1).Info("function not used by the target. Skipping")
+		return
 	}
 
-	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeQueryDC_Returns, &link.UprobeOptions{
-			Address: ret,
-		})
-		if err != nil {
-			return err
-		}
-		h.returnProbs = append(h.returnProbs, retProbe)
-	}
-
-	rd, err := perf.NewReader(h.bpfObjects.Events, os.Getpagesize())
+	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
 	if err != nil {
-		return err
+		ctx.UprobeFailed(funcName, err)
+		logger.Error(err, "could not find function end offset. Skipping")
+		return
 	}
-	h.eventsReader = rd
 
-	gmrd, err := perf.NewReader(h.bpfObjects.GmapEvents, os.Getpagesize())
+	up, err := ctx.Uprobe(funcName, prog, offset)
 	if err != nil {
-		return err
+		logger.Error(err, "could not insert start uprobe. Skipping")
+		return
 	}
-	h.gmapEventReader = gmrd
+	h.uprobes = append(h.uprobes, up)
 
-	return nil
+	for _, ret := range retOffsets {
+		retProbe, err := ctx.ReturnUprobe(funcName, retProg, ret)
+		if err != nil {
+			logger.Error(err, "could not insert return uprobe. Skipping")
+			return
+		}
+		h.returnProbs = append(h.returnProbs, retProbe)
+	}
 }
 
 // Run runs the events processing loop.
 func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
-	logger := log.Logger.WithName("database/sql/sql-instrumentor")
+	logger := log.Logger.WithName(instrumentorName)
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 
 	sqlMainEventType := utils.ItemType("database_sql_main_event")
 	sqlPlaceholderEventType := utils.ItemType("database_sql_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(sqlMainEventType, func(rawEvent interface{}) {
+	h.queue.Register(sqlMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, h.LibraryName())
+		// the statements of a transaction are the children of its span
+		if event.InTx == 0 {
+			h.goroutines.MustEnrichSpan(&event, event.Goid, h.LibraryName())
+		}
 
 		eventsChan <- h.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(sqlPlaceholderEventType, func(rawEvent interface{}) {
+	h.queue.Register(sqlPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, h.LibraryName(), false)
+		h.goroutines.RegisterSpan(&enrichEvent, h.LibraryName(), false)
 
 		if enrichEvent.Psc.TraceID.IsValid() {
 			// middleware created
@@ -201,10 +285,11 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime, sqlMainEventType)
+			h.queue.Push(event, event.StartTime, sqlMainEventType)
 		}
 	}()
 
@@ -228,10 +313,11 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, sqlPlaceholderEventType)
+			h.queue.Push(event, event.StartTime-1, sqlPlaceholderEventType)
 		}
 	}()
 
@@ -253,34 +339,69 @@ func (h *Instrumentor) convertEvent(e *Event) *events.Event {
 			TraceID:    e.ParentSpanContext.TraceID,
 			SpanID:     e.ParentSpanContext.SpanID,
 			TraceFlags: trace.FlagsSampled,
-			Remote:     true,
+			// the transaction of a statement is traced in the target
+			Remote: e.InTx == 0,
 		})
 		pscPtr = &psc
 	} else {
 		pscPtr = nil
 	}
 
-	return &events.Event{
-		Library:     h.LibraryName(),
-		Name:        "DB",
-		Kind:        trace.SpanKindClient,
-		StartTime:   int64(e.StartTime),
-		EndTime:     int64(e.EndTime),
-		SpanContext: &sc,
-		Attributes: []attribute.KeyValue{
-			semconv.DBStatementKey.String(query),
-		},
+	event := &events.Event{
+		Library:           h.LibraryName(),
+		Name:              "DB",
+		Kind:              trace.SpanKindClient,
+		StartTime:         int64(e.StartTime),
+		EndTime:           int64(e.EndTime),
+		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
 		ParentSpanContext: pscPtr,
 	}
+
+	var operation string
+	switch e.Kind {
+	case kindBegin:
+		operation = "BEGIN"
+	case kindCommit:
+		operation = "COMMIT"
+	case kindRollback:
+		operation = "ROLLBACK"
+	}
+	if operation != "" {
+		event.Name = "DB transaction"
+		event.Attributes = []attribute.KeyValue{semconv.DBOperationKey.String(operation)}
+	} else {
+		event.Attributes = []attribute.KeyValue{semconv.DBStatementKey.String(query)}
+	}
+
+	// the error is returned to the application, not read by the probes
+	if e.Failed != 0 {
+		event.Status = codes.Error
+		event.StatusDescription = statusDescription(e.Kind)
+	}
+	return event
+}
+
+// statusDescription returns the description of the failure of a span of
+// kind.
+func statusDescription(kind uint32) string {
+	switch kind {
+	case kindExec, kindStmtExec:
+		return "exec failed"
+	case kindBegin:
+		return "transaction begin failed"
+	case kindCommit:
+		return "transaction commit failed"
+	case kindRollback:
+		return "transaction rollback failed"
+	default:
+		return "query failed"
+	}
 }
 
 // Close stops the Instrumentor.
 func (h *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing database/sql/sql instrumentor")
-	if h.eventsReader != nil {
-		h.eventsReader.Close()
-	}
-
 	for _, r := range h.uprobes {
 		r.Close()
 	}
@@ -289,13 +410,17 @@ func (h *Instrumentor) Close() {
 		r.Close()
 	}
 
-	if h.bpfObjects != nil {
-		h.bpfObjects.Close()
+	if h.eventsReader != nil {
+		h.eventsReader.Close()
 	}
 
 	if h.gmapEventReader != nil {
 		h.gmapEventReader.Close()
 	}
+
+	if h.bpfObjects != nil {
+		h.bpfObjects.Close()
+	}
 }
 
 // shouldIncludeDBStatement returns if the user has configured SQL queries to be included.
@@ -15,14 +15,18 @@
 package sql
 
 import (
+	"bytes"
+	"encoding/binary"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
-	"go.opentelemetry.io/auto/internal/pkg/instrumentors/context"
-	"go.opentelemetry.io/auto/internal/pkg/instrumentors/events"
+	"go.opentelemetry.io/auto/pkg/instrumentors/context"
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -63,3 +67,50 @@ func TestInstrumentorConvertEvent(t *testing.T) {
 	}
 	assert.Equal(t, want, got)
 }
+
+func TestInstrumentorConvertTransactionEvents(t *testing.T) {
+	start := time.Now()
+	end := start.Add(1 * time.Second)
+
+	i := New()
+	tx := i.convertEvent(&Event{
+		BaseSpanProperties: context.BaseSpanProperties{
+			StartTime:   uint64(start.UnixNano()),
+			EndTime:     uint64(end.UnixNano()),
+			SpanContext: context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}},
+		},
+		Kind: kindCommit,
+	})
+	assert.Equal(t, "DB transaction", tx.Name)
+	assert.Equal(t, codes.Unset, tx.Status)
+	assert.Equal(t, []attribute.KeyValue{semconv.DBOperationKey.String("COMMIT")}, tx.Attributes)
+
+	// a statement of the transaction, failed
+	got := i.convertEvent(&Event{
+		BaseSpanProperties: context.BaseSpanProperties{
+			StartTime:         uint64(start.UnixNano()),
+			EndTime:           uint64(end.UnixNano()),
+			SpanContext:       context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+			ParentSpanContext: context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}},
+		},
+		Query:  [100]byte{'D', 'E', 'L', 'E', 'T', 'E', ' ', 'F', 'R', 'O', 'M', ' ', 'f', 'o', 'o'},
+		Kind:   kindStmtExec,
+		Failed: 1,
+		InTx:   1,
+	})
+	assert.Equal(t, "DB", got.Name)
+	assert.Equal(t, codes.Error, got.Status)
+	assert.Equal(t, "exec failed", got.StatusDescription)
+	assert.Equal(t, []attribute.KeyValue{semconv.DBStatementKey.String("DELETE FROM foo")}, got.Attributes)
+	require.NotNil(t, got.ParentSpanContext)
+	assert.Equal(t, *tx.SpanContext, *got.ParentSpanContext)
+	assert.False(t, got.ParentSpanContext.IsRemote())
+}
+
+func TestEventLayout(t *testing.T) {
+	// as struct sql_request_t of probe.bpf.c
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, Event{}))
+	assert.Equal(t, 192, buf.Len())
+	assert.Equal(t, binary.Size(bpfSqlRequestT{}), buf.Len())
+}
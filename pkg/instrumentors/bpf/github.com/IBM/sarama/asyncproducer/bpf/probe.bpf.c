@@ -0,0 +1,187 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "arguments.h"
+#include "span_context.h"
+#include "go_context.h"
+#include "goroutines.h"
+#include "go_types.h"
+#include "propagation.h"
+#include "injection_policy.h"
+#include "sarama.h"
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+#define TOPIC_MAX_LEN 64
+#define KEY_MAX_LEN 32
+#define MAX_IN_FLIGHT 1000
+// the messages of a batch whose delivery is read
+#define MAX_BATCH_MESSAGES 64
+
+struct async_message_t
+{
+    BASE_SPAN_PROPERTIES
+    char topic[TOPIC_MAX_LEN];
+    char key[KEY_MAX_LEN];
+    u64 goid;
+    s64 offset;
+    s32 partition;
+    u32 failed;
+};
+
+// The messages in flight, by message, from their receipt by the dispatcher of
+// the producer. The messages never delivered, as those of a producer closed,
+// are evicted.
+struct
+{
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, void *);
+    __type(value, struct async_message_t);
+    __uint(max_entries, MAX_IN_FLIGHT);
+} async_messages SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, struct async_message_t);
+    __uint(max_entries, 1);
+} async_message_storage_map SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+} events SEC(".maps");
+
+const struct async_message_t *unused __attribute__((unused));
+
+// Injected in init
+volatile const u64 topic_ptr_pos;
+volatile const u64 key_ptr_pos;
+volatile const u64 headers_arr_ptr_pos;
+volatile const u64 offset_pos;
+volatile const u64 partition_pos;
+
+// Ends the span of the message msg_ptr, if produced asynchronously, with its
+// delivery outcome.
+static __always_inline void end_async_message(struct pt_regs *ctx, void *msg_ptr, bool failed)
+{
+    struct async_message_t *msg = bpf_map_lookup_elem(&async_messages, &msg_ptr);
+    if (msg == NULL)
+    {
+        return;
+    }
+
+    msg->end_time = bpf_ktime_get_ns();
+    msg->failed = failed;
+    if (!failed)
+    {
+        bpf_probe_read(&msg->offset, sizeof(msg->offset), msg_ptr + offset_pos);
+        bpf_probe_read(&msg->partition, sizeof(msg->partition), msg_ptr + partition_pos);
+    }
+    msg->trace_flags = remote_trace_flags(&msg->sc);
+
+    if (span_sampled(&msg->sc, &msg->psc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, msg, sizeof(*msg));
+    }
+    bpf_map_delete_elem(&async_messages, &msg_ptr);
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (m *ProducerMessage) ByteSize(version int) int
+// starting the span of the message received by the dispatcher of a producer,
+// which sizes it with the record version of the producer.
+SEC("uprobe/ProducerMessage_ByteSize")
+int uprobe_ProducerMessage_ByteSize(struct pt_regs *ctx)
+{
+    void *msg_ptr = get_argument(ctx, 1);
+    // the messages of the sync producer have their span already, and those
+    // in flight are sized again when batched and retried
+    if (msg_ptr == NULL || bpf_map_lookup_elem(&tracked_spans, &msg_ptr) != NULL ||
+        bpf_map_lookup_elem(&async_messages, &msg_ptr) != NULL)
+    {
+        return 0;
+    }
+    u64 version = (u64)get_argument(ctx, 2);
+
+    u32 map_id = 0;
+    struct async_message_t *msg = bpf_map_lookup_elem(&async_message_storage_map, &map_id);
+    if (msg == NULL)
+    {
+        return 0;
+    }
+    __builtin_memset(msg, 0, sizeof(*msg));
+    msg->start_time = bpf_ktime_get_ns();
+    msg->goid = get_current_goroutine();
+
+    struct go_string topic = {};
+    bpf_probe_read(&topic, sizeof(topic), msg_ptr + topic_ptr_pos);
+    u64 topic_size = topic.len < TOPIC_MAX_LEN - 1 ? topic.len : TOPIC_MAX_LEN - 1;
+    bpf_probe_read(msg->topic, topic_size, topic.str);
+
+    // the data of the Key Encoder, a StringEncoder or a ByteEncoder
+    void *key_ptr = NULL;
+    bpf_probe_read(&key_ptr, sizeof(key_ptr), msg_ptr + (key_ptr_pos + 8));
+    if (key_ptr != NULL)
+    {
+        struct go_string key = {};
+        bpf_probe_read(&key, sizeof(key), key_ptr);
+        u64 key_size = key.len < KEY_MAX_LEN - 1 ? key.len : KEY_MAX_LEN - 1;
+        bpf_probe_read(msg->key, key_size, key.str);
+    }
+
+    // the dispatcher runs in a goroutine of its own, the span of the
+    // goroutine sending the message being unknown
+    msg->sc = generate_span_context();
+
+    // the record version 2 of Kafka 0.11 and later carries the headers
+    if (version >= 2 && default_injection_allowed())
+    {
+        inject_headers(msg_ptr + headers_arr_ptr_pos, &msg->sc);
+    }
+
+    bpf_map_update_elem(&async_messages, &msg_ptr, msg, BPF_ANY);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (p *asyncProducer) returnSuccesses(batch []*ProducerMessage)
+SEC("uprobe/asyncProducer_returnSuccesses")
+int uprobe_asyncProducer_returnSuccesses(struct pt_regs *ctx)
+{
+    void *batch_ptr = get_argument(ctx, 2);
+    u64 batch_len = (u64)get_argument(ctx, 3);
+
+    for (u32 i = 0; i < MAX_BATCH_MESSAGES; i++)
+    {
+        if (i >= batch_len)
+        {
+            break;
+        }
+        void *msg_ptr = NULL;
+        bpf_probe_read(&msg_ptr, sizeof(msg_ptr), batch_ptr + i * sizeof(msg_ptr));
+        end_async_message(ctx, msg_ptr, false);
+    }
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (p *asyncProducer) returnError(msg *ProducerMessage, err error)
+SEC("uprobe/asyncProducer_returnError")
+int uprobe_asyncProducer_returnError(struct pt_regs *ctx)
+{
+    end_async_message(ctx, get_argument(ctx, 2), true);
+    return 0;
+}
@@ -0,0 +1,282 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package asyncproducer provides an instrumentor for the AsyncProducer of the
+// github.com/IBM/sarama package.
+//
+// The span of a message starts when the dispatcher of the producer receives
+// it, in a goroutine of its own, and is the root of its trace. The trace
+// context is injected in the headers of the messages of the producers of
+// Kafka 0.11 and later only. The messages of the SyncProducer, traced by the
+// sarama instrumentor, are skipped.
+package asyncproducer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/auto/pkg/inject"                // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/bpffs"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
+
+const (
+	instrumentedPkg  = "IBM/sarama/asyncproducer"
+	saramaModule     = "github.com/IBM/sarama"
+	instrumentorName = "IBM/sarama-asyncproducer-instrumentor"
+
+	byteSizeFunc        = "github.com/IBM/sarama.(*ProducerMessage).ByteSize"
+	returnSuccessesFunc = "github.com/IBM/sarama.(*asyncProducer).returnSuccesses"
+	returnErrorFunc     = "github.com/IBM/sarama.(*asyncProducer).returnError"
+)
+
+// Event represents a message produced asynchronously, from its receipt by the
+// dispatcher of the producer to its delivery.
+type Event struct {
+	context.BaseSpanProperties
+	Topic     [64]byte
+	Key       [32]byte
+	Goid      uint64
+	Offset    int64
+	Partition int32
+	Failed    uint32
+}
+
+// Instrumentor is the sarama AsyncProducer instrumentor.
+type Instrumentor struct {
+	bpfObjects   *bpfObjects
+	uprobes      []link.Link
+	eventsReader *utils.PerfReader
+	queue        *utils.EventPriorityQueue
+}
+
+// New returns a new [Instrumentor].
+func New() *Instrumentor {
+	return &Instrumentor{}
+}
+
+// LibraryName returns the name of the instrumentor.
+func (i *Instrumentor) LibraryName() string {
+	return instrumentedPkg
+}
+
+// FuncNames returns the functions that are instrumented: the sizing of the
+// messages received by the dispatcher of the producer and their delivery
+// paths.
+func (i *Instrumentor) FuncNames() []string {
+	return []string{byteSizeFunc, returnSuccessesFunc, returnErrorFunc}
+}
+
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (i *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.Libraries[saramaModule], []*inject.StructField{
+		{
+			VarName:    "topic_ptr_pos",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
+			Field:      "Topic",
+		},
+		{
+			VarName:    "key_ptr_pos",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
+			Field:      "Key",
+		},
+		{
+			VarName:    "headers_arr_ptr_pos",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
+			Field:      "Headers",
+		},
+		{
+			VarName:    "offset_pos",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
+			Field:      "Offset",
+		},
+		{
+			VarName:    "partition_pos",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
+			Field:      "Partition",
+		},
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	i.queue = ctx.EventQueue
+
+	libVersion, fields := i.StructFields(ctx.TargetDetails)
+	// the headers are only injected in targets with memory allocated for it
+	initAlloc := ctx.TargetDetails.AllocationDetails != nil
+	spec, err := ctx.Injector.Inject(loadBpf, saramaModule, libVersion, fields, nil, initAlloc)
+	if err != nil {
+		return err
+	}
+
+	i.bpfObjects = &bpfObjects{}
+	err = utils.LoadEBPFObjects(spec, i.bpfObjects, &ebpf.CollectionOptions{
+		Maps: ebpf.MapOptions{
+			PinPath: bpffs.PathForTargetApplication(ctx.TargetDetails),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.InjectionPolicy.Apply(i.bpfObjects.InjectionPolicies); err != nil {
+		return err
+	}
+
+	i.registerProbe(ctx, byteSizeFunc, i.bpfObjects.UprobeProducerMessageByteSize)
+	i.registerProbe(ctx, returnSuccessesFunc, i.bpfObjects.UprobeAsyncProducerReturnSuccesses)
+	i.registerProbe(ctx, returnErrorFunc, i.bpfObjects.UprobeAsyncProducerReturnError)
+
+	rd, err := perf.NewReader(i.bpfObjects.Events, os.Getpagesize())
+	if err != nil {
+		return err
+	}
+	i.eventsReader = utils.NewPerfReader(i.LibraryName(), rd)
+
+	return nil
+}
+
+// registerProbe attaches prog to the start of funcName.
+func (i *Instrumentor) registerProbe(ctx *context.InstrumentorContext, funcName string, prog *ebpf.Program) {
+	logger := log.Logger.WithName(instrumentorName).
+		WithValues("function", funcName)
+	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
+	if err != nil {
+		ctx.UprobeFailed(funcName, err)
+		logger.Error(err, "could not find function start offset. Skipping")
+		return
+	}
+
+	up, err := ctx.Uprobe(funcName, prog, offset)
+	if err != nil {
+		logger.Error(err, "could not insert start uprobe. Skipping")
+		return
+	}
+	i.uprobes = append(i.uprobes, up)
+}
+
+// Run runs the events processing loop.
+func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
+	logger := log.Logger.WithName(instrumentorName)
+
+	saramaAsyncEventType := utils.ItemType("sarama_async_event")
+	i.queue.Register(saramaAsyncEventType, func(rawEvent interface{}) {
+		event := rawEvent.(Event)
+		eventsChan <- i.convertEvent(&event)
+	})
+
+	var event Event
+	for {
+		record, err := i.eventsReader.Read()
+		if err != nil {
+			if errors.Is(err, perf.ErrClosed) {
+				return
+			}
+			logger.Error(err, "error reading from perf reader")
+			continue
+		}
+
+		if record.LostSamples != 0 {
+			logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+			continue
+		}
+
+		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+			logger.Error(err, "error parsing perf event")
+			metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
+			continue
+		}
+
+		i.queue.Push(event, event.StartTime, saramaAsyncEventType)
+	}
+}
+
+func (i *Instrumentor) convertEvent(e *Event) *events.Event {
+	topic := unix.ByteSliceToString(e.Topic[:])
+	key := unix.ByteSliceToString(e.Key[:])
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    e.SpanContext.TraceID,
+		SpanID:     e.SpanContext.SpanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	event := &events.Event{
+		Name:         fmt.Sprintf("%s publish", topic),
+		Library:      i.LibraryName(),
+		Kind:         trace.SpanKindProducer,
+		StartTime:    int64(e.StartTime),
+		EndTime:      int64(e.EndTime),
+		SpanContext:  &sc,
+		TraceSampled: e.TraceSampled(),
+		Attributes: []attribute.KeyValue{
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(topic),
+			attribute.Key("go-id").Int64(int64(e.Goid)),
+		},
+	}
+	if key != "" {
+		event.Attributes = append(event.Attributes, semconv.MessagingKafkaMessageKey(key))
+	}
+
+	// the error is returned to the application, not read by the probes
+	if e.Failed != 0 {
+		event.Status = codes.Error
+		event.StatusDescription = "message delivery failed"
+		return event
+	}
+	event.Attributes = append(event.Attributes,
+		semconv.MessagingKafkaDestinationPartition(int(e.Partition)),
+		semconv.MessagingKafkaMessageOffset(int(e.Offset)),
+	)
+	return event
+}
+
+// Close stops the Instrumentor.
+func (i *Instrumentor) Close() {
+	log.Logger.V(0).Info("closing IBM/sarama async producer instrumentor")
+	for _, r := range i.uprobes {
+		r.Close()
+	}
+
+	if i.eventsReader != nil {
+		i.eventsReader.Close()
+	}
+
+	if i.bpfObjects != nil {
+		i.bpfObjects.Close()
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package asyncproducer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentorConvertEvent(t *testing.T) {
+	e := &Event{
+		BaseSpanProperties: context.BaseSpanProperties{
+			SpanContext: context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+		},
+		Topic:     [64]byte{'o', 'r', 'd', 'e', 'r', 's'},
+		Key:       [32]byte{'4', '2'},
+		Goid:      7,
+		Partition: 3,
+		Offset:    1234,
+	}
+
+	got := New().convertEvent(e)
+	assert.Equal(t, "orders publish", got.Name)
+	assert.Equal(t, trace.SpanKindProducer, got.Kind)
+	assert.Equal(t, codes.Unset, got.Status)
+	// the span of the goroutine sending the message is unknown
+	assert.Nil(t, got.ParentSpanContext)
+	assert.Subset(t, got.Attributes, []attribute.KeyValue{
+		semconv.MessagingSystem("kafka"),
+		semconv.MessagingOperationPublish,
+		semconv.MessagingDestinationName("orders"),
+		semconv.MessagingKafkaMessageKey("42"),
+		semconv.MessagingKafkaDestinationPartition(3),
+		semconv.MessagingKafkaMessageOffset(1234),
+	})
+
+	// the partition and offset of the messages not delivered are meaningless
+	e.Failed = 1
+	got = New().convertEvent(e)
+	assert.Equal(t, codes.Error, got.Status)
+	assert.NotContains(t, got.Attributes, semconv.MessagingKafkaMessageOffset(1234))
+}
@@ -17,6 +17,10 @@
 #include "go_context.h"
 #include "uprobe.h"
 #include "gmap.h"
+#include "go_types.h"
+#include "propagation.h"
+#include "injection_policy.h"
+#include "sarama.h"
 
 char __license[] SEC("license") = "Dual MIT/GPL";
 
@@ -44,6 +48,10 @@ struct publisher_message_t
     u64 is_goroutine;
     u64 cur_thread;
 
+    s64 offset;
+    s32 partition;
+    u32 failed;
+
 //    char header_3[MAX_HEADER_LEN];
 //    char value_3[MAX_HEADER_LEN];
 };
@@ -66,6 +74,23 @@ volatile const u64 topic_ptr_pos;
 volatile const u64 key_ptr_pos;
 volatile const u64 value_ptr_pos;
 volatile const u64 headers_arr_ptr_pos;
+volatile const u64 sync_producer_producer_pos;
+volatile const u64 async_producer_conf_pos;
+volatile const u64 config_version_pos;
+
+// Returns whether the producer sp_ptr, a *syncProducer, may send messages
+// with headers, which requires Kafka 0.11 or later. Its Config.Version is a
+// struct KafkaVersion { version [4]uint }.
+static __always_inline bool producer_supports_headers(void *sp_ptr)
+{
+    void *producer = NULL;
+    bpf_probe_read(&producer, sizeof(producer), sp_ptr + sync_producer_producer_pos);
+    void *conf = NULL;
+    bpf_probe_read(&conf, sizeof(conf), producer + async_producer_conf_pos);
+    u64 version[2] = {};
+    bpf_probe_read(version, sizeof(version), conf + config_version_pos);
+    return version[0] > 0 || version[1] >= 11;
+}
 
 // This instrumentation attachs uprobe to the following function:
 // func (sp *syncProducer) SendMessage(msg *ProducerMessage) (partition int32, offset int64, err error)
@@ -89,9 +114,9 @@ int uprobe_syncProducer_SendMessage(struct pt_regs *ctx)
     bpf_probe_read(&topic_ptr, sizeof(topic_ptr), (void *)(msg_ptr + topic_ptr_pos));
     bpf_probe_read(&req.topic, topic_len, topic_ptr);
 
-    // extract key
+    // extract key, the data of the Key Encoder
     void *key_ptr_ptr = 0;
-    bpf_probe_read(&key_ptr_ptr, sizeof(key_ptr_ptr), (void *)(msg_ptr + key_ptr_pos));
+    bpf_probe_read(&key_ptr_ptr, sizeof(key_ptr_ptr), (void *)(msg_ptr + (key_ptr_pos + 8)));
 
     void *key_ptr = 0;
     bpf_probe_read(&key_ptr, sizeof(key_ptr), key_ptr_ptr);
@@ -101,9 +126,9 @@ int uprobe_syncProducer_SendMessage(struct pt_regs *ctx)
     key_len = key_len > KEY_MAX_LEN ? KEY_MAX_LEN : key_len;
     bpf_probe_read(&req.key, key_len, key_ptr);
 
-    // extract value
+    // extract value, the data of the Value Encoder
     void *value_ptr_ptr = 0;
-    bpf_probe_read(&value_ptr_ptr, sizeof(value_ptr_ptr), (void *)(msg_ptr + value_ptr_pos));
+    bpf_probe_read(&value_ptr_ptr, sizeof(value_ptr_ptr), (void *)(msg_ptr + (value_ptr_pos + 8)));
 
     void *value_ptr = 0;
     bpf_probe_read(&value_ptr, sizeof(value_ptr), value_ptr_ptr);
@@ -113,6 +138,20 @@ int uprobe_syncProducer_SendMessage(struct pt_regs *ctx)
     value_len = value_len > VALUE_MAX_LEN ? VALUE_MAX_LEN : value_len;
     bpf_probe_read(&req.value, value_len, value_ptr);
 
+    u64 goid = get_current_goroutine();
+    void* same_goroutine_sc_ptr = bpf_map_lookup_elem(&goroutine_sc_map, &goid);
+
+    if (same_goroutine_sc_ptr != NULL) {
+        struct span_context sc = {};
+        bpf_probe_read(&sc, sizeof(sc), same_goroutine_sc_ptr);
+
+        req.psc = sc;
+        copy_byte_arrays(req.psc.TraceID, req.sc.TraceID, TRACE_ID_SIZE);
+        generate_random_bytes(req.sc.SpanID, SPAN_ID_SIZE);
+    } else {
+        req.sc = generate_span_context();
+    }
+
     // extract header length
     u64 headers_len = 0;
 
@@ -172,23 +211,16 @@ int uprobe_syncProducer_SendMessage(struct pt_regs *ctx)
 //        }
     }
 
+    // the headers read are those set by the application. The producers of
+    // the Kafka versions without headers reject the messages with some.
+    if (default_injection_allowed() && producer_supports_headers(get_argument(ctx, 1))) {
+        inject_headers(msg_ptr + headers_arr_ptr_pos, &req.sc);
+    }
+
     // extract key (address of msg)
     void *key = get_consistent_key(ctx, msg_ptr);
     u64 key64 = (u64)key;
 
-    u64 goid = get_current_goroutine();
-    void* same_goroutine_sc_ptr = bpf_map_lookup_elem(&goroutine_sc_map, &goid);
-
-    if (same_goroutine_sc_ptr != NULL) {
-        struct span_context sc = {};
-        bpf_probe_read(&sc, sizeof(sc), same_goroutine_sc_ptr);
-
-        req.psc = sc;
-        copy_byte_arrays(req.psc.TraceID, req.sc.TraceID, TRACE_ID_SIZE);
-        generate_random_bytes(req.sc.SpanID, SPAN_ID_SIZE);
-    } else {
-        req.sc = generate_span_context();
-    }
 
     u64 cur_thread = bpf_get_current_pid_tgid();
 
@@ -206,6 +238,8 @@ int uprobe_syncProducer_SendMessage(struct pt_regs *ctx)
     bpf_perf_event_output(ctx, &gmap_events, BPF_F_CURRENT_CPU, &event3, sizeof(event3));
 
     bpf_map_update_elem(&publisher_message_events, &key, &req, 0);
+    // tracked until SendMessage returns, the probes of the async producer
+    // sending the message skipping it
     start_tracking_span(msg_ptr, &req.sc);
     return 0;
 }
@@ -222,7 +256,18 @@ int uprobe_syncProducer_SendMessage_Returns(struct pt_regs *ctx) {
     bpf_probe_read(&tmpReq, sizeof(tmpReq), req_ptr_map);
     tmpReq.end_time = bpf_ktime_get_ns();
 
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    // (partition int32, offset int64, err error), following the receiver and
+    // the message on the stack
+    u64 results_pos = is_registers_abi ? 1 : 3;
+    tmpReq.partition = (s32)(u64)get_argument(ctx, results_pos);
+    tmpReq.offset = (s64)get_argument(ctx, results_pos + 1);
+    tmpReq.failed = get_argument(ctx, results_pos + 2) != NULL;
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);
+
+    if (span_sampled(&tmpReq.sc, &tmpReq.psc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    }
     bpf_map_delete_elem(&publisher_message_events, &key);
     stop_tracking_span(&tmpReq.sc);
 
@@ -17,7 +17,7 @@ type bpfPublisherMessageT struct {
 	EndTime     uint64
 	Sc          bpfSpanContext
 	Psc         bpfSpanContext
-	TraceRoot   uint64
+	TraceFlags  uint64
 	Topic       [30]int8
 	Key         [20]int8
 	Value       [50]int8
@@ -30,6 +30,9 @@ type bpfPublisherMessageT struct {
 	_           [4]byte
 	IsGoroutine uint64
 	CurThread   uint64
+	Offset      int64
+	Partition   int32
+	Failed      uint32
 }
 
 type bpfSpanContext struct {
@@ -86,13 +89,18 @@ type bpfProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfMapSpecs struct {
-	Events                 *ebpf.MapSpec `ebpf:"events"`
-	GmapEvents             *ebpf.MapSpec `ebpf:"gmap_events"`
-	GoroutineScMap         *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
-	GoroutinesMap          *ebpf.MapSpec `ebpf:"goroutines_map"`
-	PublisherMessageEvents *ebpf.MapSpec `ebpf:"publisher_message_events"`
-	TrackedSpans           *ebpf.MapSpec `ebpf:"tracked_spans"`
-	TrackedSpansBySc       *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.MapSpec `ebpf:"alloc_map"`
+	Events                      *ebpf.MapSpec `ebpf:"events"`
+	GmapEvents                  *ebpf.MapSpec `ebpf:"gmap_events"`
+	GoroutineScMap              *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.MapSpec `ebpf:"goroutines_map"`
+	HeadersBuffMap              *ebpf.MapSpec `ebpf:"headers_buff_map"`
+	InjectionPolicies           *ebpf.MapSpec `ebpf:"injection_policies"`
+	PropagatedContextStorageMap *ebpf.MapSpec `ebpf:"propagated_context_storage_map"`
+	PublisherMessageEvents      *ebpf.MapSpec `ebpf:"publisher_message_events"`
+	RemoteTraces                *ebpf.MapSpec `ebpf:"remote_traces"`
+	TrackedSpans                *ebpf.MapSpec `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
 }
 
 // bpfObjects contains all objects after they have been loaded into the kernel.
@@ -114,22 +122,32 @@ func (o *bpfObjects) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfMaps struct {
-	Events                 *ebpf.Map `ebpf:"events"`
-	GmapEvents             *ebpf.Map `ebpf:"gmap_events"`
-	GoroutineScMap         *ebpf.Map `ebpf:"goroutine_sc_map"`
-	GoroutinesMap          *ebpf.Map `ebpf:"goroutines_map"`
-	PublisherMessageEvents *ebpf.Map `ebpf:"publisher_message_events"`
-	TrackedSpans           *ebpf.Map `ebpf:"tracked_spans"`
-	TrackedSpansBySc       *ebpf.Map `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.Map `ebpf:"alloc_map"`
+	Events                      *ebpf.Map `ebpf:"events"`
+	GmapEvents                  *ebpf.Map `ebpf:"gmap_events"`
+	GoroutineScMap              *ebpf.Map `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.Map `ebpf:"goroutines_map"`
+	HeadersBuffMap              *ebpf.Map `ebpf:"headers_buff_map"`
+	InjectionPolicies           *ebpf.Map `ebpf:"injection_policies"`
+	PropagatedContextStorageMap *ebpf.Map `ebpf:"propagated_context_storage_map"`
+	PublisherMessageEvents      *ebpf.Map `ebpf:"publisher_message_events"`
+	RemoteTraces                *ebpf.Map `ebpf:"remote_traces"`
+	TrackedSpans                *ebpf.Map `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.Map `ebpf:"tracked_spans_by_sc"`
 }
 
 func (m *bpfMaps) Close() error {
 	return _BpfClose(
+		m.AllocMap,
 		m.Events,
 		m.GmapEvents,
 		m.GoroutineScMap,
 		m.GoroutinesMap,
+		m.HeadersBuffMap,
+		m.InjectionPolicies,
+		m.PropagatedContextStorageMap,
 		m.PublisherMessageEvents,
+		m.RemoteTraces,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
 	)
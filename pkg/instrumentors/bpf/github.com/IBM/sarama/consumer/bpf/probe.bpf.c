@@ -0,0 +1,299 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "arguments.h"
+#include "span_context.h"
+#include "goroutines.h"
+#include "go_types.h"
+#include "propagation.h"
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+#define TOPIC_MAX_LEN 64
+#define GROUP_MAX_LEN 64
+#define KEY_MAX_LEN 32
+#define MAX_CONCURRENT 50
+#define MAX_CONSUMERS 50
+// the messages of a fetch response traced, the following ones are counted
+// in skipped_messages, and the headers of a message read
+#define MAX_MESSAGES 16
+#define MAX_HEADERS 8
+
+struct consumer_message_t
+{
+    BASE_SPAN_PROPERTIES
+    s64 offset;
+    s32 partition;
+    char topic[TOPIC_MAX_LEN];
+    char group[GROUP_MAX_LEN];
+    char key[KEY_MAX_LEN];
+    u64 goid;
+};
+
+// The fetch response being parsed by a partition consumer.
+struct parse_response_t
+{
+    u64 start_time;
+    void *consumer;
+};
+
+struct consumer_group_t
+{
+    char id[GROUP_MAX_LEN];
+};
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, u64);
+    __type(value, struct parse_response_t);
+    __uint(max_entries, MAX_CONCURRENT);
+} parse_responses SEC(".maps");
+
+// The group of the consumers of the consumer groups, by consumer.
+struct
+{
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, void *);
+    __type(value, struct consumer_group_t);
+    __uint(max_entries, MAX_CONSUMERS);
+} consumer_groups SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, struct consumer_message_t);
+    __uint(max_entries, 1);
+} consumer_message_storage_map SEC(".maps");
+
+// The number of the messages of the fetch responses past MAX_MESSAGES, not
+// traced.
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, u64);
+    __uint(max_entries, 1);
+} skipped_messages SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+} events SEC(".maps");
+
+const struct consumer_message_t *unused __attribute__((unused));
+
+// Injected in init
+volatile const u64 message_headers_pos;
+volatile const u64 message_key_pos;
+volatile const u64 message_topic_pos;
+volatile const u64 message_partition_pos;
+volatile const u64 message_offset_pos;
+volatile const u64 partition_consumer_consumer_pos;
+volatile const u64 consumer_group_consumer_pos;
+volatile const u64 consumer_group_id_pos;
+
+// Extracts the remote parent from the record headers of the message msg_ptr,
+// []*RecordHeader, of the propagation formats selected.
+static __always_inline struct propagated_context *extract_context_from_message_headers(void *msg_ptr)
+{
+    struct go_slice headers = {};
+    bpf_probe_read(&headers, sizeof(headers), msg_ptr + message_headers_pos);
+    if (headers.len == 0)
+    {
+        return NULL;
+    }
+    struct propagated_context *pc = new_propagated_context();
+    if (pc == NULL)
+    {
+        return NULL;
+    }
+
+    for (u32 i = 0; i < MAX_HEADERS; i++)
+    {
+        if (i >= headers.len)
+        {
+            break;
+        }
+        void *header_ptr = NULL;
+        bpf_probe_read(&header_ptr, sizeof(header_ptr), headers.array + i * sizeof(header_ptr));
+        if (header_ptr == NULL)
+        {
+            continue;
+        }
+        // struct RecordHeader { Key, Value []byte }
+        struct go_slice key = {};
+        bpf_probe_read(&key, sizeof(key), header_ptr);
+        s32 h = propagation_header_of(key.array, key.len);
+        if (h < 0)
+        {
+            continue;
+        }
+        struct go_slice value = {};
+        bpf_probe_read(&value, sizeof(value), header_ptr + sizeof(key));
+        extract_propagation_header(pc, h, value.array, value.len);
+    }
+
+    if (!finish_propagated_context(pc))
+    {
+        return NULL;
+    }
+    return pc;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (c *consumerGroup) Consume(ctx context.Context, topics []string, handler ConsumerGroupHandler) error
+// recording the group of its consumer.
+SEC("uprobe/consumerGroup_Consume")
+int uprobe_consumerGroup_Consume(struct pt_regs *ctx)
+{
+    void *group_ptr = get_argument(ctx, 1);
+
+    // the data of the Consumer interface, a *consumer
+    void *consumer = NULL;
+    bpf_probe_read(&consumer, sizeof(consumer), group_ptr + (consumer_group_consumer_pos + 8));
+    if (consumer == NULL)
+    {
+        return 0;
+    }
+
+    struct go_string id = {};
+    bpf_probe_read(&id, sizeof(id), group_ptr + consumer_group_id_pos);
+    struct consumer_group_t group = {};
+    u64 size = id.len < GROUP_MAX_LEN - 1 ? id.len : GROUP_MAX_LEN - 1;
+    bpf_probe_read(group.id, size, id.str);
+
+    bpf_map_update_elem(&consumer_groups, &consumer, &group, BPF_ANY);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (child *partitionConsumer) parseResponse(response *FetchResponse) ([]*ConsumerMessage, error)
+SEC("uprobe/partitionConsumer_parseResponse")
+int uprobe_partitionConsumer_parseResponse(struct pt_regs *ctx)
+{
+    void *child_ptr = get_argument(ctx, 1);
+
+    struct parse_response_t parse = {};
+    parse.start_time = bpf_ktime_get_ns();
+    bpf_probe_read(&parse.consumer, sizeof(parse.consumer), child_ptr + partition_consumer_consumer_pos);
+
+    u64 goid = get_current_goroutine();
+    bpf_map_update_elem(&parse_responses, &goid, &parse, BPF_ANY);
+    return 0;
+}
+
+// Emits a span for each of the messages parsed, up to MAX_MESSAGES, child of
+// the trace context its record headers carry. The spans are continued, in
+// user space, by the goroutine that started the partition consumer.
+SEC("uprobe/partitionConsumer_parseResponse")
+int uprobe_partitionConsumer_parseResponse_Returns(struct pt_regs *ctx)
+{
+    u64 goid = get_current_goroutine();
+    struct parse_response_t *parse = bpf_map_lookup_elem(&parse_responses, &goid);
+    if (parse == NULL)
+    {
+        return 0;
+    }
+    u64 start_time = parse->start_time;
+    void *consumer = parse->consumer;
+    bpf_map_delete_elem(&parse_responses, &goid);
+
+    // ([]*ConsumerMessage, error), following the receiver and the response
+    // on the stack
+    u64 results_pos = is_registers_abi ? 1 : 3;
+    void *msgs_ptr = get_argument(ctx, results_pos);
+    u64 msgs_len = (u64)get_argument(ctx, results_pos + 1);
+    if (msgs_ptr == NULL || msgs_len == 0)
+    {
+        return 0;
+    }
+
+    u32 map_id = 0;
+    struct consumer_message_t *msg = bpf_map_lookup_elem(&consumer_message_storage_map, &map_id);
+    if (msg == NULL)
+    {
+        return 0;
+    }
+    __builtin_memset(msg->group, 0, sizeof(msg->group));
+    struct consumer_group_t *group = bpf_map_lookup_elem(&consumer_groups, &consumer);
+    if (group != NULL)
+    {
+        __builtin_memcpy(msg->group, group->id, sizeof(msg->group));
+    }
+    u64 end_time = bpf_ktime_get_ns();
+    msg->goid = goid;
+
+    if (msgs_len > MAX_MESSAGES)
+    {
+        u64 *skipped = bpf_map_lookup_elem(&skipped_messages, &map_id);
+        if (skipped != NULL)
+        {
+            *skipped += msgs_len - MAX_MESSAGES;
+        }
+    }
+
+    for (u32 i = 0; i < MAX_MESSAGES; i++)
+    {
+        if (i >= msgs_len)
+        {
+            break;
+        }
+        void *msg_ptr = NULL;
+        bpf_probe_read(&msg_ptr, sizeof(msg_ptr), msgs_ptr + i * sizeof(msg_ptr));
+        if (msg_ptr == NULL)
+        {
+            continue;
+        }
+
+        msg->start_time = start_time;
+        msg->end_time = end_time;
+        bpf_probe_read(&msg->offset, sizeof(msg->offset), msg_ptr + message_offset_pos);
+        bpf_probe_read(&msg->partition, sizeof(msg->partition), msg_ptr + message_partition_pos);
+
+        __builtin_memset(msg->topic, 0, sizeof(msg->topic));
+        struct go_string topic = {};
+        bpf_probe_read(&topic, sizeof(topic), msg_ptr + message_topic_pos);
+        u64 topic_size = topic.len < TOPIC_MAX_LEN - 1 ? topic.len : TOPIC_MAX_LEN - 1;
+        bpf_probe_read(msg->topic, topic_size, topic.str);
+
+        __builtin_memset(msg->key, 0, sizeof(msg->key));
+        struct go_slice key = {};
+        bpf_probe_read(&key, sizeof(key), msg_ptr + message_key_pos);
+        u64 key_size = key.len < KEY_MAX_LEN - 1 ? key.len : KEY_MAX_LEN - 1;
+        bpf_probe_read(msg->key, key_size, key.array);
+
+        __builtin_memset(&msg->psc, 0, sizeof(msg->psc));
+        struct propagated_context *parent_ctx = extract_context_from_message_headers(msg_ptr);
+        if (parent_ctx != NULL)
+        {
+            msg->psc = parent_ctx->sc;
+            copy_byte_arrays(msg->psc.TraceID, msg->sc.TraceID, TRACE_ID_SIZE);
+            generate_random_bytes(msg->sc.SpanID, SPAN_ID_SIZE);
+        }
+        else
+        {
+            msg->sc = generate_span_context();
+        }
+        msg->trace_flags = remote_trace_flags(&msg->sc);
+
+        // the span of a message is the root of its trace in the target
+        if (root_span_sampled(&msg->sc))
+        {
+            bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, msg, sizeof(*msg));
+        }
+    }
+    return 0;
+}
@@ -0,0 +1,372 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package consumer provides an instrumentor for the partition consumers, of
+// consumer groups or not, of the github.com/IBM/sarama package.
+package consumer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/auto/pkg/inject"                // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/bpffs"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"    // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
+
+const (
+	instrumentedPkg  = "IBM/sarama/consumer"
+	saramaModule     = "github.com/IBM/sarama"
+	instrumentorName = "IBM/sarama-consumer-instrumentor"
+
+	consumeFunc       = "github.com/IBM/sarama.(*consumerGroup).Consume"
+	parseResponseFunc = "github.com/IBM/sarama.(*partitionConsumer).parseResponse"
+
+	// skippedPollInterval is the interval at which the messages the probes
+	// skipped are counted.
+	skippedPollInterval = 10 * time.Second
+)
+
+// Event represents a message received by a partition consumer.
+type Event struct {
+	context.BaseSpanProperties
+	Offset    int64
+	Partition int32
+	Topic     [64]byte
+	Group     [64]byte
+	Key       [32]byte
+	_         [4]byte
+	Goid      uint64
+}
+
+// Instrumentor is the sarama consumer instrumentor.
+type Instrumentor struct {
+	bpfObjects   *bpfObjects
+	uprobes      []link.Link
+	returnProbes []link.Link
+	eventsReader *utils.PerfReader
+	queue        *utils.EventPriorityQueue
+	goroutines   *gmap.GMap
+}
+
+// New returns a new [Instrumentor].
+func New() *Instrumentor {
+	return &Instrumentor{}
+}
+
+// LibraryName returns the name of the instrumentor.
+func (i *Instrumentor) LibraryName() string {
+	return instrumentedPkg
+}
+
+// FuncNames returns the function names from "github.com/IBM/sarama" that are
+// instrumented.
+func (i *Instrumentor) FuncNames() []string {
+	return []string{consumeFunc, parseResponseFunc}
+}
+
+// FuncsOptional reports that the functions of the instrumentor are each
+// optional, as the linker drops those of the consumer groups from the
+// services consuming partitions directly.
+func (i *Instrumentor) FuncsOptional() bool {
+	return true
+}
+
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (i *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.Libraries[saramaModule], []*inject.StructField{
+		{
+			VarName:    "message_headers_pos",
+			StructName: "github.com/IBM/sarama.ConsumerMessage",
+			Field:      "Headers",
+		},
+		{
+			VarName:    "message_key_pos",
+			StructName: "github.com/IBM/sarama.ConsumerMessage",
+			Field:      "Key",
+		},
+		{
+			VarName:    "message_topic_pos",
+			StructName: "github.com/IBM/sarama.ConsumerMessage",
+			Field:      "Topic",
+		},
+		{
+			VarName:    "message_partition_pos",
+			StructName: "github.com/IBM/sarama.ConsumerMessage",
+			Field:      "Partition",
+		},
+		{
+			VarName:    "message_offset_pos",
+			StructName: "github.com/IBM/sarama.ConsumerMessage",
+			Field:      "Offset",
+		},
+		{
+			VarName:    "partition_consumer_consumer_pos",
+			StructName: "github.com/IBM/sarama.partitionConsumer",
+			Field:      "consumer",
+		},
+		{
+			VarName:    "consumer_group_consumer_pos",
+			StructName: "github.com/IBM/sarama.consumerGroup",
+			Field:      "consumer",
+		},
+		{
+			VarName:    "consumer_group_id_pos",
+			StructName: "github.com/IBM/sarama.consumerGroup",
+			Field:      "groupID",
+		},
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	i.queue = ctx.EventQueue
+	i.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := i.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, saramaModule, libVersion, fields, nil, false)
+	if err != nil {
+		return err
+	}
+
+	i.bpfObjects = &bpfObjects{}
+	err = utils.LoadEBPFObjects(spec, i.bpfObjects, &ebpf.CollectionOptions{
+		Maps: ebpf.MapOptions{
+			PinPath: bpffs.PathForTargetApplication(ctx.TargetDetails),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	i.registerProbes(ctx, consumeFunc, i.bpfObjects.UprobeConsumerGroupConsume, nil)
+	i.registerProbes(ctx, parseResponseFunc, i.bpfObjects.UprobePartitionConsumerParseResponse,
+		i.bpfObjects.UprobePartitionConsumerParseResponseReturns)
+
+	rd, err := perf.NewReader(i.bpfObjects.Events, os.Getpagesize())
+	if err != nil {
+		return err
+	}
+	i.eventsReader = utils.NewPerfReader(i.LibraryName(), rd)
+
+	return nil
+}
+
+// registerProbes attaches prog to the start of funcName, and retProg, if not
+// nil, to its returns.
+func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName string, prog, retProg *ebpf.Program) {
+	logger := log.Logger.WithName(instrumentorName).
+		WithValues("function", funcName)
+	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
+	if err != nil {
+		ctx.UprobeFailed(funcName, err)
+		logger.Error(err, "could not find function start offset. Skipping")
+		return
+	}
+
+	up, err := ctx.Uprobe(funcName, prog, offset)
+	if err != nil {
+		logger.Error(err, "could not insert start uprobe. Skipping")
+		return
+	}
+	i.uprobes = append(i.uprobes, up)
+
+	if retProg == nil {
+		return
+	}
+	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
+	if err != nil {
+		ctx.UprobeFailed(funcName, err)
+		logger.Error(err, "could not find function end offset. Skipping")
+		return
+	}
+
+	for _, ret := range retOffsets {
+		retProbe, err := ctx.ReturnUprobe(funcName, retProg, ret)
+		if err != nil {
+			logger.Error(err, "could not insert return uprobe. Skipping")
+			return
+		}
+		i.returnProbes = append(i.returnProbes, retProbe)
+	}
+}
+
+// Run runs the events processing loop.
+func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
+	logger := log.Logger.WithName(instrumentorName)
+
+	saramaConsumerEventType := utils.ItemType("sarama_consumer_event")
+	i.queue.Register(saramaConsumerEventType, func(rawEvent interface{}) {
+		event := rawEvent.(Event)
+		i.continueTrace(&event)
+		eventsChan <- i.convertEvent(&event)
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+	go i.countSkipped(done)
+
+	var event Event
+	for {
+		record, err := i.eventsReader.Read()
+		if err != nil {
+			if errors.Is(err, perf.ErrClosed) {
+				return
+			}
+			logger.Error(err, "error reading from perf reader")
+			continue
+		}
+
+		if record.LostSamples != 0 {
+			logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+			continue
+		}
+
+		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+			logger.Error(err, "error parsing perf event")
+			metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
+			continue
+		}
+
+		i.queue.Push(event, event.StartTime, saramaConsumerEventType)
+	}
+}
+
+// continueTrace makes the span of the message e the parent of the spans of
+// the goroutine that started its partition consumer, the one running the
+// ConsumeClaim of a consumer group, as it handles the messages parsed for it.
+func (i *Instrumentor) continueTrace(e *Event) {
+	if pgoid, ok := i.goroutines.GetGoId2PGoId(e.Goid); ok {
+		i.goroutines.SetGoId2Sc(pgoid, e.SpanContext)
+	}
+}
+
+// countSkipped adds the messages of the fetch responses the probes skipped
+// to metrics.MessagesSkipped, until done is closed.
+func (i *Instrumentor) countSkipped(done <-chan struct{}) {
+	ticker := time.NewTicker(skippedPollInterval)
+	defer ticker.Stop()
+
+	var counted uint64
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		var perCPU []uint64
+		if err := i.bpfObjects.SkippedMessages.Lookup(uint32(0), &perCPU); err != nil {
+			continue
+		}
+		var skipped uint64
+		for _, n := range perCPU {
+			skipped += n
+		}
+		metrics.MessagesSkipped.WithLabelValues(i.LibraryName()).Add(float64(skipped - counted))
+		counted = skipped
+	}
+}
+
+func (i *Instrumentor) convertEvent(e *Event) *events.Event {
+	topic := unix.ByteSliceToString(e.Topic[:])
+	group := unix.ByteSliceToString(e.Group[:])
+	key := unix.ByteSliceToString(e.Key[:])
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    e.SpanContext.TraceID,
+		SpanID:     e.SpanContext.SpanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	// the parent is the span of the producer, propagated in the headers of
+	// the message
+	var pscPtr *trace.SpanContext
+	if e.ParentSpanContext.TraceID.IsValid() {
+		psc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    e.ParentSpanContext.TraceID,
+			SpanID:     e.ParentSpanContext.SpanID,
+			TraceFlags: trace.FlagsSampled,
+			Remote:     true,
+		})
+		pscPtr = &psc
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystem("kafka"),
+		semconv.MessagingOperationReceive,
+		semconv.MessagingSourceName(topic),
+		semconv.MessagingKafkaSourcePartition(int(e.Partition)),
+		semconv.MessagingKafkaMessageOffset(int(e.Offset)),
+	}
+	if key != "" {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(key))
+	}
+	if group != "" {
+		attrs = append(attrs, semconv.MessagingKafkaConsumerGroup(group))
+	}
+
+	return &events.Event{
+		Library:           i.LibraryName(),
+		Name:              fmt.Sprintf("%s receive", topic),
+		Kind:              trace.SpanKindConsumer,
+		StartTime:         int64(e.StartTime),
+		EndTime:           int64(e.EndTime),
+		Attributes:        attrs,
+		ParentSpanContext: pscPtr,
+		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
+	}
+}
+
+// Close stops the Instrumentor.
+func (i *Instrumentor) Close() {
+	log.Logger.V(0).Info("closing IBM/sarama consumer instrumentor")
+	for _, r := range i.uprobes {
+		r.Close()
+	}
+
+	for _, r := range i.returnProbes {
+		r.Close()
+	}
+
+	if i.eventsReader != nil {
+		i.eventsReader.Close()
+	}
+
+	if i.bpfObjects != nil {
+		i.bpfObjects.Close()
+	}
+}
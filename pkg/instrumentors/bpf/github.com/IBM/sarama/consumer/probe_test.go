@@ -0,0 +1,81 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"    // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentorConvertEvent(t *testing.T) {
+	e := &Event{
+		BaseSpanProperties: context.BaseSpanProperties{
+			SpanContext: context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+		},
+		Offset:    1234,
+		Partition: 3,
+		Topic:     [64]byte{'o', 'r', 'd', 'e', 'r', 's'},
+		Group:     [64]byte{'b', 'i', 'l', 'l', 'i', 'n', 'g'},
+		Key:       [32]byte{'4', '2'},
+	}
+
+	got := New().convertEvent(e)
+	assert.Equal(t, "orders receive", got.Name)
+	assert.Equal(t, trace.SpanKindConsumer, got.Kind)
+	assert.Nil(t, got.ParentSpanContext, "a message without a trace context starts a trace")
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.MessagingSystem("kafka"),
+		semconv.MessagingOperationReceive,
+		semconv.MessagingSourceName("orders"),
+		semconv.MessagingKafkaSourcePartition(3),
+		semconv.MessagingKafkaMessageOffset(1234),
+		semconv.MessagingKafkaMessageKey("42"),
+		semconv.MessagingKafkaConsumerGroup("billing"),
+	}, got.Attributes)
+
+	// the span of the producer, from the record headers
+	e.ParentSpanContext = context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{3}}
+	got = New().convertEvent(e)
+	require.NotNil(t, got.ParentSpanContext)
+	assert.True(t, got.ParentSpanContext.IsRemote())
+	assert.Equal(t, trace.SpanID{3}, got.ParentSpanContext.SpanID())
+	assert.Equal(t, got.SpanContext.TraceID(), got.ParentSpanContext.TraceID())
+}
+
+func TestInstrumentorContinueTrace(t *testing.T) {
+	i := New()
+	i.goroutines = gmap.New()
+	// the goroutine parsing the messages was started by the one handling them
+	i.goroutines.SetGoId2PGoId(12, 7)
+
+	sc := context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}}
+	i.continueTrace(&Event{BaseSpanProperties: context.BaseSpanProperties{SpanContext: sc}, Goid: 12})
+	got, ok := i.goroutines.GetGoId2Sc(7)
+	require.True(t, ok)
+	assert.Equal(t, sc, got)
+
+	// the goroutines not known are left alone
+	i.continueTrace(&Event{BaseSpanProperties: context.BaseSpanProperties{SpanContext: sc}, Goid: 13})
+	_, ok = i.goroutines.GetGoId2Sc(12)
+	assert.False(t, ok)
+}
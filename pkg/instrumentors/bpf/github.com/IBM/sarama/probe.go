@@ -22,8 +22,6 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"go.opentelemetry.io/otel/attribute"
-	"golang.org/x/sys/unix"
 	"os"
 	"sync"
 
@@ -37,7 +35,13 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"
 	"go.opentelemetry.io/auto/pkg/log"
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sys/unix"
 )
 
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
@@ -45,6 +49,7 @@ import (
 const (
 	instrumentedPkg  = "IBM/sarama"
 	instrumentorName = "IBM/sarama-instrumentor"
+	saramaModule     = "github.com/IBM/sarama"
 )
 
 type Event struct {
@@ -61,6 +66,9 @@ type Event struct {
 	_           [4]byte
 	IsGoroutine uint64
 	CurThread   uint64
+	Offset      int64
+	Partition   int32
+	Failed      uint32
 	//Header3 [25]byte
 	//Value3  [25]byte
 }
@@ -69,8 +77,10 @@ type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
 	returnProbes    []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
+	queue           *utils.EventPriorityQueue
+	goroutines      *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -86,29 +96,56 @@ func (i *Instrumentor) FuncNames() []string {
 	return []string{"github.com/IBM/sarama.(*syncProducer).SendMessage"}
 }
 
-func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (i *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.Libraries[saramaModule], []*inject.StructField{
 		{
 			VarName:    "topic_ptr_pos",
-			StructName: "sarama.ProducerMessage",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
 			Field:      "Topic",
 		},
 		{
 			VarName:    "key_ptr_pos",
-			StructName: "sarama.ProducerMessage",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
 			Field:      "Key",
 		},
 		{
 			VarName:    "value_ptr_pos",
-			StructName: "sarama.ProducerMessage",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
 			Field:      "Value",
 		},
 		{
 			VarName:    "headers_arr_ptr_pos",
-			StructName: "sarama.ProducerMessage",
+			StructName: "github.com/IBM/sarama.ProducerMessage",
 			Field:      "Headers",
 		},
-	}, nil, false)
+		{
+			VarName:    "sync_producer_producer_pos",
+			StructName: "github.com/IBM/sarama.syncProducer",
+			Field:      "producer",
+		},
+		{
+			VarName:    "async_producer_conf_pos",
+			StructName: "github.com/IBM/sarama.asyncProducer",
+			Field:      "conf",
+		},
+		{
+			VarName:    "config_version_pos",
+			StructName: "github.com/IBM/sarama.Config",
+			Field:      "Version",
+		},
+	}
+}
+
+func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	i.queue = ctx.EventQueue
+	i.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := i.StructFields(ctx.TargetDetails)
+	// the headers are only injected in targets with memory allocated for it
+	initAlloc := ctx.TargetDetails.AllocationDetails != nil
+	spec, err := ctx.Injector.Inject(loadBpf, saramaModule, libVersion, fields, nil, initAlloc)
 
 	if err != nil {
 		return err
@@ -124,6 +161,10 @@ func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 		return err
 	}
 
+	if err := ctx.InjectionPolicy.Apply(i.bpfObjects.InjectionPolicies); err != nil {
+		return err
+	}
+
 	for _, funcName := range i.FuncNames() {
 		i.registerProbes(ctx, funcName)
 	}
@@ -131,13 +172,13 @@ func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	i.eventsReader = rd
+	i.eventsReader = utils.NewPerfReader(i.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(i.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	i.gmapEventReader = gmrd
+	i.gmapEventReader = utils.NewPerfReader(i.LibraryName(), gmrd)
 
 	return nil
 }
@@ -147,18 +188,18 @@ func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 		WithValues("function", funcName)
 	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function start offset. Skipping")
 		return
 	}
 	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function end offset. Skipping")
 		return
 	}
 
-	up, err := ctx.Executable.Uprobe("", i.bpfObjects.UprobeSyncProducerSendMessage, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(funcName, i.bpfObjects.UprobeSyncProducerSendMessage, offset)
 	if err != nil {
 		logger.Error(err, "could not insert start uprobe. Skipping")
 		return
@@ -167,9 +208,7 @@ func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	i.uprobes = append(i.uprobes, up)
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", i.bpfObjects.UprobeSyncProducerSendMessageReturns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(funcName, i.bpfObjects.UprobeSyncProducerSendMessageReturns, ret)
 		if err != nil {
 			logger.Error(err, "could not insert return uprobe. Skipping")
 			return
@@ -186,18 +225,18 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	saramaMainEventType := utils.ItemType("sarama_main_event")
 	saramaPlaceholderEventType := utils.ItemType("sarama_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(saramaMainEventType, func(rawEvent interface{}) {
+	i.queue.Register(saramaMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, i.LibraryName())
+		i.goroutines.MustEnrichSpan(&event, event.Goid, i.LibraryName())
 
 		eventsChan <- i.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(saramaPlaceholderEventType, func(rawEvent interface{}) {
+	i.queue.Register(saramaPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, i.LibraryName(), false)
+		i.goroutines.RegisterSpan(&enrichEvent, i.LibraryName(), false)
 
 		if enrichEvent.Psc.TraceID.IsValid() {
 			// middleware created
@@ -228,10 +267,11 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime, saramaMainEventType)
+			i.queue.Push(event, event.StartTime, saramaMainEventType)
 		}
 	}()
 
@@ -255,10 +295,11 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, saramaPlaceholderEventType)
+			i.queue.Push(event, event.StartTime-1, saramaPlaceholderEventType)
 		}
 	}()
 
@@ -290,16 +331,20 @@ func (i *Instrumentor) convertEvent(e *Event) *events.Event {
 		TraceFlags: trace.FlagsSampled,
 	})
 
-	return &events.Event{
-		Name:              fmt.Sprintf("Sarama topic: %s", topic),
+	event := &events.Event{
+		Name:              fmt.Sprintf("%s publish", topic),
 		Library:           i.LibraryName(),
-		Kind:              trace.SpanKindServer,
+		Kind:              trace.SpanKindProducer,
 		StartTime:         int64(e.StartTime),
 		EndTime:           int64(e.EndTime),
 		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
 		ParentSpanContext: &psc,
 		Attributes: []attribute.KeyValue{
-			attribute.Key("key").String(key),
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingKafkaMessageKey(key),
 			attribute.Key("value").String(value),
 			attribute.Key("go-id").Int64(int64(e.Goid)),
 			// Header 1
@@ -313,14 +358,20 @@ func (i *Instrumentor) convertEvent(e *Event) *events.Event {
 			//attribute.Key("header value 3").String(headerValue3),
 		},
 	}
+
+	if e.Failed != 0 {
+		event.Status = codes.Error
+		return event
+	}
+	event.Attributes = append(event.Attributes,
+		semconv.MessagingKafkaDestinationPartition(int(e.Partition)),
+		semconv.MessagingKafkaMessageOffset(int(e.Offset)),
+	)
+	return event
 }
 
 func (i *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing IBM/sarama instrumentor")
-	if i.eventsReader != nil {
-		i.eventsReader.Close()
-	}
-
 	for _, r := range i.uprobes {
 		r.Close()
 	}
@@ -329,6 +380,14 @@ func (i *Instrumentor) Close() {
 		r.Close()
 	}
 
+	if i.eventsReader != nil {
+		i.eventsReader.Close()
+	}
+
+	if i.gmapEventReader != nil {
+		i.gmapEventReader.Close()
+	}
+
 	if i.bpfObjects != nil {
 		i.bpfObjects.Close()
 	}
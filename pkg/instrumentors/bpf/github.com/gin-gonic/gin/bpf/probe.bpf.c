@@ -122,7 +122,12 @@ int uprobe_GinEngine_ServeHTTP_Returns(struct pt_regs *ctx) {
     struct http_request_t tmpReq = {};
     bpf_probe_read(&tmpReq, sizeof(tmpReq), req_ptr_map);
     tmpReq.end_time = bpf_ktime_get_ns();
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);
+    // the root span decides for its trace
+    if (root_span_sampled(&tmpReq.sc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    }
     bpf_map_delete_elem(&http_events, &key);
     stop_tracking_span(&tmpReq.sc);
 
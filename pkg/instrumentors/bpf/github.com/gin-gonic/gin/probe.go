@@ -40,6 +40,8 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
@@ -65,8 +67,10 @@ type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
 	returnProbs     []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
+	queue           *utils.EventPriorityQueue
+	goroutines      *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -85,9 +89,10 @@ func (h *Instrumentor) FuncNames() []string {
 	return []string{"github.com/gin-gonic/gin.(*Engine).ServeHTTP"}
 }
 
-// Load loads all instrumentation offsets.
-func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (h *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.GoVersion.Original(), []*inject.StructField{
 		{
 			VarName:    "method_ptr_pos",
 			StructName: "net/http.Request",
@@ -108,7 +113,16 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "net/url.URL",
 			Field:      "Path",
 		},
-	}, nil, false)
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	h.queue = ctx.EventQueue
+	h.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := h.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "go", libVersion, fields, nil, false)
 
 	if err != nil {
 		return err
@@ -132,13 +146,13 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	h.eventsReader = rd
+	h.eventsReader = utils.NewPerfReader(h.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(h.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	h.gmapEventReader = gmrd
+	h.gmapEventReader = utils.NewPerfReader(h.LibraryName(), gmrd)
 
 	return nil
 }
@@ -147,18 +161,18 @@ func (h *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	logger := log.Logger.WithName("gin-gonic/gin-instrumentor").WithValues("function", funcName)
 	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function start offset. Skipping")
 		return
 	}
 	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function end offsets. Skipping")
 		return
 	}
 
-	up, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeGinEngineServeHTTP, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(funcName, h.bpfObjects.UprobeGinEngineServeHTTP, offset)
 	if err != nil {
 		logger.V(1).Info("could not insert start uprobe. Skipping",
 			"error", err.Error())
@@ -168,9 +182,7 @@ func (h *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	h.uprobes = append(h.uprobes, up)
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeGinEngineServeHTTP_Returns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(funcName, h.bpfObjects.UprobeGinEngineServeHTTP_Returns, ret)
 		if err != nil {
 			logger.Error(err, "could not insert return uprobe. Skipping")
 			return
@@ -188,15 +200,15 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	ginMainEventType := utils.ItemType("gin_main_event")
 	ginPlaceholderEventType := utils.ItemType("gin_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(ginMainEventType, func(rawEvent interface{}) {
+	h.queue.Register(ginMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, h.LibraryName())
+		h.goroutines.MustEnrichSpan(&event, event.Goid, h.LibraryName())
 
 		eventsChan <- h.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(ginPlaceholderEventType, func(rawEvent interface{}) {
+	h.queue.Register(ginPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 
 		if event.Type != gmap.GoId2Sc {
@@ -206,7 +218,7 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 		// Gin gonic using one goroutine for all process. Should only keep same site on eBPF
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, h.LibraryName(), true)
+		h.goroutines.RegisterSpan(&enrichEvent, h.LibraryName(), true)
 	})
 
 	go func() {
@@ -229,10 +241,11 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime, ginMainEventType)
+			h.queue.Push(event, event.StartTime, ginMainEventType)
 		}
 	}()
 
@@ -256,10 +269,11 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, ginPlaceholderEventType)
+			h.queue.Push(event, event.StartTime-1, ginPlaceholderEventType)
 		}
 	}()
 
@@ -281,11 +295,12 @@ func (h *Instrumentor) convertEvent(e *Event) *events.Event {
 		// Do not include the high-cardinality path here (there is no
 		// templatized path manifest to reference, given we are instrumenting
 		// Engine.ServeHTTP which is not passed a Gin Context).
-		Name:        method,
-		Kind:        trace.SpanKindServer,
-		StartTime:   int64(e.StartTime),
-		EndTime:     int64(e.EndTime),
-		SpanContext: &sc,
+		Name:         method,
+		Kind:         trace.SpanKindServer,
+		StartTime:    int64(e.StartTime),
+		EndTime:      int64(e.EndTime),
+		SpanContext:  &sc,
+		TraceSampled: e.TraceSampled(),
 		Attributes: []attribute.KeyValue{
 			semconv.HTTPMethodKey.String(method),
 			semconv.HTTPTargetKey.String(path),
@@ -297,14 +312,6 @@ func (h *Instrumentor) convertEvent(e *Event) *events.Event {
 // Close stops the Instrumentor.
 func (h *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing gin-gonic/gin instrumentor")
-	if h.eventsReader != nil {
-		h.eventsReader.Close()
-	}
-
-	if h.gmapEventReader != nil {
-		h.gmapEventReader.Close()
-	}
-
 	for _, r := range h.uprobes {
 		r.Close()
 	}
@@ -313,6 +320,14 @@ func (h *Instrumentor) Close() {
 		r.Close()
 	}
 
+	if h.eventsReader != nil {
+		h.eventsReader.Close()
+	}
+
+	if h.gmapEventReader != nil {
+		h.gmapEventReader.Close()
+	}
+
 	if h.bpfObjects != nil {
 		h.bpfObjects.Close()
 	}
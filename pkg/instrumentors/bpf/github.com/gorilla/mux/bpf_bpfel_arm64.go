@@ -13,16 +13,16 @@ import (
 )
 
 type bpfHttpRequestT struct {
-	StartTime uint64
-	EndTime   uint64
-	Sc        bpfSpanContext
-	Psc       bpfSpanContext
-	TraceRoot uint64
-	Method    [7]int8
-	Path      [100]int8
-	_         [5]byte
-	Goid      uint64
-	CurThread uint64
+	StartTime  uint64
+	EndTime    uint64
+	Sc         bpfSpanContext
+	Psc        bpfSpanContext
+	TraceFlags uint64
+	Method     [7]int8
+	Path       [100]int8
+	_          [5]byte
+	Goid       uint64
+	CurThread  uint64
 }
 
 type bpfSpanContext struct {
@@ -84,6 +84,7 @@ type bpfMapSpecs struct {
 	GoroutineScMap   *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
 	GoroutinesMap    *ebpf.MapSpec `ebpf:"goroutines_map"`
 	HttpEvents       *ebpf.MapSpec `ebpf:"http_events"`
+	RemoteTraces     *ebpf.MapSpec `ebpf:"remote_traces"`
 	TrackedSpans     *ebpf.MapSpec `ebpf:"tracked_spans"`
 	TrackedSpansBySc *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
 }
@@ -112,6 +113,7 @@ type bpfMaps struct {
 	GoroutineScMap   *ebpf.Map `ebpf:"goroutine_sc_map"`
 	GoroutinesMap    *ebpf.Map `ebpf:"goroutines_map"`
 	HttpEvents       *ebpf.Map `ebpf:"http_events"`
+	RemoteTraces     *ebpf.Map `ebpf:"remote_traces"`
 	TrackedSpans     *ebpf.Map `ebpf:"tracked_spans"`
 	TrackedSpansBySc *ebpf.Map `ebpf:"tracked_spans_by_sc"`
 }
@@ -123,6 +125,7 @@ func (m *bpfMaps) Close() error {
 		m.GoroutineScMap,
 		m.GoroutinesMap,
 		m.HttpEvents,
+		m.RemoteTraces,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
 	)
@@ -38,6 +38,8 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
@@ -63,8 +65,9 @@ type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
 	returnProbs     []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
+	goroutines      *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -83,9 +86,10 @@ func (g *Instrumentor) FuncNames() []string {
 	return []string{"github.com/gorilla/mux.(*Router).ServeHTTP"}
 }
 
-// Load loads all instrumentation offsets.
-func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (g *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.GoVersion.Original(), []*inject.StructField{
 		{
 			VarName:    "method_ptr_pos",
 			StructName: "net/http.Request",
@@ -106,7 +110,15 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "net/url.URL",
 			Field:      "Path",
 		},
-	}, nil, false)
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	g.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := g.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "go", libVersion, fields, nil, false)
 
 	if err != nil {
 		return err
@@ -129,13 +141,13 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	g.eventsReader = rd
+	g.eventsReader = utils.NewPerfReader(g.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(g.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	g.gmapEventReader = gmrd
+	g.gmapEventReader = utils.NewPerfReader(g.LibraryName(), gmrd)
 
 	return nil
 }
@@ -144,18 +156,18 @@ func (g *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	logger := log.Logger.WithName("gorilla/mux-instrumentor").WithValues("function", funcName)
 	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function start offset. Skipping")
 		return
 	}
 	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function end offset. Skipping")
 		return
 	}
 
-	up, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeGorillaMuxServeHTTP, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(funcName, g.bpfObjects.UprobeGorillaMuxServeHTTP, offset)
 	if err != nil {
 		logger.Error(err, "could not insert start uprobe. Skipping")
 		return
@@ -164,9 +176,7 @@ func (g *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	g.uprobes = append(g.uprobes, up)
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeGorillaMuxServeHTTP_Returns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(funcName, g.bpfObjects.UprobeGorillaMuxServeHTTP_Returns, ret)
 		if err != nil {
 			logger.Error(err, "could not insert return uprobe. Skipping")
 			return
@@ -200,10 +210,11 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(g.LibraryName()).Inc()
 				continue
 			}
 
-			gmap.MustEnrichSpan(&event, event.Goid, g.LibraryName())
+			g.goroutines.MustEnrichSpan(&event, event.Goid, g.LibraryName())
 
 			eventsChan <- g.convertEvent(&event)
 		}
@@ -229,12 +240,13 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(g.LibraryName()).Inc()
 				continue
 			}
 
 			// gorilla/mux is deprecated
 			enrichEvent := gmap.ConvertEnrichEvent(event)
-			gmap.RegisterSpan(&enrichEvent, g.LibraryName(), false)
+			g.goroutines.RegisterSpan(&enrichEvent, g.LibraryName(), false)
 
 			if enrichEvent.Psc.TraceID.IsValid() {
 				// middleware created
@@ -260,11 +272,12 @@ func (g *Instrumentor) convertEvent(e *Event) *events.Event {
 		Library: g.LibraryName(),
 		// Do not include the high-cardinality path here (there is no
 		// templatized path manifest to reference).
-		Name:        method,
-		Kind:        trace.SpanKindServer,
-		StartTime:   int64(e.StartTime),
-		EndTime:     int64(e.EndTime),
-		SpanContext: &sc,
+		Name:         method,
+		Kind:         trace.SpanKindServer,
+		StartTime:    int64(e.StartTime),
+		EndTime:      int64(e.EndTime),
+		SpanContext:  &sc,
+		TraceSampled: e.TraceSampled(),
 		Attributes: []attribute.KeyValue{
 			semconv.HTTPMethodKey.String(method),
 			semconv.HTTPTargetKey.String(path),
@@ -276,10 +289,6 @@ func (g *Instrumentor) convertEvent(e *Event) *events.Event {
 // Close stops the Instrumentor.
 func (g *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing gorilla/mux instrumentor")
-	if g.eventsReader != nil {
-		g.eventsReader.Close()
-	}
-
 	for _, r := range g.uprobes {
 		r.Close()
 	}
@@ -288,6 +297,14 @@ func (g *Instrumentor) Close() {
 		r.Close()
 	}
 
+	if g.eventsReader != nil {
+		g.eventsReader.Close()
+	}
+
+	if g.gmapEventReader != nil {
+		g.gmapEventReader.Close()
+	}
+
 	if g.bpfObjects != nil {
 		g.bpfObjects.Close()
 	}
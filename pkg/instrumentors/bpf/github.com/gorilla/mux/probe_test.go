@@ -62,6 +62,7 @@ func TestInstrumentorConvertEvent(t *testing.T) {
 		Attributes: []attribute.KeyValue{
 			semconv.HTTPMethodKey.String("GET"),
 			semconv.HTTPTargetKey.String("/foo/bar"),
+			attribute.Key("go-id").Int64(0),
 		},
 	}
 	assert.Equal(t, want, got)
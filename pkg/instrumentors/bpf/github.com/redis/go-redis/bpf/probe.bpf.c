@@ -0,0 +1,214 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "arguments.h"
+#include "span_context.h"
+#include "go_context.h"
+#include "goroutines.h"
+#include "go_types.h"
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+#define NAME_MAX_LEN 32
+#define KEY_MAX_LEN 64
+#define ADDR_MAX_LEN 64
+#define ERR_MAX_LEN 64
+#define MAX_CONCURRENT 50
+
+// The kind of a runtime._type, in its kind byte.
+#define TYPE_KIND_POS 23
+#define TYPE_KIND_MASK 31
+#define TYPE_KIND_STRING 24
+
+struct redis_command_t
+{
+    BASE_SPAN_PROPERTIES
+    char name[NAME_MAX_LEN];
+    char key[KEY_MAX_LEN];
+    char addr[ADDR_MAX_LEN];
+    char err[ERR_MAX_LEN];
+    u64 goid;
+    u32 args_count;
+    u32 failed;
+};
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, u64);
+    __type(value, struct redis_command_t);
+    __uint(max_entries, MAX_CONCURRENT);
+} redis_commands SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, struct redis_command_t);
+    __uint(max_entries, 1);
+} redis_command_storage_map SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+} events SEC(".maps");
+
+const struct redis_command_t *unused __attribute__((unused));
+
+// Injected in init
+volatile const u64 cmd_args_pos;
+volatile const u64 client_opt_pos;
+volatile const u64 options_addr_pos;
+volatile const bool should_include_args;
+
+// Reads the string held by an interface whose dynamic type is typ and data
+// data, if the type is a string kind, as that of the command names and keys
+// and of the redis errors.
+static __always_inline bool read_string_iface(char *buf, u64 buf_size, void *typ, void *data)
+{
+    if (typ == NULL || data == NULL)
+    {
+        return false;
+    }
+    u8 kind = 0;
+    bpf_probe_read(&kind, sizeof(kind), typ + TYPE_KIND_POS);
+    if ((kind & TYPE_KIND_MASK) != TYPE_KIND_STRING)
+    {
+        return false;
+    }
+
+    struct go_string str = {};
+    bpf_probe_read(&str, sizeof(str), data);
+    u64 size = str.len < buf_size - 1 ? str.len : buf_size - 1;
+    bpf_probe_read(buf, size, str.str);
+    return true;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (c *baseClient) process(ctx context.Context, cmd Cmder) error
+SEC("uprobe/baseClient_process")
+int uprobe_baseClient_process(struct pt_regs *ctx)
+{
+    // argument positions
+    u64 client_pos = 1;
+    u64 context_ptr_pos = 3;
+    u64 cmd_ptr_pos = 5;
+
+    void *client_ptr = get_argument(ctx, client_pos);
+    void *cmd_ptr = get_argument(ctx, cmd_ptr_pos);
+    if (cmd_ptr == NULL)
+    {
+        return 0;
+    }
+
+    u32 map_id = 0;
+    struct redis_command_t *cmd = bpf_map_lookup_elem(&redis_command_storage_map, &map_id);
+    if (cmd == NULL)
+    {
+        return 0;
+    }
+    __builtin_memset(cmd, 0, sizeof(*cmd));
+    cmd->start_time = bpf_ktime_get_ns();
+
+    // the arguments of the command, as interface{} values: its name and,
+    // for most commands, its key
+    struct go_slice args = {};
+    bpf_probe_read(&args, sizeof(args), cmd_ptr + cmd_args_pos);
+    cmd->args_count = args.len;
+    if (args.len > 0)
+    {
+        struct go_iface arg = {};
+        bpf_probe_read(&arg, sizeof(arg), args.array);
+        read_string_iface(cmd->name, NAME_MAX_LEN, arg.tab, arg.data);
+    }
+    if (should_include_args && args.len > 1)
+    {
+        struct go_iface arg = {};
+        bpf_probe_read(&arg, sizeof(arg), args.array + sizeof(arg));
+        read_string_iface(cmd->key, KEY_MAX_LEN, arg.tab, arg.data);
+    }
+
+    void *opt_ptr = NULL;
+    bpf_probe_read(&opt_ptr, sizeof(opt_ptr), client_ptr + client_opt_pos);
+    if (opt_ptr != NULL)
+    {
+        struct go_string addr = {};
+        bpf_probe_read(&addr, sizeof(addr), opt_ptr + options_addr_pos);
+        u64 addr_size = addr.len < ADDR_MAX_LEN - 1 ? addr.len : ADDR_MAX_LEN - 1;
+        bpf_probe_read(cmd->addr, addr_size, addr.str);
+    }
+
+    // Get parent if exists
+    void *context_ptr = get_argument(ctx, context_ptr_pos);
+    void *context_ptr_val = 0;
+    bpf_probe_read(&context_ptr_val, sizeof(context_ptr_val), context_ptr);
+    struct span_context *parent_sc = get_parent_span_context(context_ptr_val);
+
+    u64 goid = get_current_goroutine();
+    if (parent_sc == NULL)
+    {
+        parent_sc = bpf_map_lookup_elem(&goroutine_sc_map, &goid);
+    }
+    if (parent_sc != NULL)
+    {
+        bpf_probe_read(&cmd->psc, sizeof(cmd->psc), parent_sc);
+        copy_byte_arrays(cmd->psc.TraceID, cmd->sc.TraceID, TRACE_ID_SIZE);
+        generate_random_bytes(cmd->sc.SpanID, SPAN_ID_SIZE);
+    }
+    else
+    {
+        cmd->sc = generate_span_context();
+    }
+    cmd->goid = goid;
+
+    bpf_map_update_elem(&redis_commands, &goid, cmd, BPF_ANY);
+    start_tracking_span(context_ptr_val, &cmd->sc);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the returns of the following function:
+// func (c *baseClient) process(ctx context.Context, cmd Cmder) error
+SEC("uprobe/baseClient_process")
+int uprobe_baseClient_process_Returns(struct pt_regs *ctx)
+{
+    u64 goid = get_current_goroutine();
+    struct redis_command_t *cmd = bpf_map_lookup_elem(&redis_commands, &goid);
+    if (cmd == NULL)
+    {
+        return 0;
+    }
+
+    // the error returned, following the arguments on the stack
+    u64 err_itab_pos = is_registers_abi ? 1 : 6;
+    u64 err_data_pos = is_registers_abi ? 2 : 7;
+    void *err_itab = get_argument(ctx, err_itab_pos);
+    if (err_itab != NULL)
+    {
+        cmd->failed = 1;
+        // the replies of the server are redis errors, strings
+        void *err_type = NULL;
+        bpf_probe_read(&err_type, sizeof(err_type), err_itab + 8);
+        read_string_iface(cmd->err, ERR_MAX_LEN, err_type, get_argument(ctx, err_data_pos));
+    }
+    cmd->end_time = bpf_ktime_get_ns();
+    cmd->trace_flags = remote_trace_flags(&cmd->sc);
+
+    if (span_sampled(&cmd->sc, &cmd->psc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, cmd, sizeof(*cmd));
+    }
+    stop_tracking_span(&cmd->sc);
+    bpf_map_delete_elem(&redis_commands, &goid);
+    return 0;
+}
@@ -0,0 +1,349 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redis provides an instrumentor for the clients of the
+// github.com/redis/go-redis/v9 and github.com/go-redis/redis/v8 packages.
+package redis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/auto/pkg/inject"                // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/bpffs"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"    // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
+
+const (
+	v9Pkg = "github.com/redis/go-redis/v9"
+	v8Pkg = "github.com/go-redis/redis/v8"
+
+	// nilReply is the error of the commands whose reply is nil, as the GET of
+	// a missing key.
+	nilReply = "redis: nil"
+)
+
+// IncludeArgsEnvVar is the environment variable to opt-in for the inclusion
+// of the commands, their arguments redacted, in the trace.
+const IncludeArgsEnvVar = "OTEL_GO_AUTO_INCLUDE_REDIS_ARGS"
+
+// Event represents a command processed by a client, from its write to the
+// read of its reply.
+type Event struct {
+	context.BaseSpanProperties
+	Name      [32]byte
+	Key       [64]byte
+	Addr      [64]byte
+	Err       [64]byte
+	Goid      uint64
+	ArgsCount uint32
+	Failed    uint32
+}
+
+// Instrumentor is the go-redis instrumentor, of one major version of the
+// client.
+type Instrumentor struct {
+	pkg          string
+	bpfObjects   *bpfObjects
+	uprobes      []link.Link
+	returnProbes []link.Link
+	eventsReader *utils.PerfReader
+	queue        *utils.EventPriorityQueue
+	goroutines   *gmap.GMap
+}
+
+// New returns a new [Instrumentor] of github.com/redis/go-redis/v9.
+func New() *Instrumentor {
+	return &Instrumentor{pkg: v9Pkg}
+}
+
+// NewV8 returns a new [Instrumentor] of github.com/go-redis/redis/v8.
+func NewV8() *Instrumentor {
+	return &Instrumentor{pkg: v8Pkg}
+}
+
+// LibraryName returns the module path of the instrumented client.
+func (i *Instrumentor) LibraryName() string {
+	return i.pkg
+}
+
+// FuncNames returns the function of the client that is instrumented: the
+// processing of the commands not pipelined.
+func (i *Instrumentor) FuncNames() []string {
+	return []string{i.processFunc()}
+}
+
+func (i *Instrumentor) processFunc() string {
+	return i.pkg + ".(*baseClient).process"
+}
+
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (i *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.Libraries[i.pkg], []*inject.StructField{
+		{
+			VarName:    "cmd_args_pos",
+			StructName: i.pkg + ".baseCmd",
+			Field:      "args",
+		},
+		{
+			VarName:    "client_opt_pos",
+			StructName: i.pkg + ".baseClient",
+			Field:      "opt",
+		},
+		{
+			VarName:    "options_addr_pos",
+			StructName: i.pkg + ".Options",
+			Field:      "Addr",
+		},
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	i.queue = ctx.EventQueue
+	i.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := i.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, i.LibraryName(), libVersion, fields, []*inject.FlagField{
+		{
+			VarName: "should_include_args",
+			Value:   shouldIncludeArgs(),
+		},
+	}, false)
+	if err != nil {
+		return err
+	}
+
+	i.bpfObjects = &bpfObjects{}
+	err = utils.LoadEBPFObjects(spec, i.bpfObjects, &ebpf.CollectionOptions{
+		Maps: ebpf.MapOptions{
+			PinPath: bpffs.PathForTargetApplication(ctx.TargetDetails),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	funcName := i.processFunc()
+	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
+	if err != nil {
+		return err
+	}
+
+	up, err := ctx.Uprobe(funcName, i.bpfObjects.UprobeBaseClientProcess, offset)
+	if err != nil {
+		return err
+	}
+	i.uprobes = append(i.uprobes, up)
+
+	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
+	if err != nil {
+		return err
+	}
+
+	for _, ret := range retOffsets {
+		retProbe, err := ctx.ReturnUprobe(funcName, i.bpfObjects.UprobeBaseClientProcessReturns, ret)
+		if err != nil {
+			return err
+		}
+		i.returnProbes = append(i.returnProbes, retProbe)
+	}
+
+	rd, err := perf.NewReader(i.bpfObjects.Events, os.Getpagesize())
+	if err != nil {
+		return err
+	}
+	i.eventsReader = utils.NewPerfReader(i.LibraryName(), rd)
+
+	return nil
+}
+
+// Run runs the events processing loop.
+func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
+	logger := log.Logger.WithName(i.pkg + "-instrumentor")
+
+	redisEventType := utils.ItemType(i.pkg + "_event")
+	i.queue.Register(redisEventType, func(rawEvent interface{}) {
+		event := rawEvent.(Event)
+
+		// the span of a command is the child of the span in its context, or
+		// else of that of the goroutine processing it, or of its ancestors
+		if !event.ParentSpanContext.TraceID.IsValid() {
+			i.goroutines.MustEnrichSpan(&event, event.Goid, i.LibraryName())
+		}
+
+		eventsChan <- i.convertEvent(&event)
+	})
+
+	var event Event
+	for {
+		record, err := i.eventsReader.Read()
+		if err != nil {
+			if errors.Is(err, perf.ErrClosed) {
+				return
+			}
+			logger.Error(err, "error reading from perf reader")
+			continue
+		}
+
+		if record.LostSamples != 0 {
+			logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+			continue
+		}
+
+		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+			logger.Error(err, "error parsing perf event")
+			metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
+			continue
+		}
+
+		i.queue.Push(event, event.StartTime, redisEventType)
+	}
+}
+
+// According to https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/trace/semantic_conventions/database.md
+func (i *Instrumentor) convertEvent(e *Event) *events.Event {
+	name := unix.ByteSliceToString(e.Name[:])
+	addr := unix.ByteSliceToString(e.Addr[:])
+	errMsg := unix.ByteSliceToString(e.Err[:])
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    e.SpanContext.TraceID,
+		SpanID:     e.SpanContext.SpanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	var pscPtr *trace.SpanContext
+	if e.ParentSpanContext.TraceID.IsValid() {
+		psc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    e.ParentSpanContext.TraceID,
+			SpanID:     e.ParentSpanContext.SpanID,
+			TraceFlags: trace.FlagsSampled,
+		})
+		pscPtr = &psc
+	}
+
+	attrs := []attribute.KeyValue{semconv.DBSystemRedis}
+	spanName := "redis"
+	if name != "" {
+		spanName = name
+		attrs = append(attrs, semconv.DBOperation(name))
+	}
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		attrs = append(attrs, semconv.NetPeerName(host))
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.NetPeerPort(p))
+		}
+	} else if addr != "" {
+		attrs = append(attrs, semconv.NetPeerName(addr))
+	}
+	if shouldIncludeArgs() && name != "" {
+		attrs = append(attrs, semconv.DBStatement(statement(name, unix.ByteSliceToString(e.Key[:]), int(e.ArgsCount))))
+	}
+	attrs = append(attrs, attribute.Key("go-id").Int64(int64(e.Goid)))
+
+	event := &events.Event{
+		Library:           i.LibraryName(),
+		Name:              spanName,
+		Kind:              trace.SpanKindClient,
+		StartTime:         int64(e.StartTime),
+		EndTime:           int64(e.EndTime),
+		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
+		ParentSpanContext: pscPtr,
+		Attributes:        attrs,
+	}
+
+	// a nil reply is returned as an error, but is not a failure
+	if e.Failed != 0 && errMsg != nilReply {
+		event.Status = codes.Error
+		event.StatusDescription = errMsg
+		if errMsg == "" {
+			event.StatusDescription = "redis command failed"
+		}
+	}
+	return event
+}
+
+// statement returns the command of name with argsCount arguments, its name
+// included, its arguments other than its key redacted.
+func statement(name, key string, argsCount int) string {
+	parts := []string{name}
+	redacted := argsCount - 1
+	if key != "" {
+		parts = append(parts, key)
+		redacted--
+	}
+	for j := 0; j < redacted; j++ {
+		parts = append(parts, "?")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Close stops the Instrumentor.
+func (i *Instrumentor) Close() {
+	log.Logger.V(0).Info("closing go-redis instrumentor", "library", i.pkg)
+	for _, r := range i.uprobes {
+		r.Close()
+	}
+
+	for _, r := range i.returnProbes {
+		r.Close()
+	}
+
+	if i.eventsReader != nil {
+		i.eventsReader.Close()
+	}
+
+	if i.bpfObjects != nil {
+		i.bpfObjects.Close()
+	}
+}
+
+// shouldIncludeArgs returns if the user has configured the commands to be
+// included.
+func shouldIncludeArgs() bool {
+	val := os.Getenv(IncludeArgsEnvVar)
+	if val != "" {
+		boolVal, err := strconv.ParseBool(val)
+		if err == nil {
+			return boolVal
+		}
+	}
+
+	return false
+}
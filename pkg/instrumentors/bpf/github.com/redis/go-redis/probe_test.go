@@ -0,0 +1,98 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentorConvertEvent(t *testing.T) {
+	start := time.Now()
+	end := start.Add(10 * time.Millisecond)
+
+	e := &Event{
+		BaseSpanProperties: context.BaseSpanProperties{
+			StartTime:         uint64(start.UnixNano()),
+			EndTime:           uint64(end.UnixNano()),
+			SpanContext:       context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+			ParentSpanContext: context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{3}},
+		},
+		Name:      [32]byte{'s', 'e', 't'},
+		Key:       [64]byte{'u', 's', 'e', 'r', ':', '4', '2'},
+		Addr:      [64]byte{'c', 'a', 'c', 'h', 'e', ':', '6', '3', '7', '9'},
+		Goid:      7,
+		ArgsCount: 3,
+	}
+
+	got := New().convertEvent(e)
+	assert.Equal(t, "github.com/redis/go-redis/v9", got.Library)
+	assert.Equal(t, "set", got.Name)
+	assert.Equal(t, trace.SpanKindClient, got.Kind)
+	assert.Equal(t, codes.Unset, got.Status)
+	require.NotNil(t, got.ParentSpanContext)
+	assert.Equal(t, trace.SpanID{3}, got.ParentSpanContext.SpanID())
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.DBSystemRedis,
+		semconv.DBOperation("set"),
+		semconv.NetPeerName("cache"),
+		semconv.NetPeerPort(6379),
+		attribute.Key("go-id").Int64(7),
+	}, got.Attributes)
+
+	// the command is only included on opt-in
+	t.Setenv(IncludeArgsEnvVar, "true")
+	got = NewV8().convertEvent(e)
+	assert.Equal(t, "github.com/go-redis/redis/v8", got.Library)
+	assert.Contains(t, got.Attributes, semconv.DBStatement("set user:42 ?"))
+
+	// a key miss is not a failure
+	e.Failed = 1
+	copy(e.Err[:], nilReply)
+	got = New().convertEvent(e)
+	assert.Equal(t, codes.Unset, got.Status)
+
+	e.Err = [64]byte{}
+	copy(e.Err[:], "ERR wrong number of arguments for 'set' command")
+	got = New().convertEvent(e)
+	assert.Equal(t, codes.Error, got.Status)
+	assert.Equal(t, "ERR wrong number of arguments for 'set' command", got.StatusDescription)
+}
+
+func TestStatement(t *testing.T) {
+	assert.Equal(t, "ping", statement("ping", "", 1))
+	assert.Equal(t, "get user:42", statement("get", "user:42", 2))
+	assert.Equal(t, "hset user:42 ? ? ? ?", statement("hset", "user:42", 6))
+	assert.Equal(t, "incrby ? ?", statement("incrby", "", 3), "a key not read is redacted")
+}
+
+func TestEventLayout(t *testing.T) {
+	// as struct redis_command_t of probe.bpf.c
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, Event{}))
+	assert.Equal(t, 312, buf.Len())
+	assert.Equal(t, binary.Size(bpfRedisCommandT{}), buf.Len())
+}
@@ -14,6 +14,8 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"
 	"go.opentelemetry.io/auto/pkg/log"
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"
 	"os"
 )
 
@@ -27,7 +29,9 @@ const (
 type Instrumentor struct {
 	bpfObjects   *bpfObjects
 	uprobes      []link.Link
-	eventsReader *perf.Reader
+	eventsReader *utils.PerfReader
+	queue        *utils.EventPriorityQueue
+	goroutines   *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -43,14 +47,24 @@ func (i *Instrumentor) FuncNames() []string {
 	return []string{"runtime.casgstatus", "runtime.newproc1"}
 }
 
-func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (i *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.GoVersion.Original(), []*inject.StructField{
 		{
 			VarName:    "goid_pos",
 			StructName: "runtime.g",
 			Field:      "goid",
 		},
-	}, nil, false)
+	}
+}
+
+func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	i.queue = ctx.EventQueue
+	i.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := i.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "go", libVersion, fields, nil, false)
 
 	if err != nil {
 		return err
@@ -74,7 +88,7 @@ func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	i.eventsReader = rd
+	i.eventsReader = utils.NewPerfReader(i.LibraryName(), rd)
 
 	return nil
 }
@@ -84,6 +98,7 @@ func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 		WithValues("function", funcName)
 	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function start offset. Skipping")
 		return
 	}
@@ -92,13 +107,9 @@ func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 
 	switch funcName {
 	case "runtime.casgstatus":
-		up, err = ctx.Executable.Uprobe("", i.bpfObjects.UprobeRuntimeCasgstatusByRegisters, &link.UprobeOptions{
-			Address: offset,
-		})
+		up, err = ctx.Uprobe(funcName, i.bpfObjects.UprobeRuntimeCasgstatusByRegisters, offset)
 	case "runtime.newproc1":
-		up, err = ctx.Executable.Uprobe("", i.bpfObjects.UprobeRuntimeNewproc1, &link.UprobeOptions{
-			Address: offset,
-		})
+		up, err = ctx.Uprobe(funcName, i.bpfObjects.UprobeRuntimeNewproc1, offset)
 	}
 
 	if err != nil {
@@ -114,13 +125,13 @@ func (i *Instrumentor) EventHandler(rawEvent interface{}) {
 
 	switch event.Type {
 	case gmap.GoPc2PGoId:
-		gmap.SetGoPc2GoId(event.Key, event.Value)
+		i.goroutines.SetGoPc2GoId(event.Key, event.Value)
 	case gmap.GoId2GoPc:
-		pgoid, ok := gmap.GetGoPc2GoId(event.Value)
+		pgoid, ok := i.goroutines.GetGoPc2GoId(event.Value)
 		if !ok {
 			return
 		}
-		gmap.SetGoId2PGoId(event.Key, pgoid)
+		i.goroutines.SetGoId2PGoId(event.Key, pgoid)
 	}
 }
 
@@ -129,7 +140,7 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 	runtimeEventType := utils.ItemType("runtime_event")
 
-	utils.EventProrityQueueSingleton.Register(runtimeEventType, i.EventHandler)
+	i.queue.Register(runtimeEventType, i.EventHandler)
 
 	var event gmap.GMapEvent
 	for {
@@ -149,10 +160,11 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 			logger.Error(err, "error parsing perf event")
+			metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
 			continue
 		}
 
-		utils.EventProrityQueueSingleton.Push(event, event.StartTime, runtimeEventType)
+		i.queue.Push(event, event.StartTime, runtimeEventType)
 	}
 }
 
@@ -162,11 +174,11 @@ func (i *Instrumentor) Close() {
 		r.Close()
 	}
 
-	if i.bpfObjects != nil {
-		i.bpfObjects.Close()
-	}
-
 	if i.eventsReader != nil {
 		i.eventsReader.Close()
 	}
+
+	if i.bpfObjects != nil {
+		i.bpfObjects.Close()
+	}
 }
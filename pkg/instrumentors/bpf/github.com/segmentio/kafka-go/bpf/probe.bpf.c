@@ -0,0 +1,442 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "arguments.h"
+#include "span_context.h"
+#include "go_context.h"
+#include "goroutines.h"
+#include "go_types.h"
+#include "propagation.h"
+#include "injection_policy.h"
+
+char __license[] SEC("license") = "Dual MIT/GPL";
+
+#define TOPIC_MAX_LEN 64
+#define GROUP_MAX_LEN 64
+#define KEY_MAX_LEN 32
+#define MAX_CONCURRENT 50
+// the messages of a write whose headers are injected, the following ones
+// are written without the trace context, and the headers of a message read
+#define MAX_INJECTED_MESSAGES 8
+#define MAX_HEADERS 8
+
+#define KIND_PRODUCER 0
+#define KIND_CONSUMER 1
+
+struct kafka_span_t
+{
+    BASE_SPAN_PROPERTIES
+    char topic[TOPIC_MAX_LEN];
+    char group[GROUP_MAX_LEN];
+    char key[KEY_MAX_LEN];
+    u64 goid;
+    s64 offset;
+    s64 partition;
+    u64 message_count;
+    u32 kind;
+    u32 failed;
+};
+
+// The fetch of a message by a reader.
+struct fetch_message_t
+{
+    u64 start_time;
+    void *reader;
+};
+
+// struct Header { Key string; Value []byte }
+struct message_header
+{
+    struct go_string key;
+    struct go_slice value;
+};
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, u64);
+    __type(value, struct kafka_span_t);
+    __uint(max_entries, MAX_CONCURRENT);
+} write_messages SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_HASH);
+    __type(key, u64);
+    __type(value, struct fetch_message_t);
+    __uint(max_entries, MAX_CONCURRENT);
+} fetch_messages SEC(".maps");
+
+struct headers_buff
+{
+    unsigned char buff[MAX_DATA_SIZE];
+};
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, s32);
+    __type(value, struct headers_buff);
+    __uint(max_entries, 1);
+} headers_buff_map SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
+    __type(key, u32);
+    __type(value, struct kafka_span_t);
+    __uint(max_entries, 1);
+} kafka_span_storage_map SEC(".maps");
+
+struct
+{
+    __uint(type, BPF_MAP_TYPE_PERF_EVENT_ARRAY);
+} events SEC(".maps");
+
+const struct kafka_span_t *unused __attribute__((unused));
+
+// Injected in init
+volatile const u64 message_topic_pos;
+volatile const u64 message_partition_pos;
+volatile const u64 message_offset_pos;
+volatile const u64 message_key_pos;
+volatile const u64 message_headers_pos;
+volatile const u64 message_time_pos;
+volatile const u64 writer_topic_pos;
+volatile const u64 reader_config_pos;
+volatile const u64 reader_config_group_id_pos;
+
+// Message ends with its Time, a time.Time of 3 words.
+static __always_inline u64 message_size()
+{
+    return message_time_pos + 24;
+}
+
+static __always_inline void read_topic(struct kafka_span_t *span, void *topic_ptr)
+{
+    struct go_string topic = {};
+    bpf_probe_read(&topic, sizeof(topic), topic_ptr);
+    u64 topic_size = topic.len < TOPIC_MAX_LEN - 1 ? topic.len : TOPIC_MAX_LEN - 1;
+    bpf_probe_read(span->topic, topic_size, topic.str);
+}
+
+static __always_inline void read_key(struct kafka_span_t *span, void *msg_ptr)
+{
+    struct go_slice key = {};
+    bpf_probe_read(&key, sizeof(key), msg_ptr + message_key_pos);
+    u64 key_size = key.len < KEY_MAX_LEN - 1 ? key.len : KEY_MAX_LEN - 1;
+    bpf_probe_read(span->key, key_size, key.array);
+}
+
+// Appends the headers of the propagation formats selected, propagating sc, to
+// the headers of the message msg_ptr.
+static __always_inline void inject_headers(void *msg_ptr, struct span_context *sc)
+{
+    struct go_slice headers = {};
+    struct go_slice_user_ptr headers_user_ptr = {};
+    headers_user_ptr.array = (void *)(msg_ptr + message_headers_pos);
+    headers_user_ptr.len = (void *)(msg_ptr + (message_headers_pos + 8));
+    headers_user_ptr.cap = (void *)(msg_ptr + (message_headers_pos + 16));
+    bpf_probe_read(&headers, sizeof(headers), headers_user_ptr.array);
+
+    for (u32 h = 0; h < PROPAGATION_HEADERS; h++)
+    {
+        struct go_string value = propagation_header_value(h, sc);
+        if (value.len == 0)
+        {
+            continue;
+        }
+        struct go_string key = propagation_header_key(h);
+        if (key.len == 0)
+        {
+            return;
+        }
+
+        struct message_header header = {};
+        header.key = key;
+        header.value.array = value.str;
+        header.value.len = value.len;
+        header.value.cap = value.len;
+        append_item_to_slice(&headers, &header, sizeof(header), &headers_user_ptr, &headers_buff_map);
+    }
+}
+
+// Returns whether the message msg_ptr carries a header of the propagation
+// formats selected, as when the application propagates the context itself.
+static __always_inline bool has_propagation_header(void *msg_ptr)
+{
+    struct go_slice headers = {};
+    bpf_probe_read(&headers, sizeof(headers), msg_ptr + message_headers_pos);
+    for (u32 i = 0; i < MAX_HEADERS; i++)
+    {
+        if (i >= headers.len)
+        {
+            break;
+        }
+        struct message_header header = {};
+        bpf_probe_read(&header, sizeof(header), headers.array + i * sizeof(header));
+        if (propagation_header_of(header.key.str, header.key.len) >= 0)
+        {
+            return true;
+        }
+    }
+    return false;
+}
+
+// Extracts the remote parent from the headers of the message msg_ptr, of the
+// propagation formats selected.
+static __always_inline struct propagated_context *extract_context_from_message_headers(void *msg_ptr)
+{
+    struct go_slice headers = {};
+    bpf_probe_read(&headers, sizeof(headers), msg_ptr + message_headers_pos);
+    if (headers.len == 0)
+    {
+        return NULL;
+    }
+    struct propagated_context *pc = new_propagated_context();
+    if (pc == NULL)
+    {
+        return NULL;
+    }
+
+    for (u32 i = 0; i < MAX_HEADERS; i++)
+    {
+        if (i >= headers.len)
+        {
+            break;
+        }
+        struct message_header header = {};
+        bpf_probe_read(&header, sizeof(header), headers.array + i * sizeof(header));
+        s32 h = propagation_header_of(header.key.str, header.key.len);
+        if (h < 0)
+        {
+            continue;
+        }
+        extract_propagation_header(pc, h, header.value.array, header.value.len);
+    }
+
+    if (!finish_propagated_context(pc))
+    {
+        return NULL;
+    }
+    return pc;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error
+SEC("uprobe/Writer_WriteMessages")
+int uprobe_Writer_WriteMessages(struct pt_regs *ctx)
+{
+    // argument positions
+    u64 writer_pos = 1;
+    u64 context_ptr_pos = 3;
+    u64 msgs_array_pos = 4;
+    u64 msgs_len_pos = 5;
+
+    void *writer_ptr = get_argument(ctx, writer_pos);
+    void *msgs_ptr = get_argument(ctx, msgs_array_pos);
+    u64 msgs_len = (u64)get_argument(ctx, msgs_len_pos);
+    if (msgs_ptr == NULL || msgs_len == 0)
+    {
+        return 0;
+    }
+
+    u32 map_id = 0;
+    struct kafka_span_t *span = bpf_map_lookup_elem(&kafka_span_storage_map, &map_id);
+    if (span == NULL)
+    {
+        return 0;
+    }
+    __builtin_memset(span, 0, sizeof(*span));
+    span->start_time = bpf_ktime_get_ns();
+    span->kind = KIND_PRODUCER;
+    span->message_count = msgs_len;
+
+    // the topic of the writer, or else that of each message
+    read_topic(span, writer_ptr + writer_topic_pos);
+    if (span->topic[0] == 0)
+    {
+        read_topic(span, msgs_ptr + message_topic_pos);
+    }
+    if (msgs_len == 1)
+    {
+        read_key(span, msgs_ptr);
+    }
+
+    // Get parent if exists
+    void *context_ptr = get_argument(ctx, context_ptr_pos);
+    void *context_ptr_val = 0;
+    bpf_probe_read(&context_ptr_val, sizeof(context_ptr_val), context_ptr);
+    struct span_context *parent_sc = get_parent_span_context(context_ptr_val);
+
+    u64 goid = get_current_goroutine();
+    if (parent_sc == NULL)
+    {
+        parent_sc = bpf_map_lookup_elem(&goroutine_sc_map, &goid);
+    }
+    if (parent_sc != NULL)
+    {
+        bpf_probe_read(&span->psc, sizeof(span->psc), parent_sc);
+        copy_byte_arrays(span->psc.TraceID, span->sc.TraceID, TRACE_ID_SIZE);
+        generate_random_bytes(span->sc.SpanID, SPAN_ID_SIZE);
+    }
+    else
+    {
+        span->sc = generate_span_context();
+    }
+    span->goid = goid;
+
+    if (default_injection_allowed())
+    {
+        u64 size = message_size();
+        for (u32 i = 0; i < MAX_INJECTED_MESSAGES; i++)
+        {
+            if (i >= msgs_len)
+            {
+                break;
+            }
+            void *msg_ptr = msgs_ptr + i * size;
+            if (has_propagation_header(msg_ptr))
+            {
+                continue;
+            }
+            inject_headers(msg_ptr, &span->sc);
+        }
+    }
+
+    bpf_map_update_elem(&write_messages, &goid, span, BPF_ANY);
+    start_tracking_span(context_ptr_val, &span->sc);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the returns of the following function:
+// func (w *Writer) WriteMessages(ctx context.Context, msgs ...Message) error
+SEC("uprobe/Writer_WriteMessages")
+int uprobe_Writer_WriteMessages_Returns(struct pt_regs *ctx)
+{
+    u64 goid = get_current_goroutine();
+    struct kafka_span_t *span = bpf_map_lookup_elem(&write_messages, &goid);
+    if (span == NULL)
+    {
+        return 0;
+    }
+
+    // the type of the error returned, following the arguments on the stack
+    u64 err_pos = is_registers_abi ? 1 : 7;
+    span->failed = get_argument(ctx, err_pos) != NULL;
+    span->end_time = bpf_ktime_get_ns();
+    span->trace_flags = remote_trace_flags(&span->sc);
+
+    if (span_sampled(&span->sc, &span->psc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, span, sizeof(*span));
+    }
+    stop_tracking_span(&span->sc);
+    bpf_map_delete_elem(&write_messages, &goid);
+    return 0;
+}
+
+// This instrumentation attaches uprobe to the following function:
+// func (r *Reader) FetchMessage(ctx context.Context) (Message, error)
+SEC("uprobe/Reader_FetchMessage")
+int uprobe_Reader_FetchMessage(struct pt_regs *ctx)
+{
+    struct fetch_message_t fetch = {};
+    fetch.start_time = bpf_ktime_get_ns();
+    fetch.reader = get_argument(ctx, 1);
+
+    u64 goid = get_current_goroutine();
+    bpf_map_update_elem(&fetch_messages, &goid, &fetch, BPF_ANY);
+    return 0;
+}
+
+// Emits the span of the message fetched, child of the trace context its
+// headers carry.
+SEC("uprobe/Reader_FetchMessage")
+int uprobe_Reader_FetchMessage_Returns(struct pt_regs *ctx)
+{
+    u64 goid = get_current_goroutine();
+    struct fetch_message_t *fetch = bpf_map_lookup_elem(&fetch_messages, &goid);
+    if (fetch == NULL)
+    {
+        return 0;
+    }
+    u64 start_time = fetch->start_time;
+    void *reader_ptr = fetch->reader;
+    bpf_map_delete_elem(&fetch_messages, &goid);
+
+    // The Message returned is too large for the registers, hence on the
+    // stack, first of the results. With the stack ABI, it follows the
+    // receiver and the context, and is followed by the error.
+    void *msg_ptr = NULL;
+    void *err_type = NULL;
+    if (is_registers_abi)
+    {
+        msg_ptr = (void *)(PT_REGS_SP(ctx) + 8);
+        err_type = get_argument(ctx, 1);
+    }
+    else
+    {
+        msg_ptr = (void *)(PT_REGS_SP(ctx) + 4 * 8);
+        bpf_probe_read(&err_type, sizeof(err_type), msg_ptr + message_size());
+    }
+    // no message is fetched on error, as when the context is done
+    if (err_type != NULL)
+    {
+        return 0;
+    }
+
+    u32 map_id = 0;
+    struct kafka_span_t *span = bpf_map_lookup_elem(&kafka_span_storage_map, &map_id);
+    if (span == NULL)
+    {
+        return 0;
+    }
+    __builtin_memset(span, 0, sizeof(*span));
+    span->start_time = start_time;
+    span->end_time = bpf_ktime_get_ns();
+    span->kind = KIND_CONSUMER;
+    span->message_count = 1;
+    span->goid = goid;
+
+    read_topic(span, msg_ptr + message_topic_pos);
+    read_key(span, msg_ptr);
+    bpf_probe_read(&span->partition, sizeof(span->partition), msg_ptr + message_partition_pos);
+    bpf_probe_read(&span->offset, sizeof(span->offset), msg_ptr + message_offset_pos);
+
+    struct go_string group = {};
+    bpf_probe_read(&group, sizeof(group), reader_ptr + (reader_config_pos + reader_config_group_id_pos));
+    u64 group_size = group.len < GROUP_MAX_LEN - 1 ? group.len : GROUP_MAX_LEN - 1;
+    bpf_probe_read(span->group, group_size, group.str);
+
+    struct propagated_context *parent_ctx = extract_context_from_message_headers(msg_ptr);
+    if (parent_ctx != NULL)
+    {
+        span->psc = parent_ctx->sc;
+        copy_byte_arrays(span->psc.TraceID, span->sc.TraceID, TRACE_ID_SIZE);
+        generate_random_bytes(span->sc.SpanID, SPAN_ID_SIZE);
+    }
+    else
+    {
+        span->sc = generate_span_context();
+    }
+    span->trace_flags = remote_trace_flags(&span->sc);
+
+    // the span of a message is the root of its trace in the target
+    if (root_span_sampled(&span->sc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, span, sizeof(*span));
+    }
+    return 0;
+}
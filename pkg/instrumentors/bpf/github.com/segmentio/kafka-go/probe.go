@@ -0,0 +1,411 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kafka provides an instrumentor for the Writer and the Reader of the
+// github.com/segmentio/kafka-go package.
+//
+// The trace context is injected in the headers of the first 8 messages of a
+// write only, and not in those of the messages already carrying one.
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/perf"
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/auto/pkg/inject"                // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/bpffs"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"    // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
+
+const (
+	instrumentedPkg  = "github.com/segmentio/kafka-go"
+	instrumentorName = "segmentio/kafka-go-instrumentor"
+
+	writeMessagesFunc = "github.com/segmentio/kafka-go.(*Writer).WriteMessages"
+	// ReadMessage fetches its messages with FetchMessage.
+	fetchMessageFunc = "github.com/segmentio/kafka-go.(*Reader).FetchMessage"
+)
+
+// The kinds of the spans of the Events.
+const (
+	kindProducer uint32 = iota
+	kindConsumer
+)
+
+// Event represents the messages written by a writer, or a message fetched by
+// a reader.
+type Event struct {
+	context.BaseSpanProperties
+	Topic        [64]byte
+	Group        [64]byte
+	Key          [32]byte
+	Goid         uint64
+	Offset       int64
+	Partition    int64
+	MessageCount uint64
+	Kind         uint32
+	Failed       uint32
+}
+
+// Instrumentor is the kafka-go instrumentor.
+type Instrumentor struct {
+	bpfObjects   *bpfObjects
+	uprobes      []link.Link
+	returnProbes []link.Link
+	eventsReader *utils.PerfReader
+	queue        *utils.EventPriorityQueue
+	goroutines   *gmap.GMap
+}
+
+// New returns a new [Instrumentor].
+func New() *Instrumentor {
+	return &Instrumentor{}
+}
+
+// LibraryName returns the name of the instrumentor.
+func (i *Instrumentor) LibraryName() string {
+	return instrumentedPkg
+}
+
+// FuncNames returns the function names from "github.com/segmentio/kafka-go"
+// that are instrumented.
+func (i *Instrumentor) FuncNames() []string {
+	return []string{writeMessagesFunc, fetchMessageFunc}
+}
+
+// FuncsOptional reports that the functions of the instrumentor are each
+// optional, as a service may only write or only read messages.
+func (i *Instrumentor) FuncsOptional() bool {
+	return true
+}
+
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (i *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.Libraries[i.LibraryName()], []*inject.StructField{
+		{
+			VarName:    "message_topic_pos",
+			StructName: "github.com/segmentio/kafka-go.Message",
+			Field:      "Topic",
+		},
+		{
+			VarName:    "message_partition_pos",
+			StructName: "github.com/segmentio/kafka-go.Message",
+			Field:      "Partition",
+		},
+		{
+			VarName:    "message_offset_pos",
+			StructName: "github.com/segmentio/kafka-go.Message",
+			Field:      "Offset",
+		},
+		{
+			VarName:    "message_key_pos",
+			StructName: "github.com/segmentio/kafka-go.Message",
+			Field:      "Key",
+		},
+		{
+			VarName:    "message_headers_pos",
+			StructName: "github.com/segmentio/kafka-go.Message",
+			Field:      "Headers",
+		},
+		{
+			VarName:    "message_time_pos",
+			StructName: "github.com/segmentio/kafka-go.Message",
+			Field:      "Time",
+		},
+		{
+			VarName:    "writer_topic_pos",
+			StructName: "github.com/segmentio/kafka-go.Writer",
+			Field:      "Topic",
+		},
+		{
+			VarName:    "reader_config_pos",
+			StructName: "github.com/segmentio/kafka-go.Reader",
+			Field:      "config",
+		},
+		{
+			VarName:    "reader_config_group_id_pos",
+			StructName: "github.com/segmentio/kafka-go.ReaderConfig",
+			Field:      "GroupID",
+		},
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	i.queue = ctx.EventQueue
+	i.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := i.StructFields(ctx.TargetDetails)
+	// the headers are only injected in targets with memory allocated for it
+	initAlloc := ctx.TargetDetails.AllocationDetails != nil
+	spec, err := ctx.Injector.Inject(loadBpf, i.LibraryName(), libVersion, fields, nil, initAlloc)
+	if err != nil {
+		return err
+	}
+
+	i.bpfObjects = &bpfObjects{}
+	err = utils.LoadEBPFObjects(spec, i.bpfObjects, &ebpf.CollectionOptions{
+		Maps: ebpf.MapOptions{
+			PinPath: bpffs.PathForTargetApplication(ctx.TargetDetails),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.InjectionPolicy.Apply(i.bpfObjects.InjectionPolicies); err != nil {
+		return err
+	}
+
+	i.registerProbes(ctx, writeMessagesFunc, i.bpfObjects.UprobeWriterWriteMessages,
+		i.bpfObjects.UprobeWriterWriteMessagesReturns)
+	i.registerProbes(ctx, fetchMessageFunc, i.bpfObjects.UprobeReaderFetchMessage,
+		i.bpfObjects.UprobeReaderFetchMessageReturns)
+
+	rd, err := perf.NewReader(i.bpfObjects.Events, os.Getpagesize())
+	if err != nil {
+		return err
+	}
+	i.eventsReader = utils.NewPerfReader(i.LibraryName(), rd)
+
+	return nil
+}
+
+// registerProbes attaches prog to the start of funcName and retProg to its
+// returns. Nothing is attached if the target does not use funcName.
+func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName string, prog, retProg *ebpf.Program) {
+	logger := log.Logger.WithName(instrumentorName).
+		WithValues("function", funcName)
+	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
+	if err != nil {
+		logger.V(1).Info("function not used by the target. Skipping")
+		return
+	}
+
+	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
+	if err != nil {
+		ctx.UprobeFailed(funcName, err)
+		logger.Error(err, "could not find function end offset. Skipping")
+		return
+	}
+
+	up, err := ctx.Uprobe(funcName, prog, offset)
+	if err != nil {
+		logger.Error(err, "could not insert start uprobe. Skipping")
+		return
+	}
+	i.uprobes = append(i.uprobes, up)
+
+	for _, ret := range retOffsets {
+		retProbe, err := ctx.ReturnUprobe(funcName, retProg, ret)
+		if err != nil {
+			logger.Error(err, "could not insert return uprobe. Skipping")
+			return
+		}
+		i.returnProbes = append(i.returnProbes, retProbe)
+	}
+}
+
+// Run runs the events processing loop.
+func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
+	logger := log.Logger.WithName(instrumentorName)
+
+	kafkaEventType := utils.ItemType("kafka_go_event")
+	i.queue.Register(kafkaEventType, func(rawEvent interface{}) {
+		event := rawEvent.(Event)
+
+		// the span of a write is the child of the span in its context, or
+		// else of that of the goroutine writing, or of its ancestors
+		if event.Kind == kindProducer && !event.ParentSpanContext.TraceID.IsValid() {
+			i.goroutines.MustEnrichSpan(&event, event.Goid, i.LibraryName())
+		}
+
+		eventsChan <- i.convertEvent(&event)
+	})
+
+	var event Event
+	for {
+		record, err := i.eventsReader.Read()
+		if err != nil {
+			if errors.Is(err, perf.ErrClosed) {
+				return
+			}
+			logger.Error(err, "error reading from perf reader")
+			continue
+		}
+
+		if record.LostSamples != 0 {
+			logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+			continue
+		}
+
+		if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+			logger.Error(err, "error parsing perf event")
+			metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
+			continue
+		}
+
+		i.queue.Push(event, event.StartTime, kafkaEventType)
+	}
+}
+
+func (i *Instrumentor) convertEvent(e *Event) *events.Event {
+	if e.Kind == kindConsumer {
+		return i.convertConsumerEvent(e)
+	}
+	return i.convertProducerEvent(e)
+}
+
+func (i *Instrumentor) convertProducerEvent(e *Event) *events.Event {
+	topic := unix.ByteSliceToString(e.Topic[:])
+	key := unix.ByteSliceToString(e.Key[:])
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    e.SpanContext.TraceID,
+		SpanID:     e.SpanContext.SpanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	var pscPtr *trace.SpanContext
+	if e.ParentSpanContext.TraceID.IsValid() {
+		psc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    e.ParentSpanContext.TraceID,
+			SpanID:     e.ParentSpanContext.SpanID,
+			TraceFlags: trace.FlagsSampled,
+		})
+		pscPtr = &psc
+	}
+
+	event := &events.Event{
+		Name:              fmt.Sprintf("%s publish", topic),
+		Library:           i.LibraryName(),
+		Kind:              trace.SpanKindProducer,
+		StartTime:         int64(e.StartTime),
+		EndTime:           int64(e.EndTime),
+		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
+		ParentSpanContext: pscPtr,
+		Attributes: []attribute.KeyValue{
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingDestinationName(topic),
+			attribute.Key("go-id").Int64(int64(e.Goid)),
+		},
+	}
+	// the key is only read for the writes of a single message
+	if e.MessageCount > 1 {
+		event.Attributes = append(event.Attributes, semconv.MessagingBatchMessageCount(int(e.MessageCount)))
+	} else if key != "" {
+		event.Attributes = append(event.Attributes, semconv.MessagingKafkaMessageKey(key))
+	}
+
+	// the error is returned to the application, not read by the probes
+	if e.Failed != 0 {
+		event.Status = codes.Error
+		event.StatusDescription = "messages write failed"
+	}
+	return event
+}
+
+func (i *Instrumentor) convertConsumerEvent(e *Event) *events.Event {
+	topic := unix.ByteSliceToString(e.Topic[:])
+	group := unix.ByteSliceToString(e.Group[:])
+	key := unix.ByteSliceToString(e.Key[:])
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    e.SpanContext.TraceID,
+		SpanID:     e.SpanContext.SpanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	// the parent is the span of the producer, propagated in the headers of
+	// the message
+	var pscPtr *trace.SpanContext
+	if e.ParentSpanContext.TraceID.IsValid() {
+		psc := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    e.ParentSpanContext.TraceID,
+			SpanID:     e.ParentSpanContext.SpanID,
+			TraceFlags: trace.FlagsSampled,
+			Remote:     true,
+		})
+		pscPtr = &psc
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystem("kafka"),
+		semconv.MessagingOperationReceive,
+		semconv.MessagingSourceName(topic),
+		semconv.MessagingKafkaSourcePartition(int(e.Partition)),
+		semconv.MessagingKafkaMessageOffset(int(e.Offset)),
+	}
+	if key != "" {
+		attrs = append(attrs, semconv.MessagingKafkaMessageKey(key))
+	}
+	if group != "" {
+		attrs = append(attrs, semconv.MessagingKafkaConsumerGroup(group))
+	}
+
+	return &events.Event{
+		Library:           i.LibraryName(),
+		Name:              fmt.Sprintf("%s receive", topic),
+		Kind:              trace.SpanKindConsumer,
+		StartTime:         int64(e.StartTime),
+		EndTime:           int64(e.EndTime),
+		Attributes:        attrs,
+		ParentSpanContext: pscPtr,
+		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
+	}
+}
+
+// Close stops the Instrumentor.
+func (i *Instrumentor) Close() {
+	log.Logger.V(0).Info("closing segmentio/kafka-go instrumentor")
+	for _, r := range i.uprobes {
+		r.Close()
+	}
+
+	for _, r := range i.returnProbes {
+		r.Close()
+	}
+
+	if i.eventsReader != nil {
+		i.eventsReader.Close()
+	}
+
+	if i.bpfObjects != nil {
+		i.bpfObjects.Close()
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInstrumentorConvertProducerEvent(t *testing.T) {
+	start := time.Now()
+	end := start.Add(10 * time.Millisecond)
+
+	e := &Event{
+		BaseSpanProperties: context.BaseSpanProperties{
+			StartTime:         uint64(start.UnixNano()),
+			EndTime:           uint64(end.UnixNano()),
+			SpanContext:       context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+			ParentSpanContext: context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{3}},
+		},
+		Topic:        [64]byte{'o', 'r', 'd', 'e', 'r', 's'},
+		Key:          [32]byte{'4', '2'},
+		Goid:         7,
+		MessageCount: 1,
+		Kind:         kindProducer,
+	}
+
+	got := New().convertEvent(e)
+	assert.Equal(t, "orders publish", got.Name)
+	assert.Equal(t, trace.SpanKindProducer, got.Kind)
+	assert.Equal(t, codes.Unset, got.Status)
+	require.NotNil(t, got.ParentSpanContext)
+	assert.Equal(t, trace.SpanID{3}, got.ParentSpanContext.SpanID())
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.MessagingSystem("kafka"),
+		semconv.MessagingOperationPublish,
+		semconv.MessagingDestinationName("orders"),
+		attribute.Key("go-id").Int64(7),
+		semconv.MessagingKafkaMessageKey("42"),
+	}, got.Attributes)
+
+	// a batch has no single key
+	e.MessageCount = 3
+	e.Failed = 1
+	got = New().convertEvent(e)
+	assert.Equal(t, codes.Error, got.Status)
+	assert.Contains(t, got.Attributes, semconv.MessagingBatchMessageCount(3))
+	assert.NotContains(t, got.Attributes, semconv.MessagingKafkaMessageKey("42"))
+}
+
+func TestInstrumentorConvertConsumerEvent(t *testing.T) {
+	start := time.Now()
+	end := start.Add(10 * time.Millisecond)
+
+	e := &Event{
+		BaseSpanProperties: context.BaseSpanProperties{
+			StartTime:   uint64(start.UnixNano()),
+			EndTime:     uint64(end.UnixNano()),
+			SpanContext: context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{2}},
+		},
+		Topic:        [64]byte{'o', 'r', 'd', 'e', 'r', 's'},
+		Group:        [64]byte{'b', 'i', 'l', 'l', 'i', 'n', 'g'},
+		Key:          [32]byte{'4', '2'},
+		Offset:       1234,
+		Partition:    3,
+		MessageCount: 1,
+		Kind:         kindConsumer,
+	}
+
+	got := New().convertEvent(e)
+	assert.Equal(t, "orders receive", got.Name)
+	assert.Equal(t, trace.SpanKindConsumer, got.Kind)
+	assert.Nil(t, got.ParentSpanContext, "a message without a trace context starts a trace")
+	assert.Equal(t, []attribute.KeyValue{
+		semconv.MessagingSystem("kafka"),
+		semconv.MessagingOperationReceive,
+		semconv.MessagingSourceName("orders"),
+		semconv.MessagingKafkaSourcePartition(3),
+		semconv.MessagingKafkaMessageOffset(1234),
+		semconv.MessagingKafkaMessageKey("42"),
+		semconv.MessagingKafkaConsumerGroup("billing"),
+	}, got.Attributes)
+
+	// the span of the producer, from the message headers
+	e.ParentSpanContext = context.EBPFSpanContext{TraceID: trace.TraceID{1}, SpanID: trace.SpanID{3}}
+	got = New().convertEvent(e)
+	require.NotNil(t, got.ParentSpanContext)
+	assert.True(t, got.ParentSpanContext.IsRemote())
+	assert.Equal(t, trace.SpanID{3}, got.ParentSpanContext.SpanID())
+}
+
+func TestEventLayout(t *testing.T) {
+	// as struct kafka_span_t of probe.bpf.c
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, Event{}))
+	assert.Equal(t, 272, buf.Len())
+	assert.Equal(t, binary.Size(bpfKafkaSpanT{}), buf.Len())
+}
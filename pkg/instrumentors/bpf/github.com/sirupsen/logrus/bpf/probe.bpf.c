@@ -156,10 +156,14 @@ int uprobe_Logrus_EntryWrite_Returns(struct pt_regs *ctx) {
     struct log_event_t tmpReq = {};
     bpf_probe_read(&tmpReq, sizeof(tmpReq), req_ptr_map);
     tmpReq.end_time = bpf_ktime_get_ns();
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);
 
     tmpReq.goid = get_current_goroutine();
 
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    if (span_sampled(&tmpReq.sc, &tmpReq.psc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    }
     bpf_map_delete_elem(&log_events, &key);
     stop_tracking_span(&tmpReq.sc);
     return 0;
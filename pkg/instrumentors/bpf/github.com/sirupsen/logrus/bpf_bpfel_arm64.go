@@ -17,7 +17,7 @@ type bpfLogEventT struct {
 	EndTime     uint64
 	Sc          bpfSpanContext
 	Psc         bpfSpanContext
-	TraceRoot   uint64
+	TraceFlags  uint64
 	Level       uint64
 	Log         [100]int8
 	_           [4]byte
@@ -85,6 +85,7 @@ type bpfMapSpecs struct {
 	GoroutineScMap   *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
 	GoroutinesMap    *ebpf.MapSpec `ebpf:"goroutines_map"`
 	LogEvents        *ebpf.MapSpec `ebpf:"log_events"`
+	RemoteTraces     *ebpf.MapSpec `ebpf:"remote_traces"`
 	TrackedSpans     *ebpf.MapSpec `ebpf:"tracked_spans"`
 	TrackedSpansBySc *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
 }
@@ -113,6 +114,7 @@ type bpfMaps struct {
 	GoroutineScMap   *ebpf.Map `ebpf:"goroutine_sc_map"`
 	GoroutinesMap    *ebpf.Map `ebpf:"goroutines_map"`
 	LogEvents        *ebpf.Map `ebpf:"log_events"`
+	RemoteTraces     *ebpf.Map `ebpf:"remote_traces"`
 	TrackedSpans     *ebpf.Map `ebpf:"tracked_spans"`
 	TrackedSpansBySc *ebpf.Map `ebpf:"tracked_spans_by_sc"`
 }
@@ -124,6 +126,7 @@ func (m *bpfMaps) Close() error {
 		m.GoroutineScMap,
 		m.GoroutinesMap,
 		m.LogEvents,
+		m.RemoteTraces,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
 	)
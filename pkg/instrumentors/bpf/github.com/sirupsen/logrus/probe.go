@@ -41,6 +41,8 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"
 	"go.opentelemetry.io/auto/pkg/log"
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"
 )
 
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
@@ -64,8 +66,10 @@ type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
 	returnProbes    []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
+	queue           *utils.EventPriorityQueue
+	goroutines      *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -81,8 +85,10 @@ func (i *Instrumentor) FuncNames() []string {
 	return []string{"github.com/sirupsen/logrus.(*Entry).write"}
 }
 
-func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (i *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.GoVersion.Original(), []*inject.StructField{
 		{
 			VarName:    "level_ptr_pos",
 			StructName: "logrus.Entry",
@@ -93,7 +99,15 @@ func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "logrus.Entry",
 			Field:      "Message",
 		},
-	}, nil, false)
+	}
+}
+
+func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	i.queue = ctx.EventQueue
+	i.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := i.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "go", libVersion, fields, nil, false)
 
 	if err != nil {
 		return err
@@ -116,13 +130,13 @@ func (i *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	i.eventsReader = rd
+	i.eventsReader = utils.NewPerfReader(i.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(i.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	i.gmapEventReader = gmrd
+	i.gmapEventReader = utils.NewPerfReader(i.LibraryName(), gmrd)
 
 	return nil
 }
@@ -132,19 +146,19 @@ func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 		WithValues("function", funcName)
 	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function start offset. Skipping")
 		return
 	}
 
 	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function end offset. Skipping")
 		return
 	}
 
-	up, err := ctx.Executable.Uprobe("", i.bpfObjects.UprobeLogrusEntryWrite, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(funcName, i.bpfObjects.UprobeLogrusEntryWrite, offset)
 	if err != nil {
 		logger.Error(err, "could not insert start uprobe. Skipping")
 		return
@@ -153,9 +167,7 @@ func (i *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	i.uprobes = append(i.uprobes, up)
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", i.bpfObjects.UprobeLogrusEntryWriteReturns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(funcName, i.bpfObjects.UprobeLogrusEntryWriteReturns, ret)
 		if err != nil {
 			logger.Error(err, "could not insert return uprobe. Skipping")
 			return
@@ -172,18 +184,18 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	logrusMainEventType := utils.ItemType("logrus_main_event")
 	logrusPlaceholderEventType := utils.ItemType("logrus_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(logrusMainEventType, func(rawEvent interface{}) {
+	i.queue.Register(logrusMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, i.LibraryName())
+		i.goroutines.MustEnrichSpan(&event, event.Goid, i.LibraryName())
 
 		eventsChan <- i.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(logrusPlaceholderEventType, func(rawEvent interface{}) {
+	i.queue.Register(logrusPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, i.LibraryName(), false)
+		i.goroutines.RegisterSpan(&enrichEvent, i.LibraryName(), false)
 
 		if enrichEvent.Psc.TraceID.IsValid() {
 			// middleware created
@@ -211,11 +223,12 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
 				continue
 			}
 
 			// prioritize placeholder event
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, logrusPlaceholderEventType)
+			i.queue.Push(event, event.StartTime-1, logrusPlaceholderEventType)
 		}
 	}()
 
@@ -241,10 +254,11 @@ func (i *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(i.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime, logrusMainEventType)
+			i.queue.Push(event, event.StartTime, logrusMainEventType)
 		}
 	}()
 
@@ -289,6 +303,7 @@ func (i *Instrumentor) convertEvent(e *Event) *events.Event {
 		StartTime:         int64(e.StartTime),
 		EndTime:           int64(e.EndTime),
 		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
 		ParentSpanContext: psc,
 		Attributes: []attribute.KeyValue{
 			msgKey.String(Log),
@@ -300,10 +315,6 @@ func (i *Instrumentor) convertEvent(e *Event) *events.Event {
 
 func (i *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing sirupsen/logrus instrumentor")
-	if i.eventsReader != nil {
-		i.eventsReader.Close()
-	}
-
 	for _, r := range i.uprobes {
 		r.Close()
 	}
@@ -312,6 +323,14 @@ func (i *Instrumentor) Close() {
 		r.Close()
 	}
 
+	if i.eventsReader != nil {
+		i.eventsReader.Close()
+	}
+
+	if i.gmapEventReader != nil {
+		i.gmapEventReader.Close()
+	}
+
 	if i.bpfObjects != nil {
 		i.bpfObjects.Close()
 	}
@@ -18,6 +18,8 @@
 #include "go_context.h"
 #include "uprobe.h"
 #include "gmap.h"
+#include "propagation.h"
+#include "injection_policy.h"
 
 char __license[] SEC("license") = "Dual MIT/GPL";
 
@@ -32,6 +34,7 @@ struct grpc_request_t
     char target[MAX_SIZE];
     u64 goid;
     u64 cur_thread;
+    u64 failed;
 };
 
 struct hpack_header_field
@@ -149,8 +152,15 @@ int uprobe_ClientConn_Invoke(struct pt_regs *ctx)
         }
     }
 
-    // Store to inject later
-    bpf_map_update_elem(&internal_goid_to_span_contexts, &goid, &grpcReq.sc, 0);
+    // Store to inject later. An invalid span context is stored for the
+    // targets the injection policy denies, so that the context of ctx is not
+    // injected instead.
+    if (grpc_injection_allowed(target_ptr, target_len)) {
+        bpf_map_update_elem(&internal_goid_to_span_contexts, &goid, &grpcReq.sc, 0);
+    } else {
+        struct span_context denied = {};
+        bpf_map_update_elem(&internal_goid_to_span_contexts, &goid, &denied, 0);
+    }
 
     // Get key
     void *key = get_consistent_key(ctx, context_ptr);
@@ -177,7 +187,34 @@ int uprobe_ClientConn_Invoke(struct pt_regs *ctx)
     return 0;
 }
 
-UPROBE_RETURN(ClientConn_Invoke, struct grpc_request_t, 3, 0, grpc_events, events)
+// The error returned by Invoke is that of the status of the call, nil if OK.
+SEC("uprobe/ClientConn_Invoke")
+int uprobe_ClientConn_Invoke_Returns(struct pt_regs *ctx)
+{
+    u64 context_pos = 3;
+    void *context_ptr = get_argument(ctx, context_pos);
+    void *key = get_consistent_key(ctx, context_ptr);
+    struct grpc_request_t *req_map = bpf_map_lookup_elem(&grpc_events, &key);
+    if (req_map == NULL)
+    {
+        return 0;
+    }
+    struct grpc_request_t tmpReq = {};
+    bpf_probe_read(&tmpReq, sizeof(tmpReq), req_map);
+    tmpReq.end_time = bpf_ktime_get_ns();
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);
+
+    // the error follows the arguments on the stack
+    tmpReq.failed = get_argument(ctx, is_registers_abi ? 1 : 13) != NULL;
+
+    if (span_sampled(&tmpReq.sc, &tmpReq.psc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    }
+    bpf_map_delete_elem(&grpc_events, &key);
+    stop_tracking_span(&tmpReq.sc);
+    return 0;
+}
 
 // func (l *loopyWriter) headerHandler(h *headerFrame) error
 SEC("uprobe/loopyWriter_headerHandler")
@@ -205,21 +242,25 @@ int uprobe_LoopyWriter_HeaderHandler(struct pt_regs *ctx)
     struct span_context current_span_context = {};
     bpf_probe_read(&current_span_context, sizeof(current_span_context), sc_ptr);
 
-    char tp_key[11] = "traceparent";
-    struct go_string key_str = write_user_go_string(tp_key, sizeof(tp_key));
-    if (key_str.len == 0) {
-        bpf_printk("write failed, aborting ebpf probe");
-        return 0;
-    }
-
     // Write headers
-    char val[SPAN_CONTEXT_STRING_SIZE];
-    span_context_to_w3c_string(&current_span_context, val);
-    struct go_string val_str = write_user_go_string(val, sizeof(val));
-    struct hpack_header_field hf = {};
-    hf.name = key_str;
-    hf.value = val_str;
-    append_item_to_slice(&slice, &hf, sizeof(hf), &slice_user_ptr, &headers_buff_map);
+    for (u32 h = 0; h < PROPAGATION_HEADERS; h++)
+    {
+        struct go_string val_str = propagation_header_value(h, &current_span_context);
+        if (val_str.len == 0)
+        {
+            continue;
+        }
+        struct go_string key_str = propagation_header_key(h);
+        if (key_str.len == 0)
+        {
+            bpf_printk("write failed, aborting ebpf probe");
+            return 0;
+        }
+        struct hpack_header_field hf = {};
+        hf.name = key_str;
+        hf.value = val_str;
+        append_item_to_slice(&slice, &hf, sizeof(hf), &slice_user_ptr, &headers_buff_map);
+    }
     return 0;
 }
 
@@ -240,12 +281,15 @@ int uprobe_http2Client_NewStream(struct pt_regs *ctx)
     struct span_context *current_span_context = get_parent_span_context(context_ptr_val);
 
     // prioritize internal span context
-    void *internal_span_context = bpf_map_lookup_elem(&internal_goid_to_span_contexts, &goid);
+    struct span_context *internal_span_context = bpf_map_lookup_elem(&internal_goid_to_span_contexts, &goid);
     if (internal_span_context != NULL) {
-        bpf_map_update_elem(&streamid_to_span_contexts, &nextid, internal_span_context, 0);
+        if (span_context_is_valid(internal_span_context)) {
+            bpf_map_update_elem(&streamid_to_span_contexts, &nextid, internal_span_context, 0);
+        }
         bpf_map_delete_elem(&internal_goid_to_span_contexts, &goid);
     } else {
-        if (current_span_context != NULL) {
+        // the target of the streams is unknown, the default policy applies
+        if (current_span_context != NULL && default_injection_allowed()) {
             bpf_map_update_elem(&streamid_to_span_contexts, &nextid, current_span_context, 0);
         }
     }
@@ -13,16 +13,17 @@ import (
 )
 
 type bpfGrpcRequestT struct {
-	StartTime uint64
-	EndTime   uint64
-	Sc        bpfSpanContext
-	Psc       bpfSpanContext
-	TraceRoot uint64
-	Method    [50]int8
-	Target    [50]int8
-	_         [4]byte
-	Goid      uint64
-	CurThread uint64
+	StartTime  uint64
+	EndTime    uint64
+	Sc         bpfSpanContext
+	Psc        bpfSpanContext
+	TraceFlags uint64
+	Method     [50]int8
+	Target     [50]int8
+	_          [4]byte
+	Goid       uint64
+	CurThread  uint64
+	Failed     uint64
 }
 
 type bpfHeadersBuff struct{ Buff [500]uint8 }
@@ -83,17 +84,20 @@ type bpfProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfMapSpecs struct {
-	AllocMap                   *ebpf.MapSpec `ebpf:"alloc_map"`
-	Events                     *ebpf.MapSpec `ebpf:"events"`
-	GmapEvents                 *ebpf.MapSpec `ebpf:"gmap_events"`
-	GoroutineScMap             *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
-	GoroutinesMap              *ebpf.MapSpec `ebpf:"goroutines_map"`
-	GrpcEvents                 *ebpf.MapSpec `ebpf:"grpc_events"`
-	HeadersBuffMap             *ebpf.MapSpec `ebpf:"headers_buff_map"`
-	InternalGoidToSpanContexts *ebpf.MapSpec `ebpf:"internal_goid_to_span_contexts"`
-	StreamidToSpanContexts     *ebpf.MapSpec `ebpf:"streamid_to_span_contexts"`
-	TrackedSpans               *ebpf.MapSpec `ebpf:"tracked_spans"`
-	TrackedSpansBySc           *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.MapSpec `ebpf:"alloc_map"`
+	Events                      *ebpf.MapSpec `ebpf:"events"`
+	GmapEvents                  *ebpf.MapSpec `ebpf:"gmap_events"`
+	GoroutineScMap              *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.MapSpec `ebpf:"goroutines_map"`
+	GrpcEvents                  *ebpf.MapSpec `ebpf:"grpc_events"`
+	HeadersBuffMap              *ebpf.MapSpec `ebpf:"headers_buff_map"`
+	InjectionPolicies           *ebpf.MapSpec `ebpf:"injection_policies"`
+	InternalGoidToSpanContexts  *ebpf.MapSpec `ebpf:"internal_goid_to_span_contexts"`
+	PropagatedContextStorageMap *ebpf.MapSpec `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.MapSpec `ebpf:"remote_traces"`
+	StreamidToSpanContexts      *ebpf.MapSpec `ebpf:"streamid_to_span_contexts"`
+	TrackedSpans                *ebpf.MapSpec `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
 }
 
 // bpfObjects contains all objects after they have been loaded into the kernel.
@@ -115,17 +119,20 @@ func (o *bpfObjects) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfMaps struct {
-	AllocMap                   *ebpf.Map `ebpf:"alloc_map"`
-	Events                     *ebpf.Map `ebpf:"events"`
-	GmapEvents                 *ebpf.Map `ebpf:"gmap_events"`
-	GoroutineScMap             *ebpf.Map `ebpf:"goroutine_sc_map"`
-	GoroutinesMap              *ebpf.Map `ebpf:"goroutines_map"`
-	GrpcEvents                 *ebpf.Map `ebpf:"grpc_events"`
-	HeadersBuffMap             *ebpf.Map `ebpf:"headers_buff_map"`
-	InternalGoidToSpanContexts *ebpf.Map `ebpf:"internal_goid_to_span_contexts"`
-	StreamidToSpanContexts     *ebpf.Map `ebpf:"streamid_to_span_contexts"`
-	TrackedSpans               *ebpf.Map `ebpf:"tracked_spans"`
-	TrackedSpansBySc           *ebpf.Map `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.Map `ebpf:"alloc_map"`
+	Events                      *ebpf.Map `ebpf:"events"`
+	GmapEvents                  *ebpf.Map `ebpf:"gmap_events"`
+	GoroutineScMap              *ebpf.Map `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.Map `ebpf:"goroutines_map"`
+	GrpcEvents                  *ebpf.Map `ebpf:"grpc_events"`
+	HeadersBuffMap              *ebpf.Map `ebpf:"headers_buff_map"`
+	InjectionPolicies           *ebpf.Map `ebpf:"injection_policies"`
+	InternalGoidToSpanContexts  *ebpf.Map `ebpf:"internal_goid_to_span_contexts"`
+	PropagatedContextStorageMap *ebpf.Map `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.Map `ebpf:"remote_traces"`
+	StreamidToSpanContexts      *ebpf.Map `ebpf:"streamid_to_span_contexts"`
+	TrackedSpans                *ebpf.Map `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.Map `ebpf:"tracked_spans_by_sc"`
 }
 
 func (m *bpfMaps) Close() error {
@@ -137,7 +144,10 @@ func (m *bpfMaps) Close() error {
 		m.GoroutinesMap,
 		m.GrpcEvents,
 		m.HeadersBuffMap,
+		m.InjectionPolicies,
 		m.InternalGoidToSpanContexts,
+		m.PropagatedContextStorageMap,
+		m.RemoteTraces,
 		m.StreamidToSpanContexts,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
@@ -40,7 +40,10 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -55,14 +58,17 @@ type Event struct {
 	_         [4]byte
 	Goid      uint64
 	CurThread uint64
+	Failed    uint64
 }
 
 // Instrumentor is the gRPC client instrumentor.
 type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
+	queue           *utils.EventPriorityQueue
+	goroutines      *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -83,13 +89,10 @@ func (g *Instrumentor) FuncNames() []string {
 		"google.golang.org/grpc/internal/transport.(*loopyWriter).headerHandler"}
 }
 
-// Load loads all instrumentation offsets.
-func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	libVersion, exists := ctx.TargetDetails.Libraries[g.LibraryName()]
-	if !exists {
-		libVersion = ""
-	}
-	spec, err := ctx.Injector.Inject(loadBpf, g.LibraryName(), libVersion, []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (g *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.Libraries[g.LibraryName()], []*inject.StructField{
 		{
 			VarName:    "clientconn_target_ptr_pos",
 			StructName: "google.golang.org/grpc.ClientConn",
@@ -110,7 +113,16 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "google.golang.org/grpc/internal/transport.headerFrame",
 			Field:      "streamID",
 		},
-	}, nil, true)
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	g.queue = ctx.EventQueue
+	g.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := g.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, g.LibraryName(), libVersion, fields, nil, true)
 
 	if err != nil {
 		return err
@@ -127,14 +139,17 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 		return err
 	}
 
+	// the policy is in place before the first request is traced
+	if err := ctx.InjectionPolicy.Apply(g.bpfObjects.InjectionPolicies); err != nil {
+		return err
+	}
+
 	offset, err := ctx.TargetDetails.GetFunctionOffset(g.FuncNames()[0])
 	if err != nil {
 		return err
 	}
 
-	up, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeClientConnInvoke, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(g.FuncNames()[0], g.bpfObjects.UprobeClientConnInvoke, offset)
 	if err != nil {
 		return err
 	}
@@ -147,9 +162,7 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	}
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeClientConnInvokeReturns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(g.FuncNames()[0], g.bpfObjects.UprobeClientConnInvokeReturns, ret)
 		if err != nil {
 			return err
 		}
@@ -161,9 +174,7 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	sendMsgProbe, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeHttp2ClientNewStream, &link.UprobeOptions{
-		Address: sendMsgOffset,
-	})
+	sendMsgProbe, err := ctx.Uprobe(g.FuncNames()[1], g.bpfObjects.UprobeHttp2ClientNewStream, sendMsgOffset)
 	if err != nil {
 		return err
 	}
@@ -175,9 +186,7 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 		return err
 	}
 
-	whProbe, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeLoopyWriterHeaderHandler, &link.UprobeOptions{
-		Address: whOffset,
-	})
+	whProbe, err := ctx.Uprobe(g.FuncNames()[2], g.bpfObjects.UprobeLoopyWriterHeaderHandler, whOffset)
 	if err != nil {
 		return err
 	}
@@ -188,13 +197,13 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	g.eventsReader = rd
+	g.eventsReader = utils.NewPerfReader(g.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(g.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	g.gmapEventReader = gmrd
+	g.gmapEventReader = utils.NewPerfReader(g.LibraryName(), gmrd)
 
 	return nil
 }
@@ -208,22 +217,22 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	grpcClientMainEventType := utils.ItemType("gprc_client_main_event")
 	grpcClientPlaceholderEventType := utils.ItemType("grpc_client_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(grpcClientMainEventType, func(rawEvent interface{}) {
+	g.queue.Register(grpcClientMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, g.LibraryName())
+		g.goroutines.MustEnrichSpan(&event, event.Goid, g.LibraryName())
 
 		eventsChan <- g.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(grpcClientPlaceholderEventType, func(rawEvent interface{}) {
+	g.queue.Register(grpcClientPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 		if event.Type == 4 {
 			return
 		}
 
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, g.LibraryName(), false)
+		g.goroutines.RegisterSpan(&enrichEvent, g.LibraryName(), false)
 
 		if enrichEvent.Psc.TraceID.IsValid() {
 			// middleware created
@@ -251,10 +260,11 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(g.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime, grpcClientMainEventType)
+			g.queue.Push(event, event.StartTime, grpcClientMainEventType)
 		}
 	}()
 
@@ -278,10 +288,11 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(g.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, grpcClientPlaceholderEventType)
+			g.queue.Push(event, event.StartTime-1, grpcClientPlaceholderEventType)
 		}
 	}()
 
@@ -324,7 +335,7 @@ func (g *Instrumentor) convertEvent(e *Event) *events.Event {
 		pscPtr = nil
 	}
 
-	return &events.Event{
+	event := &events.Event{
 		Library:           g.LibraryName(),
 		Name:              method,
 		Kind:              trace.SpanKindClient,
@@ -332,13 +343,24 @@ func (g *Instrumentor) convertEvent(e *Event) *events.Event {
 		EndTime:           int64(e.EndTime),
 		Attributes:        attrs,
 		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
 		ParentSpanContext: pscPtr,
 	}
+
+	// the calls fail with a status other than OK
+	if e.Failed != 0 {
+		event.Status, event.StatusDescription = codes.Error, "call failed"
+	}
+	return event
 }
 
 // Close stops the Instrumentor.
 func (g *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing gRPC instrumentor")
+	for _, r := range g.uprobes {
+		r.Close()
+	}
+
 	if g.eventsReader != nil {
 		g.eventsReader.Close()
 	}
@@ -347,10 +369,6 @@ func (g *Instrumentor) Close() {
 		g.gmapEventReader.Close()
 	}
 
-	for _, r := range g.uprobes {
-		r.Close()
-	}
-
 	if g.bpfObjects != nil {
 		g.bpfObjects.Close()
 	}
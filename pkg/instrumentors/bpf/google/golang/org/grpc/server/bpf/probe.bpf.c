@@ -18,6 +18,7 @@
 #include "go_context.h"
 #include "uprobe.h"
 #include "gmap.h"
+#include "propagation.h"
 
 char __license[] SEC("license") = "Dual MIT/GPL";
 
@@ -25,8 +26,6 @@ char __license[] SEC("license") = "Dual MIT/GPL";
 #define MAX_CONCURRENT 50
 #define MAX_HEADERS 20
 #define MAX_HEADER_STRING 50
-#define W3C_KEY_LENGTH 11
-#define W3C_VAL_LENGTH 55
 
 struct grpc_request_t
 {
@@ -144,7 +143,12 @@ int uprobe_server_handleStream_Returns(struct pt_regs *ctx) {
     struct grpc_request_t tmpReq = {};
     bpf_probe_read(&tmpReq, sizeof(tmpReq), req_ptr_map);
     tmpReq.end_time = bpf_ktime_get_ns();
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);
+    // the root span decides for its trace
+    if (root_span_sampled(&tmpReq.sc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    }
     bpf_map_delete_elem(&grpc_events, &key);
     stop_tracking_span(&tmpReq.sc);
 
@@ -161,7 +165,11 @@ int uprobe_decodeState_decodeHeader(struct pt_regs *ctx)
     void *frame_ptr = get_argument(ctx, frame_pos);
     struct go_slice header_fields = {};
     bpf_probe_read(&header_fields, sizeof(header_fields), (void *)(frame_ptr + frame_fields_pos));
-    char key[W3C_KEY_LENGTH] = "traceparent";
+    struct propagated_context *pc = new_propagated_context();
+    if (pc == NULL)
+    {
+        return 0;
+    }
     for (s32 i = 0; i < MAX_HEADERS; i++)
     {
         if (i >= header_fields.len)
@@ -170,26 +178,30 @@ int uprobe_decodeState_decodeHeader(struct pt_regs *ctx)
         }
         struct hpack_header_field hf = {};
         long res = bpf_probe_read(&hf, sizeof(hf), (void *)(header_fields.array + (i * sizeof(hf))));
-        if (hf.name.len == W3C_KEY_LENGTH && hf.value.len == W3C_VAL_LENGTH)
+        if (res < 0)
+        {
+            continue;
+        }
+        s32 header = propagation_header_of(hf.name.str, hf.name.len);
+        if (header < 0)
         {
-            char current_key[W3C_KEY_LENGTH];
-            bpf_probe_read(current_key, sizeof(current_key), hf.name.str);
-            if (bpf_memcmp(key, current_key, sizeof(key)))
-            {
-                char val[W3C_VAL_LENGTH];
-                bpf_probe_read(val, W3C_VAL_LENGTH, hf.value.str);
-
-                // Get stream id
-                void *headers_frame = NULL;
-                bpf_probe_read(&headers_frame, sizeof(headers_frame), frame_ptr);
-                u32 stream_id = 0;
-                bpf_probe_read(&stream_id, sizeof(stream_id), (void *)(headers_frame + frame_stream_id_pod));
-                struct grpc_request_t grpcReq = {};
-                w3c_string_to_span_context(val, &grpcReq.psc);
-                bpf_map_update_elem(&streamid_to_grpc_events, &stream_id, &grpcReq, 0);
-            }
+            continue;
         }
+        extract_propagation_header(pc, header, hf.value.str, hf.value.len);
     }
+    if (!finish_propagated_context(pc))
+    {
+        return 0;
+    }
+
+    // Get stream id
+    void *headers_frame = NULL;
+    bpf_probe_read(&headers_frame, sizeof(headers_frame), frame_ptr);
+    u32 stream_id = 0;
+    bpf_probe_read(&stream_id, sizeof(stream_id), (void *)(headers_frame + frame_stream_id_pod));
+    struct grpc_request_t grpcReq = {};
+    grpcReq.psc = pc->sc;
+    bpf_map_update_elem(&streamid_to_grpc_events, &stream_id, &grpcReq, 0);
 
     return 0;
-}
\ No newline at end of file
+}
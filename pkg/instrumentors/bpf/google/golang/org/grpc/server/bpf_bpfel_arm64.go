@@ -13,15 +13,15 @@ import (
 )
 
 type bpfGrpcRequestT struct {
-	StartTime uint64
-	EndTime   uint64
-	Sc        bpfSpanContext
-	Psc       bpfSpanContext
-	TraceRoot uint64
-	Method    [100]int8
-	_         [4]byte
-	Goid      uint64
-	CurThread uint64
+	StartTime  uint64
+	EndTime    uint64
+	Sc         bpfSpanContext
+	Psc        bpfSpanContext
+	TraceFlags uint64
+	Method     [100]int8
+	_          [4]byte
+	Goid       uint64
+	CurThread  uint64
 }
 
 type bpfSpanContext struct {
@@ -79,15 +79,17 @@ type bpfProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfMapSpecs struct {
-	AllocMap             *ebpf.MapSpec `ebpf:"alloc_map"`
-	Events               *ebpf.MapSpec `ebpf:"events"`
-	GmapEvents           *ebpf.MapSpec `ebpf:"gmap_events"`
-	GoroutineScMap       *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
-	GoroutinesMap        *ebpf.MapSpec `ebpf:"goroutines_map"`
-	GrpcEvents           *ebpf.MapSpec `ebpf:"grpc_events"`
-	StreamidToGrpcEvents *ebpf.MapSpec `ebpf:"streamid_to_grpc_events"`
-	TrackedSpans         *ebpf.MapSpec `ebpf:"tracked_spans"`
-	TrackedSpansBySc     *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.MapSpec `ebpf:"alloc_map"`
+	Events                      *ebpf.MapSpec `ebpf:"events"`
+	GmapEvents                  *ebpf.MapSpec `ebpf:"gmap_events"`
+	GoroutineScMap              *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.MapSpec `ebpf:"goroutines_map"`
+	GrpcEvents                  *ebpf.MapSpec `ebpf:"grpc_events"`
+	PropagatedContextStorageMap *ebpf.MapSpec `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.MapSpec `ebpf:"remote_traces"`
+	StreamidToGrpcEvents        *ebpf.MapSpec `ebpf:"streamid_to_grpc_events"`
+	TrackedSpans                *ebpf.MapSpec `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
 }
 
 // bpfObjects contains all objects after they have been loaded into the kernel.
@@ -109,15 +111,17 @@ func (o *bpfObjects) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfMaps struct {
-	AllocMap             *ebpf.Map `ebpf:"alloc_map"`
-	Events               *ebpf.Map `ebpf:"events"`
-	GmapEvents           *ebpf.Map `ebpf:"gmap_events"`
-	GoroutineScMap       *ebpf.Map `ebpf:"goroutine_sc_map"`
-	GoroutinesMap        *ebpf.Map `ebpf:"goroutines_map"`
-	GrpcEvents           *ebpf.Map `ebpf:"grpc_events"`
-	StreamidToGrpcEvents *ebpf.Map `ebpf:"streamid_to_grpc_events"`
-	TrackedSpans         *ebpf.Map `ebpf:"tracked_spans"`
-	TrackedSpansBySc     *ebpf.Map `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.Map `ebpf:"alloc_map"`
+	Events                      *ebpf.Map `ebpf:"events"`
+	GmapEvents                  *ebpf.Map `ebpf:"gmap_events"`
+	GoroutineScMap              *ebpf.Map `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.Map `ebpf:"goroutines_map"`
+	GrpcEvents                  *ebpf.Map `ebpf:"grpc_events"`
+	PropagatedContextStorageMap *ebpf.Map `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.Map `ebpf:"remote_traces"`
+	StreamidToGrpcEvents        *ebpf.Map `ebpf:"streamid_to_grpc_events"`
+	TrackedSpans                *ebpf.Map `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.Map `ebpf:"tracked_spans_by_sc"`
 }
 
 func (m *bpfMaps) Close() error {
@@ -128,6 +132,8 @@ func (m *bpfMaps) Close() error {
 		m.GoroutineScMap,
 		m.GoroutinesMap,
 		m.GrpcEvents,
+		m.PropagatedContextStorageMap,
+		m.RemoteTraces,
 		m.StreamidToGrpcEvents,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
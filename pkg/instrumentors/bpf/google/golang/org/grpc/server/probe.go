@@ -39,6 +39,8 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
 	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
@@ -61,8 +63,10 @@ type Instrumentor struct {
 	uprobe          link.Link
 	returnProbs     []link.Link
 	headersProbe    link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
+	queue           *utils.EventPriorityQueue
+	goroutines      *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -82,14 +86,10 @@ func (g *Instrumentor) FuncNames() []string {
 		"google.golang.org/grpc/internal/transport.(*http2Server).operateHeaders"}
 }
 
-// Load loads all instrumentation offsets.
-func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	targetLib := "google.golang.org/grpc"
-	libVersion, exists := ctx.TargetDetails.Libraries[targetLib]
-	if !exists {
-		libVersion = ""
-	}
-	spec, err := ctx.Injector.Inject(loadBpf, "google.golang.org/grpc", libVersion, []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (g *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.Libraries["google.golang.org/grpc"], []*inject.StructField{
 		{
 			VarName:    "stream_method_ptr_pos",
 			StructName: "google.golang.org/grpc/internal/transport.Stream",
@@ -115,7 +115,16 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "golang.org/x/net/http2.FrameHeader",
 			Field:      "StreamID",
 		},
-	}, nil, true)
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	g.queue = ctx.EventQueue
+	g.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := g.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "google.golang.org/grpc", libVersion, fields, nil, true)
 
 	if err != nil {
 		return err
@@ -136,9 +145,7 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 		return err
 	}
 
-	up, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeServerHandleStream, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(g.FuncNames()[0], g.bpfObjects.UprobeServerHandleStream, offset)
 	if err != nil {
 		return err
 	}
@@ -150,9 +157,7 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	}
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeServerHandleStreamReturns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(g.FuncNames()[0], g.bpfObjects.UprobeServerHandleStreamReturns, ret)
 		if err != nil {
 			return err
 		}
@@ -163,9 +168,7 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	hProbe, err := ctx.Executable.Uprobe("", g.bpfObjects.UprobeDecodeStateDecodeHeader, &link.UprobeOptions{
-		Address: headerOffset,
-	})
+	hProbe, err := ctx.Uprobe(g.FuncNames()[1], g.bpfObjects.UprobeDecodeStateDecodeHeader, headerOffset)
 	if err != nil {
 		return err
 	}
@@ -175,13 +178,13 @@ func (g *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	g.eventsReader = rd
+	g.eventsReader = utils.NewPerfReader(g.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(g.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	g.gmapEventReader = gmrd
+	g.gmapEventReader = utils.NewPerfReader(g.LibraryName(), gmrd)
 
 	return nil
 }
@@ -195,15 +198,15 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	grpcServerMainEventType := utils.ItemType("grpc_server_main_event")
 	grpcServerPlaceholderEventType := utils.ItemType("grpc_server_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(grpcServerMainEventType, func(rawEvent interface{}) {
+	g.queue.Register(grpcServerMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, g.LibraryName())
+		g.goroutines.MustEnrichSpan(&event, event.Goid, g.LibraryName())
 
 		eventsChan <- g.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(grpcServerPlaceholderEventType, func(rawEvent interface{}) {
+	g.queue.Register(grpcServerPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 
 		if event.Type != gmap.GoId2Sc {
@@ -212,7 +215,7 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 		}
 
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, g.LibraryName(), true)
+		g.goroutines.RegisterSpan(&enrichEvent, g.LibraryName(), true)
 	})
 
 	go func() {
@@ -235,10 +238,11 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(g.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime, grpcServerMainEventType)
+			g.queue.Push(event, event.StartTime, grpcServerMainEventType)
 		}
 	}()
 
@@ -262,10 +266,11 @@ func (g *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
 				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(g.LibraryName()).Inc()
 				continue
 			}
 
-			utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, grpcServerPlaceholderEventType)
+			g.queue.Push(event, event.StartTime-1, grpcServerPlaceholderEventType)
 		}
 	}()
 
@@ -307,20 +312,13 @@ func (g *Instrumentor) convertEvent(e *Event) *events.Event {
 		},
 		ParentSpanContext: pscPtr,
 		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
 	}
 }
 
 // Close stops the Instrumentor.
 func (g *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing gRPC server instrumentor")
-	if g.eventsReader != nil {
-		g.eventsReader.Close()
-	}
-
-	if g.gmapEventReader != nil {
-		g.gmapEventReader.Close()
-	}
-
 	if g.uprobe != nil {
 		g.uprobe.Close()
 	}
@@ -333,6 +331,14 @@ func (g *Instrumentor) Close() {
 		g.headersProbe.Close()
 	}
 
+	if g.eventsReader != nil {
+		g.eventsReader.Close()
+	}
+
+	if g.gmapEventReader != nil {
+		g.gmapEventReader.Close()
+	}
+
 	if g.bpfObjects != nil {
 		g.bpfObjects.Close()
 	}
@@ -4,13 +4,13 @@
 #include "go_types.h"
 #include "uprobe.h"
 #include "gmap.h"
+#include "propagation.h"
+#include "injection_policy.h"
 
 char __license[] SEC("license") = "Dual MIT/GPL";
 
 #define MAX_PATH_SIZE 50
 #define MAX_METHOD_SIZE 10
-#define W3C_KEY_LENGTH 11
-#define W3C_VAL_LENGTH 55
 #define MAX_CONCURRENT 30
 
 struct http_request_t {
@@ -19,6 +19,8 @@ struct http_request_t {
     char path[MAX_PATH_SIZE];
     u64 goid;
     u64 cur_thread;
+    u64 status_code;
+    u32 failed;
 };
 
 struct {
@@ -43,10 +45,15 @@ struct {
 volatile const u64 method_ptr_pos;
 volatile const u64 url_ptr_pos;
 volatile const u64 path_ptr_pos;
+volatile const u64 host_ptr_pos;
+volatile const u64 scheme_ptr_pos;
 volatile const u64 headers_ptr_pos;
 volatile const u64 ctx_ptr_pos;
+volatile const u64 status_code_pos;
 
-static __always_inline long inject_header(void* headers_ptr, struct span_context* propagated_ctx) {
+// Injects the headers of the propagation formats selected, propagating
+// propagated_ctx, into the headers map.
+static __always_inline long inject_headers(void* headers_ptr, struct span_context* propagated_ctx) {
 
     // Read headers map count
     u64 map_keyvalue_count = 0;
@@ -77,58 +84,57 @@ static __always_inline long inject_header(void* headers_ptr, struct span_context
 
     void *map_keyvalues_ptr = NULL;
     bpf_probe_read(&map_keyvalues_ptr, sizeof(map_keyvalues_ptr), headers_ptr + 16);
-    void *injected_key_ptr = map_keyvalues_ptr + 8 + (16 * map_keyvalue_count);
-    char traceparent_tophash = 0xee;
-    void *tophashes_ptr = map_keyvalues_ptr +  map_keyvalue_count;
-    res = bpf_probe_write_user(tophashes_ptr, &traceparent_tophash, 1);
 
-    if(res < 0) {
-        bpf_printk("Failed to write tophash, return code: %d", res);
-        return -1;
-    }
-
-    char key[W3C_KEY_LENGTH] = "traceparent";
-    void *ptr = write_target_data(key, W3C_KEY_LENGTH);
-
-    res = bpf_probe_write_user(injected_key_ptr, &ptr, sizeof(ptr));
-    if(res < 0) {
-        return -1;
-    }
+    for (u32 h = 0; h < PROPAGATION_HEADERS; h++) {
+        struct go_string header_value = propagation_header_value(h, propagated_ctx);
+        if (header_value.len == 0) {
+            continue;
+        }
+        if (map_keyvalue_count >= 8) {
+            bpf_printk("No room left in the headers map, skipping context propagation");
+            break;
+        }
 
-    u64 header_key_length = W3C_KEY_LENGTH;
-    res = bpf_probe_write_user(injected_key_ptr + 8, &header_key_length, sizeof(header_key_length));
+        void *injected_key_ptr = map_keyvalues_ptr + 8 + (16 * map_keyvalue_count);
+        char tophash = 0xee;
+        void *tophashes_ptr = map_keyvalues_ptr +  map_keyvalue_count;
+        res = bpf_probe_write_user(tophashes_ptr, &tophash, 1);
 
-    if(res < 0) {
-        return -1;
-    }
+        if(res < 0) {
+            bpf_printk("Failed to write tophash, return code: %d", res);
+            return -1;
+        }
 
-    void *injected_value_ptr = injected_key_ptr + (16 * (8 - map_keyvalue_count)) + 24 * map_keyvalue_count;
-    char val[W3C_VAL_LENGTH];
-    span_context_to_w3c_string(propagated_ctx, val);
+        struct go_string header_key = propagation_header_key(h);
+        if (header_key.len == 0) {
+            return -1;
+        }
+        res = bpf_probe_write_user(injected_key_ptr, &header_key, sizeof(header_key));
+        if(res < 0) {
+            return -1;
+        }
 
-    ptr = write_target_data(val, sizeof(val));
-    struct go_string header_value = {};
-    header_value.str = ptr;
-    header_value.len = W3C_VAL_LENGTH;
+        void *injected_value_ptr = injected_key_ptr + (16 * (8 - map_keyvalue_count)) + 24 * map_keyvalue_count;
+        void *ptr = write_target_data((void*)&header_value, sizeof(header_value));
 
-    ptr = write_target_data((void*)&header_value, sizeof(header_value));
+        if(ptr == NULL) {
+            return -1;
+        }
 
-    if(ptr == NULL) {
-        return -1;
-    }
+        struct go_slice values_slice = {};
+        values_slice.array = ptr;
+        values_slice.len = 1;
+        values_slice.cap = 1;
 
-    struct go_slice values_slice = {};
-    values_slice.array = ptr;
-    values_slice.len = 1;
-    values_slice.cap = 1;
+        res = bpf_probe_write_user(injected_value_ptr, &values_slice, sizeof(values_slice));
 
-    res = bpf_probe_write_user(injected_value_ptr, &values_slice, sizeof(values_slice));
+        if(res < 0) {
+            return -1;
+        }
 
-    if(res < 0) {
-        return -1;
+        map_keyvalue_count += 1;
     }
 
-    map_keyvalue_count += 1;
     res = bpf_probe_write_user(headers_ptr, &map_keyvalue_count, sizeof(map_keyvalue_count));
 
     if(res < 0) {
@@ -198,14 +204,29 @@ int uprobe_HttpClient_Do(struct pt_regs *ctx) {
     path_size = path_size < path_len ? path_size : path_len;
     bpf_probe_read(&httpReq.path, path_size, path_ptr);
 
-    // get headers from Request
-    void *headers_ptr = 0;
-    bpf_probe_read(&headers_ptr, sizeof(headers_ptr), (void *)(req_ptr+headers_ptr_pos));
-    u64 map_keyvalue_count = 0;
-    bpf_probe_read(&map_keyvalue_count, sizeof(map_keyvalue_count), headers_ptr);
-    long res = inject_header(headers_ptr, &httpReq.sc);
-    if (res < 0) {
-        bpf_printk("uprobe_HttpClient_Do: Failed to inject header");
+    // get host and scheme from Request.URL, to apply the injection policy
+    void *host_ptr = 0;
+    bpf_probe_read(&host_ptr, sizeof(host_ptr), (void *)(url_ptr+host_ptr_pos));
+    u64 host_len = 0;
+    bpf_probe_read(&host_len, sizeof(host_len), (void *)(url_ptr+(host_ptr_pos+8)));
+    void *scheme_ptr = 0;
+    bpf_probe_read(&scheme_ptr, sizeof(scheme_ptr), (void *)(url_ptr+scheme_ptr_pos));
+    u64 scheme_len = 0;
+    bpf_probe_read(&scheme_len, sizeof(scheme_len), (void *)(url_ptr+(scheme_ptr_pos+8)));
+    char scheme[5] = {};
+    if (scheme_len == sizeof(scheme)) {
+        bpf_probe_read(scheme, sizeof(scheme), scheme_ptr);
+    }
+    bool secure = scheme[0] == 'h' && scheme[1] == 't' && scheme[2] == 't' && scheme[3] == 'p' && scheme[4] == 's';
+
+    if (http_injection_allowed(host_ptr, host_len, secure)) {
+        // get headers from Request
+        void *headers_ptr = 0;
+        bpf_probe_read(&headers_ptr, sizeof(headers_ptr), (void *)(req_ptr+headers_ptr_pos));
+        long res = inject_headers(headers_ptr, &httpReq.sc);
+        if (res < 0) {
+            bpf_printk("uprobe_HttpClient_Do: Failed to inject header");
+        }
     }
 
     // Write event
@@ -234,5 +255,33 @@ int uprobe_HttpClient_Do(struct pt_regs *ctx) {
 }
 
 // This instrumentation attaches uretprobe to the following function:
-// func net/http/client.Do(req *Request)
-UPROBE_RETURN(HttpClient_Do, struct http_request_t, 2, ctx_ptr_pos, http_events, events)
\ No newline at end of file
+// func net/http/client.Do(req *Request) (*Response, error)
+SEC("uprobe/HttpClient_Do")
+int uprobe_HttpClient_Do_Returns(struct pt_regs *ctx) {
+    u64 request_pos = 2;
+    void *req_ptr = get_argument(ctx, request_pos);
+    void *key = get_consistent_key(ctx, (void *)(req_ptr+ctx_ptr_pos));
+    struct http_request_t *req_map = bpf_map_lookup_elem(&http_events, &key);
+    if (req_map == NULL) {
+        return 0;
+    }
+    struct http_request_t tmpReq = {};
+    bpf_probe_read(&tmpReq, sizeof(tmpReq), req_map);
+    tmpReq.end_time = bpf_ktime_get_ns();
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);
+
+    // the response, or else the error, is returned, after the arguments on
+    // the stack
+    void *resp_ptr = get_argument(ctx, is_registers_abi ? 1 : 3);
+    if (resp_ptr != NULL) {
+        bpf_probe_read(&tmpReq.status_code, sizeof(tmpReq.status_code), (void *)(resp_ptr+status_code_pos));
+    }
+    tmpReq.failed = get_argument(ctx, is_registers_abi ? 2 : 4) != NULL;
+
+    if (span_sampled(&tmpReq.sc, &tmpReq.psc)) {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    }
+    bpf_map_delete_elem(&http_events, &key);
+    stop_tracking_span(&tmpReq.sc);
+    return 0;
+}
\ No newline at end of file
@@ -13,16 +13,19 @@ import (
 )
 
 type bpfHttpRequestT struct {
-	StartTime uint64
-	EndTime   uint64
-	Sc        bpfSpanContext
-	Psc       bpfSpanContext
-	TraceRoot uint64
-	Method    [10]int8
-	Path      [50]int8
-	_         [4]byte
-	Goid      uint64
-	CurThread uint64
+	StartTime  uint64
+	EndTime    uint64
+	Sc         bpfSpanContext
+	Psc        bpfSpanContext
+	TraceFlags uint64
+	Method     [10]int8
+	Path       [50]int8
+	_          [4]byte
+	Goid       uint64
+	CurThread  uint64
+	StatusCode uint64
+	Failed     uint32
+	_          [4]byte
 }
 
 type bpfSpanContext struct {
@@ -79,15 +82,18 @@ type bpfProgramSpecs struct {
 //
 // It can be passed ebpf.CollectionSpec.Assign.
 type bpfMapSpecs struct {
-	AllocMap                  *ebpf.MapSpec `ebpf:"alloc_map"`
-	Events                    *ebpf.MapSpec `ebpf:"events"`
-	GmapEvents                *ebpf.MapSpec `ebpf:"gmap_events"`
-	GolangMapbucketStorageMap *ebpf.MapSpec `ebpf:"golang_mapbucket_storage_map"`
-	GoroutineScMap            *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
-	GoroutinesMap             *ebpf.MapSpec `ebpf:"goroutines_map"`
-	HttpEvents                *ebpf.MapSpec `ebpf:"http_events"`
-	TrackedSpans              *ebpf.MapSpec `ebpf:"tracked_spans"`
-	TrackedSpansBySc          *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.MapSpec `ebpf:"alloc_map"`
+	Events                      *ebpf.MapSpec `ebpf:"events"`
+	GmapEvents                  *ebpf.MapSpec `ebpf:"gmap_events"`
+	GolangMapbucketStorageMap   *ebpf.MapSpec `ebpf:"golang_mapbucket_storage_map"`
+	GoroutineScMap              *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.MapSpec `ebpf:"goroutines_map"`
+	HttpEvents                  *ebpf.MapSpec `ebpf:"http_events"`
+	InjectionPolicies           *ebpf.MapSpec `ebpf:"injection_policies"`
+	PropagatedContextStorageMap *ebpf.MapSpec `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.MapSpec `ebpf:"remote_traces"`
+	TrackedSpans                *ebpf.MapSpec `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
 }
 
 // bpfObjects contains all objects after they have been loaded into the kernel.
@@ -109,15 +115,18 @@ func (o *bpfObjects) Close() error {
 //
 // It can be passed to loadBpfObjects or ebpf.CollectionSpec.LoadAndAssign.
 type bpfMaps struct {
-	AllocMap                  *ebpf.Map `ebpf:"alloc_map"`
-	Events                    *ebpf.Map `ebpf:"events"`
-	GmapEvents                *ebpf.Map `ebpf:"gmap_events"`
-	GolangMapbucketStorageMap *ebpf.Map `ebpf:"golang_mapbucket_storage_map"`
-	GoroutineScMap            *ebpf.Map `ebpf:"goroutine_sc_map"`
-	GoroutinesMap             *ebpf.Map `ebpf:"goroutines_map"`
-	HttpEvents                *ebpf.Map `ebpf:"http_events"`
-	TrackedSpans              *ebpf.Map `ebpf:"tracked_spans"`
-	TrackedSpansBySc          *ebpf.Map `ebpf:"tracked_spans_by_sc"`
+	AllocMap                    *ebpf.Map `ebpf:"alloc_map"`
+	Events                      *ebpf.Map `ebpf:"events"`
+	GmapEvents                  *ebpf.Map `ebpf:"gmap_events"`
+	GolangMapbucketStorageMap   *ebpf.Map `ebpf:"golang_mapbucket_storage_map"`
+	GoroutineScMap              *ebpf.Map `ebpf:"goroutine_sc_map"`
+	GoroutinesMap               *ebpf.Map `ebpf:"goroutines_map"`
+	HttpEvents                  *ebpf.Map `ebpf:"http_events"`
+	InjectionPolicies           *ebpf.Map `ebpf:"injection_policies"`
+	PropagatedContextStorageMap *ebpf.Map `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.Map `ebpf:"remote_traces"`
+	TrackedSpans                *ebpf.Map `ebpf:"tracked_spans"`
+	TrackedSpansBySc            *ebpf.Map `ebpf:"tracked_spans_by_sc"`
 }
 
 func (m *bpfMaps) Close() error {
@@ -129,6 +138,9 @@ func (m *bpfMaps) Close() error {
 		m.GoroutineScMap,
 		m.GoroutinesMap,
 		m.HttpEvents,
+		m.InjectionPolicies,
+		m.PropagatedContextStorageMap,
+		m.RemoteTraces,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
 	)
@@ -38,7 +38,10 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -49,11 +52,14 @@ import (
 // request-response.
 type Event struct {
 	context.BaseSpanProperties
-	Method    [10]byte
-	Path      [50]byte
-	_         [4]byte
-	Goid      uint64
-	CurThread uint64
+	Method     [10]byte
+	Path       [50]byte
+	_          [4]byte
+	Goid       uint64
+	CurThread  uint64
+	StatusCode uint64
+	Failed     uint32
+	_          [4]byte
 }
 
 // Instrumentor is the net/http instrumentor.
@@ -61,13 +67,13 @@ type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
 	returnProbs     []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
 
 	perfRecordChan chan perf.Record
-	perfRecordDone chan struct{}
 	perfGmapChan   chan perf.Record
-	perfGmapDone   chan struct{}
+	queue          *utils.EventPriorityQueue
+	goroutines     *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -75,8 +81,6 @@ func New() *Instrumentor {
 	return &Instrumentor{
 		perfRecordChan: make(chan perf.Record, 1000),
 		perfGmapChan:   make(chan perf.Record, 1000),
-		perfRecordDone: make(chan struct{}, 1),
-		perfGmapDone:   make(chan struct{}, 1),
 	}
 }
 
@@ -90,9 +94,10 @@ func (h *Instrumentor) FuncNames() []string {
 	return []string{"net/http.(*Client).do"}
 }
 
-// Load loads all instrumentation offsets.
-func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), []*inject.StructField{
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (h *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.GoVersion.Original(), []*inject.StructField{
 		{
 			VarName:    "method_ptr_pos",
 			StructName: "net/http.Request",
@@ -108,6 +113,16 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "net/url.URL",
 			Field:      "Path",
 		},
+		{
+			VarName:    "host_ptr_pos",
+			StructName: "net/url.URL",
+			Field:      "Host",
+		},
+		{
+			VarName:    "scheme_ptr_pos",
+			StructName: "net/url.URL",
+			Field:      "Scheme",
+		},
 		{
 			VarName:    "headers_ptr_pos",
 			StructName: "net/http.Request",
@@ -118,7 +133,21 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "net/http.Request",
 			Field:      "ctx",
 		},
-	}, nil, true)
+		{
+			VarName:    "status_code_pos",
+			StructName: "net/http.Response",
+			Field:      "StatusCode",
+		},
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	h.queue = ctx.EventQueue
+	h.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := h.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "go", libVersion, fields, nil, true)
 
 	if err != nil {
 		return err
@@ -135,15 +164,18 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 		return err
 	}
 
+	// the policy is in place before the first request is traced
+	if err := ctx.InjectionPolicy.Apply(h.bpfObjects.InjectionPolicies); err != nil {
+		return err
+	}
+
 	offset, err := ctx.TargetDetails.GetFunctionOffset(h.FuncNames()[0])
 
 	if err != nil {
 		return err
 	}
 
-	up, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeHttpClientDo, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(h.FuncNames()[0], h.bpfObjects.UprobeHttpClientDo, offset)
 
 	if err != nil {
 		return err
@@ -158,9 +190,7 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	}
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeHttpClientDoReturns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(h.FuncNames()[0], h.bpfObjects.UprobeHttpClientDoReturns, ret)
 		if err != nil {
 			return err
 		}
@@ -171,13 +201,13 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 	if err != nil {
 		return err
 	}
-	h.eventsReader = rd
+	h.eventsReader = utils.NewPerfReader(h.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(h.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	h.gmapEventReader = gmrd
+	h.gmapEventReader = utils.NewPerfReader(h.LibraryName(), gmrd)
 
 	return nil
 }
@@ -191,18 +221,18 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	netClientMainEventType := utils.ItemType("net_client_main_event")
 	netClientPlaceholderEventType := utils.ItemType("net_client_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(netClientMainEventType, func(rawEvent interface{}) {
+	h.queue.Register(netClientMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, h.LibraryName())
+		h.goroutines.MustEnrichSpan(&event, event.Goid, h.LibraryName())
 
 		eventsChan <- h.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(netClientPlaceholderEventType, func(rawEvent interface{}) {
+	h.queue.Register(netClientPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, h.LibraryName(), false)
+		h.goroutines.RegisterSpan(&enrichEvent, h.LibraryName(), false)
 
 		if enrichEvent.Psc.TraceID.IsValid() {
 			// middleware created
@@ -212,6 +242,8 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 
 	go func() {
 		defer wg.Done()
+		// the parsing goroutine returns once the records left are parsed
+		defer close(h.perfRecordChan)
 		for {
 			record, err := h.eventsReader.Read()
 
@@ -230,28 +262,26 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	go func() {
 		defer wg.Done()
 		var event Event
-		for {
-			select {
-			case record := <-h.perfRecordChan:
-				if record.LostSamples != 0 {
-					logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
-					continue
-				}
-
-				if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
-					logger.Error(err, "error parsing perf event")
-					continue
-				}
+		for record := range h.perfRecordChan {
+			if record.LostSamples != 0 {
+				logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+				continue
+			}
 
-				utils.EventProrityQueueSingleton.Push(event, event.StartTime, netClientMainEventType)
-			case <-h.perfRecordDone:
-				break
+			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
+				continue
 			}
+
+			h.queue.Push(event, event.StartTime, netClientMainEventType)
 		}
 	}()
 
 	go func() {
 		defer wg.Done()
+		// the parsing goroutine returns once the records left are parsed
+		defer close(h.perfGmapChan)
 		for {
 			record, err := h.gmapEventReader.Read()
 			if err != nil {
@@ -269,23 +299,19 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	go func() {
 		defer wg.Done()
 		var event gmap.GMapEvent
-		for {
-			select {
-			case record := <-h.perfGmapChan:
-				if record.LostSamples != 0 {
-					logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
-					continue
-				}
-
-				if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
-					logger.Error(err, "error parsing perf event")
-					continue
-				}
+		for record := range h.perfGmapChan {
+			if record.LostSamples != 0 {
+				logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+				continue
+			}
 
-				utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, netClientPlaceholderEventType)
-			case <-h.perfGmapDone:
-				break
+			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
+				continue
 			}
+
+			h.queue.Push(event, event.StartTime-1, netClientPlaceholderEventType)
 		}
 	}()
 
@@ -315,33 +341,40 @@ func (h *Instrumentor) convertEvent(e *Event) *events.Event {
 		pscPtr = nil
 	}
 
-	return &events.Event{
-		Library:     h.LibraryName(),
-		Name:        path,
-		Kind:        trace.SpanKindClient,
-		StartTime:   int64(e.StartTime),
-		EndTime:     int64(e.EndTime),
-		SpanContext: &sc,
-		Attributes: []attribute.KeyValue{
-			semconv.HTTPMethodKey.String(method),
-			semconv.HTTPTargetKey.String(path),
-			attribute.Key("go-id").Int64(int64(e.Goid)),
-		},
+	attrs := []attribute.KeyValue{
+		semconv.HTTPMethodKey.String(method),
+		semconv.HTTPTargetKey.String(path),
+	}
+	if e.StatusCode != 0 {
+		attrs = append(attrs, semconv.HTTPStatusCodeKey.Int(int(e.StatusCode)))
+	}
+	attrs = append(attrs, attribute.Key("go-id").Int64(int64(e.Goid)))
+
+	event := &events.Event{
+		Library:           h.LibraryName(),
+		Name:              path,
+		Kind:              trace.SpanKindClient,
+		StartTime:         int64(e.StartTime),
+		EndTime:           int64(e.EndTime),
+		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
+		Attributes:        attrs,
 		ParentSpanContext: pscPtr,
 	}
+
+	// a request fails without a response, or with a 4xx or 5xx one
+	switch {
+	case e.Failed != 0:
+		event.Status, event.StatusDescription = codes.Error, "request failed"
+	case e.StatusCode >= 400:
+		event.Status, event.StatusDescription = codes.Error, ""
+	}
+	return event
 }
 
 // Close stops the Instrumentor.
 func (h *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing net/http/client instrumentor")
-	if h.eventsReader != nil {
-		h.eventsReader.Close()
-	}
-
-	if h.gmapEventReader != nil {
-		h.gmapEventReader.Close()
-	}
-
 	for _, r := range h.uprobes {
 		r.Close()
 	}
@@ -350,10 +383,15 @@ func (h *Instrumentor) Close() {
 		r.Close()
 	}
 
+	if h.eventsReader != nil {
+		h.eventsReader.Close()
+	}
+
+	if h.gmapEventReader != nil {
+		h.gmapEventReader.Close()
+	}
+
 	if h.bpfObjects != nil {
 		h.bpfObjects.Close()
 	}
-
-	h.perfRecordDone <- struct{}{}
-	h.perfGmapDone <- struct{}{}
 }
@@ -18,6 +18,7 @@
 #include "go_types.h"
 #include "uprobe.h"
 #include "gmap.h"
+#include "propagation.h"
 
 char __license[] SEC("license") = "Dual MIT/GPL";
 
@@ -25,8 +26,6 @@ char __license[] SEC("license") = "Dual MIT/GPL";
 #define MAX_BUCKETS 8
 #define METHOD_MAX_LEN 7
 #define MAX_CONCURRENT 50
-#define W3C_KEY_LENGTH 11
-#define W3C_VAL_LENGTH 55
 
 struct http_request_t
 {
@@ -35,6 +34,7 @@ struct http_request_t
     char path[PATH_MAX_LEN];
     u64 goid;
     u64 cur_thread;
+    u64 status_code;
 };
 
 struct
@@ -45,21 +45,23 @@ struct
     __uint(max_entries, MAX_CONCURRENT);
 } http_events SEC(".maps");
 
+// The status code of the response to the request served by each goroutine,
+// 0 until its handler writes it.
 struct
 {
-    __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
-    __uint(key_size, sizeof(u32));
-    __uint(value_size, sizeof(struct map_bucket));
-    __uint(max_entries, 1);
-} golang_mapbucket_storage_map SEC(".maps");
+    __uint(type, BPF_MAP_TYPE_LRU_HASH);
+    __type(key, u64);
+    __type(value, u64);
+    __uint(max_entries, MAX_CONCURRENT);
+} status_codes SEC(".maps");
 
 struct
 {
     __uint(type, BPF_MAP_TYPE_PERCPU_ARRAY);
     __uint(key_size, sizeof(u32));
-    __uint(value_size, sizeof(struct span_context));
+    __uint(value_size, sizeof(struct map_bucket));
     __uint(max_entries, 1);
-} parent_span_context_storage_map SEC(".maps");
+} golang_mapbucket_storage_map SEC(".maps");
 
 struct
 {
@@ -73,7 +75,9 @@ volatile const u64 path_ptr_pos;
 volatile const u64 ctx_ptr_pos;
 volatile const u64 headers_ptr_pos;
 
-static __always_inline struct span_context *extract_context_from_req_headers(void *headers_ptr_ptr)
+// Extracts the remote parent from the headers of the propagation formats
+// selected, and records the trace flags and tracestate of its trace.
+static __always_inline struct propagated_context *extract_context_from_req_headers(void *headers_ptr_ptr)
 {
     void *headers_ptr;
     long res;
@@ -111,6 +115,11 @@ static __always_inline struct span_context *extract_context_from_req_headers(voi
     {
         return NULL;
     }
+    struct propagated_context *pc = new_propagated_context();
+    if (!pc)
+    {
+        return NULL;
+    }
 
     for (u64 j = 0; j < MAX_BUCKETS; j++)
     {
@@ -129,43 +138,27 @@ static __always_inline struct span_context *extract_context_from_req_headers(voi
             {
                 continue;
             }
-            if (map_value->keys[i].len != W3C_KEY_LENGTH)
+            s32 header = propagation_header_of(map_value->keys[i].str, map_value->keys[i].len);
+            if (header < 0)
             {
                 continue;
             }
-            char current_header_key[W3C_KEY_LENGTH];
-            bpf_probe_read(current_header_key, sizeof(current_header_key), map_value->keys[i].str);
-            if (!bpf_memcmp(current_header_key, "traceparent", W3C_KEY_LENGTH) && !bpf_memcmp(current_header_key, "Traceparent", W3C_KEY_LENGTH))
-            {
-                continue;
-            }
-            void *traceparent_header_value_ptr = map_value->values[i].array;
-            struct go_string traceparent_header_value_go_str;
-            res = bpf_probe_read(&traceparent_header_value_go_str, sizeof(traceparent_header_value_go_str), traceparent_header_value_ptr);
+            // the first value of the header
+            struct go_string header_value_go_str;
+            res = bpf_probe_read(&header_value_go_str, sizeof(header_value_go_str), map_value->values[i].array);
             if (res < 0)
-            {
-                return NULL;
-            }
-            if (traceparent_header_value_go_str.len != W3C_VAL_LENGTH)
             {
                 continue;
             }
-            char traceparent_header_value[W3C_VAL_LENGTH];
-            res = bpf_probe_read(&traceparent_header_value, sizeof(traceparent_header_value), traceparent_header_value_go_str.str);
-            if (res < 0)
-            {
-                return NULL;
-            }
-            struct span_context *parent_span_context = bpf_map_lookup_elem(&parent_span_context_storage_map, &map_id);
-            if (!parent_span_context)
-            {
-                return NULL;
-            }
-            w3c_string_to_span_context(traceparent_header_value, parent_span_context);
-            return parent_span_context;
+            extract_propagation_header(pc, header, header_value_go_str.str, header_value_go_str.len);
         }
     }
-    return NULL;
+
+    if (!finish_propagated_context(pc))
+    {
+        return NULL;
+    }
+    return pc;
 }
 
 // This instrumentation attaches uprobe to the following function:
@@ -201,11 +194,11 @@ int uprobe_ServerMux_ServeHTTP(struct pt_regs *ctx)
     bpf_probe_read(&httpReq.path, path_size, path_ptr);
 
     // Propagate context
-    struct span_context *parent_ctx = extract_context_from_req_headers(req_ptr + headers_ptr_pos);
+    struct propagated_context *parent_ctx = extract_context_from_req_headers(req_ptr + headers_ptr_pos);
 
     if (parent_ctx != NULL)
     {
-        httpReq.psc = *parent_ctx;
+        httpReq.psc = parent_ctx->sc;
         copy_byte_arrays(httpReq.psc.TraceID, httpReq.sc.TraceID, TRACE_ID_SIZE);
         generate_random_bytes(httpReq.sc.SpanID, SPAN_ID_SIZE);
     }
@@ -237,6 +230,9 @@ int uprobe_ServerMux_ServeHTTP(struct pt_regs *ctx)
 
     bpf_map_update_elem(&goroutine_sc_map, &httpReq.goid, &httpReq.sc, 0);
 
+    u64 status_code = 0;
+    bpf_map_update_elem(&status_codes, &httpReq.goid, &status_code, BPF_ANY);
+
     bpf_map_update_elem(&http_events, &key, &httpReq, 0);
     start_tracking_span(req_ctx_ptr, &httpReq.sc);
     return 0;
@@ -251,11 +247,46 @@ int uprobe_ServerMux_ServeHTTP_Returns(struct pt_regs *ctx) {
     struct http_request_t tmpReq = {};
     bpf_probe_read(&tmpReq, sizeof(tmpReq), req_ptr_map);
     tmpReq.end_time = bpf_ktime_get_ns();
-    bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    tmpReq.trace_flags = remote_trace_flags(&tmpReq.sc);
+    // the entry is left to the handlers wrapping this one, if any
+    u64 *status_code = bpf_map_lookup_elem(&status_codes, &tmpReq.goid);
+    if (status_code != NULL)
+    {
+        tmpReq.status_code = *status_code;
+    }
+    // the root span decides for its trace
+    if (root_span_sampled(&tmpReq.sc))
+    {
+        bpf_perf_event_output(ctx, &events, BPF_F_CURRENT_CPU, &tmpReq, sizeof(tmpReq));
+    }
     bpf_map_delete_elem(&http_events, &key);
     stop_tracking_span(&tmpReq.sc);
 
     bpf_map_delete_elem(&goroutine_sc_map, &tmpReq.goid);
 
     return 0;
-}
\ No newline at end of file
+}
+
+// This instrumentation attaches uprobe to the following functions:
+// func (w *response) WriteHeader(code int)
+// func (w *http2responseWriter) WriteHeader(code int)
+SEC("uprobe/response_WriteHeader")
+int uprobe_response_WriteHeader(struct pt_regs *ctx)
+{
+    u64 goid = get_current_goroutine();
+    u64 *status_code = bpf_map_lookup_elem(&status_codes, &goid);
+    // the first final status written is the one sent
+    if (status_code == NULL || *status_code != 0)
+    {
+        return 0;
+    }
+
+    u64 code_pos = 2;
+    u64 code = (u64)get_argument(ctx, code_pos);
+    if (code < 200)
+    {
+        return 0;
+    }
+    bpf_map_update_elem(&status_codes, &goid, &code, BPF_ANY);
+    return 0;
+}
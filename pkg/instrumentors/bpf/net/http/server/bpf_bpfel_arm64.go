@@ -13,16 +13,17 @@ import (
 )
 
 type bpfHttpRequestT struct {
-	StartTime uint64
-	EndTime   uint64
-	Sc        bpfSpanContext
-	Psc       bpfSpanContext
-	TraceRoot uint64
-	Method    [7]int8
-	Path      [100]int8
-	_         [5]byte
-	Goid      uint64
-	CurThread uint64
+	StartTime  uint64
+	EndTime    uint64
+	Sc         bpfSpanContext
+	Psc        bpfSpanContext
+	TraceFlags uint64
+	Method     [7]int8
+	Path       [100]int8
+	_          [5]byte
+	Goid       uint64
+	CurThread  uint64
+	StatusCode uint64
 }
 
 type bpfSpanContext struct {
@@ -73,6 +74,7 @@ type bpfSpecs struct {
 type bpfProgramSpecs struct {
 	UprobeServerMuxServeHTTP         *ebpf.ProgramSpec `ebpf:"uprobe_ServerMux_ServeHTTP"`
 	UprobeServerMuxServeHTTP_Returns *ebpf.ProgramSpec `ebpf:"uprobe_ServerMux_ServeHTTP_Returns"`
+	UprobeResponseWriteHeader        *ebpf.ProgramSpec `ebpf:"uprobe_response_WriteHeader"`
 }
 
 // bpfMapSpecs contains maps before they are loaded into the kernel.
@@ -86,7 +88,9 @@ type bpfMapSpecs struct {
 	GoroutineScMap              *ebpf.MapSpec `ebpf:"goroutine_sc_map"`
 	GoroutinesMap               *ebpf.MapSpec `ebpf:"goroutines_map"`
 	HttpEvents                  *ebpf.MapSpec `ebpf:"http_events"`
-	ParentSpanContextStorageMap *ebpf.MapSpec `ebpf:"parent_span_context_storage_map"`
+	PropagatedContextStorageMap *ebpf.MapSpec `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.MapSpec `ebpf:"remote_traces"`
+	StatusCodes                 *ebpf.MapSpec `ebpf:"status_codes"`
 	TrackedSpans                *ebpf.MapSpec `ebpf:"tracked_spans"`
 	TrackedSpansBySc            *ebpf.MapSpec `ebpf:"tracked_spans_by_sc"`
 }
@@ -117,7 +121,9 @@ type bpfMaps struct {
 	GoroutineScMap              *ebpf.Map `ebpf:"goroutine_sc_map"`
 	GoroutinesMap               *ebpf.Map `ebpf:"goroutines_map"`
 	HttpEvents                  *ebpf.Map `ebpf:"http_events"`
-	ParentSpanContextStorageMap *ebpf.Map `ebpf:"parent_span_context_storage_map"`
+	PropagatedContextStorageMap *ebpf.Map `ebpf:"propagated_context_storage_map"`
+	RemoteTraces                *ebpf.Map `ebpf:"remote_traces"`
+	StatusCodes                 *ebpf.Map `ebpf:"status_codes"`
 	TrackedSpans                *ebpf.Map `ebpf:"tracked_spans"`
 	TrackedSpansBySc            *ebpf.Map `ebpf:"tracked_spans_by_sc"`
 }
@@ -131,7 +137,9 @@ func (m *bpfMaps) Close() error {
 		m.GoroutineScMap,
 		m.GoroutinesMap,
 		m.HttpEvents,
-		m.ParentSpanContextStorageMap,
+		m.PropagatedContextStorageMap,
+		m.RemoteTraces,
+		m.StatusCodes,
 		m.TrackedSpans,
 		m.TrackedSpansBySc,
 	)
@@ -143,12 +151,14 @@ func (m *bpfMaps) Close() error {
 type bpfPrograms struct {
 	UprobeServerMuxServeHTTP         *ebpf.Program `ebpf:"uprobe_ServerMux_ServeHTTP"`
 	UprobeServerMuxServeHTTP_Returns *ebpf.Program `ebpf:"uprobe_ServerMux_ServeHTTP_Returns"`
+	UprobeResponseWriteHeader        *ebpf.Program `ebpf:"uprobe_response_WriteHeader"`
 }
 
 func (p *bpfPrograms) Close() error {
 	return _BpfClose(
 		p.UprobeServerMuxServeHTTP,
 		p.UprobeServerMuxServeHTTP_Returns,
+		p.UprobeResponseWriteHeader,
 	)
 }
 
@@ -39,24 +39,39 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/utils"   // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
 //go:generate go run github.com/cilium/ebpf/cmd/bpf2go -target amd64,arm64 -cc clang -cflags $CFLAGS bpf ./bpf/probe.bpf.c
 
-const instrumentedPkg = "net/http"
+const (
+	instrumentedPkg = "net/http"
+
+	serveFunc = "net/http.HandlerFunc.ServeHTTP"
+)
+
+// writeHeaderFuncs are the functions writing the status code of the
+// responses, of HTTP/1 and HTTP/2.
+var writeHeaderFuncs = []string{
+	"net/http.(*response).WriteHeader",
+	"net/http.(*http2responseWriter).WriteHeader",
+}
 
 // Event represents an event in an HTTP server during an HTTP
 // request-response.
 type Event struct {
 	context.BaseSpanProperties
-	Method    [7]byte
-	Path      [100]byte
-	_         [5]byte
-	Goid      uint64
-	CurThread uint64
+	Method     [7]byte
+	Path       [100]byte
+	_          [5]byte
+	Goid       uint64
+	CurThread  uint64
+	StatusCode uint64
 }
 
 // Instrumentor is the net/http instrumentor.
@@ -64,13 +79,13 @@ type Instrumentor struct {
 	bpfObjects      *bpfObjects
 	uprobes         []link.Link
 	returnProbs     []link.Link
-	eventsReader    *perf.Reader
-	gmapEventReader *perf.Reader
+	eventsReader    *utils.PerfReader
+	gmapEventReader *utils.PerfReader
 
 	perfRecordChan chan perf.Record
-	perfRecordDone chan struct{}
 	perfGmapChan   chan perf.Record
-	perfGmapDone   chan struct{}
+	queue          *utils.EventPriorityQueue
+	goroutines     *gmap.GMap
 }
 
 // New returns a new [Instrumentor].
@@ -78,8 +93,6 @@ func New() *Instrumentor {
 	return &Instrumentor{
 		perfRecordChan: make(chan perf.Record, 1000),
 		perfGmapChan:   make(chan perf.Record, 1000),
-		perfRecordDone: make(chan struct{}, 1),
-		perfGmapDone:   make(chan struct{}, 1),
 	}
 }
 
@@ -90,12 +103,19 @@ func (h *Instrumentor) LibraryName() string {
 
 // FuncNames returns the function names from "net/http" that are instrumented.
 func (h *Instrumentor) FuncNames() []string {
-	return []string{"net/http.HandlerFunc.ServeHTTP"}
+	return append([]string{serveFunc}, writeHeaderFuncs...)
 }
 
-// Load loads all instrumentation offsets.
-func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
-	spec, err := ctx.Injector.Inject(loadBpf, "go", ctx.TargetDetails.GoVersion.Original(), []*inject.StructField{
+// FuncsOptional reports that the functions writing the status code are
+// instrumented only if found, as the HTTP/2 server may not be linked in.
+func (h *Instrumentor) FuncsOptional() bool {
+	return true
+}
+
+// StructFields returns the struct fields read by the eBPF programs of the
+// instrumentor, and the version selecting their offsets for target.
+func (h *Instrumentor) StructFields(target *process.TargetDetails) (string, []*inject.StructField) {
+	return target.GoVersion.Original(), []*inject.StructField{
 		{
 			VarName:    "method_ptr_pos",
 			StructName: "net/http.Request",
@@ -126,7 +146,16 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 			StructName: "net/http.Request",
 			Field:      "Header",
 		},
-	}, nil, false)
+	}
+}
+
+// Load loads all instrumentation offsets.
+func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
+	h.queue = ctx.EventQueue
+	h.goroutines = gmap.ForTarget(ctx.TargetDetails.PID)
+
+	libVersion, fields := h.StructFields(ctx.TargetDetails)
+	spec, err := ctx.Injector.Inject(loadBpf, "go", libVersion, fields, nil, false)
 
 	if err != nil {
 		return err
@@ -142,21 +171,22 @@ func (h *Instrumentor) Load(ctx *context.InstrumentorContext) error {
 		return err
 	}
 
-	for _, funcName := range h.FuncNames() {
-		h.registerProbes(ctx, funcName)
+	h.registerProbes(ctx, serveFunc)
+	for _, funcName := range writeHeaderFuncs {
+		h.registerStatusProbe(ctx, funcName)
 	}
 
 	rd, err := perf.NewReader(h.bpfObjects.Events, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	h.eventsReader = rd
+	h.eventsReader = utils.NewPerfReader(h.LibraryName(), rd)
 
 	gmrd, err := perf.NewReader(h.bpfObjects.GmapEvents, os.Getpagesize())
 	if err != nil {
 		return err
 	}
-	h.gmapEventReader = gmrd
+	h.gmapEventReader = utils.NewPerfReader(h.LibraryName(), gmrd)
 
 	return nil
 }
@@ -165,18 +195,18 @@ func (h *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	logger := log.Logger.WithName("net/http-instrumentor").WithValues("function", funcName)
 	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function start offset. Skipping")
 		return
 	}
 	retOffsets, err := ctx.TargetDetails.GetFunctionReturns(funcName)
 	if err != nil {
+		ctx.UprobeFailed(funcName, err)
 		logger.Error(err, "could not find function end offsets. Skipping")
 		return
 	}
 
-	up, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeServerMuxServeHTTP, &link.UprobeOptions{
-		Address: offset,
-	})
+	up, err := ctx.Uprobe(funcName, h.bpfObjects.UprobeServerMuxServeHTTP, offset)
 	if err != nil {
 		logger.V(1).Info("could not insert start uprobe. Skipping",
 			"error", err.Error())
@@ -186,9 +216,7 @@ func (h *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	h.uprobes = append(h.uprobes, up)
 
 	for _, ret := range retOffsets {
-		retProbe, err := ctx.Executable.Uprobe("", h.bpfObjects.UprobeServerMuxServeHTTP_Returns, &link.UprobeOptions{
-			Address: ret,
-		})
+		retProbe, err := ctx.ReturnUprobe(funcName, h.bpfObjects.UprobeServerMuxServeHTTP_Returns, ret)
 		if err != nil {
 			logger.Error(err, "could not insert return uprobe. Skipping")
 			return
@@ -197,6 +225,25 @@ func (h *Instrumentor) registerProbes(ctx *context.InstrumentorContext, funcName
 	}
 }
 
+// registerStatusProbe attaches the uprobe recording the status code written
+// by funcName, if found.
+func (h *Instrumentor) registerStatusProbe(ctx *context.InstrumentorContext, funcName string) {
+	logger := log.Logger.WithName("net/http-instrumentor").WithValues("function", funcName)
+	offset, err := ctx.TargetDetails.GetFunctionOffset(funcName)
+	if err != nil {
+		logger.V(1).Info("function not found in target. Skipping")
+		return
+	}
+
+	up, err := ctx.Uprobe(funcName, h.bpfObjects.UprobeResponseWriteHeader, offset)
+	if err != nil {
+		logger.V(1).Info("could not insert start uprobe. Skipping",
+			"error", err.Error())
+		return
+	}
+	h.uprobes = append(h.uprobes, up)
+}
+
 // Run runs the events processing loop.
 func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	logger := log.Logger.WithName("net/http-instrumentor")
@@ -206,15 +253,15 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	netServerMainEventType := utils.ItemType("net_server_main_event")
 	netServerPlaceholderEventType := utils.ItemType("net_server_placeholder_event")
 
-	utils.EventProrityQueueSingleton.Register(netServerMainEventType, func(rawEvent interface{}) {
+	h.queue.Register(netServerMainEventType, func(rawEvent interface{}) {
 		event := rawEvent.(Event)
 
-		gmap.MustEnrichSpan(&event, event.Goid, h.LibraryName())
+		h.goroutines.MustEnrichSpan(&event, event.Goid, h.LibraryName())
 
 		eventsChan <- h.convertEvent(&event)
 	})
 
-	utils.EventProrityQueueSingleton.Register(netServerPlaceholderEventType, func(rawEvent interface{}) {
+	h.queue.Register(netServerPlaceholderEventType, func(rawEvent interface{}) {
 		event := rawEvent.(gmap.GMapEvent)
 
 		if event.Type != gmap.GoId2Sc {
@@ -223,11 +270,13 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 		}
 
 		enrichEvent := gmap.ConvertEnrichEvent(event)
-		gmap.RegisterSpan(&enrichEvent, h.LibraryName(), true)
+		h.goroutines.RegisterSpan(&enrichEvent, h.LibraryName(), true)
 	})
 
 	go func() {
 		defer wg.Done()
+		// the parsing goroutine returns once the records left are parsed
+		defer close(h.perfRecordChan)
 		for {
 			record, err := h.eventsReader.Read()
 			if err != nil {
@@ -245,26 +294,26 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	go func() {
 		defer wg.Done()
 		var event Event
-		for {
-			select {
-			case record := <-h.perfRecordChan:
-				if record.LostSamples != 0 {
-					logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
-					continue
-				}
-
-				if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
-					logger.Error(err, "error parsing perf event")
-					continue
-				}
+		for record := range h.perfRecordChan {
+			if record.LostSamples != 0 {
+				logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+				continue
+			}
 
-				utils.EventProrityQueueSingleton.Push(event, event.StartTime, netServerMainEventType)
+			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
+				continue
 			}
+
+			h.queue.Push(event, event.StartTime, netServerMainEventType)
 		}
 	}()
 
 	go func() {
 		defer wg.Done()
+		// the parsing goroutine returns once the records left are parsed
+		defer close(h.perfGmapChan)
 		for {
 			record, err := h.gmapEventReader.Read()
 			if err != nil {
@@ -282,23 +331,19 @@ func (h *Instrumentor) Run(eventsChan chan<- *events.Event) {
 	go func() {
 		defer wg.Done()
 		var event gmap.GMapEvent
-		for {
-			select {
-			case record := <-h.perfGmapChan:
-				if record.LostSamples != 0 {
-					logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
-					continue
-				}
-
-				if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
-					logger.Error(err, "error parsing perf event")
-					continue
-				}
+		for record := range h.perfGmapChan {
+			if record.LostSamples != 0 {
+				logger.V(0).Info("perf event ring buffer full", "dropped", record.LostSamples)
+				continue
+			}
 
-				utils.EventProrityQueueSingleton.Push(event, event.StartTime-1, netServerPlaceholderEventType)
-			case <-h.perfGmapDone:
-				break
+			if err := binary.Read(bytes.NewBuffer(record.RawSample), binary.LittleEndian, &event); err != nil {
+				logger.Error(err, "error parsing perf event")
+				metrics.ParseErrors.WithLabelValues(h.LibraryName()).Inc()
+				continue
 			}
+
+			h.queue.Push(event, event.StartTime-1, netServerPlaceholderEventType)
 		}
 	}()
 
@@ -328,7 +373,16 @@ func (h *Instrumentor) convertEvent(e *Event) *events.Event {
 		pscPtr = nil
 	}
 
-	return &events.Event{
+	attrs := []attribute.KeyValue{
+		semconv.HTTPMethodKey.String(method),
+		semconv.HTTPTargetKey.String(path),
+	}
+	if e.StatusCode != 0 {
+		attrs = append(attrs, semconv.HTTPStatusCodeKey.Int(int(e.StatusCode)))
+	}
+	attrs = append(attrs, attribute.Key("go-id").Int64(int64(e.Goid)))
+
+	event := &events.Event{
 		Library: h.LibraryName(),
 		// Do not include the high-cardinality path here (there is no
 		// templatized path manifest to reference).
@@ -337,26 +391,22 @@ func (h *Instrumentor) convertEvent(e *Event) *events.Event {
 		StartTime:         int64(e.StartTime),
 		EndTime:           int64(e.EndTime),
 		SpanContext:       &sc,
+		TraceSampled:      e.TraceSampled(),
 		ParentSpanContext: pscPtr,
-		Attributes: []attribute.KeyValue{
-			semconv.HTTPMethodKey.String(method),
-			semconv.HTTPTargetKey.String(path),
-			attribute.Key("go-id").Int64(int64(e.Goid)),
-		},
+		Attributes:        attrs,
+	}
+
+	// the 4xx responses are errors of the clients only, and those not
+	// written by the handler are 200 OK
+	if e.StatusCode >= 500 {
+		event.Status, event.StatusDescription = codes.Error, ""
 	}
+	return event
 }
 
 // Close stops the Instrumentor.
 func (h *Instrumentor) Close() {
 	log.Logger.V(0).Info("closing net/http instrumentor")
-	if h.eventsReader != nil {
-		h.eventsReader.Close()
-	}
-
-	if h.gmapEventReader != nil {
-		h.gmapEventReader.Close()
-	}
-
 	for _, r := range h.uprobes {
 		r.Close()
 	}
@@ -365,10 +415,15 @@ func (h *Instrumentor) Close() {
 		r.Close()
 	}
 
+	if h.eventsReader != nil {
+		h.eventsReader.Close()
+	}
+
+	if h.gmapEventReader != nil {
+		h.gmapEventReader.Close()
+	}
+
 	if h.bpfObjects != nil {
 		h.bpfObjects.Close()
 	}
-
-	h.perfRecordDone <- struct{}{}
-	h.perfGmapDone <- struct{}{}
 }
@@ -23,6 +23,7 @@ import (
 	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"  // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -62,7 +63,20 @@ func TestInstrumentorConvertEvent(t *testing.T) {
 		Attributes: []attribute.KeyValue{
 			semconv.HTTPMethodKey.String("GET"),
 			semconv.HTTPTargetKey.String("/foo/bar"),
+			attribute.Key("go-id").Int64(0),
 		},
 	}
 	assert.Equal(t, want, got)
 }
+
+func TestInstrumentorConvertEventStatus(t *testing.T) {
+	e := &Event{Method: [7]byte{'G', 'E', 'T'}, StatusCode: 404}
+	got := New().convertEvent(e)
+	assert.Contains(t, got.Attributes, semconv.HTTPStatusCodeKey.Int(404))
+	assert.Equal(t, codes.Unset, got.Status, "a 4xx response is not a server error")
+
+	e.StatusCode = 503
+	got = New().convertEvent(e)
+	assert.Contains(t, got.Attributes, semconv.HTTPStatusCodeKey.Int(503))
+	assert.Equal(t, codes.Error, got.Status)
+}
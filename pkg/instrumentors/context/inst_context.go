@@ -20,8 +20,10 @@ package context
 import (
 	"github.com/cilium/ebpf/link"
 
-	"go.opentelemetry.io/auto/pkg/inject"  // nolint:staticcheck  // Atomic deprecation.
-	"go.opentelemetry.io/auto/pkg/process" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/inject"                  // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/injection" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/utils"     // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"                 // nolint:staticcheck  // Atomic deprecation.
 )
 
 // InstrumentorContext holds the state of the auto-instrumentation system.
@@ -29,4 +31,10 @@ type InstrumentorContext struct {
 	TargetDetails *process.TargetDetails
 	Executable    *link.Executable
 	Injector      *inject.Injector
+	EventQueue    *utils.EventPriorityQueue
+	// InjectionPolicy decides to which destinations the trace context is
+	// injected.
+	InjectionPolicy *injection.Policy
+	// Uprobes records the uprobes attached by the instrumentor, if not nil.
+	Uprobes *UprobeRecorder
 }
@@ -22,7 +22,23 @@ type BaseSpanProperties struct {
 	EndTime           uint64
 	SpanContext       EBPFSpanContext
 	ParentSpanContext EBPFSpanContext
-	TraceRoot         uint64
+	// TraceFlags holds the trace flags the trace was received with from a
+	// remote parent, in its lower byte, if traceFlagsPropagated is set.
+	TraceFlags uint64
+}
+
+// traceFlagsPropagated is set in the trace flags of the spans of the traces
+// whose sampled flag was received with their remote parent.
+const traceFlagsPropagated = 0x100
+
+// TraceSampled returns the sampled flag the trace of the span was received
+// with from a remote parent, or nil if it was not.
+func (b *BaseSpanProperties) TraceSampled() *bool {
+	if b.TraceFlags&traceFlagsPropagated == 0 {
+		return nil
+	}
+	sampled := trace.TraceFlags(b.TraceFlags).IsSampled()
+	return &sampled
 }
 
 type IBaseSpan interface {
@@ -0,0 +1,89 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"sync"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/link"
+)
+
+// UprobeStatus is the outcome of attaching a uprobe to a function of the
+// target.
+type UprobeStatus struct {
+	Function string `json:"function"`
+	Address  uint64 `json:"address,omitempty"`
+	// Return is set for the uprobes attached to a return instruction.
+	Return bool   `json:"return,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// UprobeRecorder records the uprobes attached by an instrumentor. It is safe
+// for concurrent use.
+type UprobeRecorder struct {
+	mu      sync.Mutex
+	uprobes []UprobeStatus
+}
+
+// Uprobes returns the recorded uprobes, in attach order.
+func (r *UprobeRecorder) Uprobes() []UprobeStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]UprobeStatus(nil), r.uprobes...)
+}
+
+func (r *UprobeRecorder) record(s UprobeStatus) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.uprobes = append(r.uprobes, s)
+}
+
+// Uprobe attaches prog to the instruction of funcName at address, and
+// records the outcome.
+func (c *InstrumentorContext) Uprobe(funcName string, prog *ebpf.Program, address uint64) (link.Link, error) {
+	return c.uprobe(funcName, prog, address, false)
+}
+
+// ReturnUprobe attaches prog to the return instruction of funcName at
+// address, and records the outcome.
+func (c *InstrumentorContext) ReturnUprobe(funcName string, prog *ebpf.Program, address uint64) (link.Link, error) {
+	return c.uprobe(funcName, prog, address, true)
+}
+
+func (c *InstrumentorContext) uprobe(funcName string, prog *ebpf.Program, address uint64, ret bool) (link.Link, error) {
+	l, err := c.Executable.Uprobe("", prog, &link.UprobeOptions{
+		Address: address,
+	})
+
+	s := UprobeStatus{Function: funcName, Address: address, Return: ret}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	c.Uprobes.record(s)
+
+	return l, err
+}
+
+// UprobeFailed records that no uprobe could be attached to funcName.
+func (c *InstrumentorContext) UprobeFailed(funcName string, err error) {
+	c.Uprobes.record(UprobeStatus{Function: funcName, Error: err.Error()})
+}
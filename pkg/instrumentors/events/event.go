@@ -19,6 +19,7 @@ package events
 
 import (
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -32,4 +33,10 @@ type Event struct {
 	EndTime           int64
 	SpanContext       *trace.SpanContext
 	ParentSpanContext *trace.SpanContext
+	// TraceSampled is the sampled flag the trace was received with from a
+	// remote parent, nil if it was not.
+	TraceSampled *bool
+	// Status is the status of the span, Unset unless the operation failed.
+	Status            codes.Code
+	StatusDescription string
 }
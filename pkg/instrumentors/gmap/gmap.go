@@ -13,6 +13,7 @@ import (
 
 	"go.opentelemetry.io/auto/pkg/instrumentors/constant"
 	"go.opentelemetry.io/auto/pkg/instrumentors/context"
+	"go.opentelemetry.io/auto/pkg/metrics"
 )
 
 const (
@@ -21,30 +22,64 @@ const (
 	GoId2Sc
 )
 
-// using map for PoC
+// GMap mirrors the goroutine relationships of a single target process: which
+// goroutine spawned which, and which span context is active on a goroutine.
+// Goroutine ids are only unique within a process, so every instrumented
+// process needs its own GMap.
 // todo, using redis or smth for retention
+type GMap struct {
+	goPc2PGoId *cache.Cache
+	goId2PGoId *cache.Cache
+	goId2Sc    *cache.Cache
+
+	writeLock sync.Mutex
+}
+
 var (
-	//goPc2PGoId     = map[uint64]uint64{}
-	goPc2PGoId = cache.New(1*time.Minute, 1*time.Minute)
+	targets   = map[int]*GMap{}
+	targetsMu = sync.Mutex{}
+)
 
-	//goId2PGoId     = map[uint64]uint64{}
-	goId2PGoId = cache.New(1*time.Minute, 1*time.Minute)
+// New returns an empty [GMap].
+func New() *GMap {
+	return &GMap{
+		goPc2PGoId: cache.New(1*time.Minute, 1*time.Minute),
+		goId2PGoId: cache.New(1*time.Minute, 1*time.Minute),
+		goId2Sc:    cache.New(1*time.Minute, 1*time.Minute),
+	}
+}
 
-	// goId2Sc     = map[uint64]context.EBPFSpanContext{}
-	goId2Sc = cache.New(1*time.Minute, 1*time.Minute)
+// ForTarget returns the GMap of the process with the given pid, creating it
+// on first use. All instrumentors loaded for the same process share it.
+func ForTarget(pid int) *GMap {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
 
-	writeLock = sync.Mutex{}
-)
+	g, ok := targets[pid]
+	if !ok {
+		g = New()
+		targets[pid] = g
+	}
+	return g
+}
+
+// Release drops the GMap of the process with the given pid.
+func Release(pid int) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
 
-func getAncestorSc(goid uint64) (context.EBPFSpanContext, bool, bool) {
+	delete(targets, pid)
+}
+
+func (g *GMap) getAncestorSc(goid uint64) (context.EBPFSpanContext, bool, bool) {
 	for {
-		pgoid, ok := GetGoId2PGoId(goid)
+		pgoid, ok := g.GetGoId2PGoId(goid)
 		if !ok {
 			// only when reach root, or span is consider to be incomplete and should be rerun
 			return context.EBPFSpanContext{}, false, goid == 1
 		}
 
-		sc, ok := GetGoId2Sc(pgoid)
+		sc, ok := g.GetGoId2Sc(pgoid)
 		if !ok {
 			goid = pgoid
 			continue
@@ -59,24 +94,30 @@ func getAncestorSc(goid uint64) (context.EBPFSpanContext, bool, bool) {
 	}
 }
 
-func GetAncestorSc(goid uint64) (context.EBPFSpanContext, bool) {
+func (g *GMap) GetAncestorSc(goid uint64) (context.EBPFSpanContext, bool) {
 	for i := 0; i < constant.MAX_RETRY; i++ {
-		// TODO add prometheus metric for counting number of retry
-		sc, ok, retry := getAncestorSc(goid)
+		sc, ok, retry := g.getAncestorSc(goid)
 		if !retry {
+			if ok {
+				metrics.GMapLookups.WithLabelValues("hit").Inc()
+			} else {
+				metrics.GMapLookups.WithLabelValues("miss").Inc()
+			}
 			return sc, ok
 		}
+		metrics.GMapRetries.Inc()
 	}
 
+	metrics.GMapLookups.WithLabelValues("miss").Inc()
 	return context.EBPFSpanContext{}, false
 }
 
-func SetGoPc2GoId(key, value uint64) {
-	goPc2PGoId.Set(strconv.FormatUint(key, 10), value, cache.DefaultExpiration)
+func (g *GMap) SetGoPc2GoId(key, value uint64) {
+	g.goPc2PGoId.Set(strconv.FormatUint(key, 10), value, cache.DefaultExpiration)
 }
 
-func GetGoPc2GoId(key uint64) (uint64, bool) {
-	res, found := goPc2PGoId.Get(strconv.FormatUint(key, 10))
+func (g *GMap) GetGoPc2GoId(key uint64) (uint64, bool) {
+	res, found := g.goPc2PGoId.Get(strconv.FormatUint(key, 10))
 	if found {
 		value, ok := res.(uint64)
 		return value, ok
@@ -84,12 +125,12 @@ func GetGoPc2GoId(key uint64) (uint64, bool) {
 	return 0, false
 }
 
-func SetGoId2PGoId(key, value uint64) {
-	goId2PGoId.Set(strconv.FormatUint(key, 10), value, cache.DefaultExpiration)
+func (g *GMap) SetGoId2PGoId(key, value uint64) {
+	g.goId2PGoId.Set(strconv.FormatUint(key, 10), value, cache.DefaultExpiration)
 }
 
-func GetGoId2PGoId(key uint64) (uint64, bool) {
-	res, found := goId2PGoId.Get(strconv.FormatUint(key, 10))
+func (g *GMap) GetGoId2PGoId(key uint64) (uint64, bool) {
+	res, found := g.goId2PGoId.Get(strconv.FormatUint(key, 10))
 	if found {
 		value, ok := res.(uint64)
 		return value, ok
@@ -97,12 +138,12 @@ func GetGoId2PGoId(key uint64) (uint64, bool) {
 	return 0, false
 }
 
-func SetGoId2Sc(key uint64, value context.EBPFSpanContext) {
-	goId2Sc.Set(strconv.FormatUint(key, 10), value, cache.DefaultExpiration)
+func (g *GMap) SetGoId2Sc(key uint64, value context.EBPFSpanContext) {
+	g.goId2Sc.Set(strconv.FormatUint(key, 10), value, cache.DefaultExpiration)
 }
 
-func GetGoId2Sc(key uint64) (context.EBPFSpanContext, bool) {
-	res, found := goId2Sc.Get(strconv.FormatUint(key, 10))
+func (g *GMap) GetGoId2Sc(key uint64) (context.EBPFSpanContext, bool) {
+	res, found := g.goId2Sc.Get(strconv.FormatUint(key, 10))
 	if found {
 		value, ok := res.(context.EBPFSpanContext)
 		return value, ok
@@ -127,21 +168,21 @@ type EnrichGMapEvent struct {
 	StartTime uint64
 }
 
-func RegisterSpan(event *EnrichGMapEvent, lib string, replace bool) {
-	writeLock.Lock()
-	defer writeLock.Unlock()
+func (g *GMap) RegisterSpan(event *EnrichGMapEvent, lib string, replace bool) {
+	g.writeLock.Lock()
+	defer g.writeLock.Unlock()
 
 	goid := event.Key
 
 	// if goroutine id already taken, then skip
-	_, ok := GetGoId2Sc(goid)
+	_, ok := g.GetGoId2Sc(goid)
 	if ok {
 		// for server, replace whenever got new event
 		if replace {
-			SetGoId2Sc(goid, event.Sc)
+			g.SetGoId2Sc(goid, event.Sc)
 		}
 	} else {
-		if psc, ok := GetAncestorSc(goid); ok {
+		if psc, ok := g.GetAncestorSc(goid); ok {
 			// create new middleware for goroutine, p is founded ancestor, c is created new
 			event.Psc = psc
 			event.Sc.TraceID = event.Psc.TraceID
@@ -149,18 +190,18 @@ func RegisterSpan(event *EnrichGMapEvent, lib string, replace bool) {
 		}
 		// set value of goroutine in current node to middleware
 		// all request after this will be the child of this middleware
-		SetGoId2Sc(goid, event.Sc)
+		g.SetGoId2Sc(goid, event.Sc)
 	}
 }
 
-func MustEnrichSpan(event context.IBaseSpan, goid uint64, lib string) {
-	writeLock.Lock()
-	defer writeLock.Unlock()
+func (g *GMap) MustEnrichSpan(event context.IBaseSpan, goid uint64, lib string) {
+	g.writeLock.Lock()
+	defer g.writeLock.Unlock()
 
 	currentSc := event.GetSpanContext()
 
 	for i := 0; i < constant.MAX_RETRY; i++ {
-		sc, ok := GetGoId2Sc(goid)
+		sc, ok := g.GetGoId2Sc(goid)
 		if ok { // same goroutine sc exist
 			if currentSc.SpanID.String() != sc.SpanID.String() {
 				currentSc.TraceID = sc.TraceID
@@ -0,0 +1,198 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package injection provides the policy deciding to which destinations the
+// probes inject the trace context headers.
+//
+// Deprecated: This package is no longer supported.
+package injection
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	// ObserveOnlyEnvVar is the environment variable key whose value, when
+	// true, keeps the probes from writing into the memory of the target: the
+	// trace context is then never injected in outgoing requests.
+	ObserveOnlyEnvVar = "OTEL_GO_AUTO_OBSERVE_ONLY"
+	// AllowEnvVar is the environment variable key whose value is the
+	// comma-separated list of the destinations the trace context is injected
+	// in the requests to. When set, the requests to other destinations do not
+	// carry it, unless * is allowed.
+	AllowEnvVar = "OTEL_GO_AUTO_HEADER_INJECTION_ALLOW"
+	// DenyEnvVar is the environment variable key whose value is the
+	// comma-separated list of the destinations the trace context is not
+	// injected in the requests to.
+	DenyEnvVar = "OTEL_GO_AUTO_HEADER_INJECTION_DENY"
+)
+
+// maxDestinationSize is the size of the destinations of the eBPF programs,
+// including their trailing zero.
+const maxDestinationSize = 64
+
+// Kinds of the destinations, as defined in injection_policy.h.
+const (
+	destinationHost uint8 = iota
+	destinationGRPCTarget
+)
+
+// Actions of the rules, as defined in injection_policy.h.
+const (
+	allow uint8 = iota + 1
+	deny
+)
+
+// key is the key of the injection_policies map of the eBPF programs.
+type key struct {
+	Destination [maxDestinationSize]byte
+	Port        uint16
+	Kind        uint8
+	_           uint8
+}
+
+// Policy decides to which destinations the probes inject the trace context.
+//
+// A destination is one of:
+//   - host, e.g. api.example.com, matching the host on any port
+//   - host:port, e.g. api.example.com:443 or [::1]:8080
+//   - :port, matching any host on the port
+//   - grpc:target, matching the gRPC client connections to target, e.g.
+//     grpc:dns:///payments:50051
+//   - *, matching any destination
+//
+// The most specific rule of a destination applies: that of its gRPC target,
+// then of its host and port, of its host, of its port and the default one.
+// The ports of the URLs without one are those of their scheme, and 443 for
+// the gRPC targets.
+type Policy struct {
+	// ObserveOnly is set if the probes are not to write into the memory of
+	// the target.
+	ObserveOnly bool
+
+	rules map[key]uint8
+}
+
+// NewPolicy returns the policy selected by the OTEL_GO_AUTO_OBSERVE_ONLY,
+// OTEL_GO_AUTO_HEADER_INJECTION_ALLOW and OTEL_GO_AUTO_HEADER_INJECTION_DENY
+// environment variables.
+func NewPolicy() (*Policy, error) {
+	p := &Policy{rules: make(map[key]uint8)}
+
+	if v := os.Getenv(ObserveOnlyEnvVar); v != "" {
+		observeOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", ObserveOnlyEnvVar, v)
+		}
+		p.ObserveOnly = observeOnly
+	}
+
+	if err := p.add(DenyEnvVar, deny); err != nil {
+		return nil, err
+	}
+	if err := p.add(AllowEnvVar, allow); err != nil {
+		return nil, err
+	}
+
+	// the allowed destinations are the only ones, unless * is a rule
+	if v := os.Getenv(AllowEnvVar); v != "" {
+		if _, exists := p.rules[key{}]; !exists {
+			p.rules[key{}] = deny
+		}
+	}
+
+	return p, nil
+}
+
+// add adds the rules of the destinations listed in the environment variable
+// envVar.
+func (p *Policy) add(envVar string, action uint8) error {
+	v := os.Getenv(envVar)
+	if v == "" {
+		return nil
+	}
+
+	for _, d := range strings.Split(v, ",") {
+		d = strings.TrimSpace(d)
+		k, err := parseDestination(d)
+		if err != nil {
+			return fmt.Errorf("invalid %s destination %q: %w", envVar, d, err)
+		}
+		if other, exists := p.rules[k]; exists && other != action {
+			return fmt.Errorf("destination %q both allowed and denied", d)
+		}
+		p.rules[k] = action
+	}
+	return nil
+}
+
+// parseDestination returns the key of the rules of the destination d.
+func parseDestination(d string) (key, error) {
+	var k key
+	if d == "*" {
+		return k, nil
+	}
+
+	var host string
+	if strings.HasPrefix(d, "grpc:") {
+		k.Kind = destinationGRPCTarget
+		host = strings.TrimPrefix(d, "grpc:")
+	} else if i := strings.LastIndexByte(d, ':'); i >= 0 && i > strings.LastIndexByte(d, ']') {
+		port, err := strconv.ParseUint(d[i+1:], 10, 16)
+		if err != nil || port == 0 {
+			return k, fmt.Errorf("invalid port %q", d[i+1:])
+		}
+		k.Port = uint16(port)
+		host = strings.ToLower(d[:i])
+	} else {
+		host = strings.ToLower(d)
+	}
+
+	if host == "" && k.Port == 0 {
+		return k, errors.New("empty destination")
+	}
+	if len(host) >= maxDestinationSize {
+		return k, fmt.Errorf("longer than %d characters", maxDestinationSize-1)
+	}
+	copy(k.Destination[:], host)
+	return k, nil
+}
+
+// Apply writes the rules of p in m, the injection_policies map of the eBPF
+// programs. The rules of a target are the same for all its instrumentors,
+// which can all apply them to their pinned map. Programs without the map
+// cannot restrict the injection, which is an error if rules are set.
+func (p *Policy) Apply(m *ebpf.Map) error {
+	if p == nil {
+		return nil
+	}
+	if m == nil {
+		if len(p.rules) > 0 {
+			return fmt.Errorf("the header injection policy cannot be applied, the probes have no injection_policies map")
+		}
+		return nil
+	}
+	for k, action := range p.rules {
+		if err := m.Update(k, action, ebpf.UpdateAny); err != nil {
+			return fmt.Errorf("failed to apply the header injection policy: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package injection
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func destination(host string, port uint16, kind uint8) key {
+	k := key{Port: port, Kind: kind}
+	copy(k.Destination[:], host)
+	return k
+}
+
+func TestNewPolicy(t *testing.T) {
+	p, err := NewPolicy()
+	require.NoError(t, err)
+	assert.False(t, p.ObserveOnly)
+	assert.Empty(t, p.rules, "the trace context is injected everywhere by default")
+
+	t.Setenv(ObserveOnlyEnvVar, "true")
+	t.Setenv(DenyEnvVar, "api.partner.com, :8443,[::1]:9000")
+	t.Setenv(AllowEnvVar, "API.example.com:443,grpc:dns:///payments:50051")
+
+	p, err = NewPolicy()
+	require.NoError(t, err)
+	assert.True(t, p.ObserveOnly)
+	assert.Equal(t, map[key]uint8{
+		destination("api.partner.com", 0, destinationHost):             deny,
+		destination("", 8443, destinationHost):                         deny,
+		destination("[::1]", 9000, destinationHost):                    deny,
+		destination("api.example.com", 443, destinationHost):           allow,
+		destination("dns:///payments:50051", 0, destinationGRPCTarget): allow,
+		{}: deny,
+	}, p.rules)
+
+	// * overrides the default of the allow list
+	t.Setenv(DenyEnvVar, "api.partner.com")
+	t.Setenv(AllowEnvVar, "*")
+	p, err = NewPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, map[key]uint8{
+		destination("api.partner.com", 0, destinationHost): deny,
+		{}: allow,
+	}, p.rules)
+}
+
+func TestApplyWithoutMap(t *testing.T) {
+	p, err := NewPolicy()
+	require.NoError(t, err)
+	assert.NoError(t, p.Apply(nil))
+
+	// the rules cannot be silently ignored
+	t.Setenv(DenyEnvVar, "api.partner.com")
+	p, err = NewPolicy()
+	require.NoError(t, err)
+	assert.ErrorContains(t, p.Apply(nil), "injection_policies")
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "invalid observe only",
+			env:  map[string]string{ObserveOnlyEnvVar: "maybe"},
+			want: `invalid OTEL_GO_AUTO_OBSERVE_ONLY "maybe"`,
+		},
+		{
+			name: "invalid port",
+			env:  map[string]string{DenyEnvVar: "api.partner.com:https"},
+			want: `invalid OTEL_GO_AUTO_HEADER_INJECTION_DENY destination "api.partner.com:https": invalid port "https"`,
+		},
+		{
+			name: "empty destination",
+			env:  map[string]string{AllowEnvVar: "a.com,,b.com"},
+			want: "empty destination",
+		},
+		{
+			name: "long destination",
+			env:  map[string]string{DenyEnvVar: string(bytes.Repeat([]byte("a"), 64))},
+			want: "longer than 63 characters",
+		},
+		{
+			name: "allowed and denied",
+			env:  map[string]string{DenyEnvVar: "a.com", AllowEnvVar: "A.com"},
+			want: `destination "A.com" both allowed and denied`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := NewPolicy()
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestKeyLayout(t *testing.T) {
+	// as struct injection_policy_key of injection_policy.h
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, destination("a", 0x0102, destinationGRPCTarget)))
+	require.Equal(t, 68, buf.Len())
+	assert.Equal(t, []byte{'a'}, buf.Bytes()[:1])
+	assert.Equal(t, []byte{0x02, 0x01, destinationGRPCTarget, 0}, buf.Bytes()[64:])
+}
@@ -0,0 +1,129 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instrumentors
+
+import (
+	"sort"
+
+	"go.opentelemetry.io/auto/pkg/inject"  // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process" // nolint:staticcheck  // Atomic deprecation.
+)
+
+// StructFieldsReader is implemented by the instrumentors whose eBPF programs
+// read struct fields at offsets injected by [inject.Injector].
+type StructFieldsReader interface {
+	// StructFields returns the struct fields read by the eBPF programs of
+	// the instrumentor, and the version selecting their offsets for target.
+	StructFields(target *process.TargetDetails) (string, []*inject.StructField)
+}
+
+// InspectReport describes what the managed instrumentors would instrument in
+// an executable.
+type InspectReport struct {
+	Path          string                `json:"path"`
+	GoVersion     string                `json:"go_version"`
+	Modules       map[string]string     `json:"modules"`
+	Instrumentors []*InstrumentorReport `json:"instrumentors"`
+}
+
+// InstrumentorReport describes what an instrumentor would instrument in an
+// executable.
+type InstrumentorReport struct {
+	Name string `json:"name"`
+	// Active is set if all the functions of the instrumentor are found, or
+	// any of them for an [OptionalFuncsInstrumentor], as otherwise the
+	// instrumentor is not loaded.
+	Active    bool              `json:"active"`
+	Functions []*FunctionReport `json:"functions"`
+	// MissingOffsets lists the struct fields read by an active instrumentor
+	// whose offsets are not tracked for the version of their library.
+	MissingOffsets []*MissingOffsetReport `json:"missing_offsets,omitempty"`
+}
+
+// FunctionReport describes an instrumented function in an executable.
+type FunctionReport struct {
+	Name    string `json:"name"`
+	Found   bool   `json:"found"`
+	Offset  uint64 `json:"offset,omitempty"`
+	Returns int    `json:"returns"`
+}
+
+// MissingOffsetReport is a struct field whose offset is not tracked.
+type MissingOffsetReport struct {
+	Struct  string `json:"struct"`
+	Field   string `json:"field"`
+	Version string `json:"version"`
+}
+
+// Inspect reports what the managed instrumentors would instrument in the Go
+// executable at path. The executable is only read, it is neither run nor
+// attached to.
+func (m *Manager) Inspect(path string) (*InspectReport, error) {
+	target, err := process.AnalyzeFile(path, m.GetRelevantFuncs())
+	if err != nil {
+		return nil, err
+	}
+
+	injector, err := inject.New(target)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &InspectReport{
+		Path:      path,
+		GoVersion: target.GoVersion.Original(),
+		Modules:   target.Libraries,
+	}
+
+	for name, inst := range m.instrumentors {
+		ir := &InstrumentorReport{Name: name}
+		found := 0
+		for _, funcName := range inst.FuncNames() {
+			fr := &FunctionReport{Name: funcName}
+			for _, f := range target.Functions {
+				if f.Name == funcName {
+					fr.Found = true
+					fr.Offset = f.Offset
+					fr.Returns = len(f.ReturnOffsets)
+				}
+			}
+			if fr.Found {
+				found++
+			}
+			ir.Functions = append(ir.Functions, fr)
+		}
+
+		ir.Active = usable(inst, found)
+
+		if sfr, ok := inst.(StructFieldsReader); ok && ir.Active {
+			libVersion, fields := sfr.StructFields(target)
+			for _, f := range injector.MissingFields(libVersion, fields) {
+				ir.MissingOffsets = append(ir.MissingOffsets, &MissingOffsetReport{
+					Struct:  f.StructName,
+					Field:   f.Field,
+					Version: libVersion,
+				})
+			}
+		}
+
+		report.Instrumentors = append(report.Instrumentors, ir)
+	}
+
+	sort.Slice(report.Instrumentors, func(i, j int) bool {
+		return report.Instrumentors[i].Name < report.Instrumentors[j].Name
+	})
+
+	return report, nil
+}
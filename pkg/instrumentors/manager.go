@@ -18,11 +18,22 @@
 package instrumentors
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
 	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/database/sql"
 	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/IBM/sarama"
+	saramaAsyncProducer "go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/IBM/sarama/asyncproducer"
+	saramaConsumer "go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/IBM/sarama/consumer"
 	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/gin-gonic/gin"
+	gorillaMux "go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/gorilla/mux"
+	goRedis "go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/redis/go-redis"
 	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/runtime"
+	kafkaGo "go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/segmentio/kafka-go"
 	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/github.com/sirupsen/logrus"
 	"go.opentelemetry.io/auto/pkg/instrumentors/bpf/google/golang/org/grpc"
 	grpcServer "go.opentelemetry.io/auto/pkg/instrumentors/bpf/google/golang/org/grpc/server"
@@ -31,6 +42,8 @@ import (
 	httpClient "go.opentelemetry.io/auto/pkg/instrumentors/bpf/net/http/client" // nolint:staticcheck  // Atomic deprecation.
 	httpServer "go.opentelemetry.io/auto/pkg/instrumentors/bpf/net/http/server" // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/instrumentors/events"                         // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/injection"                      // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/utils"                          // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                                          // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/opentelemetry"                                // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/process"                                      // nolint:staticcheck  // Atomic deprecation.
@@ -41,26 +54,61 @@ var (
 	errNotAllFuncsFound = fmt.Errorf("not all functions found for instrumentation")
 )
 
+// InstrumentationsEnvVar is the environment variable key whose value is the
+// comma separated list of library names of the only instrumentors to run, e.g.
+// "net/http,database/sql". Instrumentors disabled by default can only be
+// enabled this way.
+const InstrumentationsEnvVar = "OTEL_GO_AUTO_INSTRUMENTATIONS"
+
+// DisabledInstrumentationsEnvVar is the environment variable key whose value
+// is the comma separated list of library names of instrumentors not to run.
+const DisabledInstrumentationsEnvVar = "OTEL_GO_AUTO_DISABLED_INSTRUMENTATIONS"
+
 // Manager handles the management of [Instrumentor] instances.
 type Manager struct {
 	instrumentors  map[string]Instrumentor
-	done           chan bool
+	done           chan context.Context
 	incomingEvents chan *events.Event
 	otelController *opentelemetry.Controller
+	eventQueue     *utils.EventPriorityQueue
 	allocator      *allocator.Allocator
+	status         status
+	policy         *injection.Policy
+
+	// running counts the Run of the instrumentors not returned yet.
+	running sync.WaitGroup
+
+	// included and excluded hold the library names of the instrumentors
+	// enabled and disabled by configuration.
+	included map[string]struct{}
+	excluded map[string]struct{}
 }
 
-// NewManager returns a new [Manager].
-func NewManager(otelController *opentelemetry.Controller) (*Manager, error) {
+// NewManager returns a new [Manager]. Events of all managed instrumentors are
+// reordered through eventQueue before they reach otelController, so a Manager
+// must not share its queue with the Manager of another target.
+//
+// Only the instrumentors selected by the OTEL_GO_AUTO_INSTRUMENTATIONS and
+// OTEL_GO_AUTO_DISABLED_INSTRUMENTATIONS environment variables are managed.
+func NewManager(otelController *opentelemetry.Controller, eventQueue *utils.EventPriorityQueue) (*Manager, error) {
+	policy, err := injection.NewPolicy()
+	if err != nil {
+		return nil, err
+	}
+
 	m := &Manager{
 		instrumentors:  make(map[string]Instrumentor),
-		done:           make(chan bool, 1),
+		done:           make(chan context.Context, 1),
 		incomingEvents: make(chan *events.Event),
 		otelController: otelController,
+		eventQueue:     eventQueue,
 		allocator:      allocator.New(),
+		policy:         policy,
+		included:       parseLibraryNames(os.Getenv(InstrumentationsEnvVar)),
+		excluded:       parseLibraryNames(os.Getenv(DisabledInstrumentationsEnvVar)),
 	}
 
-	err := registerInstrumentors(m)
+	err = registerInstrumentors(m)
 	if err != nil {
 		return nil, err
 	}
@@ -68,6 +116,21 @@ func NewManager(otelController *opentelemetry.Controller) (*Manager, error) {
 	return m, nil
 }
 
+// ObserveOnly returns whether the instrumentors of m are not to write into
+// the memory of the target.
+func (m *Manager) ObserveOnly() bool {
+	return m.policy.ObserveOnly
+}
+
+// reset replaces the instrumentors of m with new ones, so that m can
+// instrument a new target after the previous one exited. The new target may
+// use a different Go version or set of dependencies, hence none of the
+// previous instrumentors, filtered or loaded, can be reused.
+func (m *Manager) reset() error {
+	m.instrumentors = make(map[string]Instrumentor)
+	return registerInstrumentors(m)
+}
+
 func (m *Manager) registerInstrumentor(instrumentor Instrumentor) error {
 	if _, exists := m.instrumentors[instrumentor.LibraryName()]; exists {
 		return fmt.Errorf("library %s registered twice, aborting", instrumentor.LibraryName())
@@ -106,7 +169,7 @@ func (m *Manager) FilterUnusedInstrumentors(target *process.TargetDetails) {
 			}
 		}
 
-		if funcsFound != len(inst.FuncNames()) {
+		if !usable(inst, funcsFound) {
 			if funcsFound > 0 {
 				log.Logger.Error(errNotAllFuncsFound, "some of expected functions not found - check instrumented functions", "instrumentation_name", name, "funcs_found", funcsFound, "funcs_expected", len(inst.FuncNames()))
 			}
@@ -115,6 +178,42 @@ func (m *Manager) FilterUnusedInstrumentors(target *process.TargetDetails) {
 	}
 }
 
+// usable reports whether inst can instrument a target in which found of its
+// functions are found.
+func usable(inst Instrumentor, found int) bool {
+	if o, ok := inst.(OptionalFuncsInstrumentor); ok && o.FuncsOptional() {
+		return found > 0
+	}
+
+	return found == len(inst.FuncNames())
+}
+
+func parseLibraryNames(val string) map[string]struct{} {
+	names := make(map[string]struct{})
+	for _, name := range strings.Split(val, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names[name] = struct{}{}
+		}
+	}
+
+	return names
+}
+
+// enabled reports whether the instrumentor of the library libName is selected
+// by configuration.
+func (m *Manager) enabled(libName string, enabledByDefault bool) bool {
+	if _, exists := m.excluded[libName]; exists {
+		return false
+	}
+
+	if len(m.included) == 0 {
+		return enabledByDefault
+	}
+	_, exists := m.included[libName]
+	return exists
+}
+
 func registerInstrumentors(m *Manager) error {
 	insts := []Instrumentor{
 		sql.New(),
@@ -122,21 +221,61 @@ func registerInstrumentors(m *Manager) error {
 		grpcServer.New(),
 		httpServer.New(),
 		httpClient.New(),
-		// deprecated, for the sake of goroutine handler for net/http
-		//gorillaMux.New(),
 		gin.New(),
 		// New auto instrumentor for thesis
 		logrus.New(),
 		sarama.New(),
+		saramaAsyncProducer.New(),
+		saramaConsumer.New(),
+		kafkaGo.New(),
+		goRedis.New(),
+		goRedis.NewV8(),
 		runtime.New(),
 	}
+	// deprecated, for the sake of goroutine handler for net/http
+	disabledByDefault := []Instrumentor{
+		gorillaMux.New(),
+	}
+
+	available := make(map[string]struct{}, len(insts)+len(disabledByDefault))
+	register := func(i Instrumentor, enabledByDefault bool) error {
+		available[i.LibraryName()] = struct{}{}
+		if !m.enabled(i.LibraryName(), enabledByDefault) {
+			log.Logger.V(0).Info("skipping disabled instrumentor", "name", i.LibraryName())
+			return nil
+		}
+		return m.registerInstrumentor(i)
+	}
 
 	for _, i := range insts {
-		err := m.registerInstrumentor(i)
-		if err != nil {
+		if err := register(i, true); err != nil {
 			return err
 		}
 	}
+	for _, i := range disabledByDefault {
+		if err := register(i, false); err != nil {
+			return err
+		}
+	}
+
+	for _, names := range []map[string]struct{}{m.included, m.excluded} {
+		for name := range names {
+			if _, exists := available[name]; !exists {
+				return fmt.Errorf("unknown instrumentation %q, available instrumentations are %s",
+					name, strings.Join(sortedNames(available), ", "))
+			}
+		}
+	}
 
 	return nil
 }
+
+func sortedNames(names map[string]struct{}) []string {
+	result := make([]string, 0, len(names))
+	for name := range names {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
@@ -0,0 +1,154 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instrumentors
+
+import (
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/errors"  // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/log"     // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process" // nolint:staticcheck  // Atomic deprecation.
+)
+
+func libraryNames(m *Manager) []string {
+	names := make(map[string]struct{}, len(m.instrumentors))
+	for name := range m.instrumentors {
+		names[name] = struct{}{}
+	}
+
+	return sortedNames(names)
+}
+
+func TestManagerSelectsInstrumentors(t *testing.T) {
+	log.Logger = logr.Discard()
+
+	tests := []struct {
+		name     string
+		included string
+		excluded string
+		want     []string
+	}{
+		{
+			name: "defaults",
+			want: []string{
+				"IBM/sarama", "IBM/sarama/asyncproducer", "IBM/sarama/consumer", "database/sql",
+				"github.com/gin-gonic/gin", "github.com/go-redis/redis/v8", "github.com/redis/go-redis/v9",
+				"github.com/segmentio/kafka-go", "google.golang.org/grpc", "google.golang.org/grpc/server",
+				"net/http", "net/http/client", "runtime", "sirupsen/logrus",
+			},
+		},
+		{
+			name:     "include",
+			included: "net/http, database/sql",
+			want:     []string{"database/sql", "net/http"},
+		},
+		{
+			name:     "include disabled by default",
+			included: "github.com/gorilla/mux",
+			want:     []string{"github.com/gorilla/mux"},
+		},
+		{
+			name:     "exclude",
+			excluded: "sirupsen/logrus,runtime,IBM/sarama,IBM/sarama/asyncproducer,IBM/sarama/consumer",
+			want: []string{
+				"database/sql", "github.com/gin-gonic/gin", "github.com/go-redis/redis/v8",
+				"github.com/redis/go-redis/v9", "github.com/segmentio/kafka-go", "google.golang.org/grpc",
+				"google.golang.org/grpc/server", "net/http", "net/http/client",
+			},
+		},
+		{
+			name:     "include and exclude",
+			included: "net/http,net/http/client",
+			excluded: "net/http/client",
+			want:     []string{"net/http"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(InstrumentationsEnvVar, tt.included)
+			t.Setenv(DisabledInstrumentationsEnvVar, tt.excluded)
+
+			m, err := NewManager(nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, libraryNames(m))
+		})
+	}
+}
+
+func TestManagerRejectsUnknownInstrumentor(t *testing.T) {
+	log.Logger = logr.Discard()
+	t.Setenv(DisabledInstrumentationsEnvVar, "net/htp")
+
+	_, err := NewManager(nil, nil)
+	assert.ErrorContains(t, err, `unknown instrumentation "net/htp"`)
+}
+
+type fakeInstrumentor struct {
+	Instrumentor
+
+	name     string
+	funcs    []string
+	optional bool
+}
+
+func (f *fakeInstrumentor) LibraryName() string { return f.name }
+
+func (f *fakeInstrumentor) FuncNames() []string { return f.funcs }
+
+func (f *fakeInstrumentor) FuncsOptional() bool { return f.optional }
+
+func TestManagerFiltersUnusedInstrumentors(t *testing.T) {
+	log.Logger = logr.Discard()
+
+	m := &Manager{instrumentors: make(map[string]Instrumentor)}
+	for _, i := range []*fakeInstrumentor{
+		{name: "all found", funcs: []string{"a", "b"}},
+		{name: "some found", funcs: []string{"a", "c"}},
+		{name: "optional some found", funcs: []string{"a", "c"}, optional: true},
+		{name: "optional none found", funcs: []string{"c", "d"}, optional: true},
+	} {
+		require.NoError(t, m.registerInstrumentor(i))
+	}
+
+	m.FilterUnusedInstrumentors(&process.TargetDetails{
+		Functions: []*process.Func{{Name: "a"}, {Name: "b"}},
+	})
+	assert.Equal(t, []string{"all found", "optional some found"}, libraryNames(m))
+}
+
+func TestManagerRunWaitsForUninstrumentedTarget(t *testing.T) {
+	log.Logger = logr.Discard()
+	t.Setenv(InstrumentationsEnvVar, "net/http")
+
+	m, err := NewManager(nil, nil)
+	require.NoError(t, err)
+	// no process has this pid
+	target := &process.TargetDetails{PID: 1 << 30}
+	m.FilterUnusedInstrumentors(target)
+	require.Empty(t, m.instrumentors)
+
+	// the instrumentors are registered again for the next process
+	assert.Equal(t, errors.ErrProcessExited, m.Run(target))
+	assert.Equal(t, []string{"net/http"}, libraryNames(m))
+
+	m.FilterUnusedInstrumentors(target)
+	m.Close()
+	assert.NoError(t, m.Run(target))
+}
@@ -15,22 +15,45 @@
 package instrumentors
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/cilium/ebpf/link"
 	"github.com/cilium/ebpf/rlimit"
 
-	"go.opentelemetry.io/auto/pkg/inject"                // nolint:staticcheck  // Atomic deprecation.
-	"go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
-	"go.opentelemetry.io/auto/pkg/log"                   // nolint:staticcheck  // Atomic deprecation.
-	"go.opentelemetry.io/auto/pkg/process"               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/errors"                            // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/inject"                            // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/bpffs"               // nolint:staticcheck  // Atomic deprecation.
+	instContext "go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"              // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"                // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/log"                               // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"                           // nolint:staticcheck  // Atomic deprecation.
 )
 
+// exitCheckInterval is how often the target process is checked for exit.
+const exitCheckInterval = 2 * time.Second
+
+// drainCheckInterval is how often the event queue is checked for pending
+// events while draining it.
+const drainCheckInterval = 100 * time.Millisecond
+
 // Run runs the event processing loop for all managed Instrumentors.
+//
+// When m is shut down, the instrumentors are torn down and the pending events
+// of the target are exported before Run returns, see [Manager.Shutdown].
+//
+// If the target process exits, the instrumentors are torn down, the pending
+// events of the process are exported and [errors.ErrProcessExited] is
+// returned. The Manager can then be run again against a new target.
+//
+// A target no instrumentor applies to is waited for to exit as well, the
+// next process started may be instrumented.
 func (m *Manager) Run(target *process.TargetDetails) error {
 	if len(m.instrumentors) == 0 {
-		log.Logger.V(0).Info("there are no available instrumentations for target process")
-		return nil
+		log.Logger.V(0).Info("there are no available instrumentations for target process, waiting for it to exit")
+		return m.waitExit(target)
 	}
 
 	err := m.load(target)
@@ -39,21 +62,104 @@ func (m *Manager) Run(target *process.TargetDetails) error {
 	}
 
 	for _, i := range m.instrumentors {
-		go i.Run(m.incomingEvents)
+		m.running.Add(1)
+		go func(i Instrumentor) {
+			defer m.running.Done()
+			i.Run(m.incomingEvents)
+		}(i)
+	}
+
+	exitTicker := time.NewTicker(exitCheckInterval)
+	defer exitTicker.Stop()
+
+	for {
+		select {
+		case ctx := <-m.done:
+			log.Logger.V(0).Info("shutting down all instrumentors due to signal", "pid", target.PID)
+			m.closeInstrumentors()
+			m.eventQueue.Flush()
+			if !m.drain(ctx) {
+				log.Logger.V(0).Info("shutdown deadline exceeded, dropping pending events",
+					"pid", target.PID, "pending", m.eventQueue.Len())
+			}
+			m.release(target)
+			return nil
+		case <-exitTicker.C:
+			if target.IsRunning() {
+				continue
+			}
+
+			log.Logger.V(0).Info("target process exited, shutting down all instrumentors", "pid", target.PID)
+			m.closeInstrumentors()
+			m.eventQueue.Flush()
+			drained := m.drain(context.Background())
+			m.release(target)
+			if !drained {
+				return nil
+			}
+
+			if err := m.reset(); err != nil {
+				return err
+			}
+			return errors.ErrProcessExited
+		case e := <-m.incomingEvents:
+			m.trace(e)
+		}
 	}
+}
+
+// waitExit waits for target, which is not instrumented, to exit. It returns
+// nil if m is shut down first.
+func (m *Manager) waitExit(target *process.TargetDetails) error {
+	exitTicker := time.NewTicker(exitCheckInterval)
+	defer exitTicker.Stop()
 
 	for {
 		select {
 		case <-m.done:
-			log.Logger.V(0).Info("shutting down all instrumentors due to signal")
-			m.cleanup()
 			return nil
+		case <-exitTicker.C:
+			if target.IsRunning() {
+				continue
+			}
+
+			log.Logger.V(0).Info("target process exited", "pid", target.PID)
+			if err := m.reset(); err != nil {
+				return err
+			}
+			return errors.ErrProcessExited
+		}
+	}
+}
+
+// drain exports the events left in the event queue. It returns false if m
+// was shut down, or ctx done, before the queue was empty.
+func (m *Manager) drain(ctx context.Context) bool {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return false
+		case <-ctx.Done():
+			return false
 		case e := <-m.incomingEvents:
-			m.otelController.Trace(e)
+			m.trace(e)
+		case <-ticker.C:
+			if m.eventQueue.Len() == 0 {
+				return true
+			}
 		}
 	}
 }
 
+// trace exports e.
+func (m *Manager) trace(e *events.Event) {
+	m.status.count(e)
+	m.otelController.Trace(e)
+}
+
 func (m *Manager) load(target *process.TargetDetails) error {
 	// Allow the current process to lock memory for eBPF resources.
 	if err := rlimit.RemoveMemlock(); err != nil {
@@ -64,15 +170,31 @@ func (m *Manager) load(target *process.TargetDetails) error {
 	if err != nil {
 		return err
 	}
+	// the ratio decides the sampled flag injected, whether the probes drop
+	// the spans of the traces not sampled or not
+	ratio, kernel := m.otelController.KernelSamplingRatio()
+	injector.SampleRatio(ratio)
+	if kernel {
+		log.Logger.V(0).Info("Sampling traces in the eBPF probes", "ratio", ratio)
+	}
+	injector.KernelSampling(kernel)
+	injector.ParentBasedSampling(m.otelController.ParentBasedSampling())
+	injector.Propagators(m.otelController.Propagators())
+	if m.policy.ObserveOnly {
+		log.Logger.V(0).Info("Observe-only mode, the trace context is not injected in outgoing requests")
+	}
+	injector.ObserveOnly(m.policy.ObserveOnly)
 
 	exe, err := link.OpenExecutable(fmt.Sprintf("/proc/%d/exe", target.PID))
 	if err != nil {
 		return err
 	}
-	ctx := &context.InstrumentorContext{
-		TargetDetails: target,
-		Executable:    exe,
-		Injector:      injector,
+	ctx := &instContext.InstrumentorContext{
+		TargetDetails:   target,
+		Executable:      exe,
+		Injector:        injector,
+		EventQueue:      m.eventQueue,
+		InjectionPolicy: m.policy,
 	}
 
 	if err := m.allocator.Load(ctx); err != nil {
@@ -81,12 +203,15 @@ func (m *Manager) load(target *process.TargetDetails) error {
 	}
 
 	// Load instrumentors
+	m.status.start(target)
 	for name, i := range m.instrumentors {
 		log.Logger.V(0).Info("loading instrumentor", "name", name)
-		err := i.Load(ctx)
+		ictx := *ctx
+		ictx.Uprobes = m.status.recorder(name)
+		err := i.Load(&ictx)
 		if err != nil {
 			log.Logger.Error(err, "error while loading instrumentors, cleaning up", "name", name)
-			m.cleanup()
+			m.cleanup(target)
 			return err
 		}
 	}
@@ -95,14 +220,48 @@ func (m *Manager) load(target *process.TargetDetails) error {
 	return nil
 }
 
-func (m *Manager) cleanup() {
-	close(m.incomingEvents)
+// closeInstrumentors closes the instrumentors of m and waits for their Run to
+// return, once the records left in their perf readers are in the event queue.
+func (m *Manager) closeInstrumentors() {
 	for _, i := range m.instrumentors {
 		i.Close()
 	}
+	m.running.Wait()
+}
+
+func (m *Manager) cleanup(target *process.TargetDetails) {
+	m.closeInstrumentors()
+	m.release(target)
+}
+
+// release frees the resources kept for target once its instrumentors are
+// closed.
+func (m *Manager) release(target *process.TargetDetails) {
+	m.status.stop()
+	gmap.Release(target.PID)
+
+	if err := bpffs.Cleanup(target); err != nil {
+		log.Logger.Error(err, "failed to remove bpf file-system of target process", "pid", target.PID)
+	}
+}
+
+// Shutdown stops m in order: the probes are detached, the events left in the
+// perf buffers and in the event queue are exported, and the bpffs pins of the
+// target are removed. Events still pending when ctx is done are dropped.
+//
+// Shutdown does not wait for the events to be exported, [Manager.Run] returns
+// once they are.
+func (m *Manager) Shutdown(ctx context.Context) {
+	select {
+	case m.done <- ctx:
+	default:
+		// already shutting down
+	}
 }
 
-// Close closes m.
+// Close stops m without exporting the pending events.
 func (m *Manager) Close() {
-	m.done <- true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.Shutdown(ctx)
 }
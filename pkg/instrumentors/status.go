@@ -0,0 +1,126 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instrumentors
+
+import (
+	"sort"
+	"sync"
+
+	instContext "go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"              // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"                           // nolint:staticcheck  // Atomic deprecation.
+)
+
+// Status is the state of the instrumentation of a target process.
+type Status struct {
+	PID           int                   `json:"pid"`
+	GoVersion     string                `json:"go_version"`
+	Instrumentors []*InstrumentorStatus `json:"instrumentors"`
+}
+
+// InstrumentorStatus is the state of an instrumentor loaded in a target
+// process.
+type InstrumentorStatus struct {
+	Name string `json:"name"`
+	// Uprobes lists the uprobes attached to the functions of the target.
+	Uprobes []instContext.UprobeStatus `json:"uprobes"`
+	// FailedUprobes lists the uprobes which could not be attached, so that
+	// the functions they instrument produce no span.
+	FailedUprobes []instContext.UprobeStatus `json:"failed_uprobes,omitempty"`
+	// Events is the number of events exported since the instrumentor was
+	// loaded.
+	Events uint64 `json:"events"`
+}
+
+// status tracks the instrumentors loaded by a Manager in its target.
+type status struct {
+	mu      sync.Mutex
+	target  *process.TargetDetails
+	uprobes map[string]*instContext.UprobeRecorder
+	events  map[string]uint64
+}
+
+// start tracks the instrumentors loaded in target.
+func (s *status) start(target *process.TargetDetails) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.target = target
+	s.uprobes = make(map[string]*instContext.UprobeRecorder)
+	s.events = make(map[string]uint64)
+}
+
+// recorder returns the recorder of the uprobes attached by the instrumentor
+// named name.
+func (s *status) recorder(name string) *instContext.UprobeRecorder {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &instContext.UprobeRecorder{}
+	s.uprobes[name] = r
+	return r
+}
+
+func (s *status) count(e *events.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.events != nil {
+		s.events[e.Library]++
+	}
+}
+
+// stop forgets the target once its instrumentors are closed.
+func (s *status) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.target = nil
+	s.uprobes = nil
+	s.events = nil
+}
+
+// Status returns the state of the instrumentation of the target process, or
+// nil if no process is instrumented.
+func (m *Manager) Status() *Status {
+	m.status.mu.Lock()
+	defer m.status.mu.Unlock()
+
+	if m.status.target == nil {
+		return nil
+	}
+
+	st := &Status{
+		PID:       m.status.target.PID,
+		GoVersion: m.status.target.GoVersion.Original(),
+	}
+	for name, r := range m.status.uprobes {
+		is := &InstrumentorStatus{Name: name, Events: m.status.events[name]}
+		for _, u := range r.Uprobes() {
+			if u.Error != "" {
+				is.FailedUprobes = append(is.FailedUprobes, u)
+			} else {
+				is.Uprobes = append(is.Uprobes, u)
+			}
+		}
+		st.Instrumentors = append(st.Instrumentors, is)
+	}
+
+	sort.Slice(st.Instrumentors, func(i, j int) bool {
+		return st.Instrumentors[i].Name < st.Instrumentors[j].Name
+	})
+
+	return st
+}
@@ -0,0 +1,59 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instrumentors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+
+	instContext "go.opentelemetry.io/auto/pkg/instrumentors/context" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/instrumentors/events"              // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/process"                           // nolint:staticcheck  // Atomic deprecation.
+)
+
+func TestManagerStatus(t *testing.T) {
+	m := &Manager{}
+	assert.Nil(t, m.Status())
+
+	m.status.start(&process.TargetDetails{PID: 42, GoVersion: version.Must(version.NewVersion("1.20.5"))})
+
+	ctx := &instContext.InstrumentorContext{Uprobes: m.status.recorder("net/http")}
+	ctx.UprobeFailed("net/http.(*ServeMux).ServeHTTP", errors.New("symbol not found"))
+	ctx.Uprobes = m.status.recorder("database/sql")
+
+	m.status.count(&events.Event{Library: "net/http"})
+	m.status.count(&events.Event{Library: "net/http"})
+
+	assert.Equal(t, &Status{
+		PID:       42,
+		GoVersion: "1.20.5",
+		Instrumentors: []*InstrumentorStatus{
+			{Name: "database/sql"},
+			{
+				Name: "net/http",
+				FailedUprobes: []instContext.UprobeStatus{
+					{Function: "net/http.(*ServeMux).ServeHTTP", Error: "symbol not found"},
+				},
+				Events: 2,
+			},
+		},
+	}, m.Status())
+
+	m.status.stop()
+	assert.Nil(t, m.Status())
+}
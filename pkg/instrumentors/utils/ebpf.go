@@ -26,9 +26,9 @@ import (
 	"github.com/cilium/ebpf"
 )
 
-const (
-	showVerifierLogEnvVar = "OTEL_GO_AUTO_SHOW_VERIFIER_LOG"
-)
+// ShowVerifierLogEnvVar is the environment variable key whose value prints,
+// when true, the verifier log of the eBPF programs failing to load.
+const ShowVerifierLogEnvVar = "OTEL_GO_AUTO_SHOW_VERIFIER_LOG"
 
 // LoadEBPFObjects loads eBPF objects from the given spec into the given interface.
 // If the environment variable OTEL_GO_AUTO_SHOW_VERIFIER_LOG is set to true, the verifier log will be printed.
@@ -53,7 +53,7 @@ func LoadEBPFObjects(spec *ebpf.CollectionSpec, to interface{}, opts *ebpf.Colle
 
 // shouldShowVerifierLogs returns if the user has configured verifier logs to be emitted.
 func shouldShowVerifierLogs() bool {
-	val, exists := os.LookupEnv(showVerifierLogEnvVar)
+	val, exists := os.LookupEnv(ShowVerifierLogEnvVar)
 	if exists {
 		boolVal, err := strconv.ParseBool(val)
 		if err == nil {
@@ -0,0 +1,119 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf/perf"
+
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+)
+
+// perfPollInterval bounds how long a read blocks before checking whether the
+// reader is being closed.
+const perfPollInterval = 100 * time.Millisecond
+
+// PerfReader is a [perf.Reader] which is drained when closed: the records left
+// in its rings are still returned by Read before it fails with
+// [perf.ErrClosed].
+//
+// The probes must be detached before closing the reader, so that no record is
+// written while it is drained.
+type PerfReader struct {
+	*perf.Reader
+	instrumentor string
+
+	closing  chan struct{}
+	drained  chan struct{}
+	reading  bool
+	mu       sync.Mutex
+	stopOnce sync.Once
+}
+
+// NewPerfReader returns a [PerfReader] reading the records of instrumentor
+// from rd.
+func NewPerfReader(instrumentor string, rd *perf.Reader) *PerfReader {
+	return &PerfReader{
+		Reader:       rd,
+		instrumentor: instrumentor,
+		closing:      make(chan struct{}),
+		drained:      make(chan struct{}),
+	}
+}
+
+// Read returns the next record of r. Once r is closing, it returns
+// [perf.ErrClosed] as soon as no record is left.
+//
+// Read must not be called concurrently.
+func (r *PerfReader) Read() (perf.Record, error) {
+	r.mu.Lock()
+	r.reading = true
+	r.mu.Unlock()
+
+	for {
+		closing := false
+		select {
+		case <-r.closing:
+			// a deadline in the past makes Read return the pending records
+			// without blocking
+			closing = true
+			r.Reader.SetDeadline(time.Now())
+		default:
+			r.Reader.SetDeadline(time.Now().Add(perfPollInterval))
+		}
+
+		record, err := r.Reader.Read()
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			if closing {
+				r.stopOnce.Do(func() { close(r.drained) })
+				return record, perf.ErrClosed
+			}
+			continue
+		}
+
+		if err == nil {
+			if record.LostSamples != 0 {
+				metrics.LostSamples.WithLabelValues(r.instrumentor).Add(float64(record.LostSamples))
+			} else {
+				metrics.EventsRead.WithLabelValues(r.instrumentor).Inc()
+			}
+		}
+		return record, err
+	}
+}
+
+// Close waits for the records left in r to be read, if r is being read, then
+// frees the resources of r.
+func (r *PerfReader) Close() error {
+	r.mu.Lock()
+	reading := r.reading
+	r.mu.Unlock()
+
+	select {
+	case <-r.closing:
+	default:
+		close(r.closing)
+	}
+
+	if reading {
+		<-r.drained
+	}
+
+	return r.Reader.Close()
+}
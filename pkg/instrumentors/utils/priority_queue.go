@@ -4,6 +4,7 @@ import (
 	"container/heap"
 	"fmt"
 	"go.opentelemetry.io/auto/pkg/log"
+	"go.opentelemetry.io/auto/pkg/metrics"
 	"sync"
 	"time"
 )
@@ -59,40 +60,41 @@ type EventPriorityQueue struct {
 	mu            sync.Mutex
 
 	handlerMap map[ItemType]func(interface{})
+	// handling is set while an event popped from queue is being handled.
+	handling bool
+	// flushing is set once the events are no longer held back.
+	flushing bool
 
 	done chan struct{}
 }
 
-var (
-	EventProrityQueueSingleton *EventPriorityQueue
-)
-
-func Initialize(delayDuration time.Duration, maxSize uint64) {
-	if EventProrityQueueSingleton != nil {
-		return
-	}
-
-	EventProrityQueueSingleton = &EventPriorityQueue{
+// NewEventPriorityQueue returns an [EventPriorityQueue] which holds every
+// event for delayDuration before handing it to its handler, and which keeps at
+// most maxSize events (0 means unbounded).
+func NewEventPriorityQueue(delayDuration time.Duration, maxSize uint64) *EventPriorityQueue {
+	epq := &EventPriorityQueue{
 		queue:         make(PriorityQueue, 0),
 		delayDuration: -1 * delayDuration,
 		maxSize:       maxSize,
 		mu:            sync.Mutex{},
 		handlerMap:    make(map[ItemType]func(interface{})),
+		done:          make(chan struct{}, 1),
 	}
 
-	heap.Init(&EventProrityQueueSingleton.queue)
+	heap.Init(&epq.queue)
 
-	log.Logger.V(0).Info("Done initialize priority queue singleton")
+	return epq
 }
 
 func (epq *EventPriorityQueue) Push(event interface{}, priority uint64, iType ItemType) {
-	EventProrityQueueSingleton.mu.Lock()
-	defer EventProrityQueueSingleton.mu.Unlock()
+	epq.mu.Lock()
+	defer epq.mu.Unlock()
 
 	if epq.maxSize != 0 && epq.queue.Len() >= int(epq.maxSize) {
-		// TODO add count to number of event ignored
+		metrics.QueueDropped.Inc()
 		return
 	}
+	metrics.QueueDepth.Inc()
 
 	heap.Push(&epq.queue, &Item{
 		value:    event,
@@ -103,15 +105,15 @@ func (epq *EventPriorityQueue) Push(event interface{}, priority uint64, iType It
 }
 
 func (epq *EventPriorityQueue) Register(iType ItemType, handler func(interface{})) {
-	EventProrityQueueSingleton.mu.Lock()
-	defer EventProrityQueueSingleton.mu.Unlock()
+	epq.mu.Lock()
+	defer epq.mu.Unlock()
 
 	epq.handlerMap[iType] = handler
 }
 
 func (epq *EventPriorityQueue) Unregister(iType ItemType) {
-	EventProrityQueueSingleton.mu.Lock()
-	defer EventProrityQueueSingleton.mu.Unlock()
+	epq.mu.Lock()
+	defer epq.mu.Unlock()
 
 	delete(epq.handlerMap, iType)
 }
@@ -125,23 +127,28 @@ func (epq *EventPriorityQueue) Run() {
 		for {
 			select {
 			case <-epq.done:
-				break
+				return
 			default:
-				func() {
-					EventProrityQueueSingleton.mu.Lock()
-					defer EventProrityQueueSingleton.mu.Unlock()
+				// The handler is called without holding the lock, as it may
+				// block until the consumer of the event is ready.
+				handler, value, ok := func() (func(interface{}), interface{}, bool) {
+					epq.mu.Lock()
+					defer epq.mu.Unlock()
 
 					if epq.queue.Len() == 0 {
-						return
+						return nil, nil, false
 					}
 
 					event := heap.Pop(&epq.queue).(*Item)
-					if event.arriveAt > uint64(time.Now().Add(epq.delayDuration).UnixNano()) {
+					if !epq.flushing && event.arriveAt > uint64(time.Now().Add(epq.delayDuration).UnixNano()) {
 						heap.Push(&epq.queue, event)
-						return
+						return nil, nil, false
 					}
 
+					metrics.QueueDepth.Dec()
+					metrics.QueueLatency.Observe(time.Since(time.Unix(0, int64(event.arriveAt))).Seconds())
 					if event.priority < previousPriority {
+						metrics.QueueOutOfOrder.Inc()
 						log.Logger.Info("[ERROR] - The incoming request is not following order")
 					}
 					previousPriority = event.priority
@@ -149,16 +156,45 @@ func (epq *EventPriorityQueue) Run() {
 					handler, ok := epq.handlerMap[event.iType]
 					if !ok {
 						log.Logger.Info(fmt.Sprintf("Error when find handler for %s", event.iType))
-						return
+						return nil, nil, false
 					}
 
-					handler(event.value)
+					epq.handling = true
+					return handler, event.value, true
 				}()
+				if ok {
+					handler(value)
+
+					epq.mu.Lock()
+					epq.handling = false
+					epq.mu.Unlock()
+				}
 			}
 		}
 	}()
 }
 
+// Len returns the number of events in the queue which are not handled yet,
+// including the one currently being handled.
+func (epq *EventPriorityQueue) Len() int {
+	epq.mu.Lock()
+	defer epq.mu.Unlock()
+
+	if epq.handling {
+		return epq.queue.Len() + 1
+	}
+	return epq.queue.Len()
+}
+
+// Flush stops holding back events, so that the events left in the queue are
+// handled in order without waiting for their delay.
+func (epq *EventPriorityQueue) Flush() {
+	epq.mu.Lock()
+	defer epq.mu.Unlock()
+
+	epq.flushing = true
+}
+
 func (epq *EventPriorityQueue) Close() {
 	epq.done <- struct{}{}
 }
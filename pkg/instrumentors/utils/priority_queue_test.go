@@ -4,14 +4,21 @@ import (
 	"container/heap"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	"go.opentelemetry.io/auto/pkg/instrumentors/gmap"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"go.opentelemetry.io/auto/pkg/metrics"
 )
 
+type testEvent struct {
+	StartTime uint64
+}
+
 func runPriorityQueue(nGoroutines int, nLoops int) {
-	eventChan := make(chan gmap.GMapEvent, nGoroutines)
+	eventChan := make(chan testEvent, nGoroutines)
 	queue := make(PriorityQueue, 0)
 
 	heap.Init(&queue)
@@ -32,7 +39,7 @@ func runPriorityQueue(nGoroutines int, nLoops int) {
 			close(eventChan)
 		}()
 		for n := 0; n < nLoops; n++ {
-			event := gmap.GMapEvent{
+			event := testEvent{
 				StartTime: uint64(time.Now().UnixNano()),
 			}
 			eventChan <- event
@@ -122,16 +129,16 @@ func TestPQueue(t *testing.T) {
 }
 
 func runEventPQueue(nGoroutines int, nLoops int) {
-	eventChan := make(chan gmap.GMapEvent, nGoroutines)
+	eventChan := make(chan testEvent, nGoroutines)
 
-	Initialize(5*time.Second, 5000)
+	epq := NewEventPriorityQueue(5*time.Second, 0)
 
 	eventCount := uint64(0)
 	previousPriority := uint64(0)
-	EventProrityQueueSingleton.Register("", func(rawEvent interface{}) {
-		eventCount += 1
+	epq.Register("", func(rawEvent interface{}) {
+		atomic.AddUint64(&eventCount, 1)
 
-		event := rawEvent.(gmap.GMapEvent)
+		event := rawEvent.(testEvent)
 
 		if previousPriority > event.StartTime {
 			panic("Wrong order")
@@ -153,7 +160,7 @@ func runEventPQueue(nGoroutines int, nLoops int) {
 			close(eventChan)
 		}()
 		for n := 0; n < nLoops; n++ {
-			event := gmap.GMapEvent{
+			event := testEvent{
 				StartTime: uint64(time.Now().UnixNano()),
 			}
 			eventChan <- event
@@ -186,7 +193,7 @@ func runEventPQueue(nGoroutines int, nLoops int) {
 							lock.Lock()
 							defer lock.Unlock()
 
-							EventProrityQueueSingleton.Push(
+							epq.Push(
 								event,
 								event.StartTime,
 								"",
@@ -207,15 +214,15 @@ func runEventPQueue(nGoroutines int, nLoops int) {
 			fmt.Printf("Priority queue checker done\n")
 		}()
 
-		EventProrityQueueSingleton.Run()
+		epq.Run()
 	}()
 
 	wg.Wait()
 
-	for int(eventCount) < nLoops {
+	for int(atomic.LoadUint64(&eventCount)) < nLoops {
 	}
 
-	fmt.Printf("Test done. Total event received %d\n", eventCount)
+	fmt.Printf("Test done. Total event received %d\n", atomic.LoadUint64(&eventCount))
 }
 
 func TestEventPQueue(t *testing.T) {
@@ -229,3 +236,56 @@ func BenchmarkEventPQueue100(b *testing.B) { runEventPQueue(100, b.N) }
 func BenchmarkPQueue20(b *testing.B)  { runPriorityQueue(20, b.N) }
 func BenchmarkPQueue50(b *testing.B)  { runPriorityQueue(50, b.N) }
 func BenchmarkPQueue100(b *testing.B) { runPriorityQueue(100, b.N) }
+
+func TestEventPQueueFlush(t *testing.T) {
+	epq := NewEventPriorityQueue(time.Hour, 0)
+	defer epq.Close()
+
+	handled := make(chan uint64, 3)
+	epq.Register("", func(rawEvent interface{}) {
+		handled <- rawEvent.(testEvent).StartTime
+	})
+
+	for _, start := range []uint64{3, 1, 2} {
+		epq.Push(testEvent{StartTime: start}, start, "")
+	}
+	epq.Run()
+
+	select {
+	case <-handled:
+		t.Fatal("event handled before its delay")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	epq.Flush()
+	for want := uint64(1); want <= 3; want++ {
+		select {
+		case got := <-handled:
+			if got != want {
+				t.Fatalf("got event %d, want %d", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d not handled after flush", want)
+		}
+	}
+
+	for epq.Len() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEventPQueueDropsWhenFull(t *testing.T) {
+	epq := NewEventPriorityQueue(time.Hour, 2)
+	dropped := testutil.ToFloat64(metrics.QueueDropped)
+
+	for start := uint64(1); start <= 3; start++ {
+		epq.Push(testEvent{StartTime: start}, start, "")
+	}
+
+	if got := epq.Len(); got != 2 {
+		t.Fatalf("got %d queued events, want 2", got)
+	}
+	if got := testutil.ToFloat64(metrics.QueueDropped) - dropped; got != 1 {
+		t.Fatalf("got %v dropped events, want 1", got)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics provides the Prometheus metrics of the agent itself.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "otel_go_auto"
+
+// Registry holds the metrics of the agent.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// EventsRead counts the perf records read per instrumentor.
+	EventsRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "perf_events_read_total",
+		Help:      "Number of perf records read from the eBPF programs.",
+	}, []string{"instrumentor"})
+
+	// LostSamples counts the perf samples dropped per instrumentor because
+	// the perf ring buffer was full.
+	LostSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "perf_lost_samples_total",
+		Help:      "Number of perf samples dropped because the ring buffer was full.",
+	}, []string{"instrumentor"})
+
+	// ParseErrors counts the perf records per instrumentor which could not
+	// be decoded into an event.
+	ParseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "perf_parse_errors_total",
+		Help:      "Number of perf records which could not be decoded.",
+	}, []string{"instrumentor"})
+
+	// QueueDepth is the number of events held in the event queues.
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Number of events held in the event queues to be reordered.",
+	})
+
+	// QueueDropped counts the events dropped because an event queue was
+	// full.
+	QueueDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_dropped_events_total",
+		Help:      "Number of events dropped because the event queue was full.",
+	})
+
+	// QueueLatency is how long events are held in the event queues.
+	QueueLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "queue_reorder_latency_seconds",
+		Help:      "Time events are held in the event queue before being handled.",
+		Buckets:   []float64{.01, .05, .1, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	// QueueOutOfOrder counts the events popped from an event queue before an
+	// event they follow.
+	QueueOutOfOrder = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "queue_out_of_order_total",
+		Help:      "Number of events handled after an event which started later.",
+	})
+
+	// GMapLookups counts the lookups of the span of the ancestor of a
+	// goroutine, by result: hit or miss.
+	GMapLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gmap_lookups_total",
+		Help:      "Number of lookups of the span of the ancestor of a goroutine.",
+	}, []string{"result"})
+
+	// GMapRetries counts the lookups of ancestor spans retried because the
+	// ancestry of the goroutine was incomplete.
+	GMapRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gmap_retries_total",
+		Help:      "Number of retried lookups of the span of the ancestor of a goroutine.",
+	})
+
+	// MessagesSkipped counts the messages, by library, not traced as they
+	// are past the limit of the messages a probe reads at once.
+	MessagesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_skipped_total",
+		Help:      "Number of messages not traced, past the limit of the messages read at once.",
+	}, []string{"library"})
+
+	// SpansExported counts the spans exported successfully.
+	SpansExported = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spans_exported_total",
+		Help:      "Number of spans exported successfully.",
+	})
+
+	// SpansFailed counts the spans whose export failed.
+	SpansFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spans_failed_total",
+		Help:      "Number of spans whose export failed.",
+	})
+
+	// RetryQueueSpans is the number of spans held in the retry queue until
+	// they are exported.
+	RetryQueueSpans = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "retry_queue_spans",
+		Help:      "Number of spans held on disk until they are exported.",
+	})
+
+	// SpansDropped counts the spans dropped from the retry queue before they
+	// were exported, by reason: size, age or invalid.
+	SpansDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "spans_dropped_total",
+		Help:      "Number of spans dropped from the retry queue before being exported.",
+	}, []string{"reason"})
+
+	// TailSamplingTraces is the number of traces buffered by the tail
+	// sampler until they are decided.
+	TailSamplingTraces = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tail_sampling_traces",
+		Help:      "Number of traces buffered until the tail sampler decides them.",
+	})
+
+	// TailSamplingDecisions counts the traces decided by the tail sampler,
+	// by the policy keeping them: latency, error, library or percentage, or
+	// none when they are dropped.
+	TailSamplingDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tail_sampling_decisions_total",
+		Help:      "Number of traces decided by the tail sampler, by policy keeping them.",
+	}, []string{"policy"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EventsRead,
+		LostSamples,
+		ParseErrors,
+		QueueDepth,
+		QueueDropped,
+		QueueLatency,
+		QueueOutOfOrder,
+		GMapLookups,
+		GMapRetries,
+		MessagesSkipped,
+		SpansExported,
+		SpansFailed,
+		RetryQueueSpans,
+		SpansDropped,
+		TailSamplingTraces,
+		TailSamplingDecisions,
+	)
+}
+
+// Handler returns the handler serving the metrics of [Registry] in the
+// Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -26,22 +26,20 @@ import (
 	"time"
 
 	"golang.org/x/sys/unix"
-	"google.golang.org/grpc"
 
 	"go.opentelemetry.io/auto"
 	"go.opentelemetry.io/auto/pkg/instrumentors/events" // nolint:staticcheck  // Atomic deprecation.
 	"go.opentelemetry.io/auto/pkg/log"                  // nolint:staticcheck  // Atomic deprecation.
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.18.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
-const (
-	otelServiceNameEnvVar = "OTEL_SERVICE_NAME"
-)
+// ServiceNameEnvVar is the environment variable key whose value is the
+// service.name of the targets without one.
+const ServiceNameEnvVar = "OTEL_SERVICE_NAME"
 
 var (
 	// Controller-local reference to the auto-instrumentation release version.
@@ -56,7 +54,10 @@ var (
 
 // Controller handles OpenTelemetry telemetry generation for events.
 type Controller struct {
-	tracerProvider trace.TracerProvider
+	tracerProvider *sdktrace.TracerProvider
+	sampling       *sampling
+	tail           *tailSampler
+	propagators    []string
 	tracersMap     map[string]trace.Tracer
 	bootTime       int64
 }
@@ -72,19 +73,30 @@ func (c *Controller) getTracer(libName string) trace.Tracer {
 	return newTracer
 }
 
-// Trace creates a trace span for event.
+// Trace creates a trace span for event. With tail sampling, the span is
+// created once the tail sampler keeps the trace of event.
 func (c *Controller) Trace(event *events.Event) {
 	//log.Logger.V(0).Info("got event", "attrs", event.Attributes)
-	ctx := context.Background()
-
 	if event.SpanContext == nil {
 		log.Logger.V(0).Info("got event without context - dropping")
 		return
 	}
 
+	if c.tail != nil {
+		c.tail.Add(event)
+		return
+	}
+	c.export(event)
+}
+
+func (c *Controller) export(event *events.Event) {
+	ctx := context.Background()
+
 	// TODO: handle remote parent
 	if event.ParentSpanContext != nil {
-		ctx = trace.ContextWithSpanContext(ctx, *event.ParentSpanContext)
+		parent := *event.ParentSpanContext
+		parent = parent.WithTraceFlags(parent.TraceFlags().WithSampled(c.traceSampled(event, parent.TraceID())))
+		ctx = trace.ContextWithSpanContext(ctx, parent)
 	}
 
 	ctx = ContextWithEBPFEvent(ctx, *event)
@@ -93,18 +105,36 @@ func (c *Controller) Trace(event *events.Event) {
 			trace.WithAttributes(event.Attributes...),
 			trace.WithSpanKind(event.Kind),
 			trace.WithTimestamp(c.convertTime(event.StartTime)))
+	if event.Status != codes.Unset {
+		span.SetStatus(event.Status, event.StatusDescription)
+	}
 	span.End(trace.WithTimestamp(c.convertTime(event.EndTime)))
 }
 
+// Shutdown exports the spans not exported yet and stops the exporter. The
+// traces buffered by the tail sampler are decided first. Spans still pending
+// when ctx is done are dropped.
+func (c *Controller) Shutdown(ctx context.Context) error {
+	if c.tail != nil {
+		c.tail.Stop()
+	}
+	return c.tracerProvider.Shutdown(ctx)
+}
+
 func (c *Controller) convertTime(t int64) time.Time {
 	return time.Unix(0, c.bootTime+t)
 }
 
-// NewController returns a new initialized [Controller].
-func NewController() (*Controller, error) {
-	serviceName, exists := os.LookupEnv(otelServiceNameEnvVar)
-	if !exists {
-		return nil, fmt.Errorf("%s env var must be set", otelServiceNameEnvVar)
+// NewController returns a new initialized [Controller] whose spans are
+// reported with serviceName as service.name. If serviceName is empty, it is
+// read from the OTEL_SERVICE_NAME environment variable.
+func NewController(serviceName string) (*Controller, error) {
+	if serviceName == "" {
+		var exists bool
+		serviceName, exists = os.LookupEnv(ServiceNameEnvVar)
+		if !exists {
+			return nil, fmt.Errorf("%s env var must be set", ServiceNameEnvVar)
+		}
 	}
 
 	ctx := context.Background()
@@ -119,34 +149,57 @@ func NewController() (*Controller, error) {
 		return nil, err
 	}
 
-	log.Logger.V(0).Info("Establishing connection to OTLP receiver ...")
-	otlpTraceClient := otlptracegrpc.NewClient(
-		otlptracegrpc.WithDialOption(grpc.WithUserAgent(autoinstUserAgent)),
-	)
-	traceExporter, err := otlptrace.New(ctx, otlpTraceClient)
+	sampling, err := newSampling()
 	if err != nil {
-		log.Logger.Error(err, "unable to connect to OTLP endpoint")
 		return nil, err
 	}
 
-	bsp := sdktrace.NewBatchSpanProcessor(traceExporter)
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	propagators, err := newPropagators()
+	if err != nil {
+		return nil, err
+	}
+
+	tail, err := newTailSampler()
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := NewExporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sampling.sampler),
 		sdktrace.WithResource(res),
-		sdktrace.WithSpanProcessor(bsp),
 		sdktrace.WithIDGenerator(newEBPFSourceIDGenerator()),
-	)
+	}
+	if exporter != nil {
+		if !usesRetryQueue() {
+			exporter = countingExporter{exporter}
+		}
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	tracerProvider := sdktrace.NewTracerProvider(opts...)
 
 	bt, err := estimateBootTimeOffset()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Controller{
+	c := &Controller{
 		tracerProvider: tracerProvider,
+		sampling:       sampling,
+		propagators:    propagators,
 		tracersMap:     make(map[string]trace.Tracer),
 		bootTime:       bt,
-	}, nil
+	}
+	if tail != nil {
+		tail.export = c.export
+		tail.Start()
+		c.tail = tail
+	}
+	return c, nil
 }
 
 func estimateBootTimeOffset() (bootTimeOffset int64, err error) {
@@ -0,0 +1,242 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+
+	"go.opentelemetry.io/auto/pkg/log"     // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	// TracesExporterEnvVar is the environment variable key whose value
+	// selects the span exporter: otlp (default), console (or stdout), file
+	// or none.
+	TracesExporterEnvVar = "OTEL_TRACES_EXPORTER"
+	// OTLPProtocolEnvVar is the environment variable key whose value selects
+	// the protocol of the otlp exporter: grpc (default) or http/protobuf.
+	OTLPProtocolEnvVar = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	// OTLPEndpointEnvVar is the environment variable key whose value is the
+	// endpoint of the otlp exporter.
+	OTLPEndpointEnvVar = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	// OTLPHeadersEnvVar is the environment variable key whose value is the
+	// comma separated list of key=value headers sent by the otlp exporter.
+	OTLPHeadersEnvVar = "OTEL_EXPORTER_OTLP_HEADERS"
+	// OTLPInsecureEnvVar is the environment variable key whose value
+	// disables, when true, the TLS of the otlp exporter. It is read by the
+	// otlp exporter itself.
+	OTLPInsecureEnvVar = "OTEL_EXPORTER_OTLP_INSECURE"
+	// OTLPTimeoutEnvVar is the environment variable key whose value is the
+	// timeout in milliseconds of the exports of the otlp exporter. It is read
+	// by the otlp exporter itself.
+	OTLPTimeoutEnvVar = "OTEL_EXPORTER_OTLP_TIMEOUT"
+
+	otlpTracesProtocolEnvVar = "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"
+	otlpTracesHeadersEnvVar  = "OTEL_EXPORTER_OTLP_TRACES_HEADERS"
+	otlpTracesEndpointEnvVar = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+)
+
+// exporterFactory returns a new span exporter, or nil if spans are not to be
+// exported.
+type exporterFactory func(ctx context.Context) (sdktrace.SpanExporter, error)
+
+// exporters are the span exporters selectable by OTEL_TRACES_EXPORTER.
+var exporters = map[string]exporterFactory{
+	"otlp":    newOTLPExporter,
+	"console": newConsoleExporter,
+	"stdout":  newConsoleExporter,
+	"file":    newFileExporter,
+	"none":    func(context.Context) (sdktrace.SpanExporter, error) { return nil, nil },
+}
+
+// otlpClients are the otlp clients selectable by OTEL_EXPORTER_OTLP_PROTOCOL.
+var otlpClients = map[string]func() (otlptrace.Client, error){
+	"grpc":          newOTLPGRPCClient,
+	"http/protobuf": newOTLPHTTPClient,
+}
+
+// NewExporter returns the span exporter selected by the OTEL_TRACES_EXPORTER
+// environment variable, or nil if it is none.
+func NewExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	name := exporterName()
+	factory, ok := exporters[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s %q, supported exporters are: %s",
+			TracesExporterEnvVar, name, strings.Join(sortedKeys(exporters), ", "))
+	}
+
+	return factory(ctx)
+}
+
+// exporterName returns the name of the span exporter selected by the
+// OTEL_TRACES_EXPORTER environment variable.
+func exporterName() string {
+	if v, exists := os.LookupEnv(TracesExporterEnvVar); exists && v != "" {
+		return v
+	}
+	return "otlp"
+}
+
+// usesRetryQueue returns whether the spans are exported through the retry
+// queue, which counts them once sent.
+func usesRetryQueue() bool {
+	return exporterName() == "otlp" && os.Getenv(RetryQueueDirEnvVar) != ""
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewOTLPClient returns the otlp client selected by the
+// OTEL_EXPORTER_OTLP_PROTOCOL environment variable. The client is not
+// started.
+func NewOTLPClient() (otlptrace.Client, error) {
+	protocol := otlpProtocol()
+	factory, ok := otlpClients[protocol]
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s %q, supported protocols are: %s",
+			OTLPProtocolEnvVar, protocol, strings.Join(sortedKeys(otlpClients), ", "))
+	}
+
+	return factory()
+}
+
+func otlpProtocol() string {
+	for _, key := range []string{otlpTracesProtocolEnvVar, OTLPProtocolEnvVar} {
+		if v, exists := os.LookupEnv(key); exists && v != "" {
+			return v
+		}
+	}
+	return "grpc"
+}
+
+// otlpDestination returns the protocol and endpoint the clients of
+// NewOTLPClient send the spans with.
+func otlpDestination() string {
+	endpoint := os.Getenv(OTLPEndpointEnvVar)
+	if v := os.Getenv(otlpTracesEndpointEnvVar); v != "" {
+		endpoint = v
+	}
+	return otlpProtocol() + " " + endpoint
+}
+
+func newOTLPExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	client, err := NewOTLPClient()
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv(RetryQueueDirEnvVar) != "" {
+		client, err = retryQueueFor(client, otlpDestination())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Logger.V(0).Info("Establishing connection to OTLP receiver ...")
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		log.Logger.Error(err, "unable to connect to OTLP endpoint")
+		return nil, err
+	}
+	return exporter, nil
+}
+
+func newOTLPGRPCClient() (otlptrace.Client, error) {
+	return otlptracegrpc.NewClient(
+		otlptracegrpc.WithDialOption(grpc.WithUserAgent(autoinstUserAgent)),
+	), nil
+}
+
+func newOTLPHTTPClient() (otlptrace.Client, error) {
+	headers, err := otlpHeaders()
+	if err != nil {
+		return nil, err
+	}
+	headers["User-Agent"] = autoinstUserAgent
+
+	return otlptracehttp.NewClient(
+		otlptracehttp.WithHeaders(headers),
+	), nil
+}
+
+// otlpHeaders returns the headers set by OTEL_EXPORTER_OTLP_HEADERS and
+// OTEL_EXPORTER_OTLP_TRACES_HEADERS, the latter taking precedence. They are
+// read here as the headers passed as an option to the otlp exporter replace
+// the ones it reads itself.
+func otlpHeaders() (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, key := range []string{OTLPHeadersEnvVar, otlpTracesHeadersEnvVar} {
+		for _, header := range strings.Split(os.Getenv(key), ",") {
+			if strings.TrimSpace(header) == "" {
+				continue
+			}
+
+			parts := strings.SplitN(header, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid header %q in %s", header, key)
+			}
+			name, err := url.QueryUnescape(strings.TrimSpace(parts[0]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid header %q in %s: %w", header, key, err)
+			}
+			value, err := url.QueryUnescape(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid header %q in %s: %w", header, key, err)
+			}
+			headers[name] = value
+		}
+	}
+
+	return headers, nil
+}
+
+func newConsoleExporter(context.Context) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithPrettyPrint())
+}
+
+// countingExporter counts the spans exported, or failed to be, by the
+// wrapped exporter. The exporters of the retry queue are not wrapped, the
+// spans written to disk are counted once sent.
+type countingExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (e countingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	if err != nil {
+		metrics.SpansFailed.Add(float64(len(spans)))
+	} else {
+		metrics.SpansExported.Add(float64(len(spans)))
+	}
+	return err
+}
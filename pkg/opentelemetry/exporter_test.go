@@ -0,0 +1,149 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/events" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"              // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type failingExporter struct {
+	sdktrace.SpanExporter
+}
+
+func (failingExporter) ExportSpans(context.Context, []sdktrace.ReadOnlySpan) error {
+	return errors.New("unavailable")
+}
+
+func TestCountingExporter(t *testing.T) {
+	spans := tracetest.SpanStubs{{Name: "a"}, {Name: "b"}}.Snapshots()
+	exported := testutil.ToFloat64(metrics.SpansExported)
+	failed := testutil.ToFloat64(metrics.SpansFailed)
+
+	assert.NoError(t, countingExporter{tracetest.NewInMemoryExporter()}.ExportSpans(context.Background(), spans))
+	assert.Equal(t, exported+2, testutil.ToFloat64(metrics.SpansExported))
+
+	assert.Error(t, countingExporter{failingExporter{}}.ExportSpans(context.Background(), spans))
+	assert.Equal(t, failed+2, testutil.ToFloat64(metrics.SpansFailed))
+}
+
+func TestControllerExportsOTLP(t *testing.T) {
+	tests := []struct {
+		protocol    string
+		newReceiver func(*testing.T) *otlpReceiver
+	}{
+		{protocol: "", newReceiver: newGRPCReceiver},
+		{protocol: "grpc", newReceiver: newGRPCReceiver},
+		{protocol: "http/protobuf", newReceiver: newHTTPReceiver},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.protocol, func(t *testing.T) {
+			receiver := tt.newReceiver(t)
+			t.Setenv(TracesExporterEnvVar, "otlp")
+			t.Setenv(OTLPProtocolEnvVar, tt.protocol)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", receiver.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-tenant=a")
+
+			c, err := NewController("frontend")
+			require.NoError(t, err)
+
+			sc := trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    trace.TraceID{1},
+				SpanID:     trace.SpanID{2},
+				TraceFlags: trace.FlagsSampled,
+			})
+			c.Trace(&events.Event{
+				Library:     "net/http",
+				Name:        "GET",
+				Kind:        trace.SpanKindServer,
+				StartTime:   1000,
+				EndTime:     2000,
+				SpanContext: &sc,
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			require.NoError(t, c.Shutdown(ctx))
+
+			var got receivedRequest
+			select {
+			case got = <-receiver.requests:
+			case <-ctx.Done():
+				t.Fatal("no span received")
+			}
+
+			assert.Contains(t, got.userAgent, "OTel-Go-Auto-Instrumentation/")
+			require.Len(t, got.request.ResourceSpans, 1)
+			rs := got.request.ResourceSpans[0]
+			assert.Contains(t, rs.Resource.String(), "frontend")
+			require.Len(t, rs.ScopeSpans, 1)
+			assert.Equal(t, "net/http", rs.ScopeSpans[0].Scope.Name)
+			require.Len(t, rs.ScopeSpans[0].Spans, 1)
+			span := rs.ScopeSpans[0].Spans[0]
+			assert.Equal(t, "GET", span.Name)
+			assert.Equal(t, sc.TraceID().String(), hex.EncodeToString(span.TraceId))
+			assert.Equal(t, uint64(1000), span.EndTimeUnixNano-span.StartTimeUnixNano)
+		})
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	t.Setenv(TracesExporterEnvVar, "console")
+	exporter, err := NewExporter(context.Background())
+	require.NoError(t, err)
+	assert.IsType(t, &stdouttrace.Exporter{}, exporter)
+
+	t.Setenv(TracesExporterEnvVar, "none")
+	exporter, err = NewExporter(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	t.Setenv(TracesExporterEnvVar, "zipkin")
+	_, err = NewExporter(context.Background())
+	assert.ErrorContains(t, err, `unsupported OTEL_TRACES_EXPORTER "zipkin"`)
+
+	t.Setenv(TracesExporterEnvVar, "otlp")
+	t.Setenv(OTLPProtocolEnvVar, "http/json")
+	_, err = NewExporter(context.Background())
+	assert.ErrorContains(t, err, `unsupported OTEL_EXPORTER_OTLP_PROTOCOL "http/json"`)
+}
+
+func TestOTLPHeaders(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "x-tenant=a, authorization=Basic%20abc")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "x-tenant=b")
+
+	headers, err := otlpHeaders()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"x-tenant": "b", "authorization": "Basic abc"}, headers)
+
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_HEADERS", "x-tenant")
+	_, err = otlpHeaders()
+	assert.Error(t, err)
+}
@@ -0,0 +1,353 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"go.opentelemetry.io/auto/pkg/log" // nolint:staticcheck  // Atomic deprecation.
+)
+
+const (
+	// FileDirEnvVar is the environment variable key whose value is the
+	// directory the file exporter writes its files to.
+	FileDirEnvVar = "OTEL_GO_AUTO_EXPORTER_FILE_DIR"
+	// FileFormatEnvVar is the environment variable key whose value selects
+	// the encoding of the files of the file exporter: protobuf (default) or
+	// json.
+	FileFormatEnvVar = "OTEL_GO_AUTO_EXPORTER_FILE_FORMAT"
+	// FileMaxSizeEnvVar is the environment variable key whose value is the
+	// size in bytes above which the file exporter starts a new file.
+	FileMaxSizeEnvVar = "OTEL_GO_AUTO_EXPORTER_FILE_MAX_SIZE"
+	// FileMaxFilesEnvVar is the environment variable key whose value is the
+	// number of files the file exporter keeps, the oldest being removed
+	// first. 0 keeps them all.
+	FileMaxFilesEnvVar = "OTEL_GO_AUTO_EXPORTER_FILE_MAX_FILES"
+
+	defaultFileMaxSize = 100 << 20
+
+	fileNamePrefix = "spans-"
+	// fileTimeLayout sorts the files in the order they were written.
+	fileTimeLayout = "20060102T150405.000000000Z"
+)
+
+// fileExtensions are the extensions of the files written by the file
+// exporter, by format.
+var fileExtensions = map[string]string{
+	"protobuf": ".pb",
+	"json":     ".jsonl",
+}
+
+// fileClient is an [otlptrace.Client] writing the spans to size-rotated files
+// instead of sending them. Every upload is written as an
+// ExportTraceServiceRequest, either length-delimited protobuf or protobuf
+// JSON on a single line, so that the files are replayed as they would have
+// been exported.
+type fileClient struct {
+	dir      string
+	format   string
+	maxSize  int64
+	maxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+var _ otlptrace.Client = (*fileClient)(nil)
+
+func newFileExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	client, err := newFileClient()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Logger.V(0).Info("Writing spans to files", "dir", client.dir, "format", client.format)
+	return otlptrace.New(ctx, client)
+}
+
+func newFileClient() (*fileClient, error) {
+	c := &fileClient{
+		dir:     os.Getenv(FileDirEnvVar),
+		format:  "protobuf",
+		maxSize: defaultFileMaxSize,
+	}
+	if c.dir == "" {
+		return nil, fmt.Errorf("%s env var must be set for the file exporter", FileDirEnvVar)
+	}
+
+	if v := os.Getenv(FileFormatEnvVar); v != "" {
+		if _, ok := fileExtensions[v]; !ok {
+			return nil, fmt.Errorf("unsupported %s %q, supported formats are: %s",
+				FileFormatEnvVar, v, strings.Join(sortedKeys(fileExtensions), ", "))
+		}
+		c.format = v
+	}
+
+	if v := os.Getenv(FileMaxSizeEnvVar); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", FileMaxSizeEnvVar, v)
+		}
+		c.maxSize = size
+	}
+
+	if v := os.Getenv(FileMaxFilesEnvVar); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s %q", FileMaxFilesEnvVar, v)
+		}
+		c.maxFiles = n
+	}
+
+	return c, nil
+}
+
+// Start creates the directory of the files.
+func (c *fileClient) Start(context.Context) error {
+	return os.MkdirAll(c.dir, 0o755)
+}
+
+// Stop closes the file being written.
+func (c *fileClient) Stop(context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
+}
+
+// UploadTraces appends spans to the current file, starting a new one first if
+// the current file would exceed the maximum size.
+func (c *fileClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	var buf bytes.Buffer
+	req := &collectortrace.ExportTraceServiceRequest{ResourceSpans: spans}
+	switch c.format {
+	case "json":
+		b, err := protojson.Marshal(req)
+		if err != nil {
+			return err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	default:
+		if _, err := protodelim.MarshalTo(&buf, req); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil || (c.size > 0 && c.size+int64(buf.Len()) > c.maxSize) {
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := c.f.Write(buf.Bytes())
+	c.size += int64(n)
+	return err
+}
+
+// rotate closes the current file, opens a new one and removes the oldest
+// files beyond the maximum number of files.
+func (c *fileClient) rotate() error {
+	if c.f != nil {
+		if err := c.f.Close(); err != nil {
+			log.Logger.Error(err, "unable to close span file", "file", c.f.Name())
+		}
+		c.f = nil
+	}
+
+	// the exporters of several targets may share the directory
+	var f *os.File
+	for {
+		name := fileNamePrefix + time.Now().UTC().Format(fileTimeLayout) + fileExtensions[c.format]
+		var err error
+		f, err = os.OpenFile(filepath.Join(c.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+	}
+	c.f = f
+	c.size = 0
+
+	if c.maxFiles == 0 {
+		return nil
+	}
+	files, err := SpanFiles(c.dir)
+	if err != nil {
+		return err
+	}
+	for len(files) > c.maxFiles {
+		if err := os.Remove(files[0]); err != nil {
+			return err
+		}
+		files = files[1:]
+	}
+	return nil
+}
+
+// SpanFiles returns the files written by the file exporter to dir, oldest
+// first.
+func SpanFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), fileNamePrefix) {
+			continue
+		}
+		if _, ok := fileFormat(e.Name()); ok {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func fileFormat(name string) (string, bool) {
+	for format, ext := range fileExtensions {
+		if strings.HasSuffix(name, ext) {
+			return format, true
+		}
+	}
+	return "", false
+}
+
+// ReadSpanFile calls fn with the spans of every upload written to the file
+// at path by the file exporter, in the order they were written. The format
+// of the file is told by its extension.
+func ReadSpanFile(path string, fn func([]*tracepb.ResourceSpans) error) error {
+	format, ok := fileFormat(path)
+	if !ok {
+		return fmt.Errorf("%s: unknown span file extension", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		req := &collectortrace.ExportTraceServiceRequest{}
+		switch format {
+		case "json":
+			var line []byte
+			line, err = r.ReadBytes('\n')
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				// the last line was not fully written
+				err = io.ErrUnexpectedEOF
+			}
+			if err == nil {
+				err = protojson.Unmarshal(line, req)
+			}
+		default:
+			err = protodelim.UnmarshalFrom(r, req)
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if err := fn(req.ResourceSpans); err != nil {
+			return err
+		}
+	}
+}
+
+// Replay uploads with client the spans of the files written by the file
+// exporter at paths, directories being replaced by the files they hold. The
+// spans are sent unchanged, so that they keep the timestamps they were
+// recorded with. It returns the number of spans uploaded.
+func Replay(ctx context.Context, client otlptrace.Client, paths []string) (int, error) {
+	var files []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return 0, err
+		}
+		if !info.IsDir() {
+			files = append(files, p)
+			continue
+		}
+
+		dirFiles, err := SpanFiles(p)
+		if err != nil {
+			return 0, err
+		}
+		files = append(files, dirFiles...)
+	}
+
+	count := 0
+	for _, file := range files {
+		err := ReadSpanFile(file, func(spans []*tracepb.ResourceSpans) error {
+			if err := client.UploadTraces(ctx, spans); err != nil {
+				return err
+			}
+			count += spanCount(spans)
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+func spanCount(spans []*tracepb.ResourceSpans) int {
+	count := 0
+	for _, rs := range spans {
+		for _, ss := range rs.ScopeSpans {
+			count += len(ss.Spans)
+		}
+	}
+	return count
+}
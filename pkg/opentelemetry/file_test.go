@@ -0,0 +1,210 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/events" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/trace"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+func resourceSpans(names ...string) []*tracepb.ResourceSpans {
+	ss := &tracepb.ScopeSpans{}
+	for i, name := range names {
+		ss.Spans = append(ss.Spans, &tracepb.Span{
+			TraceId:           []byte{1, 15: byte(i)},
+			SpanId:            []byte{2, 7: byte(i)},
+			Name:              name,
+			StartTimeUnixNano: 1000,
+			EndTimeUnixNano:   2000,
+		})
+	}
+	return []*tracepb.ResourceSpans{{ScopeSpans: []*tracepb.ScopeSpans{ss}}}
+}
+
+func readNames(t *testing.T, dir string) [][]string {
+	files, err := SpanFiles(dir)
+	require.NoError(t, err)
+
+	var names [][]string
+	for _, file := range files {
+		var fileNames []string
+		require.NoError(t, ReadSpanFile(file, func(spans []*tracepb.ResourceSpans) error {
+			for _, s := range spans[0].ScopeSpans[0].Spans {
+				fileNames = append(fileNames, s.Name)
+			}
+			return nil
+		}))
+		names = append(names, fileNames)
+	}
+	return names
+}
+
+func TestFileClientRotates(t *testing.T) {
+	for _, format := range []string{"protobuf", "json"} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv(FileDirEnvVar, dir)
+			t.Setenv(FileFormatEnvVar, format)
+
+			// every upload exceeds the maximum size on its own, and is
+			// still written whole
+			t.Setenv(FileMaxSizeEnvVar, "1")
+			c, err := newFileClient()
+			require.NoError(t, err)
+			ctx := context.Background()
+			require.NoError(t, c.Start(ctx))
+			require.NoError(t, c.UploadTraces(ctx, resourceSpans("a", "b")))
+			require.NoError(t, c.UploadTraces(ctx, resourceSpans("c")))
+			require.NoError(t, c.Stop(ctx))
+			assert.Equal(t, [][]string{{"a", "b"}, {"c"}}, readNames(t, dir))
+
+			// the file is continued by uploads fitting in the maximum size
+			t.Setenv(FileMaxSizeEnvVar, "")
+			c, err = newFileClient()
+			require.NoError(t, err)
+			require.NoError(t, c.UploadTraces(ctx, resourceSpans("d")))
+			require.NoError(t, c.UploadTraces(ctx, resourceSpans("e", "f")))
+			require.NoError(t, c.Stop(ctx))
+			assert.Equal(t, [][]string{{"a", "b"}, {"c"}, {"d", "e", "f"}}, readNames(t, dir))
+		})
+	}
+}
+
+func TestFileClientMaxFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(FileDirEnvVar, dir)
+	t.Setenv(FileMaxSizeEnvVar, "1")
+	t.Setenv(FileMaxFilesEnvVar, "2")
+
+	c, err := newFileClient()
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.Start(ctx))
+	for _, name := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, c.UploadTraces(ctx, resourceSpans(name)))
+	}
+	require.NoError(t, c.Stop(ctx))
+
+	assert.Equal(t, [][]string{{"c"}, {"d"}}, readNames(t, dir))
+}
+
+func TestNewFileClientErrors(t *testing.T) {
+	t.Setenv(FileDirEnvVar, "")
+	_, err := newFileClient()
+	assert.ErrorContains(t, err, "OTEL_GO_AUTO_EXPORTER_FILE_DIR env var must be set")
+
+	t.Setenv(FileDirEnvVar, t.TempDir())
+	t.Setenv(FileFormatEnvVar, "csv")
+	_, err = newFileClient()
+	assert.ErrorContains(t, err, `unsupported OTEL_GO_AUTO_EXPORTER_FILE_FORMAT "csv"`)
+
+	t.Setenv(FileFormatEnvVar, "json")
+	t.Setenv(FileMaxSizeEnvVar, "-1")
+	_, err = newFileClient()
+	assert.ErrorContains(t, err, `invalid OTEL_GO_AUTO_EXPORTER_FILE_MAX_SIZE "-1"`)
+}
+
+func TestReadSpanFileTruncated(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(FileDirEnvVar, dir)
+	t.Setenv(FileFormatEnvVar, "json")
+
+	c, err := newFileClient()
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, c.Start(ctx))
+	require.NoError(t, c.UploadTraces(ctx, resourceSpans("a")))
+	require.NoError(t, c.Stop(ctx))
+
+	files, err := SpanFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"resourceSpans":`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	calls := 0
+	err = ReadSpanFile(files[0], func([]*tracepb.ResourceSpans) error {
+		calls++
+		return nil
+	})
+	assert.Equal(t, 1, calls)
+	assert.ErrorContains(t, err, "unexpected EOF")
+}
+
+func TestReplayKeepsTimestamps(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(TracesExporterEnvVar, "file")
+	t.Setenv(FileDirEnvVar, dir)
+
+	c, err := NewController("frontend")
+	require.NoError(t, err)
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	c.Trace(&events.Event{
+		Library:     "net/http",
+		Name:        "GET",
+		Kind:        trace.SpanKindServer,
+		StartTime:   1000,
+		EndTime:     2000,
+		SpanContext: &sc,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, c.Shutdown(ctx))
+
+	receiver := newGRPCReceiver(t)
+	t.Setenv(OTLPProtocolEnvVar, "grpc")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", receiver.endpoint)
+	t.Setenv("OTEL_EXPORTER_OTLP_INSECURE", "true")
+	client, err := NewOTLPClient()
+	require.NoError(t, err)
+	require.NoError(t, client.Start(ctx))
+	defer func() { _ = client.Stop(ctx) }()
+
+	count, err := Replay(ctx, client, []string{dir})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	var got receivedRequest
+	select {
+	case got = <-receiver.requests:
+	case <-ctx.Done():
+		t.Fatal("no span replayed")
+	}
+
+	require.Len(t, got.request.ResourceSpans, 1)
+	rs := got.request.ResourceSpans[0]
+	assert.Contains(t, rs.Resource.String(), "frontend")
+	span := rs.ScopeSpans[0].Spans[0]
+	assert.Equal(t, "GET", span.Name)
+	assert.Equal(t, c.convertTime(1000).UnixNano(), int64(span.StartTimeUnixNano))
+	assert.Equal(t, c.convertTime(2000).UnixNano(), int64(span.EndTimeUnixNano))
+}
@@ -0,0 +1,68 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PropagatorsEnvVar is the environment variable key whose value is the
+// comma-separated list of the formats the probes extract the trace context
+// from and inject it with: tracecontext (default), b3, b3multi and jaeger.
+// baggage is accepted, but no baggage is propagated, and none disables the
+// propagation.
+const PropagatorsEnvVar = "OTEL_PROPAGATORS"
+
+// propagators are the formats selectable by OTEL_PROPAGATORS, and whether the
+// probes propagate them.
+var propagators = map[string]bool{
+	"tracecontext": true,
+	"baggage":      false,
+	"b3":           true,
+	"b3multi":      true,
+	"jaeger":       true,
+	"none":         false,
+}
+
+// newPropagators returns the formats propagated by the probes selected by
+// OTEL_PROPAGATORS.
+func newPropagators() ([]string, error) {
+	v := os.Getenv(PropagatorsEnvVar)
+	if v == "" {
+		return []string{"tracecontext"}, nil
+	}
+
+	var result []string
+	for _, name := range strings.Split(v, ",") {
+		name = strings.TrimSpace(name)
+		propagated, ok := propagators[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported %s %q, supported propagators are: %s",
+				PropagatorsEnvVar, name, strings.Join(sortedKeys(propagators), ", "))
+		}
+		if propagated {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// Propagators returns the formats the probes of the target propagate the
+// trace context with.
+func (c *Controller) Propagators() []string {
+	return c.propagators
+}
@@ -0,0 +1,47 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPropagators(t *testing.T) {
+	tests := []struct {
+		env  string
+		want []string
+	}{
+		{env: "", want: []string{"tracecontext"}},
+		{env: "tracecontext,baggage", want: []string{"tracecontext"}},
+		{env: "b3, b3multi,jaeger", want: []string{"b3", "b3multi", "jaeger"}},
+		{env: "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			t.Setenv(PropagatorsEnvVar, tt.env)
+			got, err := newPropagators()
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Setenv(PropagatorsEnvVar, "tracecontext,xray")
+	_, err := newPropagators()
+	assert.ErrorContains(t, err, `unsupported OTEL_PROPAGATORS "xray"`)
+}
@@ -0,0 +1,97 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+)
+
+// receivedRequest is an export request received by an otlpReceiver.
+type receivedRequest struct {
+	userAgent string
+	request   *collectortrace.ExportTraceServiceRequest
+}
+
+// otlpReceiver stands in for an OTLP collector, over gRPC or HTTP.
+type otlpReceiver struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	// endpoint is the URL the receiver is listening on.
+	endpoint string
+	requests chan receivedRequest
+}
+
+func (r *otlpReceiver) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	r.requests <- receivedRequest{userAgent: md.Get("user-agent")[0], request: req}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+// newGRPCReceiver starts an OTLP/gRPC receiver for the duration of t.
+func newGRPCReceiver(t *testing.T) *otlpReceiver {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	r := &otlpReceiver{endpoint: "http://" + l.Addr().String(), requests: make(chan receivedRequest, 10)}
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, r)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+
+	return r
+}
+
+// newHTTPReceiver starts an OTLP/HTTP receiver for the duration of t.
+func newHTTPReceiver(t *testing.T) *otlpReceiver {
+	r := &otlpReceiver{requests: make(chan receivedRequest, 10)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/traces" || req.Header.Get("Content-Type") != "application/x-protobuf" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		export := &collectortrace.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, export); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.requests <- receivedRequest{userAgent: req.Header.Get("User-Agent"), request: export}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		resp, _ := proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(srv.Close)
+	r.endpoint = srv.URL
+
+	return r
+}
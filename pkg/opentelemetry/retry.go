@@ -0,0 +1,511 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"go.opentelemetry.io/auto/pkg/log"     // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+)
+
+const (
+	// RetryQueueDirEnvVar is the environment variable key whose value is the
+	// directory of the retry queue. When set, the spans are written to the
+	// queue, and sent from it to the otlp endpoint until they are received
+	// or rejected, so that they survive an outage of the endpoint or a restart of the
+	// agent.
+	RetryQueueDirEnvVar = "OTEL_GO_AUTO_RETRY_QUEUE_DIR"
+	// RetryQueueMaxSizeEnvVar is the environment variable key whose value is
+	// the size in bytes of the retry queue above which the oldest spans are
+	// dropped.
+	RetryQueueMaxSizeEnvVar = "OTEL_GO_AUTO_RETRY_QUEUE_MAX_SIZE"
+	// RetryQueueMaxAgeEnvVar is the environment variable key whose value is
+	// the duration after which the spans of the retry queue are dropped.
+	RetryQueueMaxAgeEnvVar = "OTEL_GO_AUTO_RETRY_QUEUE_MAX_AGE"
+
+	defaultRetryQueueMaxSize = 256 << 20
+	defaultRetryQueueMaxAge  = 24 * time.Hour
+
+	retryBatchExt = ".batch"
+)
+
+// Bounds of the delay between the attempts to send a batch of the retry
+// queue.
+var (
+	retryInitialBackoff = time.Second
+	retryMaxBackoff     = time.Minute
+)
+
+// httpStatusError matches the errors of the otlp http client for the
+// responses it does not retry itself, capturing their status code.
+var httpStatusError = regexp.MustCompile(`^failed to send to \S+: (\d{3}) `)
+
+// retryBatch is a batch of spans held by the retry queue in a file of its
+// own, named after the time it was queued and its number of spans.
+type retryBatch struct {
+	name     string
+	size     int64
+	spans    int
+	queuedAt time.Time
+}
+
+// retryQueue is an [otlptrace.Client] writing the spans to disk, and sending
+// them with another client in the order they were written, backing off while
+// the endpoint is unavailable.
+//
+// The exporters of every target share the retry queue of a directory, which
+// is started by the first of them and stopped by the last.
+//
+// The spans are counted as exported once sent, and as failed whenever an
+// attempt to send them fails. Those the endpoint rejects are dropped.
+type retryQueue struct {
+	dir         string
+	maxSize     int64
+	maxAge      time.Duration
+	client      otlptrace.Client
+	destination string
+
+	mu       sync.Mutex
+	refs     int
+	batches  []retryBatch
+	size     int64
+	seq      uint64
+	inFlight string
+
+	notify   chan struct{}
+	stopping chan struct{}
+	done     chan struct{}
+	cancel   context.CancelFunc
+}
+
+var _ otlptrace.Client = (*retryQueue)(nil)
+
+var (
+	retryQueuesMu sync.Mutex
+	retryQueues   = make(map[string]*retryQueue)
+)
+
+// retryQueueFor returns the retry queue of the directory set by
+// OTEL_GO_AUTO_RETRY_QUEUE_DIR, sending its spans with client to destination
+// unless the queue already exists. An existing queue of the directory is only
+// returned if its spans are sent to the same destination, and bounded the
+// same.
+func retryQueueFor(client otlptrace.Client, destination string) (*retryQueue, error) {
+	dir := os.Getenv(RetryQueueDirEnvVar)
+	maxSize := int64(defaultRetryQueueMaxSize)
+	if v := os.Getenv(RetryQueueMaxSizeEnvVar); v != "" {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", RetryQueueMaxSizeEnvVar, v)
+		}
+		maxSize = size
+	}
+	maxAge := defaultRetryQueueMaxAge
+	if v := os.Getenv(RetryQueueMaxAgeEnvVar); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", RetryQueueMaxAgeEnvVar, v)
+		}
+		maxAge = age
+	}
+
+	retryQueuesMu.Lock()
+	defer retryQueuesMu.Unlock()
+
+	if q, exists := retryQueues[dir]; exists {
+		if q.destination != destination || q.maxSize != maxSize || q.maxAge != maxAge {
+			return nil, fmt.Errorf("retry queue %s is already used with another configuration", dir)
+		}
+		return q, nil
+	}
+	q := &retryQueue{
+		dir:         dir,
+		maxSize:     maxSize,
+		maxAge:      maxAge,
+		client:      client,
+		destination: destination,
+	}
+	retryQueues[dir] = q
+	return q, nil
+}
+
+// Start loads the spans left in the queue by a previous run, and starts
+// sending them.
+func (q *retryQueue) Start(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.refs++; q.refs > 1 {
+		return nil
+	}
+
+	err := os.MkdirAll(q.dir, 0o755)
+	if err == nil {
+		err = q.load()
+	}
+	if err == nil {
+		err = q.client.Start(ctx)
+	}
+	if err != nil {
+		q.refs--
+		return err
+	}
+
+	q.notify = make(chan struct{}, 1)
+	q.stopping = make(chan struct{})
+	q.done = make(chan struct{})
+	runCtx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	go q.run(runCtx)
+
+	return nil
+}
+
+// load reads the batches of the queue from its directory.
+func (q *retryQueue) load() error {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	q.batches = nil
+	q.size = 0
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, retryBatchExt+".tmp") {
+			// the agent stopped while writing the batch
+			_ = os.Remove(filepath.Join(q.dir, name))
+			continue
+		}
+
+		b, ok := parseRetryBatchName(name)
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		b.size = info.Size()
+		q.batches = append(q.batches, b)
+		q.size += b.size
+	}
+	sort.Slice(q.batches, func(i, j int) bool { return q.batches[i].name < q.batches[j].name })
+
+	spans := 0
+	for _, b := range q.batches {
+		spans += b.spans
+	}
+	metrics.RetryQueueSpans.Add(float64(spans))
+	if spans > 0 {
+		log.Logger.V(0).Info("Resuming export of queued spans", "spans", spans, "dir", q.dir)
+	}
+
+	return nil
+}
+
+// parseRetryBatchName parses the name of a batch file,
+// <queue time in ns>-<sequence>-<spans>.batch.
+func parseRetryBatchName(name string) (retryBatch, bool) {
+	if !strings.HasSuffix(name, retryBatchExt) {
+		return retryBatch{}, false
+	}
+	parts := strings.Split(strings.TrimSuffix(name, retryBatchExt), "-")
+	if len(parts) != 3 {
+		return retryBatch{}, false
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return retryBatch{}, false
+	}
+	spans, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return retryBatch{}, false
+	}
+
+	return retryBatch{name: name, spans: spans, queuedAt: time.Unix(0, ts)}, true
+}
+
+// UploadTraces writes spans to the queue, dropping the oldest spans queued if
+// the queue exceeds its maximum size.
+func (q *retryQueue) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	data, err := proto.Marshal(&collectortrace.ExportTraceServiceRequest{ResourceSpans: spans})
+	if err != nil {
+		return err
+	}
+	count := spanCount(spans)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if int64(len(data)) > q.maxSize {
+		q.dropped("size", count)
+		return nil
+	}
+
+	now := time.Now()
+	q.seq++
+	b := retryBatch{
+		// the zero padding sorts the batches in the order they were queued
+		name:     fmt.Sprintf("%020d-%010d-%d%s", now.UnixNano(), q.seq, count, retryBatchExt),
+		size:     int64(len(data)),
+		spans:    count,
+		queuedAt: now,
+	}
+
+	// the batch is renamed once complete, so that no partial batch is sent
+	path := filepath.Join(q.dir, b.name)
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	q.batches = append(q.batches, b)
+	q.size += b.size
+	metrics.RetryQueueSpans.Add(float64(count))
+
+	for q.size > q.maxSize {
+		i := 0
+		if q.batches[0].name == q.inFlight {
+			i = 1
+		}
+		if i >= len(q.batches) {
+			break
+		}
+		q.remove(i)
+		q.dropped("size", q.batches[i].spans)
+		q.batches = append(q.batches[:i], q.batches[i+1:]...)
+	}
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// remove deletes the file of the i-th batch and forgets its size. It must be
+// called with q.mu held.
+func (q *retryQueue) remove(i int) {
+	b := q.batches[i]
+	if err := os.Remove(filepath.Join(q.dir, b.name)); err != nil && !os.IsNotExist(err) {
+		log.Logger.Error(err, "unable to remove span batch", "batch", b.name)
+	}
+	q.size -= b.size
+	metrics.RetryQueueSpans.Sub(float64(b.spans))
+}
+
+func (q *retryQueue) dropped(reason string, spans int) {
+	metrics.SpansDropped.WithLabelValues(reason).Add(float64(spans))
+	log.Logger.V(0).Info("dropped spans from the retry queue", "reason", reason, "spans", spans)
+}
+
+// run sends the batches of the queue, oldest first, until ctx is done or the
+// queue is stopping and empty.
+func (q *retryQueue) run(ctx context.Context) {
+	defer close(q.done)
+
+	backoff := retryInitialBackoff
+	for {
+		b, ok := q.next()
+		if !ok {
+			select {
+			case <-q.notify:
+				continue
+			case <-q.stopping:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		err := q.send(ctx, b)
+		if err == nil {
+			backoff = retryInitialBackoff
+			continue
+		}
+
+		log.Logger.Error(err, "unable to export queued spans, retrying", "spans", b.spans, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > retryMaxBackoff {
+			backoff = retryMaxBackoff
+		}
+	}
+}
+
+// next drops the batches older than the maximum age, and returns the oldest
+// batch left.
+func (q *retryQueue) next() (retryBatch, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.inFlight = ""
+	for len(q.batches) > 0 && time.Since(q.batches[0].queuedAt) > q.maxAge {
+		q.remove(0)
+		q.dropped("age", q.batches[0].spans)
+		q.batches = q.batches[1:]
+	}
+	if len(q.batches) == 0 {
+		return retryBatch{}, false
+	}
+
+	q.inFlight = q.batches[0].name
+	return q.batches[0], true
+}
+
+// send sends the batch b, and removes it from the queue once received.
+func (q *retryQueue) send(ctx context.Context, b retryBatch) error {
+	data, err := os.ReadFile(filepath.Join(q.dir, b.name))
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err == nil {
+		err = proto.Unmarshal(data, req)
+	}
+	if err != nil {
+		log.Logger.Error(err, "unable to read span batch", "batch", b.name)
+		q.ack(b, "invalid")
+		return nil
+	}
+
+	if err := q.client.UploadTraces(ctx, req.ResourceSpans); err != nil {
+		if rejected(err) {
+			log.Logger.Error(err, "queued spans rejected by the endpoint, dropping them", "spans", b.spans)
+			q.ack(b, "rejected")
+			return nil
+		}
+		metrics.SpansFailed.Add(float64(b.spans))
+		return err
+	}
+	metrics.SpansExported.Add(float64(b.spans))
+	q.ack(b, "")
+	return nil
+}
+
+// rejected returns whether err, the failure to send a batch, rejects the
+// batch for good: sending it again fails the same. The responses of the
+// endpoint are retryable as the OTLP specification tells, the failures to
+// reach it always are.
+func rejected(err error) bool {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		s := grpcErr.GRPCStatus()
+		switch s.Code() {
+		case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+			return false
+		case codes.ResourceExhausted:
+			// the endpoint tells when to retry if throttling, the batch is
+			// over the size limit otherwise
+			for _, detail := range s.Details() {
+				if _, ok := detail.(*errdetails.RetryInfo); ok {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	m := httpStatusError.FindStringSubmatch(err.Error())
+	if m == nil {
+		return false
+	}
+	switch code, _ := strconv.Atoi(m[1]); code {
+	case 429, 502, 503, 504:
+		return false
+	}
+	return true
+}
+
+// ack removes the batch b from the queue, counting its spans as dropped for
+// reason unless it is empty.
+func (q *retryQueue) ack(b retryBatch, reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.inFlight = ""
+	if len(q.batches) == 0 || q.batches[0].name != b.name {
+		return
+	}
+	q.remove(0)
+	if reason != "" {
+		q.dropped(reason, b.spans)
+	}
+	q.batches = q.batches[1:]
+}
+
+// Stop sends the spans left in the queue until ctx is done, the spans not
+// sent by then being kept on disk for the next run, and stops the client.
+func (q *retryQueue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	q.refs--
+	if q.refs > 0 {
+		q.mu.Unlock()
+		return nil
+	}
+	q.mu.Unlock()
+
+	retryQueuesMu.Lock()
+	delete(retryQueues, q.dir)
+	retryQueuesMu.Unlock()
+
+	close(q.stopping)
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+
+	q.mu.Lock()
+	spans := 0
+	for _, b := range q.batches {
+		spans += b.spans
+	}
+	q.mu.Unlock()
+	// the spans left are counted again by the queue loading them
+	metrics.RetryQueueSpans.Sub(float64(spans))
+	if spans > 0 {
+		log.Logger.V(0).Info("spans left in the retry queue", "spans", spans, "dir", q.dir)
+	}
+
+	return q.client.Stop(ctx)
+}
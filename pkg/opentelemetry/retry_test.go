@@ -0,0 +1,263 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/metrics" // nolint:staticcheck  // Atomic deprecation.
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// unavailableClient is an otlp client failing while its endpoint is down.
+type unavailableClient struct {
+	mu       sync.Mutex
+	down     bool
+	reject   string
+	attempts int
+	received []string
+}
+
+func (c *unavailableClient) Start(context.Context) error { return nil }
+func (c *unavailableClient) Stop(context.Context) error  { return nil }
+
+func (c *unavailableClient) UploadTraces(_ context.Context, spans []*tracepb.ResourceSpans) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.attempts++
+	if c.down {
+		return errors.New("unavailable")
+	}
+	if spans[0].ScopeSpans[0].Spans[0].Name == c.reject {
+		return status.Error(codes.InvalidArgument, "invalid span")
+	}
+	for _, s := range spans[0].ScopeSpans[0].Spans {
+		c.received = append(c.received, s.Name)
+	}
+	return nil
+}
+
+func (c *unavailableClient) setDown(down bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.down = down
+}
+
+func (c *unavailableClient) state() (int, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts, append([]string(nil), c.received...)
+}
+
+func newTestRetryQueue(t *testing.T, dir string, client *unavailableClient) *retryQueue {
+	t.Setenv(RetryQueueDirEnvVar, dir)
+	q, err := retryQueueFor(client, "grpc localhost:4317")
+	require.NoError(t, err)
+	return q
+}
+
+func init() {
+	retryInitialBackoff = time.Millisecond
+	retryMaxBackoff = 10 * time.Millisecond
+}
+
+func TestRetryQueueRetriesInOrder(t *testing.T) {
+	client := &unavailableClient{down: true}
+	q := newTestRetryQueue(t, t.TempDir(), client)
+	ctx := context.Background()
+	require.NoError(t, q.Start(ctx))
+
+	// the spans written to disk are not exported yet
+	exported := testutil.ToFloat64(metrics.SpansExported)
+	failed := testutil.ToFloat64(metrics.SpansFailed)
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("a")))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("b", "c")))
+	assert.Eventually(t, func() bool {
+		attempts, _ := client.state()
+		return attempts > 3
+	}, 5*time.Second, time.Millisecond)
+
+	assert.GreaterOrEqual(t, testutil.ToFloat64(metrics.SpansFailed), failed+3)
+
+	client.setDown(false)
+	assert.Eventually(t, func() bool {
+		_, received := client.state()
+		return len(received) == 3
+	}, 5*time.Second, time.Millisecond)
+	_, received := client.state()
+	assert.Equal(t, []string{"a", "b", "c"}, received)
+	assert.Equal(t, exported+3, testutil.ToFloat64(metrics.SpansExported))
+
+	require.NoError(t, q.Stop(ctx))
+	entries, err := os.ReadDir(q.dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRetryQueueDropsRejectedBatches(t *testing.T) {
+	client := &unavailableClient{reject: "a"}
+	q := newTestRetryQueue(t, t.TempDir(), client)
+	ctx := context.Background()
+
+	dropped := testutil.ToFloat64(metrics.SpansDropped.WithLabelValues("rejected"))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("a", "b")))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("c")))
+	require.NoError(t, q.Start(ctx))
+
+	// the batch rejected does not hold back the next ones
+	assert.Eventually(t, func() bool {
+		_, received := client.state()
+		return len(received) == 1
+	}, 5*time.Second, time.Millisecond)
+	require.NoError(t, q.Stop(ctx))
+	attempts, received := client.state()
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, []string{"c"}, received)
+	assert.Equal(t, dropped+2, testutil.ToFloat64(metrics.SpansDropped.WithLabelValues("rejected")))
+}
+
+func TestRejected(t *testing.T) {
+	throttled, err := status.New(codes.ResourceExhausted, "throttled").
+		WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Second)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection refused"), false},
+		{status.Error(codes.Unavailable, "unavailable"), false},
+		{fmt.Errorf("max retry time elapsed: %w", status.Error(codes.Unavailable, "unavailable")), false},
+		{throttled.Err(), false},
+		{status.Error(codes.ResourceExhausted, "message larger than max"), true},
+		{status.Error(codes.InvalidArgument, "invalid span"), true},
+		{errors.New("failed to send to http://localhost:4318/v1/traces: 503 Service Unavailable"), false},
+		{errors.New("failed to send to http://localhost:4318/v1/traces: 400 Bad Request"), true},
+		{errors.New("failed to send to http://localhost:4318/v1/traces: 413 Request Entity Too Large"), true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, rejected(tt.err), tt.err.Error())
+	}
+}
+
+func TestRetryQueueMaxSize(t *testing.T) {
+	client := &unavailableClient{down: true}
+	q := newTestRetryQueue(t, t.TempDir(), client)
+	ctx := context.Background()
+	require.NoError(t, q.Start(ctx))
+
+	dropped := testutil.ToFloat64(metrics.SpansDropped.WithLabelValues("size"))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("a")))
+	q.mu.Lock()
+	q.maxSize = 2*q.size + 1
+	q.mu.Unlock()
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("b")))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("c")))
+
+	// the batch being sent is kept
+	assert.Equal(t, dropped+1, testutil.ToFloat64(metrics.SpansDropped.WithLabelValues("size")))
+
+	client.setDown(false)
+	assert.Eventually(t, func() bool {
+		_, received := client.state()
+		return len(received) == 2
+	}, 5*time.Second, time.Millisecond)
+	_, received := client.state()
+	assert.Len(t, received, 2)
+	assert.Equal(t, "c", received[1])
+
+	require.NoError(t, q.Stop(ctx))
+}
+
+func TestRetryQueueMaxAge(t *testing.T) {
+	client := &unavailableClient{down: true}
+	q := newTestRetryQueue(t, t.TempDir(), client)
+	q.maxAge = 50 * time.Millisecond
+	ctx := context.Background()
+	require.NoError(t, q.Start(ctx))
+
+	dropped := testutil.ToFloat64(metrics.SpansDropped.WithLabelValues("age"))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("a", "b")))
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.SpansDropped.WithLabelValues("age")) == dropped+2
+	}, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, q.Stop(ctx))
+	_, received := client.state()
+	assert.Empty(t, received)
+}
+
+func TestRetryQueueResumes(t *testing.T) {
+	dir := t.TempDir()
+	client := &unavailableClient{down: true}
+	q := newTestRetryQueue(t, dir, client)
+	ctx := context.Background()
+	require.NoError(t, q.Start(ctx))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("a")))
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("b")))
+
+	// the spans not sent by the deadline are kept for the next run
+	stopCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.NoError(t, q.Stop(stopCtx))
+
+	client = &unavailableClient{}
+	q = newTestRetryQueue(t, dir, client)
+	require.NoError(t, q.Start(ctx))
+	require.NoError(t, q.Stop(ctx))
+
+	_, received := client.state()
+	assert.Equal(t, []string{"a", "b"}, received)
+}
+
+func TestRetryQueueShared(t *testing.T) {
+	dir := t.TempDir()
+	client := &unavailableClient{}
+	q := newTestRetryQueue(t, dir, client)
+	assert.Same(t, q, newTestRetryQueue(t, dir, &unavailableClient{}))
+
+	ctx := context.Background()
+	require.NoError(t, q.Start(ctx))
+	require.NoError(t, q.Start(ctx))
+	require.NoError(t, q.Stop(ctx))
+
+	// the queue is still used by another exporter
+	require.NoError(t, q.UploadTraces(ctx, resourceSpans("a")))
+	require.NoError(t, q.Stop(ctx))
+	_, received := client.state()
+	assert.Equal(t, []string{"a"}, received)
+
+	// a directory holds the spans of a single destination
+	q = newTestRetryQueue(t, dir, client)
+	_, err := retryQueueFor(client, "http/protobuf localhost:4318")
+	assert.ErrorContains(t, err, "another configuration")
+	require.NoError(t, q.Start(ctx))
+	require.NoError(t, q.Stop(ctx))
+}
@@ -0,0 +1,157 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/events" // nolint:staticcheck  // Atomic deprecation.
+)
+
+const (
+	// TracesSamplerEnvVar is the environment variable key whose value selects
+	// the sampler of the spans: always_on, always_off, traceidratio,
+	// parentbased_always_on (default), parentbased_always_off or
+	// parentbased_traceidratio.
+	TracesSamplerEnvVar = "OTEL_TRACES_SAMPLER"
+	// TracesSamplerArgEnvVar is the environment variable key whose value is
+	// the argument of the sampler, the sampling probability between 0 and 1
+	// of the traceidratio samplers.
+	TracesSamplerArgEnvVar = "OTEL_TRACES_SAMPLER_ARG"
+	// KernelSamplingEnvVar is the environment variable key whose value
+	// enables, when true, the sampling of the traces by the eBPF probes
+	// themselves. The spans of the traces not sampled by the root sampler
+	// are then dropped before being read by the agent.
+	KernelSamplingEnvVar = "OTEL_GO_AUTO_KERNEL_SAMPLING"
+)
+
+// sampling is the sampling of the spans selected by the environment.
+type sampling struct {
+	// sampler is the sampler of the tracer provider.
+	sampler sdktrace.Sampler
+	// root is the sampler of the root spans.
+	root sdktrace.Sampler
+	// ratio is the ratio of the traces sampled by root.
+	ratio float64
+	// parentBased is set if the sampled flag of the remote parents decides
+	// for their traces.
+	parentBased bool
+	// kernel is set if the eBPF probes sample the traces.
+	kernel bool
+}
+
+// rootSampler returns the root sampler selected with arg, and the ratio of
+// the traces it samples.
+type rootSampler func(arg string) (sdktrace.Sampler, float64, error)
+
+// samplers are the root samplers selectable by OTEL_TRACES_SAMPLER, without
+// their parentbased_ prefix.
+var samplers = map[string]rootSampler{
+	"always_on":  func(string) (sdktrace.Sampler, float64, error) { return sdktrace.AlwaysSample(), 1, nil },
+	"always_off": func(string) (sdktrace.Sampler, float64, error) { return sdktrace.NeverSample(), 0, nil },
+	"traceidratio": func(arg string) (sdktrace.Sampler, float64, error) {
+		if arg == "" {
+			return sdktrace.TraceIDRatioBased(1), 1, nil
+		}
+		ratio, err := strconv.ParseFloat(arg, 64)
+		if err != nil || ratio < 0 || ratio > 1 {
+			return nil, 0, fmt.Errorf("invalid %s %q, must be a probability between 0 and 1", TracesSamplerArgEnvVar, arg)
+		}
+		return sdktrace.TraceIDRatioBased(ratio), ratio, nil
+	},
+}
+
+// newSampling returns the sampling selected by the OTEL_TRACES_SAMPLER and
+// OTEL_GO_AUTO_KERNEL_SAMPLING environment variables.
+func newSampling() (*sampling, error) {
+	name := "parentbased_always_on"
+	if v, exists := os.LookupEnv(TracesSamplerEnvVar); exists && v != "" {
+		name = v
+	}
+
+	rootName := strings.TrimPrefix(name, "parentbased_")
+	factory, ok := samplers[rootName]
+	if !ok {
+		names := sortedKeys(samplers)
+		for _, n := range sortedKeys(samplers) {
+			names = append(names, "parentbased_"+n)
+		}
+		return nil, fmt.Errorf("unsupported %s %q, supported samplers are: %s",
+			TracesSamplerEnvVar, name, strings.Join(names, ", "))
+	}
+
+	s := &sampling{}
+	var err error
+	s.root, s.ratio, err = factory(os.Getenv(TracesSamplerArgEnvVar))
+	if err != nil {
+		return nil, err
+	}
+	s.sampler = s.root
+	if rootName != name {
+		s.sampler = sdktrace.ParentBased(s.root)
+		s.parentBased = true
+	}
+
+	if v := os.Getenv(KernelSamplingEnvVar); v != "" {
+		s.kernel, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", KernelSamplingEnvVar, v)
+		}
+	}
+
+	return s, nil
+}
+
+// sampled returns whether the trace traceID is sampled by the root sampler of
+// c. The trace flags of the parents read by the probes are not those the
+// parent was started with, so the spans of a trace follow the decision made
+// for its root span instead, whichever span is traced first.
+func (c *Controller) sampled(traceID trace.TraceID) bool {
+	res := c.sampling.root.ShouldSample(sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       traceID,
+	})
+	return res.Decision == sdktrace.RecordAndSample
+}
+
+// traceSampled returns whether the trace traceID of event is sampled: as its
+// remote parent was with a parent-based sampler, as its root span is
+// otherwise.
+func (c *Controller) traceSampled(event *events.Event, traceID trace.TraceID) bool {
+	if c.sampling.parentBased && event.TraceSampled != nil {
+		return *event.TraceSampled
+	}
+	return c.sampled(traceID)
+}
+
+// ParentBasedSampling returns whether the sampled flag received with the
+// remote parent of a trace decides for the trace.
+func (c *Controller) ParentBasedSampling() bool {
+	return c.sampling.parentBased
+}
+
+// KernelSamplingRatio returns the ratio of the traces sampled by the root
+// sampler, deciding the sampled flag injected by the eBPF probes, and whether
+// the probes are to drop the spans of the traces not sampled.
+func (c *Controller) KernelSamplingRatio() (float64, bool) {
+	return c.sampling.ratio, c.sampling.kernel
+}
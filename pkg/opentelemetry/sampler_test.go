@@ -0,0 +1,173 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/events" // nolint:staticcheck  // Atomic deprecation.
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewSampler(t *testing.T) {
+	tests := []struct {
+		sampler string
+		arg     string
+		want    string
+		ratio   float64
+	}{
+		{sampler: "", want: "ParentBased{root:AlwaysOnSampler", ratio: 1},
+		{sampler: "always_on", want: "AlwaysOnSampler", ratio: 1},
+		{sampler: "always_off", want: "AlwaysOffSampler"},
+		{sampler: "traceidratio", arg: "0.25", want: "TraceIDRatioBased{0.25}", ratio: 0.25},
+		{sampler: "traceidratio", want: "AlwaysOnSampler", ratio: 1},
+		{sampler: "parentbased_always_off", want: "ParentBased{root:AlwaysOffSampler"},
+		{sampler: "parentbased_traceidratio", arg: "0.1", want: "ParentBased{root:TraceIDRatioBased{0.1}", ratio: 0.1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sampler, func(t *testing.T) {
+			t.Setenv(TracesSamplerEnvVar, tt.sampler)
+			t.Setenv(TracesSamplerArgEnvVar, tt.arg)
+
+			s, err := newSampling()
+			require.NoError(t, err)
+			assert.Contains(t, s.sampler.Description(), tt.want)
+			assert.Equal(t, tt.ratio, s.ratio)
+			assert.False(t, s.kernel)
+		})
+	}
+}
+
+func TestNewSamplerErrors(t *testing.T) {
+	t.Setenv(TracesSamplerEnvVar, "jaeger_remote")
+	_, err := newSampling()
+	assert.ErrorContains(t, err, `unsupported OTEL_TRACES_SAMPLER "jaeger_remote"`)
+
+	t.Setenv(TracesSamplerEnvVar, "parentbased_traceidratio")
+	t.Setenv(TracesSamplerArgEnvVar, "2")
+	_, err = newSampling()
+	assert.ErrorContains(t, err, `invalid OTEL_TRACES_SAMPLER_ARG "2"`)
+
+	t.Setenv(TracesSamplerArgEnvVar, "0.5")
+	t.Setenv(KernelSamplingEnvVar, "yes")
+	_, err = newSampling()
+	assert.ErrorContains(t, err, `invalid OTEL_GO_AUTO_KERNEL_SAMPLING "yes"`)
+}
+
+func TestKernelSamplingRatio(t *testing.T) {
+	t.Setenv(TracesExporterEnvVar, "none")
+	t.Setenv(TracesSamplerEnvVar, "parentbased_traceidratio")
+	t.Setenv(TracesSamplerArgEnvVar, "0.2")
+	t.Setenv(KernelSamplingEnvVar, "true")
+
+	c, err := NewController("frontend")
+	require.NoError(t, err)
+	ratio, ok := c.KernelSamplingRatio()
+	assert.True(t, ok)
+	assert.Equal(t, 0.2, ratio)
+}
+
+func TestSamplingIsConsistentPerTrace(t *testing.T) {
+	for _, sampler := range []string{"traceidratio", "parentbased_traceidratio"} {
+		t.Run(sampler, func(t *testing.T) {
+			t.Setenv(TracesExporterEnvVar, "none")
+			t.Setenv(TracesSamplerEnvVar, sampler)
+			t.Setenv(TracesSamplerArgEnvVar, "0.5")
+
+			c, err := NewController("frontend")
+			require.NoError(t, err)
+			exporter := tracetest.NewInMemoryExporter()
+			c.tracerProvider.RegisterSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))
+
+			rnd := rand.New(rand.NewSource(1))
+			const traces = 200
+			for i := 0; i < traces; i++ {
+				var tid trace.TraceID
+				binary.BigEndian.PutUint64(tid[:8], rnd.Uint64())
+				binary.BigEndian.PutUint64(tid[8:], rnd.Uint64())
+				root := trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID:    tid,
+					SpanID:     trace.SpanID{1},
+					TraceFlags: trace.FlagsSampled,
+				})
+				child := trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID:    tid,
+					SpanID:     trace.SpanID{2},
+					TraceFlags: trace.FlagsSampled,
+				})
+
+				// the child is traced first, as its span ends first
+				c.Trace(&events.Event{Library: "database/sql", Name: "DB", SpanContext: &child, ParentSpanContext: &root})
+				c.Trace(&events.Event{Library: "net/http", Name: "GET", SpanContext: &root})
+			}
+
+			perTrace := make(map[trace.TraceID]int)
+			for _, s := range exporter.GetSpans() {
+				perTrace[s.SpanContext.TraceID()]++
+			}
+			require.NoError(t, c.Shutdown(context.Background()))
+			for tid, n := range perTrace {
+				assert.Equal(t, 2, n, "trace %s is partially sampled", tid)
+			}
+			assert.Greater(t, len(perTrace), traces/4)
+			assert.Less(t, len(perTrace), traces*3/4)
+		})
+	}
+}
+
+func TestRemoteSampledFlag(t *testing.T) {
+	for _, sampler := range []string{"traceidratio", "parentbased_traceidratio"} {
+		t.Run(sampler, func(t *testing.T) {
+			t.Setenv(TracesExporterEnvVar, "none")
+			t.Setenv(TracesSamplerEnvVar, sampler)
+			t.Setenv(TracesSamplerArgEnvVar, "0")
+
+			c, err := NewController("frontend")
+			require.NoError(t, err)
+			assert.Equal(t, sampler == "parentbased_traceidratio", c.ParentBasedSampling())
+			exporter := tracetest.NewInMemoryExporter()
+			c.tracerProvider.RegisterSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))
+
+			sampled, notSampled := true, false
+			for i, flag := range []*bool{&sampled, &notSampled, nil} {
+				remote := trace.NewSpanContext(trace.SpanContextConfig{
+					TraceID: trace.TraceID{byte(i + 1)},
+					SpanID:  trace.SpanID{1},
+					Remote:  true,
+				})
+				sc := remote.WithSpanID(trace.SpanID{2})
+				c.Trace(&events.Event{Library: "net/http", Name: "GET", SpanContext: &sc, ParentSpanContext: &remote, TraceSampled: flag})
+			}
+
+			spans := exporter.GetSpans()
+			require.NoError(t, c.Shutdown(context.Background()))
+			if sampler == "traceidratio" {
+				assert.Empty(t, spans, "the root sampler decides")
+				return
+			}
+			require.Len(t, spans, 1, "the remote parent decides")
+			assert.Equal(t, trace.TraceID{1}, spans[0].SpanContext.TraceID())
+		})
+	}
+}
@@ -0,0 +1,343 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/events" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/auto/pkg/metrics"              // nolint:staticcheck  // Atomic deprecation.
+)
+
+const (
+	// TailSamplingWindowEnvVar is the environment variable key whose value
+	// is the decision window of the tail sampler. When set, the spans of a
+	// trace are buffered for that long after its first span is read, and
+	// the trace is then exported only if one of the tail sampling policies
+	// keeps it.
+	TailSamplingWindowEnvVar = "OTEL_GO_AUTO_TAIL_SAMPLING_WINDOW"
+	// TailSamplingLatencyEnvVar is the environment variable key whose value
+	// is the duration above which a trace is kept.
+	TailSamplingLatencyEnvVar = "OTEL_GO_AUTO_TAIL_SAMPLING_LATENCY"
+	// TailSamplingErrorsEnvVar is the environment variable key whose value
+	// keeps, when true, the traces with a span whose status is Error. The
+	// spans of the gRPC servers carry no status and are never kept by it.
+	TailSamplingErrorsEnvVar = "OTEL_GO_AUTO_TAIL_SAMPLING_ERRORS"
+	// TailSamplingLibrariesEnvVar is the environment variable key whose value
+	// is the comma-separated list of the libraries, e.g. database/sql, whose
+	// traces are kept.
+	TailSamplingLibrariesEnvVar = "OTEL_GO_AUTO_TAIL_SAMPLING_LIBRARIES"
+	// TailSamplingPercentageEnvVar is the environment variable key whose value
+	// is the percentage of the traces kept regardless of their spans.
+	TailSamplingPercentageEnvVar = "OTEL_GO_AUTO_TAIL_SAMPLING_PERCENTAGE"
+	// TailSamplingMaxTracesEnvVar is the environment variable key whose value
+	// is the number of traces buffered above which the oldest trace is
+	// decided before the end of its window.
+	TailSamplingMaxTracesEnvVar = "OTEL_GO_AUTO_TAIL_SAMPLING_MAX_TRACES"
+
+	defaultTailSamplingMaxTraces = 10000
+)
+
+// tailPolicy keeps the traces for which keep returns true.
+type tailPolicy struct {
+	name string
+	keep func(t *tailTrace) bool
+}
+
+// tailTrace is a trace buffered by the tail sampler.
+type tailTrace struct {
+	id       trace.TraceID
+	events   []*events.Event
+	deadline time.Time
+}
+
+// duration returns the time from the start of the first span of t to the end
+// of the last one.
+func (t *tailTrace) duration() time.Duration {
+	start, end := t.events[0].StartTime, t.events[0].EndTime
+	for _, e := range t.events[1:] {
+		if e.StartTime < start {
+			start = e.StartTime
+		}
+		if e.EndTime > end {
+			end = e.EndTime
+		}
+	}
+	return time.Duration(end - start)
+}
+
+// tailDecision is the expiry of the decision made for a trace.
+type tailDecision struct {
+	id      trace.TraceID
+	expires time.Time
+}
+
+// tailSampler buffers the events of every trace for its decision window and
+// then exports them if one of its policies keeps the trace.
+type tailSampler struct {
+	window    time.Duration
+	maxTraces int
+	policies  []tailPolicy
+	// export is only called with mu held, so that it is never called
+	// concurrently.
+	export func(*events.Event)
+
+	mu sync.Mutex
+	// traces are the undecided traces, and pending the same traces in the
+	// order their windows end.
+	traces  map[trace.TraceID]*tailTrace
+	pending []*tailTrace
+	// decided are the decisions made within the last window, and
+	// decisions the same decisions in the order they expire, so that the
+	// spans read late follow the decision made for their trace.
+	decided   map[trace.TraceID]bool
+	decisions []tailDecision
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newTailSampler returns the tail sampler selected by the environment
+// variables, or nil if OTEL_GO_AUTO_TAIL_SAMPLING_WINDOW is not set. Its
+// export function is to be set before it is started.
+func newTailSampler() (*tailSampler, error) {
+	v := os.Getenv(TailSamplingWindowEnvVar)
+	if v == "" {
+		return nil, nil
+	}
+	window, err := time.ParseDuration(v)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid %s %q", TailSamplingWindowEnvVar, v)
+	}
+
+	s := &tailSampler{
+		window:    window,
+		maxTraces: defaultTailSamplingMaxTraces,
+		traces:    make(map[trace.TraceID]*tailTrace),
+		decided:   make(map[trace.TraceID]bool),
+	}
+
+	if v := os.Getenv(TailSamplingMaxTracesEnvVar); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid %s %q", TailSamplingMaxTracesEnvVar, v)
+		}
+		s.maxTraces = n
+	}
+
+	if v := os.Getenv(TailSamplingLatencyEnvVar); v != "" {
+		latency, err := time.ParseDuration(v)
+		if err != nil || latency < 0 {
+			return nil, fmt.Errorf("invalid %s %q", TailSamplingLatencyEnvVar, v)
+		}
+		s.policies = append(s.policies, tailPolicy{
+			name: "latency",
+			keep: func(t *tailTrace) bool { return t.duration() >= latency },
+		})
+	}
+
+	if v := os.Getenv(TailSamplingErrorsEnvVar); v != "" {
+		keepErrors, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", TailSamplingErrorsEnvVar, v)
+		}
+		if keepErrors {
+			s.policies = append(s.policies, tailPolicy{
+				name: "error",
+				keep: func(t *tailTrace) bool {
+					for _, e := range t.events {
+						if e.Status == codes.Error {
+							return true
+						}
+					}
+					return false
+				},
+			})
+		}
+	}
+
+	if v := os.Getenv(TailSamplingLibrariesEnvVar); v != "" {
+		libraries := make(map[string]struct{})
+		for _, lib := range strings.Split(v, ",") {
+			if lib = strings.TrimSpace(lib); lib != "" {
+				libraries[lib] = struct{}{}
+			}
+		}
+		s.policies = append(s.policies, tailPolicy{
+			name: "library",
+			keep: func(t *tailTrace) bool {
+				for _, e := range t.events {
+					if _, ok := libraries[e.Library]; ok {
+						return true
+					}
+				}
+				return false
+			},
+		})
+	}
+
+	if v := os.Getenv(TailSamplingPercentageEnvVar); v != "" {
+		percentage, err := strconv.ParseFloat(v, 64)
+		if err != nil || percentage < 0 || percentage > 100 {
+			return nil, fmt.Errorf("invalid %s %q, must be between 0 and 100", TailSamplingPercentageEnvVar, v)
+		}
+		// the trace ID decides, as for the traceidratio sampler, so that the
+		// agents of the services of a trace keep the same traces
+		ratio := sdktrace.TraceIDRatioBased(percentage / 100)
+		s.policies = append(s.policies, tailPolicy{
+			name: "percentage",
+			keep: func(t *tailTrace) bool {
+				res := ratio.ShouldSample(sdktrace.SamplingParameters{
+					ParentContext: context.Background(),
+					TraceID:       t.id,
+				})
+				return res.Decision == sdktrace.RecordAndSample
+			},
+		})
+	}
+
+	if len(s.policies) == 0 {
+		return nil, errors.New("tail sampling requires at least one policy")
+	}
+
+	return s, nil
+}
+
+// Start starts deciding the traces whose window ended.
+func (s *tailSampler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run()
+}
+
+func (s *tailSampler) run() {
+	defer close(s.done)
+
+	tick := s.window / 10
+	if tick < 10*time.Millisecond {
+		tick = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.flush(now)
+		}
+	}
+}
+
+// Stop stops s and decides the traces still buffered.
+func (s *tailSampler) Stop() {
+	close(s.stop)
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.pending) > 0 {
+		s.decideOldest(time.Now())
+	}
+}
+
+// Add buffers e until the trace it belongs to is decided, or exports it if
+// the trace was kept.
+func (s *tailSampler) Add(e *events.Event) {
+	id := e.SpanContext.TraceID()
+	if e.ParentSpanContext != nil {
+		id = e.ParentSpanContext.TraceID()
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if keep, decided := s.decided[id]; decided {
+		if keep {
+			s.export(e)
+		}
+		return
+	}
+
+	t, exists := s.traces[id]
+	if !exists {
+		if len(s.pending) >= s.maxTraces {
+			s.decideOldest(now)
+		}
+		t = &tailTrace{id: id, deadline: now.Add(s.window)}
+		s.traces[id] = t
+		s.pending = append(s.pending, t)
+		metrics.TailSamplingTraces.Set(float64(len(s.pending)))
+	}
+	t.events = append(t.events, e)
+}
+
+// flush decides the traces whose window ended at now, and forgets the
+// decisions which expired.
+func (s *tailSampler) flush(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.pending) > 0 && !s.pending[0].deadline.After(now) {
+		s.decideOldest(now)
+	}
+
+	n := 0
+	for n < len(s.decisions) && !s.decisions[n].expires.After(now) {
+		delete(s.decided, s.decisions[n].id)
+		n++
+	}
+	s.decisions = s.decisions[n:]
+}
+
+// decideOldest decides the trace buffered first, exporting its events if a
+// policy keeps it.
+func (s *tailSampler) decideOldest(now time.Time) {
+	t := s.pending[0]
+	s.pending = s.pending[1:]
+	delete(s.traces, t.id)
+	metrics.TailSamplingTraces.Set(float64(len(s.pending)))
+
+	policy := "none"
+	for _, p := range s.policies {
+		if p.keep(t) {
+			policy = p.name
+			break
+		}
+	}
+	metrics.TailSamplingDecisions.WithLabelValues(policy).Inc()
+
+	keep := policy != "none"
+	s.decided[t.id] = keep
+	s.decisions = append(s.decisions, tailDecision{id: t.id, expires: now.Add(s.window)})
+	if keep {
+		for _, e := range t.events {
+			s.export(e)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentelemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/auto/pkg/instrumentors/events" // nolint:staticcheck  // Atomic deprecation.
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func tailEvent(tid byte, sid byte, library string, duration time.Duration) *events.Event {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{tid},
+		SpanID:     trace.SpanID{sid},
+		TraceFlags: trace.FlagsSampled,
+	})
+	return &events.Event{
+		Library:     library,
+		Name:        library,
+		StartTime:   1000,
+		EndTime:     1000 + int64(duration),
+		SpanContext: &sc,
+	}
+}
+
+func newTestTailSampler(t *testing.T, exported *[]*events.Event) *tailSampler {
+	s, err := newTailSampler()
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	s.export = func(e *events.Event) { *exported = append(*exported, e) }
+	return s
+}
+
+func TestNewTailSamplerErrors(t *testing.T) {
+	s, err := newTailSampler()
+	require.NoError(t, err)
+	assert.Nil(t, s, "tail sampling is disabled by default")
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "invalid window",
+			env:  map[string]string{TailSamplingWindowEnvVar: "10"},
+			want: `invalid OTEL_GO_AUTO_TAIL_SAMPLING_WINDOW "10"`,
+		},
+		{
+			name: "no policy",
+			env:  map[string]string{TailSamplingWindowEnvVar: "10s", TailSamplingErrorsEnvVar: "false"},
+			want: "tail sampling requires at least one policy",
+		},
+		{
+			name: "invalid latency",
+			env:  map[string]string{TailSamplingWindowEnvVar: "10s", TailSamplingLatencyEnvVar: "-1s"},
+			want: `invalid OTEL_GO_AUTO_TAIL_SAMPLING_LATENCY "-1s"`,
+		},
+		{
+			name: "invalid percentage",
+			env:  map[string]string{TailSamplingWindowEnvVar: "10s", TailSamplingPercentageEnvVar: "150"},
+			want: `invalid OTEL_GO_AUTO_TAIL_SAMPLING_PERCENTAGE "150"`,
+		},
+		{
+			name: "invalid max traces",
+			env:  map[string]string{TailSamplingWindowEnvVar: "10s", TailSamplingErrorsEnvVar: "true", TailSamplingMaxTracesEnvVar: "0"},
+			want: `invalid OTEL_GO_AUTO_TAIL_SAMPLING_MAX_TRACES "0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := newTailSampler()
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestTailSamplerPolicies(t *testing.T) {
+	t.Setenv(TailSamplingWindowEnvVar, "10s")
+	t.Setenv(TailSamplingLatencyEnvVar, "100ms")
+	t.Setenv(TailSamplingErrorsEnvVar, "true")
+	t.Setenv(TailSamplingLibrariesEnvVar, "database/sql")
+
+	var exported []*events.Event
+	s := newTestTailSampler(t, &exported)
+
+	slow := tailEvent(1, 1, "net/http", time.Second)
+	failed := tailEvent(2, 1, "net/http", time.Millisecond)
+	failed.Status = codes.Error
+	fast := tailEvent(3, 1, "net/http", time.Millisecond)
+	sqlRoot := tailEvent(4, 1, "net/http", time.Millisecond)
+	sqlChild := tailEvent(4, 2, "database/sql", time.Millisecond)
+	sqlChild.ParentSpanContext = sqlRoot.SpanContext
+
+	for _, e := range []*events.Event{slow, failed, fast, sqlChild, sqlRoot} {
+		s.Add(e)
+	}
+	s.flush(time.Now())
+	assert.Empty(t, exported, "traces are decided at the end of their window")
+
+	s.flush(time.Now().Add(10 * time.Second))
+	assert.Equal(t, []*events.Event{slow, failed, sqlChild, sqlRoot}, exported)
+	assert.Empty(t, s.pending)
+
+	// the spans read after the decision follow it
+	exported = nil
+	lateKept := tailEvent(1, 2, "net/http", time.Millisecond)
+	lateKept.ParentSpanContext = slow.SpanContext
+	s.Add(lateKept)
+	s.Add(tailEvent(3, 2, "net/http", time.Millisecond))
+	assert.Equal(t, []*events.Event{lateKept}, exported)
+	assert.Empty(t, s.pending)
+
+	// until the decision expires
+	s.flush(time.Now().Add(30 * time.Second))
+	assert.Empty(t, s.decided)
+	s.Add(tailEvent(3, 3, "net/http", time.Millisecond))
+	assert.Len(t, s.pending, 1)
+}
+
+func TestTailSamplerPercentage(t *testing.T) {
+	t.Setenv(TailSamplingWindowEnvVar, "10s")
+	t.Setenv(TailSamplingPercentageEnvVar, "50")
+
+	var exported []*events.Event
+	s := newTestTailSampler(t, &exported)
+
+	ratio := sdktrace.TraceIDRatioBased(0.5)
+	var want []*events.Event
+	for i := 0; i < 200; i++ {
+		e := tailEvent(0, 1, "net/http", time.Millisecond)
+		sc := e.SpanContext.WithTraceID(trace.TraceID{0: 1, 8: byte(i), 15: byte(i * 7)})
+		e.SpanContext = &sc
+		s.Add(e)
+
+		res := ratio.ShouldSample(sdktrace.SamplingParameters{
+			ParentContext: context.Background(),
+			TraceID:       e.SpanContext.TraceID(),
+		})
+		if res.Decision == sdktrace.RecordAndSample {
+			want = append(want, e)
+		}
+	}
+	s.flush(time.Now().Add(10 * time.Second))
+
+	assert.Equal(t, want, exported)
+	assert.Greater(t, len(exported), 50)
+	assert.Less(t, len(exported), 150)
+}
+
+func TestTailSamplerMaxTraces(t *testing.T) {
+	t.Setenv(TailSamplingWindowEnvVar, "10s")
+	t.Setenv(TailSamplingLibrariesEnvVar, "net/http")
+	t.Setenv(TailSamplingMaxTracesEnvVar, "2")
+
+	var exported []*events.Event
+	s := newTestTailSampler(t, &exported)
+
+	first := tailEvent(1, 1, "net/http", time.Millisecond)
+	s.Add(first)
+	s.Add(tailEvent(2, 1, "net/http", time.Millisecond))
+	assert.Empty(t, exported)
+
+	// the oldest trace is decided early to make room for the new one
+	s.Add(tailEvent(3, 1, "net/http", time.Millisecond))
+	assert.Equal(t, []*events.Event{first}, exported)
+	assert.Len(t, s.pending, 2)
+}
+
+func TestControllerTailSampling(t *testing.T) {
+	t.Setenv(TracesExporterEnvVar, "none")
+	t.Setenv(TailSamplingWindowEnvVar, "1h")
+	t.Setenv(TailSamplingErrorsEnvVar, "true")
+
+	c, err := NewController("frontend")
+	require.NoError(t, err)
+	exporter := tracetest.NewInMemoryExporter()
+	c.tracerProvider.RegisterSpanProcessor(sdktrace.NewSimpleSpanProcessor(exporter))
+
+	failed := tailEvent(1, 1, "net/http", time.Millisecond)
+	failed.Status = codes.Error
+	failed.StatusDescription = "internal error"
+	c.Trace(failed)
+	c.Trace(tailEvent(2, 1, "net/http", time.Millisecond))
+	assert.Empty(t, exporter.GetSpans(), "spans are buffered for the decision window")
+
+	c.tail.flush(time.Now().Add(time.Hour))
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, trace.TraceID{1}, spans[0].SpanContext.TraceID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "internal error", spans[0].Status.Description)
+
+	require.NoError(t, c.Shutdown(context.Background()))
+}
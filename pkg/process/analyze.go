@@ -39,6 +39,10 @@ type TargetDetails struct {
 	GoVersion         *version.Version
 	Libraries         map[string]string
 	AllocationDetails *AllocationDetails
+
+	// StartTime is the time the process started at, in clock ticks since
+	// boot, telling it from a later process reusing its PID.
+	StartTime uint64
 }
 
 // AllocationDetails are the details about allocated memory.
@@ -107,29 +111,32 @@ func (a *Analyzer) remoteMmap(pid int, mapSize uint64) (uint64, error) {
 	return addr, nil
 }
 
-// Analyze returns the target details for an actively running process.
-func (a *Analyzer) Analyze(pid int, relevantFuncs map[string]interface{}) (*TargetDetails, error) {
-	result := &TargetDetails{
-		PID: pid,
-	}
+// ObserveOnly keeps a from writing into the memory of the processes it
+// analyzes, if enabled. No memory is then allocated in them for the trace
+// context injected by the probes.
+func (a *Analyzer) ObserveOnly(enabled bool) {
+	a.observeOnly = enabled
+}
 
-	f, err := os.Open(fmt.Sprintf("/proc/%d/exe", pid))
+// Analyze returns the target details for an actively running process. Unless
+// a is in observe-only mode, memory is allocated in the process.
+func (a *Analyzer) Analyze(pid int, relevantFuncs map[string]interface{}) (*TargetDetails, error) {
+	result, err := AnalyzeFile(fmt.Sprintf("/proc/%d/exe", pid), relevantFuncs)
 	if err != nil {
 		return nil, err
 	}
-
-	defer f.Close()
-	elfF, err := elf.NewFile(f)
-	if err != nil {
+	if len(result.Functions) == 0 {
+		return nil, errors.New("could not find function offsets for instrumenter")
+	}
+	result.PID = pid
+	if _, result.StartTime, err = procStat(pid); err != nil {
 		return nil, err
 	}
 
-	goVersion, modules, err := a.getModuleDetails(elfF)
-	if err != nil {
-		return nil, err
+	if a.observeOnly {
+		log.Logger.V(0).Info("observe-only mode, no memory is allocated in the target", "pid", pid)
+		return result, nil
 	}
-	result.GoVersion = goVersion
-	result.Libraries = modules
 
 	addr, err := a.remoteMmap(pid, mapSize)
 	if err != nil {
@@ -144,9 +151,34 @@ func (a *Analyzer) Analyze(pid int, relevantFuncs map[string]interface{}) (*Targ
 		EndAddr:   addr + mapSize,
 	}
 
+	return result, nil
+}
+
+// AnalyzeFile returns the target details of the Go executable at path,
+// reading its ELF symbols and build info only. The executable is not run, so
+// neither the PID nor the AllocationDetails of the result are set, and
+// relevant functions which are not found are left out of it.
+func AnalyzeFile(path string, relevantFuncs map[string]interface{}) (*TargetDetails, error) {
+	result := &TargetDetails{}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+	elfF, err := elf.NewFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	goVersion, modules, err := getModuleDetails(elfF)
 	if err != nil {
 		return nil, err
 	}
+	result.GoVersion = goVersion
+	result.Libraries = modules
+
 	symbols, err := elfF.Symbols()
 	if err != nil {
 		return nil, err
@@ -178,9 +210,6 @@ func (a *Analyzer) Analyze(pid int, relevantFuncs map[string]interface{}) (*Targ
 			result.Functions = append(result.Functions, function)
 		}
 	}
-	if len(result.Functions) == 0 {
-		return nil, errors.New("could not find function offsets for instrumenter")
-	}
 
 	return result, nil
 }
@@ -195,7 +224,7 @@ func getFuncOffset(f *elf.File, symbol elf.Symbol) (uint64, error) {
 	}
 
 	if len(sections) == 0 {
-		return 0, fmt.Errorf("function %q not found in file", symbol)
+		return 0, fmt.Errorf("function %q not found in file", symbol.Name)
 	}
 
 	var execSection *elf.Section
@@ -16,30 +16,131 @@ package process
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 // ExePathEnvVar is the environment variable key whose value points to the
 // instrumented executable.
 const ExePathEnvVar = "OTEL_GO_AUTO_TARGET_EXE"
 
-// TargetArgs are the binary target information.
+// PIDEnvVar is the environment variable key whose value is the PID of the
+// instrumented process.
+const PIDEnvVar = "OTEL_GO_AUTO_TARGET_PID"
+
+// CmdlineEnvVar is the environment variable key whose value is a regular
+// expression matched against the command line of the instrumented process.
+const CmdlineEnvVar = "OTEL_GO_AUTO_TARGET_CMDLINE"
+
+// ContainerIDEnvVar is the environment variable key whose value is the ID, or
+// an unambiguous prefix of it, of the container running the instrumented
+// process.
+const ContainerIDEnvVar = "OTEL_GO_AUTO_TARGET_CONTAINER_ID"
+
+// CgroupEnvVar is the environment variable key whose value is the cgroup path,
+// as listed in /proc/<pid>/cgroup, of the instrumented process.
+const CgroupEnvVar = "OTEL_GO_AUTO_TARGET_CGROUP"
+
+// PodUIDEnvVar is the environment variable key whose value is the UID of the
+// Kubernetes pod running the instrumented process.
+const PodUIDEnvVar = "OTEL_GO_AUTO_TARGET_POD_UID"
+
+// TargetsEnvVar is the environment variable key whose value lists several
+// instrumented processes as comma separated service_name=selector pairs, e.g.
+// "frontend=/usr/bin/frontend,cart=pod:0f1c2d3e-...". A selector is either an
+// executable path or one of the pid:, cmdline:, container:, cgroup: and pod:
+// prefixed values, with the same meaning as the single target environment
+// variables. Regular expressions of cmdline: selectors cannot contain commas.
+const TargetsEnvVar = "OTEL_GO_AUTO_TARGETS"
+
+// TargetArgs are the binary target information. Every selector set has to
+// match for a process to be the target.
 type TargetArgs struct {
 	ExePath string
+
+	// PID is the process ID of the target.
+	PID int
+
+	// CmdlinePattern is a regular expression matched against the command
+	// line of the target, its arguments being separated by spaces.
+	CmdlinePattern string
+
+	// ContainerID is the ID, or a prefix of it, of the container running the
+	// target.
+	ContainerID string
+
+	// CgroupPath is a cgroup path of the target. Processes of nested cgroups
+	// match too.
+	CgroupPath string
+
+	// PodUID is the UID of the Kubernetes pod running the target.
+	PodUID string
+
+	// ServiceName is the service.name of the spans produced for the target.
+	// If empty, the service name is read from the OTEL_SERVICE_NAME
+	// environment variable.
+	ServiceName string
+
+	cmdlineRegexp *regexp.Regexp
 }
 
 // Validate validates t and returns an error if not valid.
 func (t *TargetArgs) Validate() error {
-	if t.ExePath == "" {
-		return errors.New("target binary path not specified, please specify " + ExePathEnvVar + " env variable")
+	if t.ExePath == "" && t.PID == 0 && t.CmdlinePattern == "" &&
+		t.ContainerID == "" && t.CgroupPath == "" && t.PodUID == "" {
+		return errors.New("target process not specified, please specify " + ExePathEnvVar + ", " +
+			PIDEnvVar + ", " + CmdlineEnvVar + ", " + ContainerIDEnvVar + ", " + CgroupEnvVar +
+			" or " + PodUIDEnvVar + " env variable")
+	}
+
+	if t.PID < 0 {
+		return fmt.Errorf("invalid target pid %d", t.PID)
+	}
+
+	if t.CmdlinePattern != "" {
+		re, err := regexp.Compile(t.CmdlinePattern)
+		if err != nil {
+			return fmt.Errorf("invalid target command line pattern %q: %w", t.CmdlinePattern, err)
+		}
+		t.cmdlineRegexp = re
 	}
 
 	return nil
 }
 
+// String returns a description of the selectors of t.
+func (t *TargetArgs) String() string {
+	var selectors []string
+	if t.ExePath != "" {
+		selectors = append(selectors, "exe="+t.ExePath)
+	}
+	if t.PID != 0 {
+		selectors = append(selectors, "pid="+strconv.Itoa(t.PID))
+	}
+	if t.CmdlinePattern != "" {
+		selectors = append(selectors, "cmdline="+t.CmdlinePattern)
+	}
+	if t.ContainerID != "" {
+		selectors = append(selectors, "container="+t.ContainerID)
+	}
+	if t.CgroupPath != "" {
+		selectors = append(selectors, "cgroup="+t.CgroupPath)
+	}
+	if t.PodUID != "" {
+		selectors = append(selectors, "pod="+t.PodUID)
+	}
+
+	return strings.Join(selectors, ",")
+}
+
 // ParseTargetArgs returns TargetArgs for the target pointed to by the
-// environment variable OTEL_GO_AUTO_TARGET_EXE.
-func ParseTargetArgs() *TargetArgs {
+// environment variables OTEL_GO_AUTO_TARGET_EXE, OTEL_GO_AUTO_TARGET_PID,
+// OTEL_GO_AUTO_TARGET_CMDLINE, OTEL_GO_AUTO_TARGET_CONTAINER_ID,
+// OTEL_GO_AUTO_TARGET_CGROUP and OTEL_GO_AUTO_TARGET_POD_UID.
+func ParseTargetArgs() (*TargetArgs, error) {
 	result := &TargetArgs{}
 
 	val, exists := os.LookupEnv(ExePathEnvVar)
@@ -47,5 +148,117 @@ func ParseTargetArgs() *TargetArgs {
 		result.ExePath = val
 	}
 
-	return result
+	val, exists = os.LookupEnv(PIDEnvVar)
+	if exists {
+		pid, err := strconv.Atoi(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s value %q: %w", PIDEnvVar, val, err)
+		}
+		result.PID = pid
+	}
+
+	result.CmdlinePattern = os.Getenv(CmdlineEnvVar)
+	result.ContainerID = os.Getenv(ContainerIDEnvVar)
+	result.CgroupPath = os.Getenv(CgroupEnvVar)
+	result.PodUID = os.Getenv(PodUIDEnvVar)
+
+	return result, nil
+}
+
+// TargetEnvSet reports whether any of the environment variables selecting
+// targets is set.
+func TargetEnvSet() bool {
+	for _, key := range []string{TargetsEnvVar, ExePathEnvVar, PIDEnvVar, CmdlineEnvVar,
+		ContainerIDEnvVar, CgroupEnvVar, PodUIDEnvVar} {
+		if _, exists := os.LookupEnv(key); exists {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTargetsArgs returns the TargetArgs of every target listed in the
+// environment variable OTEL_GO_AUTO_TARGETS. If it is not set, the single
+// target returned by ParseTargetArgs is used.
+func ParseTargetsArgs() ([]*TargetArgs, error) {
+	val, exists := os.LookupEnv(TargetsEnvVar)
+	if !exists {
+		target, err := ParseTargetArgs()
+		if err != nil {
+			return nil, err
+		}
+		return []*TargetArgs{target}, nil
+	}
+
+	var result []*TargetArgs
+	for _, entry := range strings.Split(val, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		serviceName, selector, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid %s entry %q, expected service_name=selector", TargetsEnvVar, entry)
+		}
+
+		target, err := parseTargetSelector(strings.TrimSpace(selector))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s entry %q: %w", TargetsEnvVar, entry, err)
+		}
+		target.ServiceName = strings.TrimSpace(serviceName)
+
+		result = append(result, target)
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New(TargetsEnvVar + " env variable does not list any target")
+	}
+
+	return result, nil
+}
+
+func parseTargetSelector(selector string) (*TargetArgs, error) {
+	kind, value, found := strings.Cut(selector, ":")
+	if !found {
+		return &TargetArgs{ExePath: selector}, nil
+	}
+
+	switch kind {
+	case "pid":
+		pid, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q: %w", value, err)
+		}
+		return &TargetArgs{PID: pid}, nil
+	case "cmdline":
+		return &TargetArgs{CmdlinePattern: value}, nil
+	case "container":
+		return &TargetArgs{ContainerID: value}, nil
+	case "cgroup":
+		return &TargetArgs{CgroupPath: value}, nil
+	case "pod":
+		return &TargetArgs{PodUID: value}, nil
+	default:
+		return &TargetArgs{ExePath: selector}, nil
+	}
+}
+
+// ValidateTargets validates every target of targets and returns an error if
+// any of them is not valid or if two of them use the same selectors.
+func ValidateTargets(targets []*TargetArgs) error {
+	seen := make(map[string]struct{}, len(targets))
+	for _, t := range targets {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+
+		if _, exists := seen[t.String()]; exists {
+			return fmt.Errorf("target %s specified more than once", t)
+		}
+		seen[t.String()] = struct{}{}
+	}
+
+	return nil
 }
@@ -0,0 +1,99 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// readCgroupPaths returns the cgroup paths of the process with the given pid,
+// one per hierarchy listed in /proc/<pid>/cgroup.
+func readCgroupPaths(pid int) ([]string, error) {
+	content, err := ioutil.ReadFile(path.Join("/proc", strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCgroupPaths(string(content)), nil
+}
+
+// parseCgroupPaths parses the content of a /proc/<pid>/cgroup file, where
+// every line has the hierarchy-ID:controller-list:cgroup-path format.
+func parseCgroupPaths(content string) []string {
+	var paths []string
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 || fields[2] == "" {
+			continue
+		}
+		paths = append(paths, fields[2])
+	}
+
+	return paths
+}
+
+// matchCgroupPath reports whether one of paths is cgroupPath or a cgroup
+// nested in it.
+func matchCgroupPath(paths []string, cgroupPath string) bool {
+	cgroupPath = strings.TrimSuffix(cgroupPath, "/")
+	for _, p := range paths {
+		if p == cgroupPath || strings.HasPrefix(p, cgroupPath+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchContainerID reports whether one of paths belongs to the container with
+// the given ID. Container runtimes name the cgroup of a container after its
+// ID, e.g. /docker/<id>, /system.slice/docker-<id>.scope or
+// /kubepods/besteffort/pod<uid>/<id>, so the ID has to start a path element
+// or follow the runtime prefix of one.
+func matchContainerID(paths []string, containerID string) bool {
+	for _, p := range paths {
+		for _, elem := range strings.Split(p, "/") {
+			if idx := strings.LastIndex(elem, "-"); idx >= 0 {
+				elem = elem[idx+1:]
+			}
+			if strings.HasPrefix(elem, containerID) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchPodUID reports whether one of paths belongs to the Kubernetes pod with
+// the given UID. The cgroupfs driver names the pod cgroup pod<uid>, while the
+// systemd driver names it kubepods-<qos>-pod<uid>.slice with the dashes of the
+// UID replaced by underscores.
+func matchPodUID(paths []string, podUID string) bool {
+	cgroupfsName := "pod" + podUID
+	systemdName := "pod" + strings.ReplaceAll(podUID, "-", "_") + ".slice"
+	for _, p := range paths {
+		for _, elem := range strings.Split(p, "/") {
+			if elem == cgroupfsName || strings.HasSuffix(elem, systemdName) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	containerID = "3f4b0c5e8a1d2f6b7c9e0a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d"
+	podUID      = "0f1c2d3e-4a5b-6c7d-8e9f-a0b1c2d3e4f5"
+)
+
+func TestParseCgroupPaths(t *testing.T) {
+	content := "12:memory:/docker/" + containerID + "\n" +
+		"1:name=systemd:/docker/" + containerID + "\n" +
+		"0::/\n"
+
+	assert.Equal(t, []string{
+		"/docker/" + containerID,
+		"/docker/" + containerID,
+		"/",
+	}, parseCgroupPaths(content))
+}
+
+func TestMatchContainerID(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		id   string
+		want bool
+	}{
+		{"docker cgroupfs", "/docker/" + containerID, containerID, true},
+		{"docker systemd", "/system.slice/docker-" + containerID + ".scope", containerID, true},
+		{"containerd", "/kubepods.slice/kubepods-besteffort.slice/cri-containerd-" + containerID + ".scope", containerID, true},
+		{"short id", "/kubepods/besteffort/pod" + podUID + "/" + containerID, containerID[:12], true},
+		{"other container", "/docker/" + containerID, "ab12cd34ef56", false},
+		{"host", "/user.slice/user-1000.slice/session-1.scope", containerID[:12], false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchContainerID([]string{tt.path}, tt.id))
+		})
+	}
+}
+
+func TestMatchPodUID(t *testing.T) {
+	systemdUID := "0f1c2d3e_4a5b_6c7d_8e9f_a0b1c2d3e4f5"
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{"cgroupfs", "/kubepods/burstable/pod" + podUID + "/" + containerID, true},
+		{"systemd", "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod" + systemdUID + ".slice/cri-containerd-" + containerID + ".scope", true},
+		{"other pod", "/kubepods/burstable/pod11111111-2222-3333-4444-555555555555/" + containerID, false},
+		{"host", "/system.slice/kubelet.service", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchPodUID([]string{tt.path}, podUID))
+		})
+	}
+}
+
+func TestMatchCgroupPath(t *testing.T) {
+	paths := []string{"/system.slice/payments.service/worker"}
+
+	assert.True(t, matchCgroupPath(paths, "/system.slice/payments.service"))
+	assert.True(t, matchCgroupPath(paths, "/system.slice/payments.service/"))
+	assert.True(t, matchCgroupPath(paths, "/system.slice/payments.service/worker"))
+	assert.False(t, matchCgroupPath(paths, "/system.slice/payments"))
+	assert.False(t, matchCgroupPath(paths, "/system.slice/orders.service"))
+}
@@ -15,10 +15,12 @@
 package process
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -28,55 +30,151 @@ import (
 )
 
 // Analyzer is used to find actively running processes.
+//
+// Processes are discovered as soon as they start a new program using the
+// netlink proc connector. As the connector misses the processes of other
+// network namespaces, as those of containers, all processes are polled every
+// 30 seconds too. If the connector is not available, or fails, all processes
+// are polled every 2 seconds instead.
 type Analyzer struct {
-	done          chan bool
-	pidTickerChan <-chan time.Time
+	done        chan bool
+	pidTicker   *time.Ticker
+	connector   *procConnector
+	observeOnly bool
 }
 
 // NewAnalyzer returns a new [ProcessAnalyzer].
 func NewAnalyzer() *Analyzer {
-	return &Analyzer{
-		done:          make(chan bool, 1),
-		pidTickerChan: time.NewTicker(2 * time.Second).C,
+	a := &Analyzer{
+		done: make(chan bool, 1),
 	}
+
+	connector, err := newProcConnector()
+	if err != nil {
+		log.Logger.V(0).Info("proc connector not available, polling processes instead", "error", err.Error())
+		a.pidTicker = time.NewTicker(pollInterval)
+	} else {
+		a.connector = connector
+		a.pidTicker = time.NewTicker(rescanInterval)
+	}
+
+	return a
 }
 
+const (
+	// pollInterval is how often all processes are examined without the proc
+	// connector.
+	pollInterval = 2 * time.Second
+	// rescanInterval is how often all processes are examined alongside the
+	// proc connector, for those it misses.
+	rescanInterval = 30 * time.Second
+)
+
 // DiscoverProcessID searches for the target as an actively running process,
-// returning its PID if found.
+// returning its PID if found. An error is returned if more than one process
+// matches the target.
 func (a *Analyzer) DiscoverProcessID(target *TargetArgs) (int, error) {
+	if a.connector == nil {
+		return a.pollProcessID(target)
+	}
+
+	// The target may already be running, or may have started while exec
+	// events were not read, hence all processes are examined first.
+	scan := true
 	for {
+		if scan {
+			pid, found, err := a.scanProcessID(target)
+			if found || err != nil {
+				return pid, err
+			}
+			scan = false
+		}
+
 		select {
 		case <-a.done:
 			log.Logger.V(0).Info("stopping process id discovery due to kill signal")
 			return 0, errors.ErrInterrupted
-		case <-a.pidTickerChan:
-			pid, err := a.findProcessID(target)
-			if err == nil {
-				log.Logger.V(0).Info("found process", "pid", pid)
-				return pid, nil
-			}
-			if err == errors.ErrProcessNotFound {
-				log.Logger.V(0).Info("process not found yet, trying again soon", "exe_path", target.ExePath)
-			} else {
-				log.Logger.Error(err, "error while searching for process", "exe_path", target.ExePath)
+		case pid := <-a.connector.execs:
+			// Every process is examined again to find out whether the new
+			// process is the only one matching the target.
+			scan = pid != os.Getpid() && target.matches(pid)
+		case <-a.connector.rescan:
+			scan = true
+		case <-a.pidTicker.C:
+			scan = true
+		case <-a.connector.failed:
+			log.Logger.V(0).Info("proc connector failed, polling processes instead")
+			a.closeConnector()
+			// the ticker is reset rather than replaced, Close stopping it
+			a.pidTicker.Reset(pollInterval)
+			return a.pollProcessID(target)
+		}
+	}
+}
+
+func (a *Analyzer) pollProcessID(target *TargetArgs) (int, error) {
+	for {
+		select {
+		case <-a.done:
+			log.Logger.V(0).Info("stopping process id discovery due to kill signal")
+			return 0, errors.ErrInterrupted
+		case <-a.pidTicker.C:
+			pid, found, err := a.scanProcessID(target)
+			if found || err != nil {
+				return pid, err
 			}
 		}
 	}
 }
 
-func (a *Analyzer) findProcessID(target *TargetArgs) (int, error) {
+// scanProcessID examines all processes and returns the PID of the target if
+// exactly one process matches it.
+func (a *Analyzer) scanProcessID(target *TargetArgs) (int, bool, error) {
+	pids, err := FindProcessIDs(target)
+	if err != nil {
+		log.Logger.Error(err, "error while searching for process", "target", target.String())
+		return 0, false, nil
+	}
+
+	switch len(pids) {
+	case 0:
+		log.Logger.V(0).Info("process not found yet, waiting for it to start", "target", target.String())
+		return 0, false, nil
+	case 1:
+		log.Logger.V(0).Info("found process", "pid", pids[0])
+		return pids[0], true, nil
+	default:
+		return 0, false, fmt.Errorf("%w: target %s matches pids %v, please narrow down its selectors",
+			errors.ErrMultipleProcessesFound, target, pids)
+	}
+}
+
+// FindProcessIDs returns the PIDs of the running processes matching target,
+// leaving out the current process. Unless target selects a PID, the processes
+// which do not run a Go executable, as the shell wrappers and sidecars of the
+// container or pod of the target, are left out too.
+func FindProcessIDs(target *TargetArgs) ([]int, error) {
+	if target.PID != 0 {
+		if target.PID == os.Getpid() || !IsRunning(target.PID) || !target.matches(target.PID) {
+			return nil, nil
+		}
+		return []int{target.PID}, nil
+	}
+
 	proc, err := os.Open("/proc")
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
+	defer proc.Close()
 
+	var pids []int
 	for {
 		dirs, err := proc.Readdir(15)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 
 		for _, di := range dirs {
@@ -91,30 +189,134 @@ func (a *Analyzer) findProcessID(target *TargetArgs) (int, error) {
 
 			pid, err := strconv.Atoi(dname)
 			if err != nil {
-				return 0, err
+				return nil, err
 			}
 
-			exeName, err := os.Readlink(path.Join("/proc", dname, "exe"))
+			if pid != os.Getpid() && target.matches(pid) && isGoExecutable(pid) {
+				pids = append(pids, pid)
+			}
+		}
+	}
+
+	return pids, nil
+}
+
+// matches reports whether the process with the given pid matches every
+// selector of t. Processes which exit while being examined do not match.
+func (t *TargetArgs) matches(pid int) bool {
+	if t.PID != 0 && t.PID != pid {
+		return false
+	}
+
+	var cmdLine string
+	if t.ExePath != "" || t.CmdlinePattern != "" {
+		raw, err := ioutil.ReadFile(path.Join("/proc", strconv.Itoa(pid), "cmdline"))
+		if err != nil {
+			return false
+		}
+		cmdLine = strings.TrimSpace(strings.ReplaceAll(string(raw), "\x00", " "))
+	}
+
+	if t.ExePath != "" {
+		exeName, err := os.Readlink(path.Join("/proc", strconv.Itoa(pid), "exe"))
+		if err != nil {
+			// Read link may fail if target process runs not as root
+			if !strings.Contains(cmdLine, t.ExePath) {
+				return false
+			}
+		} else if exeName != t.ExePath {
+			return false
+		}
+	}
+
+	if t.CmdlinePattern != "" {
+		if t.cmdlineRegexp == nil {
+			re, err := regexp.Compile(t.CmdlinePattern)
 			if err != nil {
-				// Read link may fail if target process runs not as root
-				cmdLine, err := ioutil.ReadFile(path.Join("/proc", dname, "cmdline"))
-				if err != nil {
-					return 0, err
-				}
-
-				if strings.Contains(string(cmdLine), target.ExePath) {
-					return pid, nil
-				}
-			} else if exeName == target.ExePath {
-				return pid, nil
+				return false
 			}
+			t.cmdlineRegexp = re
 		}
+		if !t.cmdlineRegexp.MatchString(cmdLine) {
+			return false
+		}
+	}
+
+	if t.ContainerID == "" && t.CgroupPath == "" && t.PodUID == "" {
+		return true
+	}
+
+	cgroupPaths, err := readCgroupPaths(pid)
+	if err != nil {
+		return false
+	}
+	if t.ContainerID != "" && !matchContainerID(cgroupPaths, t.ContainerID) {
+		return false
+	}
+	if t.CgroupPath != "" && !matchCgroupPath(cgroupPaths, t.CgroupPath) {
+		return false
+	}
+	if t.PodUID != "" && !matchPodUID(cgroupPaths, t.PodUID) {
+		return false
 	}
 
-	return 0, errors.ErrProcessNotFound
+	return true
+}
+
+// IsRunning reports whether the process with the given pid is still alive.
+// Zombie processes are considered to have exited, as they no longer run any
+// code that could be instrumented.
+func IsRunning(pid int) bool {
+	state, _, err := procStat(pid)
+	return err == nil && state != 'Z' && state != 'X'
+}
+
+// IsRunning reports whether the process t is the details of is still alive.
+// A process started since with the same, reused, pid is not.
+func (t *TargetDetails) IsRunning() bool {
+	state, startTime, err := procStat(t.PID)
+	return err == nil && state != 'Z' && state != 'X' && startTime == t.StartTime
+}
+
+// procStat returns the state of the process with the given pid and the time
+// it started at, in clock ticks since boot.
+func procStat(pid int) (byte, uint64, error) {
+	stat, err := ioutil.ReadFile(path.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The state follows the command name, which is wrapped in parentheses and
+	// may itself contain spaces or parentheses. The start time is the 22nd
+	// field, the 20th from the state.
+	idx := strings.LastIndex(string(stat), ")")
+	if idx < 0 {
+		return 0, 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+	fields := strings.Fields(string(stat[idx+1:]))
+	if len(fields) < 20 || len(fields[0]) != 1 {
+		return 0, 0, fmt.Errorf("invalid stat of process %d", pid)
+	}
+
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start time of process %d: %w", pid, err)
+	}
+	return fields[0][0], startTime, nil
 }
 
 // Close closes the analyzer.
 func (a *Analyzer) Close() {
 	a.done <- true
+	a.pidTicker.Stop()
+	a.closeConnector()
+}
+
+func (a *Analyzer) closeConnector() {
+	if a.connector != nil {
+		if err := a.connector.Close(); err != nil {
+			log.Logger.Error(err, "failed to close proc connector")
+		}
+		a.connector = nil
+	}
 }
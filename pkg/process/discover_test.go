@@ -0,0 +1,43 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetDetailsIsRunning(t *testing.T) {
+	state, startTime, err := procStat(os.Getpid())
+	require.NoError(t, err)
+	// The main thread may be sleeping while another thread reads its stat.
+	assert.Contains(t, []byte{'R', 'S'}, state)
+	assert.NotZero(t, startTime)
+
+	target := &TargetDetails{PID: os.Getpid(), StartTime: startTime}
+	assert.True(t, target.IsRunning())
+
+	// another process reusing the pid
+	target.StartTime++
+	assert.False(t, target.IsRunning())
+}
+
+func TestIsGoExecutable(t *testing.T) {
+	assert.True(t, isGoExecutable(os.Getpid()))
+	assert.False(t, isGoExecutable(-1))
+}
@@ -23,6 +23,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/go-version"
@@ -37,7 +39,7 @@ import (
 var buildInfoMagic = []byte("\xff Go buildinf:")
 var errNotGoExe = errors.New("not a Go executable")
 
-func (a *Analyzer) getModuleDetails(f *elf.File) (*version.Version, map[string]string, error) {
+func getModuleDetails(f *elf.File) (*version.Version, map[string]string, error) {
 	goVersion, modules, err := getGoDetails(f)
 	if err != nil {
 		return nil, nil, err
@@ -53,6 +55,19 @@ func (a *Analyzer) getModuleDetails(f *elf.File) (*version.Version, map[string]s
 	return v, modsMap, nil
 }
 
+// isGoExecutable reports whether the process with the given pid runs a Go
+// executable, one with build info.
+func isGoExecutable(pid int) bool {
+	f, err := elf.Open(path.Join("/proc", strconv.Itoa(pid), "exe"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	_, _, err = getGoDetails(f)
+	return err == nil
+}
+
 func parseGoVersion(vers string) (*version.Version, error) {
 	vers = strings.ReplaceAll(vers, "go", "")
 	return version.NewVersion(vers)
@@ -0,0 +1,197 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"go.opentelemetry.io/auto/pkg/log" // nolint:staticcheck  // Atomic deprecation.
+)
+
+// Constants of the kernel proc connector, see include/uapi/linux/cn_proc.h
+// and include/uapi/linux/connector.h.
+const (
+	cnIdxProc         = 0x1
+	cnValProc         = 0x1
+	procCnMcastListen = 0x1
+	procEventExec     = 0x2
+
+	nlMsgHdrLen = unix.SizeofNlMsghdr
+	cnMsgLen    = 20
+	// procEventHdrLen is the size of the what, cpu and timestamp_ns fields
+	// which precede the event data of a proc_event.
+	procEventHdrLen = 16
+
+	// maxReadErrors is the number of consecutive errors reading from the
+	// proc connector after which it is given up.
+	maxReadErrors = 10
+	// readErrorBackoff is how long reading is paused for after an error.
+	readErrorBackoff = 100 * time.Millisecond
+)
+
+// procConnector receives exec events of all processes from the netlink proc
+// connector. The pid of every process which started a new program is sent to
+// execs. Whenever exec events are lost, a rescan of all processes is
+// requested through rescan instead. If reading fails repeatedly, failed is
+// closed and no more events are sent.
+//
+// Fields of the messages are decoded as little endian, the byte order of all
+// the architectures the instrumentors are built for.
+type procConnector struct {
+	file   *os.File
+	execs  chan int
+	rescan chan struct{}
+	failed chan struct{}
+}
+
+// newProcConnector subscribes to the proc connector. It fails if the kernel
+// was built without CONFIG_PROC_EVENTS or if the agent lacks CAP_NET_ADMIN.
+func newProcConnector() (*procConnector, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_DGRAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.NETLINK_CONNECTOR)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK, Groups: cnIdxProc}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	if err := unix.Sendto(fd, listenMessage(), 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// Wrapping the non-blocking socket in a file registers it in the runtime
+	// poller, so that closing the file interrupts a pending read.
+	pc := &procConnector{
+		file:   os.NewFile(uintptr(fd), "proc-connector"),
+		execs:  make(chan int, 256),
+		rescan: make(chan struct{}, 1),
+		failed: make(chan struct{}),
+	}
+	go pc.run()
+
+	return pc, nil
+}
+
+// listenMessage returns the netlink message asking the proc connector to
+// multicast process events to the sender.
+func listenMessage() []byte {
+	msg := make([]byte, nlMsgHdrLen+cnMsgLen+4)
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.LittleEndian.PutUint16(msg[4:], unix.NLMSG_DONE)
+	binary.LittleEndian.PutUint32(msg[12:], uint32(os.Getpid()))
+
+	cn := msg[nlMsgHdrLen:]
+	binary.LittleEndian.PutUint32(cn[0:], cnIdxProc)
+	binary.LittleEndian.PutUint32(cn[4:], cnValProc)
+	binary.LittleEndian.PutUint16(cn[16:], 4)
+	binary.LittleEndian.PutUint32(cn[cnMsgLen:], procCnMcastListen)
+
+	return msg
+}
+
+func (pc *procConnector) run() {
+	logger := log.Logger.WithName("proc-connector")
+
+	buf := make([]byte, os.Getpagesize())
+	readErrors := 0
+	for {
+		n, err := pc.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return
+			}
+			if errors.Is(err, unix.ENOBUFS) {
+				pc.requestRescan()
+				continue
+			}
+			logger.Error(err, "error reading from proc connector")
+			if readErrors++; readErrors >= maxReadErrors {
+				close(pc.failed)
+				return
+			}
+			time.Sleep(readErrorBackoff)
+			continue
+		}
+		readErrors = 0
+
+		for _, pid := range parseExecEvents(buf[:n]) {
+			pc.notify(pid)
+		}
+	}
+}
+
+// notify hands pid to the discovery. Nobody reads exec events while the
+// target is instrumented, so they are dropped once execs is full and a rescan
+// is requested instead.
+func (pc *procConnector) notify(pid int) {
+	select {
+	case pc.execs <- pid:
+	default:
+		pc.requestRescan()
+	}
+}
+
+func (pc *procConnector) requestRescan() {
+	select {
+	case pc.rescan <- struct{}{}:
+	default:
+	}
+}
+
+// parseExecEvents returns the pids of the processes of the exec events held
+// by the netlink messages of buf.
+func parseExecEvents(buf []byte) []int {
+	var pids []int
+	for len(buf) >= nlMsgHdrLen {
+		msgLen := int(binary.LittleEndian.Uint32(buf[0:]))
+		msgType := binary.LittleEndian.Uint16(buf[4:])
+		if msgLen < nlMsgHdrLen || msgLen > len(buf) {
+			break
+		}
+
+		data := buf[nlMsgHdrLen:msgLen]
+		if msgType == unix.NLMSG_DONE && len(data) >= cnMsgLen+procEventHdrLen+8 &&
+			binary.LittleEndian.Uint32(data[0:]) == cnIdxProc &&
+			binary.LittleEndian.Uint32(data[4:]) == cnValProc {
+			ev := data[cnMsgLen:]
+			if binary.LittleEndian.Uint32(ev[0:]) == procEventExec {
+				// The exec event data holds the thread id then the process id.
+				pids = append(pids, int(binary.LittleEndian.Uint32(ev[procEventHdrLen+4:])))
+			}
+		}
+
+		// Netlink messages are aligned to 4 bytes.
+		next := (msgLen + unix.NLMSG_ALIGNTO - 1) &^ (unix.NLMSG_ALIGNTO - 1)
+		if next > len(buf) {
+			break
+		}
+		buf = buf[next:]
+	}
+
+	return pids
+}
+
+// Close unsubscribes from the proc connector.
+func (pc *procConnector) Close() error {
+	return pc.file.Close()
+}
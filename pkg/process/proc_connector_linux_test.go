@@ -0,0 +1,78 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package process
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func procEventMessage(what uint32, tid, pid uint32) []byte {
+	msg := make([]byte, nlMsgHdrLen+cnMsgLen+procEventHdrLen+8)
+	binary.LittleEndian.PutUint32(msg[0:], uint32(len(msg)))
+	binary.LittleEndian.PutUint16(msg[4:], unix.NLMSG_DONE)
+
+	cn := msg[nlMsgHdrLen:]
+	binary.LittleEndian.PutUint32(cn[0:], cnIdxProc)
+	binary.LittleEndian.PutUint32(cn[4:], cnValProc)
+	binary.LittleEndian.PutUint16(cn[16:], procEventHdrLen+8)
+
+	ev := cn[cnMsgLen:]
+	binary.LittleEndian.PutUint32(ev[0:], what)
+	binary.LittleEndian.PutUint32(ev[procEventHdrLen:], tid)
+	binary.LittleEndian.PutUint32(ev[procEventHdrLen+4:], pid)
+
+	return msg
+}
+
+func TestParseExecEvents(t *testing.T) {
+	const procEventFork = 0x1
+
+	var buf []byte
+	buf = append(buf, procEventMessage(procEventExec, 42, 42)...)
+	buf = append(buf, procEventMessage(procEventFork, 43, 43)...)
+	buf = append(buf, procEventMessage(procEventExec, 45, 44)...)
+
+	assert.Equal(t, []int{42, 44}, parseExecEvents(buf))
+}
+
+func TestParseExecEventsTruncated(t *testing.T) {
+	msg := procEventMessage(procEventExec, 42, 42)
+
+	assert.Empty(t, parseExecEvents(msg[:len(msg)-4]))
+}
+
+func TestProcConnectorFailsOnReadErrors(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	defer r.Close()
+
+	// every read of the closed pipe fails
+	pc := &procConnector{file: r, execs: make(chan int, 1), rescan: make(chan struct{}, 1), failed: make(chan struct{})}
+	go pc.run()
+
+	select {
+	case <-pc.failed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the proc connector did not give up")
+	}
+}
@@ -0,0 +1,15 @@
+module main
+
+go 1.20
+
+require (
+	github.com/segmentio/kafka-go v0.4.47
+	go.uber.org/zap v1.24.0
+)
+
+require (
+	github.com/klauspost/compress v1.16.7 // indirect
+	github.com/pierrec/lz4/v4 v4.1.18 // indirect
+	go.uber.org/atomic v1.7.0 // indirect
+	go.uber.org/multierr v1.6.0 // indirect
+)
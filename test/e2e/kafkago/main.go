@@ -0,0 +1,290 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	"github.com/segmentio/kafka-go/protocol/apiversions"
+	"github.com/segmentio/kafka-go/protocol/fetch"
+	"github.com/segmentio/kafka-go/protocol/listoffsets"
+	"github.com/segmentio/kafka-go/protocol/metadata"
+	"github.com/segmentio/kafka-go/protocol/produce"
+	"go.uber.org/zap"
+)
+
+const (
+	brokerHost = "127.0.0.1"
+	brokerPort = 9092
+	topic      = "orders"
+)
+
+// errNoRecords is returned for the fetches past the last record: an empty
+// record set cannot be encoded, hence the connection is closed instead, and
+// the reader reconnects.
+var errNoRecords = errors.New("no records to fetch")
+
+// broker stands in for a Kafka broker leading the single partition of topic,
+// so that the sample app needs no Kafka cluster.
+type broker struct {
+	mu      sync.Mutex
+	records []record
+}
+
+// record is a record stored by the broker, whose offset is its index.
+type record struct {
+	time    time.Time
+	key     []byte
+	value   []byte
+	headers []protocol.Header
+}
+
+// supported are the API versions served by the broker, as negotiated by the
+// kafka-go clients.
+var supported = []apiversions.ApiKeyResponse{
+	{ApiKey: int16(protocol.Produce), MinVersion: 0, MaxVersion: 7},
+	{ApiKey: int16(protocol.Fetch), MinVersion: 0, MaxVersion: 10},
+	{ApiKey: int16(protocol.ListOffsets), MinVersion: 1, MaxVersion: 1},
+	{ApiKey: int16(protocol.Metadata), MinVersion: 0, MaxVersion: 6},
+	{ApiKey: int16(protocol.ApiVersions), MinVersion: 0, MaxVersion: 2},
+}
+
+func (b *broker) serve(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *broker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		version, correlationID, _, req, err := protocol.ReadRequest(r)
+		if err != nil {
+			// the clients close their connections once done
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				logger.Error("error reading request", zap.Error(err))
+			}
+			return
+		}
+
+		res, err := b.respond(req)
+		if err != nil {
+			if !errors.Is(err, errNoRecords) {
+				logger.Error("error handling request", zap.Error(err))
+			}
+			return
+		}
+		if err := protocol.WriteResponse(conn, version, correlationID, res); err != nil {
+			logger.Error("error writing response", zap.Error(err))
+			return
+		}
+	}
+}
+
+func (b *broker) respond(req protocol.Message) (protocol.Message, error) {
+	switch req := req.(type) {
+	case *apiversions.Request:
+		return &apiversions.Response{ApiKeys: supported}, nil
+	case *metadata.Request:
+		return &metadata.Response{
+			Brokers: []metadata.ResponseBroker{{NodeID: 1, Host: brokerHost, Port: brokerPort}},
+			Topics: []metadata.ResponseTopic{{
+				Name: topic,
+				Partitions: []metadata.ResponsePartition{{
+					PartitionIndex: 0,
+					LeaderID:       1,
+					ReplicaNodes:   []int32{1},
+					IsrNodes:       []int32{1},
+				}},
+			}},
+			ControllerID: 1,
+		}, nil
+	case *produce.Request:
+		return b.produce(req)
+	case *listoffsets.Request:
+		return b.listOffsets(req), nil
+	case *fetch.Request:
+		res, fetched := b.fetch(req)
+		if fetched == 0 {
+			time.Sleep(time.Duration(req.MaxWaitTime) * time.Millisecond)
+			return nil, errNoRecords
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unsupported request %T", req)
+	}
+}
+
+func (b *broker) produce(req *produce.Request) (*produce.Response, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := &produce.Response{}
+	for _, t := range req.Topics {
+		rt := produce.ResponseTopic{Topic: t.Topic}
+		for _, p := range t.Partitions {
+			baseOffset := int64(len(b.records))
+			for {
+				rec, err := p.RecordSet.Records.ReadRecord()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				key, _ := protocol.ReadAll(rec.Key)
+				value, _ := protocol.ReadAll(rec.Value)
+				b.records = append(b.records, record{
+					time:    rec.Time,
+					key:     key,
+					value:   value,
+					headers: rec.Headers,
+				})
+			}
+			rt.Partitions = append(rt.Partitions, produce.ResponsePartition{
+				Partition:  p.Partition,
+				BaseOffset: baseOffset,
+			})
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res, nil
+}
+
+func (b *broker) listOffsets(req *listoffsets.Request) *listoffsets.Response {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := &listoffsets.Response{}
+	for _, t := range req.Topics {
+		rt := listoffsets.ResponseTopic{Topic: t.Topic}
+		for _, p := range t.Partitions {
+			// the first offset is requested with timestamp -2
+			offset := int64(len(b.records))
+			if p.Timestamp == -2 {
+				offset = 0
+			}
+			rt.Partitions = append(rt.Partitions, listoffsets.ResponsePartition{
+				Partition: p.Partition,
+				Timestamp: -1,
+				Offset:    offset,
+			})
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res
+}
+
+// fetch returns the response to req, and the number of records fetched.
+func (b *broker) fetch(req *fetch.Request) (*fetch.Response, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	res := &fetch.Response{}
+	fetched := 0
+	for _, t := range req.Topics {
+		rt := fetch.ResponseTopic{Topic: t.Topic}
+		for _, p := range t.Partitions {
+			var records []protocol.Record
+			for offset := p.FetchOffset; offset < int64(len(b.records)); offset++ {
+				rec := b.records[offset]
+				records = append(records, protocol.Record{
+					Offset:  offset,
+					Time:    rec.time,
+					Key:     protocol.NewBytes(rec.key),
+					Value:   protocol.NewBytes(rec.value),
+					Headers: rec.headers,
+				})
+			}
+			fetched += len(records)
+			rt.Partitions = append(rt.Partitions, fetch.ResponsePartition{
+				Partition:        p.Partition,
+				HighWatermark:    int64(len(b.records)),
+				LastStableOffset: int64(len(b.records)),
+				RecordSet: protocol.RecordSet{
+					Version: 2,
+					Records: protocol.NewRecordReader(records...),
+				},
+			})
+		}
+		res.Topics = append(res.Topics, rt)
+	}
+	return res, fetched
+}
+
+var logger *zap.Logger
+
+func main() {
+	var err error
+	logger, err = zap.NewDevelopment()
+	if err != nil {
+		fmt.Printf("error creating zap logger, error:%v", err)
+		return
+	}
+
+	l, err := net.Listen("tcp", fmt.Sprintf("%s:%d", brokerHost, brokerPort))
+	if err != nil {
+		logger.Fatal("error starting broker", zap.Error(err))
+	}
+	go (&broker{}).serve(l)
+
+	// give time for auto-instrumentation to start up
+	time.Sleep(5 * time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(fmt.Sprintf("%s:%d", brokerHost, brokerPort)),
+		Topic:        topic,
+		BatchTimeout: 10 * time.Millisecond,
+	}
+	err = w.WriteMessages(ctx, kafka.Message{Key: []byte("42"), Value: []byte("order created")})
+	if err != nil {
+		logger.Fatal("error writing message", zap.Error(err))
+	}
+	_ = w.Close()
+
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{fmt.Sprintf("%s:%d", brokerHost, brokerPort)},
+		Topic:     topic,
+		Partition: 0,
+		MaxWait:   100 * time.Millisecond,
+	})
+	msg, err := r.ReadMessage(ctx)
+	if err != nil {
+		logger.Fatal("error reading message", zap.Error(err))
+	}
+	logger.Info("message read", zap.String("key", string(msg.Key)), zap.String("value", string(msg.Value)),
+		zap.Int("headers", len(msg.Headers)))
+	_ = r.Close()
+
+	// give time for auto-instrumentation to report signal
+	time.Sleep(5 * time.Second)
+}
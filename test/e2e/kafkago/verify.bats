@@ -0,0 +1,43 @@
+#!/usr/bin/env bats
+
+load ../../test_helpers/utilities
+
+LIBRARY_NAME="github.com/segmentio/kafka-go"
+
+@test "${LIBRARY_NAME} :: emits a span name '{topic} publish' and '{topic} receive'" {
+  result=$(span_names_for ${LIBRARY_NAME})
+  assert_equal "$result" '"orders publish"
+"orders receive"'
+}
+
+@test "${LIBRARY_NAME} :: includes messaging.system attribute" {
+  result=$(span_attributes_for ${LIBRARY_NAME} | jq "select(.key == \"messaging.system\").value.stringValue" | uniq)
+  assert_equal "$result" '"kafka"'
+}
+
+@test "${LIBRARY_NAME} :: includes messaging.kafka.message.key attribute" {
+  result=$(span_attributes_for ${LIBRARY_NAME} | jq "select(.key == \"messaging.kafka.message.key\").value.stringValue" | uniq)
+  assert_equal "$result" '"42"'
+}
+
+@test "${LIBRARY_NAME} :: trace ID present, valid and propagated in all spans" {
+  trace_id=$(spans_from_scope_named ${LIBRARY_NAME} | jq ".traceId" | uniq)
+  assert_regex "$trace_id" ${MATCH_A_TRACE_ID}
+}
+
+@test "${LIBRARY_NAME} :: span ID present and valid in all spans" {
+  for span_id in $(spans_from_scope_named ${LIBRARY_NAME} | jq ".spanId"); do
+    assert_regex "$span_id" ${MATCH_A_SPAN_ID}
+  done
+}
+
+@test "${LIBRARY_NAME} :: consumer span is the child of the producer span" {
+  producer_span_id=$(spans_from_scope_named ${LIBRARY_NAME} | jq "select(.kind == 4).spanId")
+  consumer_parent_span_id=$(spans_from_scope_named ${LIBRARY_NAME} | jq "select(.kind == 5).parentSpanId")
+  assert_equal "$consumer_parent_span_id" "$producer_span_id"
+}
+
+@test "${LIBRARY_NAME} :: expected (redacted) trace output" {
+  redact_json
+  assert_equal "$(git --no-pager diff ${BATS_TEST_DIRNAME}/traces.json)" ""
+}